@@ -1,28 +1,64 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"small-merchant-ops-hub-server/internal/cache"
 	"small-merchant-ops-hub-server/internal/config"
 	"small-merchant-ops-hub-server/internal/db"
 	httpapi "small-merchant-ops-hub-server/internal/http"
+	"small-merchant-ops-hub-server/internal/jobs"
+	"small-merchant-ops-hub-server/internal/lifecycle"
+	"small-merchant-ops-hub-server/internal/phone"
+	"small-merchant-ops-hub-server/internal/tier"
 )
 
+// Job lock keys make replicas sharing a cache take turns.
+const (
+	jobLockKeyPrefix         = "merchant_ops:lock:"
+	tierRecalculationLockKey = jobLockKeyPrefix + "tier-recalculation"
+	campaignLifecycleLockKey = jobLockKeyPrefix + "campaign-lifecycle"
+)
+
+// tierRecalculationLockTTL outlasts a nightly run so no other replica starts
+// one while it is in progress; it is released as soon as the run ends.
+const tierRecalculationLockTTL = time.Hour
+
+// shutdownTimeout bounds how long in-flight requests may finish after a signal.
+const shutdownTimeout = 10 * time.Second
+
 func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run serves until SIGINT or SIGTERM, then lets in-flight requests finish,
+// stops the background jobs and closes the cache, in that order.
+func run() error {
 	cfg := config.LoadFromEnv()
 	if err := cfg.Validate(); err != nil {
-		log.Fatalf("invalid config: %v", err)
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if cfg.PhoneDefaultRegion != "" && !phone.IsSupportedRegion(cfg.PhoneDefaultRegion) {
+		return fmt.Errorf("invalid config: PHONE_DEFAULT_REGION %q is not a supported region", cfg.PhoneDefaultRegion)
 	}
 
 	database, err := db.Open(cfg)
 	if err != nil {
-		log.Fatalf("open database: %v", err)
+		return fmt.Errorf("open database: %w", err)
 	}
 
-	cacheStore, err := cache.New(cfg)
+	cacheStore, err := cache.New(cfg, append(httpapi.PinnedCacheKeyPrefixes(), jobLockKeyPrefix)...)
 	if err != nil {
-		log.Fatalf("create cache: %v", err)
+		return fmt.Errorf("create cache: %w", err)
 	}
 	defer func() {
 		if err := cacheStore.Close(); err != nil {
@@ -30,10 +66,62 @@ func main() {
 		}
 	}()
 
+	lifecycleInterval := cfg.CampaignLifecycleInterval()
+	scheduler := jobs.NewScheduler(
+		jobs.Job{
+			Name: "tier-recalculation",
+			Next: jobs.DailyAt(cfg.TierRecalcHour),
+			Run: jobs.Exclusive(cacheStore, tierRecalculationLockKey, tierRecalculationLockTTL, func(ctx context.Context) error {
+				result, err := tier.Recalculate(ctx, database, time.Now(), "system")
+				if err != nil {
+					return err
+				}
+				log.Printf("tier recalculation: %d members, %d upgraded, %d downgraded", result.Evaluated, result.Upgraded, result.Downgraded)
+				return nil
+			}),
+		},
+		jobs.Job{
+			Name: "campaign-lifecycle",
+			Next: jobs.Every(lifecycleInterval),
+			Run: jobs.Exclusive(cacheStore, campaignLifecycleLockKey, lifecycleInterval, func(ctx context.Context) error {
+				result, err := lifecycle.Advance(ctx, database, time.Now(), "system")
+				if result.Activated+result.Closed > 0 {
+					if err := httpapi.InvalidateSummary(ctx, cacheStore); err != nil {
+						log.Printf("campaign lifecycle: invalidate summary: %v", err)
+					}
+					log.Printf("campaign lifecycle: %d activated, %d closed", result.Activated, result.Closed)
+				}
+				return err
+			}),
+		},
+	)
+	scheduler.Start()
+	defer scheduler.Stop()
+
 	router := httpapi.NewRouter(database, cacheStore, cfg)
 	addr := ":" + cfg.Port
-	log.Printf("starting server on %s (env=%s, db=%s, cache=%s)", addr, cfg.Env, cfg.DatabaseDriver(), cfg.CacheMode)
-	if err := router.Run(addr); err != nil {
-		log.Fatalf("run server: %v", err)
+	server := &http.Server{Addr: addr, Handler: router}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("starting server on %s (env=%s, db=%s, cache=%s)", addr, cfg.Env, cfg.DatabaseDriver(), cfg.CacheMode)
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("run server: %w", err)
+	case <-ctx.Done():
+	}
+
+	log.Printf("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown server: %w", err)
 	}
+	return nil
 }
@@ -1,9 +1,11 @@
 package cache
 
 import (
+	"container/list"
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,14 +17,23 @@ type Store interface {
 	Ping(ctx context.Context) error
 	Get(ctx context.Context, key string) (string, bool, error)
 	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	// SetIfAbsent stores value only when key is missing and reports whether it did.
+	SetIfAbsent(ctx context.Context, key, value string, ttl time.Duration) (bool, error)
 	Delete(ctx context.Context, key string) error
+	// CompareAndDelete removes key only while it still holds value and reports
+	// whether it did, so a lock owner never frees a lock someone else took.
+	CompareAndDelete(ctx context.Context, key, value string) (bool, error)
 	Close() error
 }
 
-func New(cfg config.Config) (Store, error) {
+// New opens the store cfg.CacheMode selects. Keys starting with one of
+// pinnedPrefixes hold state rather than cached reads, such as sessions or
+// locks: the local store never evicts them to stay under its bound, and like
+// in redis they only leave on expiry or Delete.
+func New(cfg config.Config, pinnedPrefixes ...string) (Store, error) {
 	switch cfg.CacheMode {
 	case "local":
-		return newLocalStore(), nil
+		return newLocalStore(cfg.LocalCacheMaxEntries, localJanitorInterval, pinnedPrefixes), nil
 	case "redis":
 		return newRedisStore(cfg.RedisURL)
 	default:
@@ -30,13 +41,66 @@ func New(cfg config.Config) (Store, error) {
 	}
 }
 
+const (
+	defaultLocalMaxEntries = 10000
+	localJanitorInterval   = time.Minute
+)
+
+// Stats reports local cache counters.
+type Stats struct {
+	Entries   int    `json:"entries"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Expired   uint64 `json:"expired"`
+}
+
+// StatsProvider is implemented by stores that track their own counters.
+type StatsProvider interface {
+	Stats() Stats
+}
+
+type localEntry struct {
+	key       string
+	value     string
+	expiresAt time.Time
+	pinned    bool
+}
+
+// localStore is an in-process LRU cache. Entries expire lazily on Get and in
+// the background janitor; a non-positive TTL never expires, like redis.
+// maxEntries bounds the evictable entries in recency; pinned ones are kept
+// apart in pinned and do not count against it.
 type localStore struct {
-	mu   sync.RWMutex
-	data map[string]string
+	mu         sync.Mutex
+	items      map[string]*list.Element
+	recency    *list.List
+	pinned     *list.List
+	maxEntries int
+	// pinnedPrefixes mark keys that go to pinned instead of recency.
+	pinnedPrefixes []string
+	stats          Stats
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
-func newLocalStore() *localStore {
-	return &localStore{data: map[string]string{}}
+func newLocalStore(maxEntries int, janitorInterval time.Duration, pinnedPrefixes []string) *localStore {
+	if maxEntries <= 0 {
+		maxEntries = defaultLocalMaxEntries
+	}
+	l := &localStore{
+		items:          map[string]*list.Element{},
+		recency:        list.New(),
+		pinned:         list.New(),
+		maxEntries:     maxEntries,
+		pinnedPrefixes: pinnedPrefixes,
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+	go l.runJanitor(janitorInterval)
+	return l
 }
 
 func (l *localStore) Ping(context.Context) error {
@@ -44,30 +108,184 @@ func (l *localStore) Ping(context.Context) error {
 }
 
 func (l *localStore) Get(_ context.Context, key string) (string, bool, error) {
-	l.mu.RLock()
-	defer l.mu.RUnlock()
-	value, ok := l.data[key]
-	return value, ok, nil
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	element, ok := l.items[key]
+	if !ok {
+		l.stats.Misses++
+		return "", false, nil
+	}
+	entry := element.Value.(*localEntry)
+	if entry.expired(time.Now()) {
+		l.removeElement(element)
+		l.stats.Expired++
+		l.stats.Misses++
+		return "", false, nil
+	}
+	l.recency.MoveToFront(element)
+	l.stats.Hits++
+	return entry.value, true, nil
 }
 
-func (l *localStore) Set(_ context.Context, key, value string, _ time.Duration) error {
+func (l *localStore) Set(_ context.Context, key, value string, ttl time.Duration) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	l.data[key] = value
+	l.set(key, value, ttl)
 	return nil
 }
 
+func (l *localStore) SetIfAbsent(_ context.Context, key, value string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if element, ok := l.items[key]; ok {
+		if !element.Value.(*localEntry).expired(time.Now()) {
+			return false, nil
+		}
+		l.removeElement(element)
+		l.stats.Expired++
+	}
+	l.set(key, value, ttl)
+	return true, nil
+}
+
+// set stores an entry and evicts the least recently used ones; l.mu must be held.
+func (l *localStore) set(key, value string, ttl time.Duration) {
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+
+	if element, ok := l.items[key]; ok {
+		entry := element.Value.(*localEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		l.recency.MoveToFront(element)
+		return
+	}
+
+	entry := &localEntry{
+		key:       key,
+		value:     value,
+		expiresAt: expiresAt,
+		pinned:    l.isPinned(key),
+	}
+	if entry.pinned {
+		l.items[key] = l.pinned.PushFront(entry)
+		return
+	}
+	for l.recency.Len() >= l.maxEntries {
+		l.removeElement(l.recency.Back())
+		l.stats.Evictions++
+	}
+	l.items[key] = l.recency.PushFront(entry)
+}
+
+func (l *localStore) isPinned(key string) bool {
+	for _, prefix := range l.pinnedPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Close stops the janitor; it is safe to call more than once.
 func (l *localStore) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.stop)
+		<-l.done
+	})
 	return nil
 }
 
 func (l *localStore) Delete(_ context.Context, key string) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	delete(l.data, key)
+	if element, ok := l.items[key]; ok {
+		l.removeElement(element)
+	}
 	return nil
 }
 
+func (l *localStore) CompareAndDelete(_ context.Context, key, value string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	element, ok := l.items[key]
+	if !ok {
+		return false, nil
+	}
+	entry := element.Value.(*localEntry)
+	if entry.expired(time.Now()) {
+		l.removeElement(element)
+		l.stats.Expired++
+		return false, nil
+	}
+	if entry.value != value {
+		return false, nil
+	}
+	l.removeElement(element)
+	return true, nil
+}
+
+func (l *localStore) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := l.stats
+	stats.Entries = len(l.items)
+	return stats
+}
+
+func (l *localStore) runJanitor(interval time.Duration) {
+	defer close(l.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case now := <-ticker.C:
+			l.removeExpired(now)
+		}
+	}
+}
+
+func (l *localStore) removeExpired(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, element := range l.items {
+		if element.Value.(*localEntry).expired(now) {
+			l.removeElement(element)
+			l.stats.Expired++
+		}
+	}
+}
+
+func (l *localStore) removeElement(element *list.Element) {
+	entry := element.Value.(*localEntry)
+	delete(l.items, entry.key)
+	if entry.pinned {
+		l.pinned.Remove(element)
+		return
+	}
+	l.recency.Remove(element)
+}
+
+func (e *localEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// compareAndDeleteScript runs GET and DEL as one step on the server.
+var compareAndDeleteScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
 type redisStore struct {
 	client *redis.Client
 }
@@ -99,6 +317,10 @@ func (r *redisStore) Set(ctx context.Context, key, value string, ttl time.Durati
 	return r.client.Set(ctx, key, value, ttl).Err()
 }
 
+func (r *redisStore) SetIfAbsent(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, key, value, ttl).Result()
+}
+
 func (r *redisStore) Close() error {
 	return r.client.Close()
 }
@@ -106,3 +328,11 @@ func (r *redisStore) Close() error {
 func (r *redisStore) Delete(ctx context.Context, key string) error {
 	return r.client.Del(ctx, key).Err()
 }
+
+func (r *redisStore) CompareAndDelete(ctx context.Context, key, value string) (bool, error) {
+	deleted, err := compareAndDeleteScript.Run(ctx, r.client, []string{key}, value).Int64()
+	if err != nil {
+		return false, err
+	}
+	return deleted == 1, nil
+}
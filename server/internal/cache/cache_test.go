@@ -0,0 +1,212 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLocalStoreExpiresOnGet(t *testing.T) {
+	t.Parallel()
+
+	store := newLocalStore(10, time.Hour, nil)
+	t.Cleanup(func() {
+		_ = store.Close()
+	})
+	ctx := context.Background()
+
+	if err := store.Set(ctx, "short", "v", 20*time.Millisecond); err != nil {
+		t.Fatalf("set short: %v", err)
+	}
+	if err := store.Set(ctx, "forever", "v", 0); err != nil {
+		t.Fatalf("set forever: %v", err)
+	}
+	if _, found, _ := store.Get(ctx, "short"); !found {
+		t.Fatalf("short should be readable before ttl")
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	if _, found, _ := store.Get(ctx, "short"); found {
+		t.Fatalf("short should expire after ttl")
+	}
+	if _, found, _ := store.Get(ctx, "forever"); !found {
+		t.Fatalf("zero ttl should never expire")
+	}
+
+	stats := store.Stats()
+	if stats.Hits != 2 || stats.Misses != 1 || stats.Expired != 1 || stats.Entries != 1 {
+		t.Fatalf("stats = %+v, want hits=2 misses=1 expired=1 entries=1", stats)
+	}
+}
+
+func TestLocalStoreJanitorRemovesExpired(t *testing.T) {
+	t.Parallel()
+
+	store := newLocalStore(10, 10*time.Millisecond, nil)
+	t.Cleanup(func() {
+		_ = store.Close()
+	})
+	ctx := context.Background()
+
+	for _, key := range []string{"a", "b", "c"} {
+		if err := store.Set(ctx, key, "v", 5*time.Millisecond); err != nil {
+			t.Fatalf("set %s: %v", key, err)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for store.Stats().Entries > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("janitor did not remove expired entries: %+v", store.Stats())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if stats := store.Stats(); stats.Expired != 3 || stats.Misses != 0 {
+		t.Fatalf("stats = %+v, want expired=3 misses=0", stats)
+	}
+}
+
+func TestLocalStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	t.Parallel()
+
+	store := newLocalStore(2, time.Hour, nil)
+	t.Cleanup(func() {
+		_ = store.Close()
+	})
+	ctx := context.Background()
+
+	_ = store.Set(ctx, "a", "1", 0)
+	_ = store.Set(ctx, "b", "2", 0)
+	if _, found, _ := store.Get(ctx, "a"); !found {
+		t.Fatalf("a should be present")
+	}
+	_ = store.Set(ctx, "c", "3", 0)
+
+	if _, found, _ := store.Get(ctx, "b"); found {
+		t.Fatalf("b was least recently used and should be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, found, _ := store.Get(ctx, key); !found {
+			t.Fatalf("%s should survive eviction", key)
+		}
+	}
+
+	_ = store.Set(ctx, "a", "updated", 0)
+	if value, _, _ := store.Get(ctx, "a"); value != "updated" {
+		t.Fatalf("a = %q, want updated", value)
+	}
+	if stats := store.Stats(); stats.Evictions != 1 || stats.Entries != 2 {
+		t.Fatalf("stats = %+v, want evictions=1 entries=2", stats)
+	}
+}
+
+func TestLocalStoreNeverEvictsPinnedKeys(t *testing.T) {
+	t.Parallel()
+
+	store := newLocalStore(2, time.Hour, []string{"auth:", "lock:"})
+	t.Cleanup(func() {
+		_ = store.Close()
+	})
+	ctx := context.Background()
+
+	pinned := []string{"auth:session:a", "auth:refresh:b", "lock:job"}
+	for _, key := range pinned {
+		_ = store.Set(ctx, key, "v", time.Hour)
+	}
+	for _, key := range []string{"merchant_ops:summary", "x", "y"} {
+		_ = store.Set(ctx, key, "v", time.Minute)
+	}
+
+	for _, key := range pinned {
+		if _, found, _ := store.Get(ctx, key); !found {
+			t.Fatalf("pinned key %s was evicted", key)
+		}
+	}
+	if _, found, _ := store.Get(ctx, "merchant_ops:summary"); found {
+		t.Fatalf("summary was least recently used and should be evicted")
+	}
+	if stats := store.Stats(); stats.Evictions != 1 || stats.Entries != len(pinned)+2 {
+		t.Fatalf("stats = %+v, want evictions=1 entries=%d", stats, len(pinned)+2)
+	}
+
+	_ = store.Delete(ctx, "auth:session:a")
+	if _, found, _ := store.Get(ctx, "auth:session:a"); found {
+		t.Fatalf("deleted pinned key should be gone")
+	}
+}
+
+func TestLocalStoreCloseIsIdempotent(t *testing.T) {
+	t.Parallel()
+
+	store := newLocalStore(0, time.Millisecond, nil)
+	if store.maxEntries != defaultLocalMaxEntries {
+		t.Fatalf("maxEntries = %d, want default %d", store.maxEntries, defaultLocalMaxEntries)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("second close: %v", err)
+	}
+}
+
+func TestLocalStoreSetIfAbsent(t *testing.T) {
+	t.Parallel()
+
+	store := newLocalStore(10, time.Hour, nil)
+	t.Cleanup(func() {
+		_ = store.Close()
+	})
+	ctx := context.Background()
+
+	if stored, err := store.SetIfAbsent(ctx, "lock", "first", 20*time.Millisecond); err != nil || !stored {
+		t.Fatalf("first SetIfAbsent = %v, %v; want stored", stored, err)
+	}
+	if stored, _ := store.SetIfAbsent(ctx, "lock", "second", time.Minute); stored {
+		t.Fatalf("second SetIfAbsent should not overwrite a live key")
+	}
+	if value, _, _ := store.Get(ctx, "lock"); value != "first" {
+		t.Fatalf("value = %q, want first", value)
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	if stored, _ := store.SetIfAbsent(ctx, "lock", "third", time.Minute); !stored {
+		t.Fatalf("SetIfAbsent should replace an expired key")
+	}
+	if value, _, _ := store.Get(ctx, "lock"); value != "third" {
+		t.Fatalf("value = %q, want third", value)
+	}
+}
+
+func TestLocalStoreCompareAndDelete(t *testing.T) {
+	t.Parallel()
+
+	store := newLocalStore(10, time.Hour, nil)
+	t.Cleanup(func() {
+		_ = store.Close()
+	})
+	ctx := context.Background()
+
+	_ = store.Set(ctx, "lock", "owner", time.Minute)
+	if deleted, err := store.CompareAndDelete(ctx, "lock", "other"); err != nil || deleted {
+		t.Fatalf("CompareAndDelete with another value = %v, %v; want kept", deleted, err)
+	}
+	if value, _, _ := store.Get(ctx, "lock"); value != "owner" {
+		t.Fatalf("value = %q, want owner", value)
+	}
+	if deleted, err := store.CompareAndDelete(ctx, "lock", "owner"); err != nil || !deleted {
+		t.Fatalf("CompareAndDelete with own value = %v, %v; want deleted", deleted, err)
+	}
+	if _, found, _ := store.Get(ctx, "lock"); found {
+		t.Fatalf("lock should be gone")
+	}
+	if deleted, _ := store.CompareAndDelete(ctx, "lock", "owner"); deleted {
+		t.Fatalf("CompareAndDelete of a missing key should report false")
+	}
+
+	_ = store.Set(ctx, "short", "owner", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if deleted, _ := store.CompareAndDelete(ctx, "short", "owner"); deleted {
+		t.Fatalf("CompareAndDelete of an expired key should report false")
+	}
+}
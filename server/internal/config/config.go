@@ -3,6 +3,9 @@ package config
 import (
 	"errors"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -13,8 +16,35 @@ type Config struct {
 	RedisURL        string
 	CacheMode       string
 	CORSAllowOrigin string
+
+	// LocalCacheMaxEntries bounds the local cache; 0 uses the built-in default.
+	LocalCacheMaxEntries int
+
+	// PhoneDefaultRegion is the region national member phones are read in;
+	// empty means phone.DefaultRegion. main checks it is supported.
+	PhoneDefaultRegion string
+
+	// TierRecalcHour is the local hour (0-23) the nightly tier recalculation runs at.
+	TierRecalcHour int
+
+	// CampaignLifecycleSeconds is how often campaigns are activated and closed
+	// as their windows open and end; 0 uses the built-in default.
+	CampaignLifecycleSeconds int
+
+	// ConsentSigningSecret signs unsubscribe links; local runs get a fixed
+	// development secret when it is unset.
+	ConsentSigningSecret string
+
+	BootstrapSuperUserName string
+	BootstrapSuperPassword string
 }
 
+// localConsentSigningSecret is only used when APP_ENV=local, so links
+// signed on a developer machine never verify in production.
+const localConsentSigningSecret = "local-consent-signing-secret"
+
+const defaultCampaignLifecycleInterval = time.Minute
+
 func LoadFromEnv() Config {
 	env := getenv("APP_ENV", "local")
 	corsDefault := "*"
@@ -29,6 +59,19 @@ func LoadFromEnv() Config {
 		RedisURL:        getenv("REDIS_URL", "redis://127.0.0.1:6379/0"),
 		CacheMode:       getenv("CACHE_MODE", ""),
 		CORSAllowOrigin: getenv("CORS_ALLOW_ORIGIN", corsDefault),
+
+		LocalCacheMaxEntries: getenvInt("LOCAL_CACHE_MAX_ENTRIES", 10000),
+
+		PhoneDefaultRegion: strings.ToUpper(getenv("PHONE_DEFAULT_REGION", "")),
+
+		TierRecalcHour: getenvInt("TIER_RECALC_HOUR", 3),
+
+		CampaignLifecycleSeconds: getenvInt("CAMPAIGN_LIFECYCLE_INTERVAL_SECONDS", 60),
+
+		ConsentSigningSecret: os.Getenv("CONSENT_SIGNING_SECRET"),
+
+		BootstrapSuperUserName: getenv("BOOTSTRAP_SUPER_USERNAME", "Super"),
+		BootstrapSuperPassword: os.Getenv("BOOTSTRAP_SUPER_PASSWORD"),
 	}
 
 	if cfg.CacheMode == "" {
@@ -39,6 +82,10 @@ func LoadFromEnv() Config {
 		}
 	}
 
+	if cfg.ConsentSigningSecret == "" && cfg.IsLocal() {
+		cfg.ConsentSigningSecret = localConsentSigningSecret
+	}
+
 	return cfg
 }
 
@@ -46,6 +93,14 @@ func (c Config) IsLocal() bool {
 	return c.Env == "local"
 }
 
+// CampaignLifecycleInterval is CampaignLifecycleSeconds as a duration.
+func (c Config) CampaignLifecycleInterval() time.Duration {
+	if c.CampaignLifecycleSeconds == 0 {
+		return defaultCampaignLifecycleInterval
+	}
+	return time.Duration(c.CampaignLifecycleSeconds) * time.Second
+}
+
 func (c Config) DatabaseDriver() string {
 	if c.IsLocal() {
 		return "sqlite"
@@ -69,6 +124,18 @@ func (c Config) Validate() error {
 	if c.CacheMode == "redis" && c.RedisURL == "" {
 		return errors.New("REDIS_URL is required when CACHE_MODE=redis")
 	}
+	if c.LocalCacheMaxEntries < 0 {
+		return errors.New("LOCAL_CACHE_MAX_ENTRIES cannot be negative")
+	}
+	if c.TierRecalcHour < 0 || c.TierRecalcHour > 23 {
+		return errors.New("TIER_RECALC_HOUR must be between 0 and 23")
+	}
+	if c.CampaignLifecycleSeconds != 0 && (c.CampaignLifecycleSeconds < 10 || c.CampaignLifecycleSeconds > 3600) {
+		return errors.New("CAMPAIGN_LIFECYCLE_INTERVAL_SECONDS must be between 10 and 3600")
+	}
+	if !c.IsLocal() && len(c.ConsentSigningSecret) < 32 {
+		return errors.New("CONSENT_SIGNING_SECRET must be at least 32 characters when APP_ENV is not local")
+	}
 	return nil
 }
 
@@ -79,3 +146,11 @@ func getenv(key, fallback string) string {
 	}
 	return value
 }
+
+func getenvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,41 @@
+package consent
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSignerRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	signer := NewSigner("secret")
+	memberID, channel, err := signer.Parse(signer.Token(42, "sms"))
+	if err != nil || memberID != 42 || channel != "sms" {
+		t.Fatalf("Parse(Token(42, sms)) = %d, %q, %v", memberID, channel, err)
+	}
+}
+
+func TestSignerRejectsTamperedTokens(t *testing.T) {
+	t.Parallel()
+
+	signer := NewSigner("secret")
+	token := signer.Token(42, "sms")
+	_, sig, _ := strings.Cut(token, ".")
+	forged := encode([]byte("43:sms")) + "." + sig
+
+	tests := map[string]string{
+		"empty":          "",
+		"no signature":   strings.Split(token, ".")[0],
+		"other member":   forged,
+		"other secret":   NewSigner("other").Token(42, "sms"),
+		"bad encoding":   "!!." + sig,
+		"missing member": NewSigner("secret").Token(0, "sms"),
+		"missing chan":   NewSigner("secret").Token(42, ""),
+	}
+	for name, tampered := range tests {
+		if _, _, err := signer.Parse(tampered); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("%s: Parse error = %v, want ErrInvalidToken", name, err)
+		}
+	}
+}
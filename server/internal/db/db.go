@@ -34,8 +34,55 @@ func Open(cfg config.Config) (*gorm.DB, error) {
 		return nil, fmt.Errorf("open database: %w", err)
 	}
 
-	if err := database.AutoMigrate(&KeyValue{}, &Member{}, &Order{}, &Campaign{}); err != nil {
-		return nil, fmt.Errorf("auto migrate: %w", err)
+	if err := migrate(database); err != nil {
+		return nil, err
+	}
+	if err := Bootstrap(database, cfg); err != nil {
+		return nil, fmt.Errorf("bootstrap: %w", err)
 	}
 	return database, nil
 }
+
+func migrate(database *gorm.DB) error {
+	if err := database.SetupJoinTable(&User{}, "Roles", &UserRole{}); err != nil {
+		return fmt.Errorf("setup user roles: %w", err)
+	}
+	if err := database.SetupJoinTable(&Role{}, "Permissions", &RolePermission{}); err != nil {
+		return fmt.Errorf("setup role permissions: %w", err)
+	}
+	if err := database.SetupJoinTable(&Member{}, "Tags", &MemberTag{}); err != nil {
+		return fmt.Errorf("setup member tags: %w", err)
+	}
+	if err := database.AutoMigrate(
+		&KeyValue{},
+		&Member{},
+		&MemberMerge{},
+		&Tag{},
+		&MemberTag{},
+		&Segment{},
+		&PIIAccessLog{},
+		&MemberNote{},
+		&FollowupTask{},
+		&MemberConsent{},
+		&PointsTransaction{},
+		&PointsRule{},
+		&MembershipTier{},
+		&MemberTierChange{},
+		&Order{},
+		&OrderStatusHistory{},
+		&Refund{},
+		&OrderItem{},
+		&Product{},
+		&SKU{},
+		&Campaign{},
+		&CampaignChange{},
+		&User{},
+		&Role{},
+		&Permission{},
+		&UserRole{},
+		&RolePermission{},
+	); err != nil {
+		return fmt.Errorf("auto migrate: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package db
+
+import "fmt"
+
+// Dialect renders the SQL fragments that differ between the sqlite and pgsql drivers.
+type Dialect string
+
+const (
+	DialectSQLite   Dialect = "sqlite"
+	DialectPostgres Dialect = "pgsql"
+)
+
+// DialectFor maps config.Config.DatabaseDriver() to its Dialect.
+func DialectFor(driver string) Dialect {
+	if driver == string(DialectPostgres) {
+		return DialectPostgres
+	}
+	return DialectSQLite
+}
+
+// EpochSeconds returns an integer expression holding the Unix seconds of a timestamp expression.
+func (d Dialect) EpochSeconds(expr string) string {
+	if d == DialectPostgres {
+		return fmt.Sprintf("CAST(EXTRACT(EPOCH FROM %s) AS BIGINT)", expr)
+	}
+	return fmt.Sprintf("CAST(strftime('%%s', %s) AS INTEGER)", expr)
+}
@@ -0,0 +1,27 @@
+package db
+
+import "testing"
+
+func TestDialectEpochSeconds(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		driver string
+		want   Dialect
+		sql    string
+	}{
+		{driver: "sqlite", want: DialectSQLite, sql: "CAST(strftime('%s', o.paid_at) AS INTEGER)"},
+		{driver: "pgsql", want: DialectPostgres, sql: "CAST(EXTRACT(EPOCH FROM o.paid_at) AS BIGINT)"},
+		{driver: "", want: DialectSQLite, sql: "CAST(strftime('%s', o.paid_at) AS INTEGER)"},
+	}
+
+	for _, tt := range tests {
+		dialect := DialectFor(tt.driver)
+		if dialect != tt.want {
+			t.Fatalf("DialectFor(%q) = %q, want %q", tt.driver, dialect, tt.want)
+		}
+		if got := dialect.EpochSeconds("o.paid_at"); got != tt.sql {
+			t.Fatalf("%s EpochSeconds = %q, want %q", dialect, got, tt.sql)
+		}
+	}
+}
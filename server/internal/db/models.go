@@ -1,6 +1,10 @@
 package db
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 // KeyValue is a generic key-value storage table for lightweight metadata.
 type KeyValue struct {
@@ -11,40 +15,382 @@ type KeyValue struct {
 	UpdatedAt time.Time
 }
 
-// Member represents a merchant member/customer profile.
+// Member represents a merchant member/customer profile. Deleting a member is
+// a soft delete: it leaves queries but keeps its orders for historical revenue.
+// PointsBalance is the running total of its PointsTransaction rows and
+// TierCode the MembershipTier it was last assigned, empty for none.
 type Member struct {
+	ID            uint   `gorm:"primaryKey"`
+	Name          string `gorm:"size:80;not null"`
+	Phone         string `gorm:"size:20;uniqueIndex;not null"`
+	Channel       string `gorm:"size:30;not null"`
+	PointsBalance int64  `gorm:"not null;default:0"`
+	TierCode      string `gorm:"size:30;index;not null;default:''"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	DeletedAt     gorm.DeletedAt `gorm:"index"`
+	Orders        []Order        `gorm:"constraint:OnDelete:CASCADE"`
+	Tags          []Tag          `gorm:"many2many:member_tags"`
+}
+
+// MemberMerge records one source member folded into a target. The source is
+// soft-deleted with its phone released to the unique index, so SourcePhone
+// keeps the number it had.
+type MemberMerge struct {
+	ID          uint   `gorm:"primaryKey"`
+	TargetID    uint   `gorm:"index;not null"`
+	SourceID    uint   `gorm:"uniqueIndex;not null"`
+	SourcePhone string `gorm:"size:20;not null"`
+	MergedBy    string `gorm:"size:50"`
+	CreatedAt   time.Time
+}
+
+// Tag is a free-form member label such as VIP.
+type Tag struct {
 	ID        uint   `gorm:"primaryKey"`
-	Name      string `gorm:"size:80;not null"`
-	Phone     string `gorm:"size:20;uniqueIndex;not null"`
-	Channel   string `gorm:"size:30;not null"`
+	Name      string `gorm:"size:50;uniqueIndex;not null"`
+	Color     string `gorm:"size:20"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	Orders    []Order `gorm:"constraint:OnDelete:CASCADE"`
 }
 
-// Order represents a merchant order.
-type Order struct {
-	ID          uint       `gorm:"primaryKey"`
-	OrderNo     string     `gorm:"size:40;uniqueIndex;not null"`
-	MemberID    uint       `gorm:"index;not null"`
-	AmountCents int64      `gorm:"not null"`
-	Status      string     `gorm:"size:20;index;not null"`
-	Source      string     `gorm:"size:30;not null"`
-	PaidAt      *time.Time `gorm:"index"`
+// MemberTag joins members to tags.
+type MemberTag struct {
+	MemberID  uint `gorm:"primaryKey"`
+	TagID     uint `gorm:"primaryKey;index"`
+	CreatedAt time.Time
+}
+
+// PIIAccessLog records each time a masked member field was revealed in full.
+type PIIAccessLog struct {
+	ID        uint   `gorm:"primaryKey"`
+	MemberID  uint   `gorm:"index;not null"`
+	UserID    int    `gorm:"index;not null"`
+	UserName  string `gorm:"size:50"`
+	Field     string `gorm:"size:30;not null"`
+	Reason    string `gorm:"size:200;not null"`
+	ClientIP  string `gorm:"size:64"`
+	CreatedAt time.Time
+}
+
+// MemberNote is a free-text staff note on a member.
+type MemberNote struct {
+	ID        uint   `gorm:"primaryKey"`
+	MemberID  uint   `gorm:"index;not null"`
+	Content   string `gorm:"size:1000;not null"`
+	Author    string `gorm:"size:50"`
+	CreatedAt time.Time
+}
+
+// Marketing consent channels and statuses. A member with no consent row for
+// a channel has not answered yet and may still be contacted on it.
+const (
+	ConsentChannelSMS    = "sms"
+	ConsentChannelWeChat = "wechat"
+	ConsentChannelPhone  = "phone"
+
+	ConsentOptedIn  = "opted_in"
+	ConsentOptedOut = "opted_out"
+)
+
+// MemberConsent is a member's latest marketing answer on one channel. Source
+// records where it came from, e.g. manual, unsubscribe_link or followup.
+type MemberConsent struct {
+	ID        uint   `gorm:"primaryKey"`
+	MemberID  uint   `gorm:"uniqueIndex:idx_member_consent_channel;not null"`
+	Channel   string `gorm:"size:20;uniqueIndex:idx_member_consent_channel;not null"`
+	Status    string `gorm:"size:20;index;not null"`
+	Source    string `gorm:"size:30;not null"`
+	UpdatedBy string `gorm:"size:50"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Follow-up task statuses and outcomes. A task is open until its assignee
+// records an outcome, which marks it done.
+const (
+	FollowupTaskOpen = "open"
+	FollowupTaskDone = "done"
+
+	FollowupOutcomeReached   = "reached"
+	FollowupOutcomeNoAnswer  = "no_answer"
+	FollowupOutcomePurchased = "purchased"
+	FollowupOutcomeOptedOut  = "opted_out"
+)
+
+// FollowupTask assigns a member from the follow-up list to a staff user.
+// AssigneeName is copied from the user so lists need no join.
+type FollowupTask struct {
+	ID           uint       `gorm:"primaryKey"`
+	MemberID     uint       `gorm:"index;not null"`
+	AssigneeID   uint       `gorm:"index;not null"`
+	AssigneeName string     `gorm:"size:50"`
+	Status       string     `gorm:"size:20;index;not null"`
+	DueAt        *time.Time `gorm:"index"`
+	Note         string     `gorm:"size:500"`
+	Outcome      string     `gorm:"size:20"`
+	OutcomeNote  string     `gorm:"size:500"`
+	CreatedBy    string     `gorm:"size:50"`
+	CompletedAt  *time.Time `gorm:"index"`
+	CompletedBy  string     `gorm:"size:50"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// Points transaction kinds. Earn and reverse follow paid orders and their
+// refunds; redeem is spent by staff on behalf of the member.
+const (
+	PointsKindEarn    = "earn"
+	PointsKindReverse = "reverse"
+	PointsKindRedeem  = "redeem"
+)
+
+// PointsTransaction is one entry of a member's points ledger. Points is signed
+// and BalanceAfter is the member balance right after the entry was applied.
+type PointsTransaction struct {
+	ID           uint   `gorm:"primaryKey"`
+	MemberID     uint   `gorm:"index;not null"`
+	OrderID      *uint  `gorm:"index"`
+	Kind         string `gorm:"size:20;index;not null"`
+	Points       int64  `gorm:"not null"`
+	BalanceAfter int64  `gorm:"not null"`
+	Reason       string `gorm:"size:200"`
+	Operator     string `gorm:"size:50"`
+	CreatedAt    time.Time
+}
+
+// PointsRule grants points for paid orders: PointsPerUnit for every full
+// UnitCents of the order amount plus BonusPoints. An empty Channel matches
+// every order source; every enabled matching rule applies.
+type PointsRule struct {
+	ID            uint   `gorm:"primaryKey"`
+	Name          string `gorm:"size:80;not null"`
+	Channel       string `gorm:"size:30;index"`
+	UnitCents     int64  `gorm:"not null"`
+	PointsPerUnit int64  `gorm:"not null"`
+	BonusPoints   int64  `gorm:"not null"`
+	Enabled       bool   `gorm:"not null"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// MembershipTier is a member level such as gold. A member qualifies when its
+// paid orders of the last WindowDays reach MinPaidCents (net of refunds) or
+// MinOrderCount; a zero threshold is ignored. The qualifying tier with the
+// highest Level wins.
+type MembershipTier struct {
+	ID            uint   `gorm:"primaryKey"`
+	Code          string `gorm:"size:30;uniqueIndex;not null"`
+	Name          string `gorm:"size:50;not null"`
+	Level         int    `gorm:"uniqueIndex;not null"`
+	MinPaidCents  int64  `gorm:"not null"`
+	MinOrderCount int64  `gorm:"not null"`
+	WindowDays    int    `gorm:"not null"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// MemberTierChange records a member moving between tiers. PaidCents and
+// OrderCount are the figures the new tier was decided on.
+type MemberTierChange struct {
+	ID         uint   `gorm:"primaryKey"`
+	MemberID   uint   `gorm:"index;not null"`
+	FromTier   string `gorm:"size:30"`
+	ToTier     string `gorm:"size:30"`
+	PaidCents  int64  `gorm:"not null"`
+	OrderCount int64  `gorm:"not null"`
+	Reason     string `gorm:"size:50;not null"`
+	ChangedBy  string `gorm:"size:50"`
+	CreatedAt  time.Time
+}
+
+// Segment is a saved audience. Rule is a JSON rule tree evaluated against
+// members and their paid orders whenever the audience is read.
+type Segment struct {
+	ID          uint   `gorm:"primaryKey"`
+	Name        string `gorm:"size:80;uniqueIndex;not null"`
+	Description string `gorm:"size:200"`
+	Rule        string `gorm:"type:text;not null"`
+	CreatedBy   string `gorm:"size:50"`
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
-	Member      Member `gorm:"foreignKey:MemberID"`
 }
 
-// Campaign represents a repurchase or growth campaign.
+// Order represents a merchant order. RefundedCents is the running total of its
+// Refund rows, kept on the order so revenue never needs a join to refunds.
+type Order struct {
+	ID            uint       `gorm:"primaryKey"`
+	OrderNo       string     `gorm:"size:40;uniqueIndex;not null"`
+	MemberID      uint       `gorm:"index;not null"`
+	AmountCents   int64      `gorm:"not null"`
+	Status        string     `gorm:"size:20;index;not null"`
+	Source        string     `gorm:"size:30;not null"`
+	PaidAt        *time.Time `gorm:"index"`
+	CampaignID    *uint      `gorm:"index"`
+	CouponCode    string     `gorm:"size:40"`
+	RefundedCents int64      `gorm:"not null;default:0"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Member        Member      `gorm:"foreignKey:MemberID"`
+	Items         []OrderItem `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+// OrderItem is one SKU line of an order. ProductID is copied from the SKU so
+// product reports group without joining skus.
+type OrderItem struct {
+	ID             uint  `gorm:"primaryKey"`
+	OrderID        uint  `gorm:"index;not null"`
+	ProductID      uint  `gorm:"index;not null"`
+	SKUID          uint  `gorm:"column:sku_id;index;not null"`
+	Quantity       int   `gorm:"not null"`
+	UnitPriceCents int64 `gorm:"not null"`
+	AmountCents    int64 `gorm:"not null"`
+	CreatedAt      time.Time
+}
+
+// Product status values.
+const (
+	ProductStatusActive   = "active"
+	ProductStatusInactive = "inactive"
+)
+
+// Product is a catalog entry sold through one or more SKUs.
+type Product struct {
+	ID        uint   `gorm:"primaryKey"`
+	Name      string `gorm:"size:120;not null"`
+	Category  string `gorm:"size:60;index"`
+	Status    string `gorm:"size:20;index;not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	SKUs      []SKU `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+// SKU is a sellable variant of a product with its list price.
+type SKU struct {
+	ID         uint   `gorm:"primaryKey"`
+	ProductID  uint   `gorm:"index;not null"`
+	Code       string `gorm:"size:60;uniqueIndex;not null"`
+	Name       string `gorm:"size:120"`
+	PriceCents int64  `gorm:"not null"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// Refund is one partial or full refund of a paid order.
+type Refund struct {
+	ID          uint   `gorm:"primaryKey"`
+	OrderID     uint   `gorm:"index;not null"`
+	AmountCents int64  `gorm:"not null"`
+	Reason      string `gorm:"size:200"`
+	Operator    string `gorm:"size:50"`
+	CreatedAt   time.Time
+}
+
+// OrderStatusHistory records every status an order entered. FromStatus is
+// empty for the status the order was created with.
+type OrderStatusHistory struct {
+	ID         uint   `gorm:"primaryKey"`
+	OrderID    uint   `gorm:"index;not null"`
+	FromStatus string `gorm:"size:20"`
+	ToStatus   string `gorm:"size:20;not null"`
+	Note       string `gorm:"size:200"`
+	ChangedBy  string `gorm:"size:50"`
+	CreatedAt  time.Time
+}
+
+// Campaign represents a repurchase or growth campaign. Channel is where
+// members were acquired; ContactChannel is the consent channel the campaign
+// reaches them on.
 type Campaign struct {
-	ID          uint       `gorm:"primaryKey"`
-	Name        string     `gorm:"size:120;not null"`
-	Channel     string     `gorm:"size:30;not null"`
-	DiscountPct float64    `gorm:"not null"`
-	Status      string     `gorm:"size:20;index;not null"`
-	StartAt     *time.Time `gorm:"index"`
-	EndAt       *time.Time `gorm:"index"`
+	ID             uint       `gorm:"primaryKey"`
+	Name           string     `gorm:"size:120;not null"`
+	Channel        string     `gorm:"size:30;not null"`
+	DiscountPct    float64    `gorm:"not null"`
+	Status         string     `gorm:"size:20;index;not null"`
+	StartAt        *time.Time `gorm:"index"`
+	EndAt          *time.Time `gorm:"index"`
+	CouponCode     string     `gorm:"size:40;index"`
+	ContactChannel string     `gorm:"size:20;not null;default:'sms'"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// Campaign change actions. Status moves only through activate and close.
+const (
+	CampaignActionCreated   = "created"
+	CampaignActionCloned    = "cloned"
+	CampaignActionUpdated   = "updated"
+	CampaignActionActivated = "activated"
+	CampaignActionClosed    = "closed"
+)
+
+// CampaignChange records one edit or status move of a campaign. Changes is a
+// JSON object of field name to {"from", "to"}; Note explains moves that are
+// not edits, e.g. the campaign a clone was copied from.
+type CampaignChange struct {
+	ID         uint   `gorm:"primaryKey"`
+	CampaignID uint   `gorm:"index;not null"`
+	Action     string `gorm:"size:20;not null"`
+	Changes    string `gorm:"type:text"`
+	Note       string `gorm:"size:200"`
+	ChangedBy  string `gorm:"size:50"`
+	CreatedAt  time.Time
+}
+
+// User status values follow the admin console convention.
+const (
+	UserStatusEnabled  = "1"
+	UserStatusDisabled = "2"
+)
+
+// User is an admin console account.
+type User struct {
+	ID           uint   `gorm:"primaryKey"`
+	UserName     string `gorm:"size:50;uniqueIndex;not null"`
+	NickName     string `gorm:"size:50"`
+	Email        string `gorm:"size:120"`
+	Phone        string `gorm:"size:20"`
+	Gender       string `gorm:"size:1"`
+	Avatar       string `gorm:"size:255"`
+	PasswordHash string `gorm:"size:100;not null"`
+	Status       string `gorm:"size:1;index;not null"`
+	CreatedBy    string `gorm:"size:50"`
+	UpdatedBy    string `gorm:"size:50"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Roles        []Role `gorm:"many2many:user_roles"`
+}
+
+// Role groups permissions under a role code such as R_SUPER.
+type Role struct {
+	ID          uint   `gorm:"primaryKey"`
+	Code        string `gorm:"size:30;uniqueIndex;not null"`
+	Name        string `gorm:"size:50;not null"`
+	Description string `gorm:"size:200"`
+	Enabled     bool   `gorm:"not null"`
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
+	Permissions []Permission `gorm:"many2many:role_permissions"`
+}
+
+// Permission is a button auth mark such as member:create.
+type Permission struct {
+	ID        uint   `gorm:"primaryKey"`
+	Mark      string `gorm:"size:60;uniqueIndex;not null"`
+	Title     string `gorm:"size:60;not null"`
+	CreatedAt time.Time
+}
+
+// UserRole joins users to roles.
+type UserRole struct {
+	UserID    uint `gorm:"primaryKey"`
+	RoleID    uint `gorm:"primaryKey;index"`
+	CreatedAt time.Time
+}
+
+// RolePermission joins roles to permissions.
+type RolePermission struct {
+	RoleID       uint `gorm:"primaryKey"`
+	PermissionID uint `gorm:"primaryKey;index"`
+	CreatedAt    time.Time
 }
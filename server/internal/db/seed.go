@@ -0,0 +1,160 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"small-merchant-ops-hub-server/internal/config"
+)
+
+const demoPassword = "123456"
+
+type seedRole struct {
+	Code        string
+	Name        string
+	Description string
+}
+
+type seedPermission struct {
+	Mark  string
+	Title string
+	Roles []string
+}
+
+type seedUser struct {
+	UserName string
+	Email    string
+	Phone    string
+	Role     string
+	Password string
+}
+
+var builtinRoles = []seedRole{
+	{Code: "R_SUPER", Name: "Super Admin", Description: "Full access"},
+	{Code: "R_ADMIN", Name: "Admin", Description: "Operations access without export"},
+	{Code: "R_USER", Name: "User", Description: "Read-only business access"},
+}
+
+// builtinPermissions lists every auth mark the server checks. A mark is granted
+// to its default roles only when it is first created, so later edits stick.
+var builtinPermissions = []seedPermission{
+	{Mark: "member:create", Title: "新增会员", Roles: []string{"R_SUPER", "R_ADMIN"}},
+	{Mark: "member:update", Title: "编辑会员", Roles: []string{"R_SUPER", "R_ADMIN"}},
+	{Mark: "member:delete", Title: "删除会员", Roles: []string{"R_SUPER"}},
+	{Mark: "member:import", Title: "批量导入会员", Roles: []string{"R_SUPER", "R_ADMIN"}},
+	{Mark: "member:merge", Title: "合并重复会员", Roles: []string{"R_SUPER"}},
+	{Mark: "member:phone:view", Title: "查看会员完整手机号", Roles: []string{"R_SUPER", "R_ADMIN"}},
+	{Mark: "member:phone:reveal", Title: "单次查看会员手机号", Roles: []string{"R_SUPER", "R_ADMIN", "R_USER"}},
+	{Mark: "member:phone:audit", Title: "查看手机号访问记录", Roles: []string{"R_SUPER"}},
+	{Mark: "tag:manage", Title: "管理会员标签", Roles: []string{"R_SUPER", "R_ADMIN"}},
+	{Mark: "segment:manage", Title: "管理人群分组", Roles: []string{"R_SUPER", "R_ADMIN"}},
+	{Mark: "points:redeem", Title: "会员积分兑换", Roles: []string{"R_SUPER", "R_ADMIN"}},
+	{Mark: "points:manage", Title: "管理积分规则", Roles: []string{"R_SUPER"}},
+	{Mark: "tier:manage", Title: "管理会员等级", Roles: []string{"R_SUPER"}},
+	{Mark: "order:create", Title: "新增订单", Roles: []string{"R_SUPER", "R_ADMIN"}},
+	{Mark: "order:update", Title: "变更订单状态", Roles: []string{"R_SUPER", "R_ADMIN"}},
+	{Mark: "order:refund", Title: "订单退款", Roles: []string{"R_SUPER", "R_ADMIN"}},
+	{Mark: "product:manage", Title: "管理商品", Roles: []string{"R_SUPER", "R_ADMIN"}},
+	{Mark: "campaign:create", Title: "新增活动", Roles: []string{"R_SUPER"}},
+	{Mark: "campaign:update", Title: "编辑活动", Roles: []string{"R_SUPER"}},
+	{Mark: "followup:view", Title: "查看跟进名单", Roles: []string{"R_SUPER", "R_ADMIN", "R_USER"}},
+	{Mark: "followup:assign", Title: "分配跟进任务", Roles: []string{"R_SUPER", "R_ADMIN"}},
+	{Mark: "member:note", Title: "添加会员备注", Roles: []string{"R_SUPER", "R_ADMIN", "R_USER"}},
+	{Mark: "member:consent", Title: "维护营销授权", Roles: []string{"R_SUPER", "R_ADMIN"}},
+	{Mark: "report:export", Title: "导出归因报表", Roles: []string{"R_SUPER"}},
+}
+
+// demoUsers are only created in local env so the admin console works out of the box.
+var demoUsers = []seedUser{
+	{UserName: "Admin", Email: "admin@merchant.local", Phone: "13800002222", Role: "R_ADMIN", Password: demoPassword},
+	{UserName: "User", Email: "user@merchant.local", Phone: "13800003333", Role: "R_USER", Password: demoPassword},
+}
+
+// Bootstrap upserts built-in roles and permissions and, when the users table is
+// empty, creates the super admin from BOOTSTRAP_SUPER_USERNAME/BOOTSTRAP_SUPER_PASSWORD.
+func Bootstrap(database *gorm.DB, cfg config.Config) error {
+	return database.Transaction(func(tx *gorm.DB) error {
+		roles := make(map[string]Role, len(builtinRoles))
+		for _, item := range builtinRoles {
+			role := Role{Code: item.Code}
+			if err := tx.Where(Role{Code: item.Code}).
+				Attrs(Role{Name: item.Name, Description: item.Description, Enabled: true}).
+				FirstOrCreate(&role).Error; err != nil {
+				return fmt.Errorf("seed role %s: %w", item.Code, err)
+			}
+			roles[item.Code] = role
+		}
+
+		for _, item := range builtinPermissions {
+			var permission Permission
+			err := tx.Where("mark = ?", item.Mark).First(&permission).Error
+			if err == nil {
+				continue
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("query permission %s: %w", item.Mark, err)
+			}
+
+			permission = Permission{Mark: item.Mark, Title: item.Title}
+			if err := tx.Create(&permission).Error; err != nil {
+				return fmt.Errorf("seed permission %s: %w", item.Mark, err)
+			}
+			for _, code := range item.Roles {
+				grant := RolePermission{RoleID: roles[code].ID, PermissionID: permission.ID}
+				if err := tx.Create(&grant).Error; err != nil {
+					return fmt.Errorf("grant %s to %s: %w", item.Mark, code, err)
+				}
+			}
+		}
+
+		var userCount int64
+		if err := tx.Model(&User{}).Count(&userCount).Error; err != nil {
+			return fmt.Errorf("count users: %w", err)
+		}
+		if userCount > 0 {
+			return nil
+		}
+
+		superUserName := strings.TrimSpace(cfg.BootstrapSuperUserName)
+		if superUserName == "" {
+			superUserName = "Super"
+		}
+		superPassword := cfg.BootstrapSuperPassword
+		if superPassword == "" && cfg.IsLocal() {
+			superPassword = demoPassword
+		}
+		if superPassword == "" {
+			return errors.New("BOOTSTRAP_SUPER_PASSWORD is required to create the first super admin")
+		}
+
+		users := []seedUser{{UserName: superUserName, Role: "R_SUPER", Password: superPassword}}
+		if cfg.IsLocal() {
+			users = append(users, demoUsers...)
+		}
+
+		for _, seed := range users {
+			hash, err := HashPassword(seed.Password)
+			if err != nil {
+				return fmt.Errorf("hash password for %s: %w", seed.UserName, err)
+			}
+			user := User{
+				UserName:     seed.UserName,
+				NickName:     seed.UserName,
+				Email:        seed.Email,
+				Phone:        seed.Phone,
+				Gender:       "1",
+				PasswordHash: hash,
+				Status:       UserStatusEnabled,
+				CreatedBy:    "system",
+				UpdatedBy:    "system",
+				Roles:        []Role{roles[seed.Role]},
+			}
+			if err := tx.Omit("Roles.*").Create(&user).Error; err != nil {
+				return fmt.Errorf("create user %s: %w", seed.UserName, err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"small-merchant-ops-hub-server/internal/config"
+)
+
+func TestBootstrap(t *testing.T) {
+	t.Parallel()
+
+	database, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "app.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Warn),
+	})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err := migrate(database); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	cfg := config.Config{Env: "production", BootstrapSuperUserName: "owner"}
+	if err := Bootstrap(database, cfg); err == nil {
+		t.Fatalf("expected error without BOOTSTRAP_SUPER_PASSWORD")
+	}
+
+	cfg.BootstrapSuperPassword = "s3cret-pass"
+	if err := Bootstrap(database, cfg); err != nil {
+		t.Fatalf("bootstrap: %v", err)
+	}
+	cfg.BootstrapSuperPassword = "another-pass"
+	if err := Bootstrap(database, cfg); err != nil {
+		t.Fatalf("second bootstrap: %v", err)
+	}
+
+	var users []User
+	if err := database.Preload("Roles.Permissions").Find(&users).Error; err != nil {
+		t.Fatalf("list users: %v", err)
+	}
+	if len(users) != 1 {
+		t.Fatalf("users = %d, want 1 (no demo accounts outside local)", len(users))
+	}
+	owner := users[0]
+	if owner.UserName != "owner" {
+		t.Fatalf("userName = %s, want owner", owner.UserName)
+	}
+	if owner.PasswordHash == "s3cret-pass" || !CheckPassword(owner.PasswordHash, "s3cret-pass") {
+		t.Fatalf("password hash does not verify the bootstrap password")
+	}
+	if CheckPassword(owner.PasswordHash, "another-pass") {
+		t.Fatalf("second bootstrap should not reset the password")
+	}
+	if len(owner.Roles) != 1 || owner.Roles[0].Code != "R_SUPER" {
+		t.Fatalf("roles = %+v, want R_SUPER", owner.Roles)
+	}
+	if len(owner.Roles[0].Permissions) != len(builtinPermissions) {
+		t.Fatalf("super permissions = %d, want %d", len(owner.Roles[0].Permissions), len(builtinPermissions))
+	}
+
+	var roleCount int64
+	if err := database.Model(&Role{}).Count(&roleCount).Error; err != nil {
+		t.Fatalf("count roles: %v", err)
+	}
+	if roleCount != int64(len(builtinRoles)) {
+		t.Fatalf("roles = %d, want %d", roleCount, len(builtinRoles))
+	}
+}
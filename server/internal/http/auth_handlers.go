@@ -1,15 +1,19 @@
 package http
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"small-merchant-ops-hub-server/internal/db"
 )
 
 type loginRequest struct {
@@ -85,357 +89,341 @@ type menuRoute struct {
 	Children  []menuRoute `json:"children,omitempty"`
 }
 
-type authSessionEntry struct {
-	Session   authSession
-	ExpiresAt time.Time
-}
-
 var (
 	authSessionTTL    = 24 * time.Hour
 	refreshSessionTTL = 7 * 24 * time.Hour
-	authSessions      = map[string]authSessionEntry{}
-	refreshSessions   = map[string]authSessionEntry{}
-	authSessionsMu    sync.RWMutex
 )
 
-func registerAuthRoutes(router *gin.Engine) {
-	router.POST("/api/auth/login", loginHandler)
-	router.POST("/api/auth/logout", logoutHandler)
-	router.POST("/api/auth/refresh", refreshTokenHandler)
-	router.GET("/api/user/info", userInfoHandler)
-	router.GET("/api/user/list", userListHandler)
-	router.GET("/api/role/list", roleListHandler)
-	router.GET("/api/v3/system/menus", systemMenuListHandler)
+const dateTimeLayout = "2006-01-02 15:04:05"
+
+func registerAuthRoutes(router *gin.Engine, database *gorm.DB, sessions *sessionStore) {
+	router.POST("/api/auth/login", loginHandler(database, sessions))
+	router.POST("/api/auth/logout", logoutHandler(sessions))
+	router.POST("/api/auth/refresh", refreshTokenHandler(sessions))
+	router.GET("/api/user/info", userInfoHandler(sessions))
+	router.GET("/api/user/list", userListHandler(database, sessions))
+	router.GET("/api/role/list", roleListHandler(database, sessions))
+	router.GET("/api/v3/system/menus", systemMenuListHandler(sessions))
 }
 
-func loginHandler(c *gin.Context) {
-	var req loginRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		fail(c, 400, "invalid login payload")
-		return
-	}
+func loginHandler(database *gorm.DB, sessions *sessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req loginRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid login payload")
+			return
+		}
 
-	req.UserName = strings.TrimSpace(req.UserName)
-	req.Password = strings.TrimSpace(req.Password)
-	if req.UserName == "" || req.Password == "" {
-		fail(c, 400, "userName and password are required")
-		return
-	}
-	if req.Password != "123456" {
-		fail(c, 401, "invalid credentials")
-		return
-	}
+		req.UserName = strings.TrimSpace(req.UserName)
+		req.Password = strings.TrimSpace(req.Password)
+		if req.UserName == "" || req.Password == "" {
+			fail(c, 400, "userName and password are required")
+			return
+		}
 
-	session, found := resolveSessionByUserName(req.UserName)
-	if !found {
-		fail(c, 401, "invalid credentials")
-		return
-	}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var user db.User
+		err := database.WithContext(ctx).
+			Preload("Roles.Permissions").
+			Where("LOWER(user_name) = ?", strings.ToLower(req.UserName)).
+			First(&user).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 401, "invalid credentials")
+				return
+			}
+			fail(c, 500, "query user failed")
+			return
+		}
+		if !db.CheckPassword(user.PasswordHash, req.Password) {
+			fail(c, 401, "invalid credentials")
+			return
+		}
+		if user.Status != db.UserStatusEnabled {
+			fail(c, 403, "account disabled")
+			return
+		}
 
-	token := newToken("token")
-	refreshToken := newToken("refresh")
-	saveSession(token, session)
-	saveRefreshSession(refreshToken, session)
+		session := sessionFromUser(user)
+		token := newToken("token")
+		refreshToken := newToken("refresh")
+		if err := sessions.saveSession(ctx, token, session); err != nil {
+			fail(c, 500, "save session failed")
+			return
+		}
+		if err := sessions.saveRefreshSession(ctx, refreshToken, session); err != nil {
+			fail(c, 500, "save session failed")
+			return
+		}
 
-	ok(c, gin.H{
-		"token":        token,
-		"refreshToken": refreshToken,
-	})
+		ok(c, gin.H{
+			"token":        token,
+			"refreshToken": refreshToken,
+		})
+	}
 }
 
-func logoutHandler(c *gin.Context) {
-	token := parseAuthToken(c.GetHeader("Authorization"))
-	if token != "" {
-		session, found := currentSession(c)
-		if found {
-			removeRefreshSessionsByUserID(session.UserID)
+func logoutHandler(sessions *sessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		token := parseAuthToken(c.GetHeader("Authorization"))
+		if token != "" {
+			session, found := sessions.currentSession(c)
+			if found {
+				if err := sessions.removeRefreshSessionsByUserID(ctx, session.UserID); err != nil {
+					fail(c, 500, "revoke refresh sessions failed")
+					return
+				}
+			}
+			if err := sessions.removeSession(ctx, token); err != nil {
+				fail(c, 500, "revoke session failed")
+				return
+			}
 		}
-		removeSession(token)
+		ok(c, gin.H{
+			"success": true,
+		})
 	}
-	ok(c, gin.H{
-		"success": true,
-	})
 }
 
-func refreshTokenHandler(c *gin.Context) {
-	var req refreshRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		fail(c, 400, "invalid refresh payload")
-		return
-	}
-	req.RefreshToken = strings.TrimSpace(req.RefreshToken)
-	if req.RefreshToken == "" {
-		fail(c, 400, "refreshToken is required")
-		return
-	}
+func refreshTokenHandler(sessions *sessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req refreshRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid refresh payload")
+			return
+		}
+		req.RefreshToken = strings.TrimSpace(req.RefreshToken)
+		if req.RefreshToken == "" {
+			fail(c, 400, "refreshToken is required")
+			return
+		}
 
-	session, found := currentRefreshSession(req.RefreshToken)
-	if !found {
-		fail(c, 401, "invalid refresh token")
-		return
-	}
+		ctx := c.Request.Context()
+		session, found := sessions.currentRefreshSession(ctx, req.RefreshToken)
+		if !found {
+			fail(c, 401, "invalid refresh token")
+			return
+		}
 
-	removeRefreshSession(req.RefreshToken)
-	token := newToken("token")
-	refreshToken := newToken("refresh")
-	saveSession(token, session)
-	saveRefreshSession(refreshToken, session)
+		if err := sessions.removeRefreshSession(ctx, req.RefreshToken); err != nil {
+			fail(c, 500, "revoke refresh session failed")
+			return
+		}
+		token := newToken("token")
+		refreshToken := newToken("refresh")
+		if err := sessions.saveSession(ctx, token, session); err != nil {
+			fail(c, 500, "save session failed")
+			return
+		}
+		if err := sessions.saveRefreshSession(ctx, refreshToken, session); err != nil {
+			fail(c, 500, "save session failed")
+			return
+		}
 
-	ok(c, gin.H{
-		"token":        token,
-		"refreshToken": refreshToken,
-	})
+		ok(c, gin.H{
+			"token":        token,
+			"refreshToken": refreshToken,
+		})
+	}
 }
 
-func userInfoHandler(c *gin.Context) {
-	session, found := currentSession(c)
-	if !found {
-		fail(c, 401, "unauthorized")
-		return
+func userInfoHandler(sessions *sessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session, found := sessions.currentSession(c)
+		if !found {
+			fail(c, 401, "unauthorized")
+			return
+		}
+		ok(c, session)
 	}
-	ok(c, session)
 }
 
-func userListHandler(c *gin.Context) {
-	_, found := currentSession(c)
-	if !found {
-		fail(c, 401, "unauthorized")
-		return
-	}
+func userListHandler(database *gorm.DB, sessions *sessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, found := sessions.currentSession(c)
+		if !found {
+			fail(c, 401, "unauthorized")
+			return
+		}
 
-	current := parseIntWithBounds(c.Query("current"), 1, 1, 1000)
-	size := parseIntWithBounds(c.Query("size"), 10, 1, 200)
+		current := parseIntWithBounds(c.Query("current"), 1, 1, 1000)
+		size := parseIntWithBounds(c.Query("size"), 10, 1, 200)
 
-	users := []userListItem{
-		{
-			ID:         1,
-			Avatar:     "",
-			Status:     "1",
-			UserName:   "Super",
-			UserGender: "1",
-			NickName:   "Super",
-			UserPhone:  "13800001111",
-			UserEmail:  "super@merchant.local",
-			UserRoles:  []string{"R_SUPER"},
-			CreateBy:   "system",
-			CreateTime: "2026-02-01 10:00:00",
-			UpdateBy:   "system",
-			UpdateTime: "2026-02-01 10:00:00",
-		},
-		{
-			ID:         2,
-			Avatar:     "",
-			Status:     "1",
-			UserName:   "Admin",
-			UserGender: "1",
-			NickName:   "Admin",
-			UserPhone:  "13800002222",
-			UserEmail:  "admin@merchant.local",
-			UserRoles:  []string{"R_ADMIN"},
-			CreateBy:   "system",
-			CreateTime: "2026-02-01 10:00:00",
-			UpdateBy:   "system",
-			UpdateTime: "2026-02-01 10:00:00",
-		},
-		{
-			ID:         3,
-			Avatar:     "",
-			Status:     "1",
-			UserName:   "User",
-			UserGender: "1",
-			NickName:   "User",
-			UserPhone:  "13800003333",
-			UserEmail:  "user@merchant.local",
-			UserRoles:  []string{"R_USER"},
-			CreateBy:   "system",
-			CreateTime: "2026-02-01 10:00:00",
-			UpdateBy:   "system",
-			UpdateTime: "2026-02-01 10:00:00",
-		},
-	}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
 
-	paged := paginate(users, current, size)
-	ok(c, paginatedData{
-		Records: paged,
-		Current: current,
-		Size:    size,
-		Total:   len(users),
-	})
-}
+		query := database.WithContext(ctx).Model(&db.User{})
+		if keyword := strings.TrimSpace(c.Query("keyword")); keyword != "" {
+			like := "%" + keyword + "%"
+			query = query.Where("user_name LIKE ? OR nick_name LIKE ? OR phone LIKE ? OR email LIKE ?", like, like, like, like)
+		}
+		if userName := strings.TrimSpace(c.Query("userName")); userName != "" {
+			query = query.Where("user_name LIKE ?", "%"+userName+"%")
+		}
+		if userPhone := strings.TrimSpace(c.Query("userPhone")); userPhone != "" {
+			query = query.Where("phone LIKE ?", "%"+userPhone+"%")
+		}
+		if userEmail := strings.TrimSpace(c.Query("userEmail")); userEmail != "" {
+			query = query.Where("email LIKE ?", "%"+userEmail+"%")
+		}
+		if userGender := strings.TrimSpace(c.Query("userGender")); userGender != "" {
+			query = query.Where("gender = ?", userGender)
+		}
+		if status := strings.TrimSpace(c.Query("status")); status != "" {
+			query = query.Where("status = ?", status)
+		}
 
-func roleListHandler(c *gin.Context) {
-	_, found := currentSession(c)
-	if !found {
-		fail(c, 401, "unauthorized")
-		return
-	}
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			fail(c, 500, "count users failed")
+			return
+		}
 
-	current := parseIntWithBounds(c.Query("current"), 1, 1, 1000)
-	size := parseIntWithBounds(c.Query("size"), 10, 1, 200)
+		users := make([]db.User, 0, size)
+		if err := query.Preload("Roles").Order("id ASC").Offset((current - 1) * size).Limit(size).Find(&users).Error; err != nil {
+			fail(c, 500, "list users failed")
+			return
+		}
 
-	roles := []roleListItem{
-		{
-			RoleID:      1,
-			RoleName:    "Super Admin",
-			RoleCode:    "R_SUPER",
-			Description: "Full access",
-			Enabled:     true,
-			CreateTime:  "2026-02-01 10:00:00",
-		},
-		{
-			RoleID:      2,
-			RoleName:    "Admin",
-			RoleCode:    "R_ADMIN",
-			Description: "Operations access without export",
-			Enabled:     true,
-			CreateTime:  "2026-02-01 10:00:00",
-		},
-		{
-			RoleID:      3,
-			RoleName:    "User",
-			RoleCode:    "R_USER",
-			Description: "Read-only business access",
-			Enabled:     true,
-			CreateTime:  "2026-02-01 10:00:00",
-		},
+		records := make([]userListItem, 0, len(users))
+		for _, user := range users {
+			records = append(records, toUserListItem(user))
+		}
+		ok(c, paginatedData{
+			Records: records,
+			Current: current,
+			Size:    size,
+			Total:   int(total),
+		})
 	}
-
-	paged := paginate(roles, current, size)
-	ok(c, paginatedData{
-		Records: paged,
-		Current: current,
-		Size:    size,
-		Total:   len(roles),
-	})
 }
 
-func systemMenuListHandler(c *gin.Context) {
-	session, found := currentSession(c)
-	if !found {
-		fail(c, 401, "unauthorized")
-		return
-	}
+func roleListHandler(database *gorm.DB, sessions *sessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, found := sessions.currentSession(c)
+		if !found {
+			fail(c, 401, "unauthorized")
+			return
+		}
 
-	menus := filterMenuRoutesByRoles(baseSystemMenus(), session.Roles)
-	ok(c, menus)
-}
+		current := parseIntWithBounds(c.Query("current"), 1, 1, 1000)
+		size := parseIntWithBounds(c.Query("size"), 10, 1, 200)
 
-func resolveSessionByUserName(userName string) (authSession, bool) {
-	switch strings.ToLower(strings.TrimSpace(userName)) {
-	case "super":
-		return authSession{
-			UserID:   1,
-			UserName: "Super",
-			Email:    "super@merchant.local",
-			Avatar:   "",
-			Roles:    []string{"R_SUPER"},
-			Buttons: []string{
-				"member:create",
-				"order:create",
-				"campaign:create",
-				"followup:view",
-				"report:export",
-			},
-		}, true
-	case "admin":
-		return authSession{
-			UserID:   2,
-			UserName: "Admin",
-			Email:    "admin@merchant.local",
-			Avatar:   "",
-			Roles:    []string{"R_ADMIN"},
-			Buttons: []string{
-				"member:create",
-				"order:create",
-				"followup:view",
-			},
-		}, true
-	case "user":
-		return authSession{
-			UserID:   3,
-			UserName: "User",
-			Email:    "user@merchant.local",
-			Avatar:   "",
-			Roles:    []string{"R_USER"},
-			Buttons: []string{
-				"followup:view",
-			},
-		}, true
-	default:
-		return authSession{}, false
-	}
-}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
 
-func currentSession(c *gin.Context) (authSession, bool) {
-	token := parseAuthToken(c.GetHeader("Authorization"))
-	if token == "" {
-		return authSession{}, false
-	}
+		query := database.WithContext(ctx).Model(&db.Role{})
+		if keyword := strings.TrimSpace(c.Query("keyword")); keyword != "" {
+			like := "%" + keyword + "%"
+			query = query.Where("name LIKE ? OR code LIKE ? OR description LIKE ?", like, like, like)
+		}
+		if roleName := strings.TrimSpace(c.Query("roleName")); roleName != "" {
+			query = query.Where("name LIKE ?", "%"+roleName+"%")
+		}
+		if roleCode := strings.TrimSpace(c.Query("roleCode")); roleCode != "" {
+			query = query.Where("code LIKE ?", "%"+roleCode+"%")
+		}
+		if enabled, err := strconv.ParseBool(c.Query("enabled")); err == nil {
+			query = query.Where("enabled = ?", enabled)
+		}
 
-	authSessionsMu.RLock()
-	entry, ok := authSessions[token]
-	authSessionsMu.RUnlock()
-	if !ok {
-		return authSession{}, false
-	}
-	if time.Now().After(entry.ExpiresAt) {
-		removeSession(token)
-		return authSession{}, false
-	}
-	return entry.Session, true
-}
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			fail(c, 500, "count roles failed")
+			return
+		}
 
-func saveSession(token string, session authSession) {
-	authSessionsMu.Lock()
-	defer authSessionsMu.Unlock()
-	authSessions[token] = authSessionEntry{
-		Session:   session,
-		ExpiresAt: time.Now().Add(authSessionTTL),
+		roles := make([]db.Role, 0, size)
+		if err := query.Order("id ASC").Offset((current - 1) * size).Limit(size).Find(&roles).Error; err != nil {
+			fail(c, 500, "list roles failed")
+			return
+		}
+
+		records := make([]roleListItem, 0, len(roles))
+		for _, role := range roles {
+			records = append(records, toRoleListItem(role))
+		}
+		ok(c, paginatedData{
+			Records: records,
+			Current: current,
+			Size:    size,
+			Total:   int(total),
+		})
 	}
 }
 
-func removeSession(token string) {
-	authSessionsMu.Lock()
-	defer authSessionsMu.Unlock()
-	delete(authSessions, token)
-}
+func systemMenuListHandler(sessions *sessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session, found := sessions.currentSession(c)
+		if !found {
+			fail(c, 401, "unauthorized")
+			return
+		}
 
-func currentRefreshSession(refreshToken string) (authSession, bool) {
-	authSessionsMu.RLock()
-	entry, ok := refreshSessions[refreshToken]
-	authSessionsMu.RUnlock()
-	if !ok {
-		return authSession{}, false
-	}
-	if time.Now().After(entry.ExpiresAt) {
-		removeRefreshSession(refreshToken)
-		return authSession{}, false
+		menus := filterMenuRoutesByRoles(baseSystemMenus(), session.Roles)
+		ok(c, menus)
 	}
-	return entry.Session, true
 }
 
-func saveRefreshSession(refreshToken string, session authSession) {
-	authSessionsMu.Lock()
-	defer authSessionsMu.Unlock()
-	refreshSessions[refreshToken] = authSessionEntry{
-		Session:   session,
-		ExpiresAt: time.Now().Add(refreshSessionTTL),
+// sessionFromUser flattens enabled roles and their permissions into the session payload.
+func sessionFromUser(user db.User) authSession {
+	roles := make([]string, 0, len(user.Roles))
+	buttons := make([]string, 0)
+	seen := map[string]bool{}
+	for _, role := range user.Roles {
+		if !role.Enabled {
+			continue
+		}
+		roles = append(roles, role.Code)
+		for _, permission := range role.Permissions {
+			if seen[permission.Mark] {
+				continue
+			}
+			seen[permission.Mark] = true
+			buttons = append(buttons, permission.Mark)
+		}
+	}
+	sort.Strings(buttons)
+
+	return authSession{
+		UserID:   int(user.ID),
+		UserName: user.UserName,
+		Email:    user.Email,
+		Avatar:   user.Avatar,
+		Roles:    roles,
+		Buttons:  buttons,
 	}
 }
 
-func removeRefreshSession(refreshToken string) {
-	authSessionsMu.Lock()
-	defer authSessionsMu.Unlock()
-	delete(refreshSessions, refreshToken)
+func toUserListItem(user db.User) userListItem {
+	return userListItem{
+		ID:         int(user.ID),
+		Avatar:     user.Avatar,
+		Status:     user.Status,
+		UserName:   user.UserName,
+		UserGender: user.Gender,
+		NickName:   user.NickName,
+		UserPhone:  user.Phone,
+		UserEmail:  user.Email,
+		UserRoles:  roleCodes(user.Roles),
+		CreateBy:   user.CreatedBy,
+		CreateTime: user.CreatedAt.Format(dateTimeLayout),
+		UpdateBy:   user.UpdatedBy,
+		UpdateTime: user.UpdatedAt.Format(dateTimeLayout),
+	}
 }
 
-func removeRefreshSessionsByUserID(userID int) {
-	authSessionsMu.Lock()
-	defer authSessionsMu.Unlock()
-	for token, entry := range refreshSessions {
-		if entry.Session.UserID == userID {
-			delete(refreshSessions, token)
-		}
+func toRoleListItem(role db.Role) roleListItem {
+	return roleListItem{
+		RoleID:      int(role.ID),
+		RoleName:    role.Name,
+		RoleCode:    role.Code,
+		Description: role.Description,
+		Enabled:     role.Enabled,
+		CreateTime:  role.CreatedAt.Format(dateTimeLayout),
 	}
 }
 
@@ -467,21 +455,6 @@ func parseIntWithBounds(raw string, fallback, min, max int) int {
 	return value
 }
 
-func paginate[T any](items []T, current, size int) []T {
-	if len(items) == 0 {
-		return []T{}
-	}
-	start := (current - 1) * size
-	if start >= len(items) {
-		return []T{}
-	}
-	end := start + size
-	if end > len(items) {
-		end = len(items)
-	}
-	return items[start:end]
-}
-
 func newToken(prefix string) string {
 	raw := make([]byte, 16)
 	if _, err := rand.Read(raw); err == nil {
@@ -40,8 +40,6 @@ type authMenuRoute struct {
 
 func TestAuthRoutesSmoke(t *testing.T) {
 	t.Parallel()
-	resetAuthStateForTest()
-	t.Cleanup(resetAuthStateForTest)
 
 	cfg := config.Config{
 		Env:             "local",
@@ -56,7 +54,7 @@ func TestAuthRoutesSmoke(t *testing.T) {
 		t.Fatalf("open db: %v", err)
 	}
 
-	cacheStore, err := cache.New(cfg)
+	cacheStore, err := cache.New(cfg, PinnedCacheKeyPrefixes()...)
 	if err != nil {
 		t.Fatalf("open cache: %v", err)
 	}
@@ -64,7 +62,8 @@ func TestAuthRoutesSmoke(t *testing.T) {
 		_ = cacheStore.Close()
 	})
 
-	router := NewRouter(database, cacheStore, cfg)
+	sessions := newSessionStore(cacheStore)
+	router := newRouter(database, cacheStore, sessions, cfg)
 
 	unauthorized := performJSONRequestWithHeaders[map[string]interface{}](
 		t,
@@ -240,8 +239,7 @@ func TestAuthRoutesSmoke(t *testing.T) {
 		)
 	}
 
-	originalTTL := authSessionTTL
-	authSessionTTL = -1 * time.Second
+	sessions.accessTTL = -1 * time.Second
 	expiredLogin := performJSONRequestWithHeaders[authLoginData](
 		t,
 		router,
@@ -253,7 +251,7 @@ func TestAuthRoutesSmoke(t *testing.T) {
 		},
 		nil,
 	)
-	authSessionTTL = originalTTL
+	sessions.accessTTL = authSessionTTL
 	if expiredLogin.Code != 200 {
 		t.Fatalf("expired login code = %d, msg = %s", expiredLogin.Code, expiredLogin.Msg)
 	}
@@ -271,8 +269,7 @@ func TestAuthRoutesSmoke(t *testing.T) {
 		t.Fatalf("expired token code = %d, want 401", expiredInfo.Code)
 	}
 
-	originalRefreshTTL := refreshSessionTTL
-	refreshSessionTTL = -1 * time.Second
+	sessions.refreshTTL = -1 * time.Second
 	expiredRefreshLogin := performJSONRequestWithHeaders[authLoginData](
 		t,
 		router,
@@ -284,7 +281,7 @@ func TestAuthRoutesSmoke(t *testing.T) {
 		},
 		nil,
 	)
-	refreshSessionTTL = originalRefreshTTL
+	sessions.refreshTTL = refreshSessionTTL
 	if expiredRefreshLogin.Code != 200 {
 		t.Fatalf("expired refresh login code = %d, msg = %s", expiredRefreshLogin.Code, expiredRefreshLogin.Msg)
 	}
@@ -489,6 +486,46 @@ func TestAuthRoutesSmoke(t *testing.T) {
 		t.Fatalf("role list records length = %d, want 2", len(roles.Data.Records))
 	}
 
+	filteredUsers := performJSONRequestWithHeaders[authPaginated[userListItem]](
+		t,
+		router,
+		http.MethodGet,
+		"/api/user/list?keyword=admin",
+		nil,
+		map[string]string{
+			"Authorization": superLogin.Data.Token,
+		},
+	)
+	if filteredUsers.Code != 200 {
+		t.Fatalf("filtered user list code = %d, msg = %s", filteredUsers.Code, filteredUsers.Msg)
+	}
+	if filteredUsers.Data.Total != 1 || len(filteredUsers.Data.Records) != 1 {
+		t.Fatalf("filtered user list total = %d, want 1", filteredUsers.Data.Total)
+	}
+	if filteredUsers.Data.Records[0].UserName != "Admin" {
+		t.Fatalf("filtered user = %s, want Admin", filteredUsers.Data.Records[0].UserName)
+	}
+	if !containsString(filteredUsers.Data.Records[0].UserRoles, "R_ADMIN") {
+		t.Fatalf("filtered user roles missing R_ADMIN: %+v", filteredUsers.Data.Records[0].UserRoles)
+	}
+
+	filteredRoles := performJSONRequestWithHeaders[authPaginated[roleListItem]](
+		t,
+		router,
+		http.MethodGet,
+		"/api/role/list?roleCode=R_USER",
+		nil,
+		map[string]string{
+			"Authorization": superLogin.Data.Token,
+		},
+	)
+	if filteredRoles.Code != 200 {
+		t.Fatalf("filtered role list code = %d, msg = %s", filteredRoles.Code, filteredRoles.Msg)
+	}
+	if filteredRoles.Data.Total != 1 || len(filteredRoles.Data.Records) != 1 {
+		t.Fatalf("filtered role list total = %d, want 1", filteredRoles.Data.Total)
+	}
+
 	superMenus := performJSONRequestWithHeaders[[]authMenuRoute](
 		t,
 		router,
@@ -577,10 +614,3 @@ func findMenuByPath(items []authMenuRoute, targetPath string) *authMenuRoute {
 	}
 	return nil
 }
-
-func resetAuthStateForTest() {
-	authSessionsMu.Lock()
-	defer authSessionsMu.Unlock()
-	authSessions = map[string]authSessionEntry{}
-	refreshSessions = map[string]authSessionEntry{}
-}
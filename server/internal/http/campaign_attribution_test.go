@@ -0,0 +1,475 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"small-merchant-ops-hub-server/internal/config"
+	"small-merchant-ops-hub-server/internal/db"
+)
+
+var attributionChannels = []string{"wechat", "douyin", "xiaohongshu", "offline", "miniapp"}
+
+func TestLoadCampaignAttributionRowsMatchesPerCampaign(t *testing.T) {
+	t.Parallel()
+
+	database := seedAttributionFixture(t, 300, 4, 25)
+	ctx := context.Background()
+	filters := []campaignAttributionFilter{
+		{Limit: 100},
+		{Limit: 10, Channel: "douyin"},
+		{Limit: 100, Status: "closed"},
+	}
+
+	for _, filter := range filters {
+		want, err := loadCampaignAttributionRowsPerCampaign(ctx, database, filter)
+		if err != nil {
+			t.Fatalf("per-campaign rows: %v", err)
+		}
+		got, err := loadCampaignAttributionRows(ctx, database, filter)
+		if err != nil {
+			t.Fatalf("set-based rows: %v", err)
+		}
+		if len(got) == 0 {
+			t.Fatalf("filter %+v returned no rows", filter)
+		}
+		// The reference predates attribution models, so compare the shared metrics only.
+		for i := range got {
+			got[i].AttributedOrders = 0
+			got[i].AttributedRevenueCents = 0
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("filter %+v rows differ:\n got  %+v\n want %+v", filter, got, want)
+		}
+	}
+}
+
+func TestCampaignAttributionModes(t *testing.T) {
+	t.Parallel()
+
+	router := newTestRouter(t)
+	token := loginForTest(t, router, "Super")
+
+	member := performJSONRequest[testMember](t, router, token, http.MethodPost, "/api/v1/members", map[string]interface{}{
+		"name":    "Dora",
+		"phone":   "13800004444",
+		"channel": "wechat",
+	})
+	if member.Code != 200 {
+		t.Fatalf("create member code = %d, msg = %s", member.Code, member.Msg)
+	}
+
+	spring := performJSONRequest[testCampaign](t, router, token, http.MethodPost, "/api/v1/campaigns", map[string]interface{}{
+		"name":        "Spring Coupon",
+		"channel":     "wechat",
+		"discountPct": 10,
+		"couponCode":  " spring10 ",
+	})
+	if spring.Code != 200 {
+		t.Fatalf("create spring campaign code = %d, msg = %s", spring.Code, spring.Msg)
+	}
+	summer := performJSONRequest[testCampaign](t, router, token, http.MethodPost, "/api/v1/campaigns", map[string]interface{}{
+		"name":        "Summer Push",
+		"channel":     "wechat",
+		"discountPct": 15,
+	})
+	if summer.Code != 200 {
+		t.Fatalf("create summer campaign code = %d, msg = %s", summer.Code, summer.Msg)
+	}
+	duplicateCoupon := performJSONRequest[testCampaign](t, router, token, http.MethodPost, "/api/v1/campaigns", map[string]interface{}{
+		"name":        "Copy",
+		"channel":     "wechat",
+		"discountPct": 10,
+		"couponCode":  "SPRING10",
+	})
+	if duplicateCoupon.Code != 400 {
+		t.Fatalf("duplicate coupon code = %d, want 400", duplicateCoupon.Code)
+	}
+
+	orders := []map[string]interface{}{
+		{"memberId": member.Data.ID, "amountCents": int64(1000), "source": "wechat", "couponCode": "Spring10"},
+		{"memberId": member.Data.ID, "amountCents": int64(2000), "source": "wechat", "campaignId": summer.Data.ID},
+		{"memberId": member.Data.ID, "amountCents": int64(4000), "source": "wechat"},
+	}
+	for _, payload := range orders {
+		order := performJSONRequest[testOrder](t, router, token, http.MethodPost, "/api/v1/orders", payload)
+		if order.Code != 200 {
+			t.Fatalf("create order code = %d, msg = %s", order.Code, order.Msg)
+		}
+	}
+
+	unknownCoupon := performJSONRequest[testOrder](t, router, token, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+		"memberId": member.Data.ID, "amountCents": int64(1000), "source": "wechat", "couponCode": "NOPE",
+	})
+	if unknownCoupon.Code != 400 {
+		t.Fatalf("unknown coupon order code = %d, want 400", unknownCoupon.Code)
+	}
+	mismatch := performJSONRequest[testOrder](t, router, token, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+		"memberId": member.Data.ID, "amountCents": int64(1000), "source": "wechat",
+		"couponCode": "SPRING10", "campaignId": summer.Data.ID,
+	})
+	if mismatch.Code != 400 {
+		t.Fatalf("mismatched coupon order code = %d, want 400", mismatch.Code)
+	}
+	unknownCampaign := performJSONRequest[testOrder](t, router, token, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+		"memberId": member.Data.ID, "amountCents": int64(1000), "source": "wechat", "campaignId": 9999,
+	})
+	if unknownCampaign.Code != 400 {
+		t.Fatalf("unknown campaign order code = %d, want 400", unknownCampaign.Code)
+	}
+
+	paidOrders := func(mode string) map[uint]int64 {
+		target := "/api/v1/reports/campaign-attribution"
+		if mode != "" {
+			target += "?mode=" + mode
+		}
+		report := performJSONRequest[testAttributionPayload](t, router, token, http.MethodGet, target, nil)
+		if report.Code != 200 {
+			t.Fatalf("attribution mode %q code = %d, msg = %s", mode, report.Code, report.Msg)
+		}
+		counts := make(map[uint]int64, len(report.Data.Rows))
+		for _, row := range report.Data.Rows {
+			counts[row.CampaignID] = row.PaidOrderCount
+		}
+		return counts
+	}
+
+	channelWindow := paidOrders("")
+	if channelWindow[spring.Data.ID] != 3 || channelWindow[summer.Data.ID] != 3 {
+		t.Fatalf("channel-window paid orders = %v, want 3 for both campaigns", channelWindow)
+	}
+	explicit := paidOrders("explicit")
+	if explicit[spring.Data.ID] != 1 || explicit[summer.Data.ID] != 1 {
+		t.Fatalf("explicit paid orders = %v, want 1 for both campaigns", explicit)
+	}
+
+	invalidMode := performJSONRequest[testAttributionPayload](t, router, token, http.MethodGet, "/api/v1/reports/campaign-attribution?mode=guess", nil)
+	if invalidMode.Code != 400 {
+		t.Fatalf("invalid mode code = %d, want 400", invalidMode.Code)
+	}
+}
+
+func TestCampaignAttributionModels(t *testing.T) {
+	t.Parallel()
+
+	router := newTestRouter(t)
+	token := loginForTest(t, router, "Super")
+
+	member := performJSONRequest[testMember](t, router, token, http.MethodPost, "/api/v1/members", map[string]interface{}{
+		"name":    "Erin",
+		"phone":   "13800005555",
+		"channel": "wechat",
+	})
+	if member.Code != 200 {
+		t.Fatalf("create member code = %d, msg = %s", member.Code, member.Msg)
+	}
+
+	now := time.Now().UTC()
+	early := performJSONRequest[testCampaign](t, router, token, http.MethodPost, "/api/v1/campaigns", map[string]interface{}{
+		"name":        "Early Bird",
+		"channel":     "wechat",
+		"discountPct": 10,
+		"startAt":     now.AddDate(0, 0, -14).Format(time.RFC3339),
+	})
+	late := performJSONRequest[testCampaign](t, router, token, http.MethodPost, "/api/v1/campaigns", map[string]interface{}{
+		"name":        "Late Push",
+		"channel":     "wechat",
+		"discountPct": 10,
+		"startAt":     now.AddDate(0, 0, -1).Format(time.RFC3339),
+	})
+	if early.Code != 200 || late.Code != 200 {
+		t.Fatalf("create campaigns code = %d/%d", early.Code, late.Code)
+	}
+
+	order := performJSONRequest[testOrder](t, router, token, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+		"memberId":    member.Data.ID,
+		"amountCents": int64(1000),
+		"source":      "wechat",
+	})
+	if order.Code != 200 {
+		t.Fatalf("create order code = %d, msg = %s", order.Code, order.Msg)
+	}
+
+	type creditRow struct {
+		CampaignID             uint    `json:"campaignId"`
+		RevenueCents           int64   `json:"revenueCents"`
+		AttributedOrders       float64 `json:"attributedOrders"`
+		AttributedRevenueCents float64 `json:"attributedRevenueCents"`
+	}
+	type creditPayload struct {
+		Model string      `json:"model"`
+		Rows  []creditRow `json:"rows"`
+	}
+	credit := func(model string) map[uint]creditRow {
+		report := performJSONRequest[creditPayload](t, router, token, http.MethodGet, "/api/v1/reports/campaign-attribution?model="+model, nil)
+		if report.Code != 200 {
+			t.Fatalf("attribution model %q code = %d, msg = %s", model, report.Code, report.Msg)
+		}
+		if report.Data.Model != model {
+			t.Fatalf("attribution model = %q, want %q", report.Data.Model, model)
+		}
+		rows := make(map[uint]creditRow, len(report.Data.Rows))
+		for _, row := range report.Data.Rows {
+			if row.RevenueCents != 1000 {
+				t.Fatalf("%s campaign %d revenueCents = %d, want full 1000", model, row.CampaignID, row.RevenueCents)
+			}
+			rows[row.CampaignID] = row
+		}
+		return rows
+	}
+
+	lastTouch := credit("last-touch")
+	if lastTouch[late.Data.ID].AttributedOrders != 1 || lastTouch[early.Data.ID].AttributedOrders != 0 {
+		t.Fatalf("last-touch credit = %+v, want all on late campaign", lastTouch)
+	}
+	firstTouch := credit("first-touch")
+	if firstTouch[early.Data.ID].AttributedRevenueCents != 1000 || firstTouch[late.Data.ID].AttributedRevenueCents != 0 {
+		t.Fatalf("first-touch credit = %+v, want all on early campaign", firstTouch)
+	}
+	linear := credit("linear")
+	if linear[early.Data.ID].AttributedRevenueCents != 500 || linear[late.Data.ID].AttributedOrders != 0.5 {
+		t.Fatalf("linear credit = %+v, want an even split", linear)
+	}
+	timeDecay := credit("time-decay")
+	earlyShare, lateShare := timeDecay[early.Data.ID].AttributedRevenueCents, timeDecay[late.Data.ID].AttributedRevenueCents
+	if lateShare <= earlyShare || math.Abs(earlyShare+lateShare-1000) > 0.02 {
+		t.Fatalf("time-decay credit = %v/%v, want late > early summing to 1000", earlyShare, lateShare)
+	}
+
+	// A partial refund lowers the net revenue every model distributes.
+	refund := performJSONRequest[map[string]interface{}](t, router, token, http.MethodPost,
+		fmt.Sprintf("/api/v1/orders/%d/refunds", order.Data.ID), map[string]interface{}{"amountCents": int64(400)})
+	if refund.Code != 200 {
+		t.Fatalf("refund code = %d, msg = %s", refund.Code, refund.Msg)
+	}
+	netReport := performJSONRequest[creditPayload](t, router, token, http.MethodGet, "/api/v1/reports/campaign-attribution?model=linear", nil)
+	for _, row := range netReport.Data.Rows {
+		if row.RevenueCents != 600 || row.AttributedRevenueCents != 300 {
+			t.Fatalf("net attribution row = %+v, want revenue 600 split to 300", row)
+		}
+	}
+
+	invalidModel := performJSONRequest[creditPayload](t, router, token, http.MethodGet, "/api/v1/reports/campaign-attribution?model=u-shape", nil)
+	if invalidModel.Code != 400 {
+		t.Fatalf("invalid model code = %d, want 400", invalidModel.Code)
+	}
+
+	csvResp := performRawRequest(t, router, token, http.MethodGet, "/api/v1/reports/campaign-attribution/export?model=linear")
+	body, err := io.ReadAll(csvResp.Body)
+	if err != nil {
+		t.Fatalf("read csv body: %v", err)
+	}
+	if !strings.Contains(string(body), "conversion_rate,attributed_orders,attributed_revenue_cents") {
+		t.Fatalf("csv header missing attribution columns: %s", body)
+	}
+	if !strings.Contains(string(body), ",0.50,300.00") {
+		t.Fatalf("csv rows missing linear credit: %s", body)
+	}
+}
+
+// BenchmarkLoadCampaignAttributionRows compares the grouped queries with the
+// previous five-queries-per-campaign implementation on 100 campaigns.
+func BenchmarkLoadCampaignAttributionRows(b *testing.B) {
+	database := seedAttributionFixture(b, 3000, 3, 100)
+	ctx := context.Background()
+	filter := campaignAttributionFilter{Limit: 100}
+
+	b.Run("set-based", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := loadCampaignAttributionRows(ctx, database, filter); err != nil {
+				b.Fatalf("load rows: %v", err)
+			}
+		}
+	})
+	b.Run("per-campaign", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := loadCampaignAttributionRowsPerCampaign(ctx, database, filter); err != nil {
+				b.Fatalf("load rows: %v", err)
+			}
+		}
+	})
+}
+
+// seedAttributionFixture creates members spread over channels, paid/pending
+// orders over the last 120 days and campaigns with open and bounded windows.
+func seedAttributionFixture(tb testing.TB, memberCount, ordersPerMember, campaignCount int) *gorm.DB {
+	tb.Helper()
+
+	database, err := db.Open(config.Config{
+		Env:        "local",
+		SQLitePath: filepath.Join(tb.TempDir(), "app.db"),
+	})
+	if err != nil {
+		tb.Fatalf("open db: %v", err)
+	}
+
+	now := time.Now()
+	members := make([]db.Member, 0, memberCount)
+	for i := 0; i < memberCount; i++ {
+		members = append(members, db.Member{
+			Name:    fmt.Sprintf("Member %d", i),
+			Phone:   fmt.Sprintf("139%08d", i),
+			Channel: attributionChannels[i%len(attributionChannels)],
+		})
+	}
+	if err := database.CreateInBatches(&members, 500).Error; err != nil {
+		tb.Fatalf("seed members: %v", err)
+	}
+
+	orders := make([]db.Order, 0, memberCount*ordersPerMember)
+	for i, member := range members {
+		// Every third member buys only once so repurchase counts differ from conversions.
+		count := ordersPerMember
+		if i%3 == 0 {
+			count = 1
+		}
+		for j := 0; j < count; j++ {
+			status := "paid"
+			if (i+j)%7 == 0 {
+				status = "pending"
+			}
+			var paidAt *time.Time
+			if status == "paid" {
+				value := now.Add(-time.Duration((i*13+j*29)%120*24) * time.Hour)
+				paidAt = &value
+			}
+			orders = append(orders, db.Order{
+				OrderNo:     fmt.Sprintf("ORD-%d-%d", member.ID, j),
+				MemberID:    member.ID,
+				AmountCents: int64(1000 + (i*j)%5000),
+				Status:      status,
+				Source:      attributionChannels[(i+j)%len(attributionChannels)],
+				PaidAt:      paidAt,
+			})
+		}
+	}
+	if err := database.CreateInBatches(&orders, 500).Error; err != nil {
+		tb.Fatalf("seed orders: %v", err)
+	}
+
+	campaigns := make([]db.Campaign, 0, campaignCount)
+	for i := 0; i < campaignCount; i++ {
+		campaign := db.Campaign{
+			Name:        fmt.Sprintf("Campaign %d", i),
+			Channel:     attributionChannels[i%len(attributionChannels)],
+			DiscountPct: 10,
+			Status:      []string{"active", "closed", "draft"}[i%3],
+		}
+		if i%4 != 0 {
+			startAt := now.AddDate(0, 0, -(i%90 + 20))
+			endAt := startAt.AddDate(0, 0, 30)
+			campaign.StartAt = &startAt
+			campaign.EndAt = &endAt
+		}
+		campaigns = append(campaigns, campaign)
+	}
+	if err := database.CreateInBatches(&campaigns, 500).Error; err != nil {
+		tb.Fatalf("seed campaigns: %v", err)
+	}
+	return database
+}
+
+// loadCampaignAttributionRowsPerCampaign is the previous implementation that
+// issued five queries per campaign; it is kept as the reference for tests.
+func loadCampaignAttributionRowsPerCampaign(
+	ctx context.Context,
+	database *gorm.DB,
+	filter campaignAttributionFilter,
+) ([]campaignAttributionRow, error) {
+	query := database.WithContext(ctx).Model(&db.Campaign{}).Order("id DESC").Limit(filter.Limit)
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Channel != "" {
+		query = query.Where("channel = ?", filter.Channel)
+	}
+
+	campaigns := make([]db.Campaign, 0, filter.Limit)
+	if err := query.Find(&campaigns).Error; err != nil {
+		return nil, err
+	}
+
+	repurchaseMembersSubQuery := database.WithContext(ctx).
+		Model(&db.Order{}).
+		Select("member_id").
+		Where("status = ?", "paid").
+		Group("member_id").
+		Having("COUNT(*) >= 2")
+
+	rows := make([]campaignAttributionRow, 0, len(campaigns))
+	for _, campaign := range campaigns {
+		var targetMemberCount int64
+		if err := database.WithContext(ctx).
+			Model(&db.Member{}).
+			Where("channel = ?", campaign.Channel).
+			Count(&targetMemberCount).Error; err != nil {
+			return nil, err
+		}
+
+		orderScope := database.WithContext(ctx).
+			Model(&db.Order{}).
+			Where("status = ? AND source = ?", "paid", campaign.Channel)
+		if campaign.StartAt != nil {
+			orderScope = orderScope.Where("paid_at >= ?", *campaign.StartAt)
+		}
+		if campaign.EndAt != nil {
+			orderScope = orderScope.Where("paid_at <= ?", *campaign.EndAt)
+		}
+
+		var paidOrderCount int64
+		if err := orderScope.Count(&paidOrderCount).Error; err != nil {
+			return nil, err
+		}
+
+		type revenueAgg struct {
+			RevenueCents int64 `gorm:"column:revenue_cents"`
+		}
+		var revenue revenueAgg
+		if err := orderScope.Select("COALESCE(SUM(amount_cents), 0) AS revenue_cents").Scan(&revenue).Error; err != nil {
+			return nil, err
+		}
+
+		var convertedMemberCount int64
+		if err := orderScope.Distinct("member_id").Count(&convertedMemberCount).Error; err != nil {
+			return nil, err
+		}
+
+		var repurchaseConvertedCount int64
+		if err := orderScope.
+			Where("member_id IN (?)", repurchaseMembersSubQuery).
+			Distinct("member_id").
+			Count(&repurchaseConvertedCount).Error; err != nil {
+			return nil, err
+		}
+
+		conversionRate := 0.0
+		if targetMemberCount > 0 {
+			conversionRate = math.Round((float64(convertedMemberCount)/float64(targetMemberCount))*10000) / 100
+		}
+
+		rows = append(rows, campaignAttributionRow{
+			CampaignID:               campaign.ID,
+			CampaignName:             campaign.Name,
+			Channel:                  campaign.Channel,
+			Status:                   campaign.Status,
+			StartAt:                  campaign.StartAt,
+			EndAt:                    campaign.EndAt,
+			TargetMemberCount:        targetMemberCount,
+			PaidOrderCount:           paidOrderCount,
+			ConvertedMemberCount:     convertedMemberCount,
+			RepurchaseConvertedCount: repurchaseConvertedCount,
+			RevenueCents:             revenue.RevenueCents,
+			ConversionRate:           conversionRate,
+		})
+	}
+	return rows, nil
+}
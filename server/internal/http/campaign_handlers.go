@@ -0,0 +1,440 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"small-merchant-ops-hub-server/internal/cache"
+	"small-merchant-ops-hub-server/internal/db"
+	"small-merchant-ops-hub-server/internal/lifecycle"
+)
+
+var (
+	errCampaignClosed        = errors.New("closed campaigns cannot be edited")
+	errCampaignStatusChanged = errors.New("campaign status changed, reload and retry")
+	errCampaignEnded         = errors.New("campaign has already ended")
+)
+
+// campaignTransition is a status move and the statuses it may start from.
+type campaignTransition struct {
+	To   string
+	From []string
+}
+
+// allows reports whether the move may start from status.
+func (t campaignTransition) allows(status string) bool {
+	for _, from := range t.From {
+		if from == status {
+			return true
+		}
+	}
+	return false
+}
+
+// campaignTransitions maps each transition action to its move. Closed is
+// final; a campaign to run again is cloned instead. lifecycle.Advance makes
+// the same moves when a campaign's window opens or ends.
+var campaignTransitions = map[string]campaignTransition{
+	db.CampaignActionActivated: {To: "active", From: []string{"draft"}},
+	db.CampaignActionClosed:    {To: "closed", From: []string{"draft", "active"}},
+}
+
+type cloneCampaignRequest struct {
+	Name       string `json:"name"`
+	StartAt    string `json:"startAt"`
+	EndAt      string `json:"endAt"`
+	CouponCode string `json:"couponCode"`
+}
+
+type campaignFieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+type campaignChangeResponse struct {
+	ID         uint                           `json:"id"`
+	CampaignID uint                           `json:"campaignId"`
+	Action     string                         `json:"action"`
+	Changes    map[string]campaignFieldChange `json:"changes"`
+	Note       string                         `json:"note"`
+	ChangedBy  string                         `json:"changedBy"`
+	CreatedAt  time.Time                      `json:"createdAt"`
+}
+
+// updateCampaignHandler edits a draft or active campaign with the checks
+// create applies. Status is left alone; it moves through activate and close.
+func updateCampaignHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		campaignID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid campaign id")
+			return
+		}
+
+		var req createCampaignRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid campaign payload")
+			return
+		}
+		startAt, endAt, msg := normalizeCampaignRequest(&req)
+		if msg != "" {
+			fail(c, 400, msg)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var campaign db.Campaign
+		if err := database.WithContext(ctx).First(&campaign, campaignID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "campaign not found")
+				return
+			}
+			fail(c, 500, "query campaign failed")
+			return
+		}
+		if campaign.Status == "closed" {
+			fail(c, 409, errCampaignClosed.Error())
+			return
+		}
+		if req.Status != "" && req.Status != campaign.Status {
+			fail(c, 400, "use activate or close to change status")
+			return
+		}
+		if req.CouponCode != "" && req.CouponCode != campaign.CouponCode {
+			taken, err := couponCodeTaken(ctx, database, req.CouponCode, campaign.ID)
+			if err != nil {
+				fail(c, 500, "query campaign failed")
+				return
+			}
+			if taken {
+				fail(c, 400, "couponCode already exists")
+				return
+			}
+		}
+
+		updated := campaign
+		updated.Name = req.Name
+		updated.Channel = req.Channel
+		updated.DiscountPct = req.DiscountPct
+		updated.StartAt = startAt
+		updated.EndAt = endAt
+		updated.CouponCode = req.CouponCode
+		updated.ContactChannel = req.ContactChannel
+		changes := diffCampaigns(campaign, updated)
+
+		err := database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&db.Campaign{}).
+				Where("id = ? AND status = ?", campaign.ID, campaign.Status).
+				Updates(map[string]interface{}{
+					"name":            updated.Name,
+					"channel":         updated.Channel,
+					"discount_pct":    updated.DiscountPct,
+					"start_at":        updated.StartAt,
+					"end_at":          updated.EndAt,
+					"coupon_code":     updated.CouponCode,
+					"contact_channel": updated.ContactChannel,
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errCampaignStatusChanged
+			}
+			if len(changes) == 0 {
+				return nil
+			}
+			return recordCampaignChange(tx, campaign.ID, db.CampaignActionUpdated, changes, "", sessionFromContext(c).UserName)
+		})
+		if err != nil {
+			if errors.Is(err, errCampaignStatusChanged) {
+				fail(c, 409, err.Error())
+				return
+			}
+			fail(c, 500, "update campaign failed")
+			return
+		}
+		ok(c, toCampaignResponse(updated))
+	}
+}
+
+// campaignTransitionHandler moves a campaign along campaignTransitions[action].
+// A campaign whose endAt has passed cannot be activated.
+func campaignTransitionHandler(database *gorm.DB, cacheStore cache.Store, action string) gin.HandlerFunc {
+	transition := campaignTransitions[action]
+
+	return func(c *gin.Context) {
+		campaignID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid campaign id")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var campaign db.Campaign
+		if err := database.WithContext(ctx).First(&campaign, campaignID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "campaign not found")
+				return
+			}
+			fail(c, 500, "query campaign failed")
+			return
+		}
+		if !transition.allows(campaign.Status) {
+			fail(c, 409, fmt.Sprintf("campaign is %s and cannot be %s", campaign.Status, action))
+			return
+		}
+		if transition.To == "active" && campaign.EndAt != nil && campaign.EndAt.Before(time.Now()) {
+			fail(c, 409, errCampaignEnded.Error())
+			return
+		}
+
+		err := database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			moved, err := lifecycle.Transition(tx, campaign, action, transition.To, "", sessionFromContext(c).UserName)
+			if err != nil {
+				return err
+			}
+			if !moved {
+				return errCampaignStatusChanged
+			}
+			return nil
+		})
+		if err != nil {
+			if errors.Is(err, errCampaignStatusChanged) {
+				fail(c, 409, err.Error())
+				return
+			}
+			fail(c, 500, "change campaign status failed")
+			return
+		}
+		campaign.Status = transition.To
+
+		_ = cacheStore.Delete(ctx, summaryCacheKey)
+		ok(c, toCampaignResponse(campaign))
+	}
+}
+
+// cloneCampaignHandler copies a campaign's channel, discount and contact
+// channel into a new draft with its own dates. Coupon codes are unique, so
+// the clone only gets the one given in the request.
+func cloneCampaignHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sourceID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid campaign id")
+			return
+		}
+
+		var req cloneCampaignRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid clone payload")
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		req.CouponCode = normalizeCouponCode(req.CouponCode)
+		startAt, endAt, msg := parseCampaignWindow(req.StartAt, req.EndAt)
+		if msg != "" {
+			fail(c, 400, msg)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var source db.Campaign
+		if err := database.WithContext(ctx).First(&source, sourceID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "campaign not found")
+				return
+			}
+			fail(c, 500, "query campaign failed")
+			return
+		}
+		if req.Name == "" {
+			req.Name = source.Name
+		}
+		if req.CouponCode != "" {
+			taken, err := couponCodeTaken(ctx, database, req.CouponCode, 0)
+			if err != nil {
+				fail(c, 500, "query campaign failed")
+				return
+			}
+			if taken {
+				fail(c, 400, "couponCode already exists")
+				return
+			}
+		}
+
+		clone := db.Campaign{
+			Name:           req.Name,
+			Channel:        source.Channel,
+			DiscountPct:    source.DiscountPct,
+			Status:         "draft",
+			StartAt:        startAt,
+			EndAt:          endAt,
+			CouponCode:     req.CouponCode,
+			ContactChannel: source.ContactChannel,
+		}
+		err := database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&clone).Error; err != nil {
+				return err
+			}
+			return recordCampaignChange(tx, clone.ID, db.CampaignActionCloned, nil,
+				fmt.Sprintf("cloned from campaign %d", source.ID), sessionFromContext(c).UserName)
+		})
+		if err != nil {
+			fail(c, 500, "clone campaign failed")
+			return
+		}
+		ok(c, toCampaignResponse(clone))
+	}
+}
+
+// listCampaignChangesHandler lists a campaign's history, newest first.
+func listCampaignChangesHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		campaignID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid campaign id")
+			return
+		}
+		limit := parseLimit(c.Query("limit"), 20)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		changes := make([]db.CampaignChange, 0, limit)
+		if err := database.WithContext(ctx).
+			Where("campaign_id = ?", campaignID).
+			Order("id DESC").
+			Limit(limit).
+			Find(&changes).Error; err != nil {
+			fail(c, 500, "list campaign changes failed")
+			return
+		}
+
+		result := make([]campaignChangeResponse, 0, len(changes))
+		for _, change := range changes {
+			result = append(result, toCampaignChangeResponse(change))
+		}
+		ok(c, result)
+	}
+}
+
+// normalizeCampaignRequest trims req, defaults ContactChannel to sms and
+// returns the parsed window with a validation message, or "" when the
+// campaign is usable. An empty Status is allowed for updates.
+func normalizeCampaignRequest(req *createCampaignRequest) (*time.Time, *time.Time, string) {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Channel = strings.TrimSpace(req.Channel)
+	req.Status = strings.TrimSpace(strings.ToLower(req.Status))
+	req.CouponCode = normalizeCouponCode(req.CouponCode)
+	req.ContactChannel = strings.TrimSpace(strings.ToLower(req.ContactChannel))
+	if req.ContactChannel == "" {
+		req.ContactChannel = db.ConsentChannelSMS
+	}
+
+	switch {
+	case req.Name == "" || req.Channel == "":
+		return nil, nil, "name and channel are required"
+	case req.DiscountPct <= 0 || req.DiscountPct > 100:
+		return nil, nil, "discountPct must be in (0, 100]"
+	case req.Status != "" && !isSupportedCampaignStatus(req.Status):
+		return nil, nil, "status must be draft, active or closed"
+	case !isSupportedConsentChannel(req.ContactChannel):
+		return nil, nil, "contactChannel must be sms, wechat or phone"
+	}
+	return parseCampaignWindow(req.StartAt, req.EndAt)
+}
+
+// parseCampaignWindow parses optional RFC3339 startAt and endAt.
+func parseCampaignWindow(rawStart, rawEnd string) (*time.Time, *time.Time, string) {
+	startAt, err := parseOptionalRFC3339(rawStart)
+	if err != nil {
+		return nil, nil, "startAt must be RFC3339 format"
+	}
+	endAt, err := parseOptionalRFC3339(rawEnd)
+	if err != nil {
+		return nil, nil, "endAt must be RFC3339 format"
+	}
+	if startAt != nil && endAt != nil && endAt.Before(*startAt) {
+		return nil, nil, "endAt cannot be earlier than startAt"
+	}
+	return startAt, endAt, ""
+}
+
+// couponCodeTaken reports whether another campaign than exceptID uses code.
+func couponCodeTaken(ctx context.Context, database *gorm.DB, code string, exceptID uint) (bool, error) {
+	var taken int64
+	err := database.WithContext(ctx).
+		Model(&db.Campaign{}).
+		Where("coupon_code = ? AND id <> ?", code, exceptID).
+		Count(&taken).Error
+	return taken > 0, err
+}
+
+// diffCampaigns returns the editable fields that differ between before and after.
+func diffCampaigns(before, after db.Campaign) map[string]campaignFieldChange {
+	changes := make(map[string]campaignFieldChange)
+	add := func(field string, from, to interface{}, same bool) {
+		if !same {
+			changes[field] = campaignFieldChange{From: from, To: to}
+		}
+	}
+	add("name", before.Name, after.Name, before.Name == after.Name)
+	add("channel", before.Channel, after.Channel, before.Channel == after.Channel)
+	add("discountPct", before.DiscountPct, after.DiscountPct, before.DiscountPct == after.DiscountPct)
+	add("startAt", before.StartAt, after.StartAt, sameTime(before.StartAt, after.StartAt))
+	add("endAt", before.EndAt, after.EndAt, sameTime(before.EndAt, after.EndAt))
+	add("couponCode", before.CouponCode, after.CouponCode, before.CouponCode == after.CouponCode)
+	add("contactChannel", before.ContactChannel, after.ContactChannel, before.ContactChannel == after.ContactChannel)
+	return changes
+}
+
+func recordCampaignChange(tx *gorm.DB, campaignID uint, action string, changes map[string]campaignFieldChange, note, changedBy string) error {
+	change := db.CampaignChange{
+		CampaignID: campaignID,
+		Action:     action,
+		Note:       note,
+		ChangedBy:  changedBy,
+	}
+	if len(changes) > 0 {
+		raw, err := json.Marshal(changes)
+		if err != nil {
+			return err
+		}
+		change.Changes = string(raw)
+	}
+	return tx.Create(&change).Error
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Equal(*b)
+}
+
+func toCampaignChangeResponse(change db.CampaignChange) campaignChangeResponse {
+	response := campaignChangeResponse{
+		ID:         change.ID,
+		CampaignID: change.CampaignID,
+		Action:     change.Action,
+		Note:       change.Note,
+		ChangedBy:  change.ChangedBy,
+		CreatedAt:  change.CreatedAt,
+	}
+	if change.Changes != "" {
+		_ = json.Unmarshal([]byte(change.Changes), &response.Changes)
+	}
+	return response
+}
@@ -0,0 +1,105 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestCampaignUpdateTransitionsAndClone(t *testing.T) {
+	t.Parallel()
+
+	router := newTestRouter(t)
+	superToken := loginForTest(t, router, "Super")
+	adminToken := loginForTest(t, router, "Admin")
+
+	created := performJSONRequest[campaignResponse](t, router, superToken, http.MethodPost, "/api/v1/campaigns", map[string]interface{}{
+		"name":        "Spring",
+		"channel":     "wechat",
+		"discountPct": 10,
+		"status":      "draft",
+		"startAt":     "2030-03-01T00:00:00Z",
+		"endAt":       "2030-03-31T00:00:00Z",
+		"couponCode":  "spring",
+	})
+	if created.Code != 200 {
+		t.Fatalf("create campaign code = %d, msg = %s", created.Code, created.Msg)
+	}
+	campaignPath := fmt.Sprintf("/api/v1/campaigns/%d", created.Data.ID)
+
+	update := map[string]interface{}{
+		"name":        "Spring sale",
+		"channel":     "wechat",
+		"discountPct": 15,
+		"startAt":     "2030-03-01T00:00:00Z",
+		"endAt":       "2030-04-15T00:00:00Z",
+		"couponCode":  "SPRING",
+	}
+	if denied := performJSONRequest[campaignResponse](t, router, adminToken, http.MethodPut, campaignPath, update); denied.Code != 403 {
+		t.Fatalf("admin update campaign code = %d, want 403", denied.Code)
+	}
+	if invalid := performJSONRequest[campaignResponse](t, router, superToken, http.MethodPut, campaignPath,
+		map[string]interface{}{"name": "Spring", "channel": "wechat", "discountPct": 120}); invalid.Code != 400 {
+		t.Fatalf("invalid discount code = %d, want 400", invalid.Code)
+	}
+	if statusEdit := performJSONRequest[campaignResponse](t, router, superToken, http.MethodPut, campaignPath,
+		map[string]interface{}{"name": "Spring", "channel": "wechat", "discountPct": 10, "status": "active"}); statusEdit.Code != 400 {
+		t.Fatalf("status change through update code = %d, want 400", statusEdit.Code)
+	}
+	updated := performJSONRequest[campaignResponse](t, router, superToken, http.MethodPut, campaignPath, update)
+	if updated.Code != 200 || updated.Data.Name != "Spring sale" || updated.Data.DiscountPct != 15 || updated.Data.Status != "draft" {
+		t.Fatalf("update campaign = %d %+v, msg = %s", updated.Code, updated.Data, updated.Msg)
+	}
+
+	if activated := performJSONRequest[campaignResponse](t, router, superToken, http.MethodPost, campaignPath+"/activate", nil); activated.Code != 200 || activated.Data.Status != "active" {
+		t.Fatalf("activate = %d %+v, msg = %s", activated.Code, activated.Data, activated.Msg)
+	}
+	if again := performJSONRequest[campaignResponse](t, router, superToken, http.MethodPost, campaignPath+"/activate", nil); again.Code != 409 {
+		t.Fatalf("activate twice code = %d, want 409", again.Code)
+	}
+	if closed := performJSONRequest[campaignResponse](t, router, superToken, http.MethodPost, campaignPath+"/close", nil); closed.Code != 200 || closed.Data.Status != "closed" {
+		t.Fatalf("close = %d %+v, msg = %s", closed.Code, closed.Data, closed.Msg)
+	}
+	if edit := performJSONRequest[campaignResponse](t, router, superToken, http.MethodPut, campaignPath, update); edit.Code != 409 {
+		t.Fatalf("edit closed campaign code = %d, want 409", edit.Code)
+	}
+	if reopen := performJSONRequest[campaignResponse](t, router, superToken, http.MethodPost, campaignPath+"/activate", nil); reopen.Code != 409 {
+		t.Fatalf("activate closed campaign code = %d, want 409", reopen.Code)
+	}
+
+	changes := performJSONRequest[[]campaignChangeResponse](t, router, adminToken, http.MethodGet, campaignPath+"/changes", nil)
+	if changes.Code != 200 || len(changes.Data) != 4 {
+		t.Fatalf("campaign changes = %d %+v", changes.Code, changes.Data)
+	}
+	edit := changes.Data[2]
+	if edit.Action != "updated" || edit.ChangedBy != "Super" || len(edit.Changes) != 3 || edit.Changes["discountPct"].To != 15.0 {
+		t.Fatalf("update change = %+v, want name, discountPct and endAt", edit)
+	}
+	if changes.Data[0].Action != "closed" || changes.Data[0].Changes["status"].From != "active" || changes.Data[3].Action != "created" {
+		t.Fatalf("campaign changes = %+v", changes.Data)
+	}
+
+	clonePath := campaignPath + "/clone"
+	if taken := performJSONRequest[campaignResponse](t, router, superToken, http.MethodPost, clonePath,
+		map[string]interface{}{"couponCode": "spring"}); taken.Code != 400 {
+		t.Fatalf("clone with used coupon code = %d, want 400", taken.Code)
+	}
+	clone := performJSONRequest[campaignResponse](t, router, superToken, http.MethodPost, clonePath, map[string]interface{}{
+		"startAt": "2020-04-01T00:00:00Z",
+		"endAt":   "2020-04-30T00:00:00Z",
+	})
+	if clone.Code != 200 || clone.Data.ID == created.Data.ID || clone.Data.Name != "Spring sale" || clone.Data.DiscountPct != 15 ||
+		clone.Data.Status != "draft" || clone.Data.CouponCode != "" || clone.Data.StartAt == nil || clone.Data.StartAt.Year() != 2020 {
+		t.Fatalf("clone = %d %+v, msg = %s", clone.Code, clone.Data, clone.Msg)
+	}
+	cloneChanges := performJSONRequest[[]campaignChangeResponse](t, router, adminToken, http.MethodGet,
+		fmt.Sprintf("/api/v1/campaigns/%d/changes", clone.Data.ID), nil)
+	if cloneChanges.Code != 200 || len(cloneChanges.Data) != 1 || cloneChanges.Data[0].Action != "cloned" ||
+		cloneChanges.Data[0].Note != fmt.Sprintf("cloned from campaign %d", created.Data.ID) {
+		t.Fatalf("clone changes = %d %+v", cloneChanges.Code, cloneChanges.Data)
+	}
+	if ended := performJSONRequest[campaignResponse](t, router, superToken, http.MethodPost,
+		fmt.Sprintf("/api/v1/campaigns/%d/activate", clone.Data.ID), nil); ended.Code != 409 {
+		t.Fatalf("activate ended campaign code = %d, want 409", ended.Code)
+	}
+}
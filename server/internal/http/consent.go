@@ -0,0 +1,362 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"small-merchant-ops-hub-server/internal/consent"
+	"small-merchant-ops-hub-server/internal/db"
+)
+
+// Consent sources written by the server itself; staff may record others.
+const (
+	consentSourceManual          = "manual"
+	consentSourceUnsubscribeLink = "unsubscribe_link"
+	consentSourceFollowup        = "followup"
+
+	consentStatusUnknown   = "unknown"
+	maxConsentSourceLength = 30
+)
+
+// consentChannels lists the channels in the order responses show them.
+var consentChannels = []string{db.ConsentChannelSMS, db.ConsentChannelWeChat, db.ConsentChannelPhone}
+
+// consentUpsert replaces the answer of an existing member and channel row.
+var consentUpsert = clause.OnConflict{
+	Columns:   []clause.Column{{Name: "member_id"}, {Name: "channel"}},
+	DoUpdates: clause.AssignmentColumns([]string{"status", "source", "updated_by", "updated_at"}),
+}
+
+type saveConsentRequest struct {
+	Status string `json:"status"`
+	Source string `json:"source"`
+}
+
+type unsubscribeRequest struct {
+	Token string `json:"token"`
+}
+
+// consentResponse is one channel of a member. Status is unknown and
+// RecordedAt nil until the member answers on that channel.
+type consentResponse struct {
+	Channel          string     `json:"channel"`
+	Status           string     `json:"status"`
+	Source           string     `json:"source"`
+	UpdatedBy        string     `json:"updatedBy"`
+	RecordedAt       *time.Time `json:"recordedAt"`
+	UnsubscribeToken string     `json:"unsubscribeToken"`
+}
+
+type unsubscribeResponse struct {
+	Channel    string `json:"channel"`
+	OptedOut   bool   `json:"optedOut"`
+	MemberName string `json:"memberName"`
+}
+
+func registerConsentRoutes(router *gin.Engine, database *gorm.DB, signer consent.Signer) {
+	router.GET("/api/consent/unsubscribe", unsubscribeStatusHandler(database, signer))
+	router.POST("/api/consent/unsubscribe", unsubscribeHandler(database, signer))
+}
+
+// memberConsentsHandler shows every channel of a member with the token its
+// unsubscribe links carry.
+func memberConsentsHandler(database *gorm.DB, signer consent.Signer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		memberID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid member id")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var member db.Member
+		if err := database.WithContext(ctx).Select("id").First(&member, memberID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "member not found")
+				return
+			}
+			fail(c, 500, "query member failed")
+			return
+		}
+
+		consents := make([]db.MemberConsent, 0, len(consentChannels))
+		if err := database.WithContext(ctx).Where("member_id = ?", member.ID).Find(&consents).Error; err != nil {
+			fail(c, 500, "list consents failed")
+			return
+		}
+		byChannel := make(map[string]db.MemberConsent, len(consents))
+		for _, item := range consents {
+			byChannel[item.Channel] = item
+		}
+
+		result := make([]consentResponse, 0, len(consentChannels))
+		for _, channel := range consentChannels {
+			if stored, found := byChannel[channel]; found {
+				result = append(result, toConsentResponse(stored, signer))
+				continue
+			}
+			result = append(result, consentResponse{
+				Channel:          channel,
+				Status:           consentStatusUnknown,
+				UnsubscribeToken: signer.Token(member.ID, channel),
+			})
+		}
+		ok(c, result)
+	}
+}
+
+// updateMemberConsentHandler records a member's answer on one channel, e.g.
+// a paper form or a phone call; source defaults to manual.
+func updateMemberConsentHandler(database *gorm.DB, signer consent.Signer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		memberID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid member id")
+			return
+		}
+		channel := strings.TrimSpace(strings.ToLower(c.Param("channel")))
+		if !isSupportedConsentChannel(channel) {
+			fail(c, 400, "channel must be sms, wechat or phone")
+			return
+		}
+
+		var req saveConsentRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid consent payload")
+			return
+		}
+		req.Status = strings.TrimSpace(strings.ToLower(req.Status))
+		req.Source = strings.TrimSpace(strings.ToLower(req.Source))
+		if req.Status != db.ConsentOptedIn && req.Status != db.ConsentOptedOut {
+			fail(c, 400, "status must be opted_in or opted_out")
+			return
+		}
+		if req.Source == "" {
+			req.Source = consentSourceManual
+		}
+		if len(req.Source) > maxConsentSourceLength {
+			fail(c, 400, "source must be at most 30 characters")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var member db.Member
+		if err := database.WithContext(ctx).Select("id").First(&member, memberID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "member not found")
+				return
+			}
+			fail(c, 500, "query member failed")
+			return
+		}
+
+		stored, err := recordConsent(database.WithContext(ctx), db.MemberConsent{
+			MemberID:  member.ID,
+			Channel:   channel,
+			Status:    req.Status,
+			Source:    req.Source,
+			UpdatedBy: sessionFromContext(c).UserName,
+		})
+		if err != nil {
+			fail(c, 500, "save consent failed")
+			return
+		}
+		ok(c, toConsentResponse(stored, signer))
+	}
+}
+
+// unsubscribeStatusHandler lets the public unsubscribe page show what a link
+// is for before the member confirms. It never returns member contact data.
+func unsubscribeStatusHandler(database *gorm.DB, signer consent.Signer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		memberID, channel, err := parseUnsubscribeToken(signer, c.Query("token"))
+		if err != nil {
+			fail(c, 400, err.Error())
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var member db.Member
+		if err := database.WithContext(ctx).Select("id, name").First(&member, memberID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "member not found")
+				return
+			}
+			fail(c, 500, "query member failed")
+			return
+		}
+
+		var optedOut int64
+		if err := database.WithContext(ctx).Model(&db.MemberConsent{}).
+			Where("member_id = ? AND channel = ? AND status = ?", member.ID, channel, db.ConsentOptedOut).
+			Count(&optedOut).Error; err != nil {
+			fail(c, 500, "query consent failed")
+			return
+		}
+		ok(c, unsubscribeResponse{Channel: channel, OptedOut: optedOut > 0, MemberName: maskName(member.Name)})
+	}
+}
+
+// unsubscribeHandler opts the member in a signed link out of its channel.
+// Repeating it keeps the first opt-out's source and time.
+func unsubscribeHandler(database *gorm.DB, signer consent.Signer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req unsubscribeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid unsubscribe payload")
+			return
+		}
+		memberID, channel, err := parseUnsubscribeToken(signer, req.Token)
+		if err != nil {
+			fail(c, 400, err.Error())
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var member db.Member
+		if err := database.WithContext(ctx).Select("id, name").First(&member, memberID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "member not found")
+				return
+			}
+			fail(c, 500, "query member failed")
+			return
+		}
+
+		var existing db.MemberConsent
+		err = database.WithContext(ctx).Where("member_id = ? AND channel = ?", member.ID, channel).First(&existing).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			fail(c, 500, "query consent failed")
+			return
+		}
+		if err != nil || existing.Status != db.ConsentOptedOut {
+			if _, err := recordConsent(database.WithContext(ctx), db.MemberConsent{
+				MemberID: member.ID,
+				Channel:  channel,
+				Status:   db.ConsentOptedOut,
+				Source:   consentSourceUnsubscribeLink,
+			}); err != nil {
+				fail(c, 500, "save consent failed")
+				return
+			}
+		}
+		ok(c, unsubscribeResponse{Channel: channel, OptedOut: true, MemberName: maskName(member.Name)})
+	}
+}
+
+// recordConsent inserts or replaces the member's row for item.Channel and
+// returns it as stored.
+func recordConsent(tx *gorm.DB, item db.MemberConsent) (db.MemberConsent, error) {
+	if err := tx.Clauses(consentUpsert).Create(&item).Error; err != nil {
+		return db.MemberConsent{}, err
+	}
+	var stored db.MemberConsent
+	err := tx.Where("member_id = ? AND channel = ?", item.MemberID, item.Channel).First(&stored).Error
+	return stored, err
+}
+
+// optedOutMemberIDs is a subquery of members who opted out of channel.
+func optedOutMemberIDs(database *gorm.DB, channel string) *gorm.DB {
+	return database.Model(&db.MemberConsent{}).
+		Select("member_id").
+		Where("channel = ? AND status = ?", channel, db.ConsentOptedOut)
+}
+
+// mergeMemberConsents keeps one row per channel on the target. An opt-out on
+// any merged member wins; otherwise the most recent answer does.
+func mergeMemberConsents(tx *gorm.DB, targetID uint, sourceIDs []uint) error {
+	var consents []db.MemberConsent
+	if err := tx.Where("member_id IN ?", append([]uint{targetID}, sourceIDs...)).Find(&consents).Error; err != nil {
+		return err
+	}
+	winners := make(map[string]db.MemberConsent, len(consentChannels))
+	for _, item := range consents {
+		if current, found := winners[item.Channel]; !found || consentSupersedes(item, current) {
+			winners[item.Channel] = item
+		}
+	}
+
+	if err := tx.Where("member_id IN ?", sourceIDs).Delete(&db.MemberConsent{}).Error; err != nil {
+		return err
+	}
+	for _, winner := range winners {
+		if winner.MemberID == targetID {
+			continue
+		}
+		if err := tx.Clauses(consentUpsert).Create(&db.MemberConsent{
+			MemberID:  targetID,
+			Channel:   winner.Channel,
+			Status:    winner.Status,
+			Source:    winner.Source,
+			UpdatedBy: winner.UpdatedBy,
+			CreatedAt: winner.CreatedAt,
+			UpdatedAt: winner.UpdatedAt,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// consentSupersedes reports whether item replaces current when merging.
+func consentSupersedes(item, current db.MemberConsent) bool {
+	itemOut, currentOut := item.Status == db.ConsentOptedOut, current.Status == db.ConsentOptedOut
+	if itemOut != currentOut {
+		return itemOut
+	}
+	return item.UpdatedAt.After(current.UpdatedAt)
+}
+
+// parseUnsubscribeToken verifies token and rejects channels the server does
+// not know, which only an old or hand-made token could carry.
+func parseUnsubscribeToken(signer consent.Signer, token string) (uint, string, error) {
+	memberID, channel, err := signer.Parse(strings.TrimSpace(token))
+	if err != nil || !isSupportedConsentChannel(channel) {
+		return 0, "", consent.ErrInvalidToken
+	}
+	return memberID, channel, nil
+}
+
+func isSupportedConsentChannel(channel string) bool {
+	switch channel {
+	case db.ConsentChannelSMS, db.ConsentChannelWeChat, db.ConsentChannelPhone:
+		return true
+	default:
+		return false
+	}
+}
+
+// maskName keeps the first character so the public page can say whose link
+// it is without naming the member.
+func maskName(name string) string {
+	runes := []rune(strings.TrimSpace(name))
+	if len(runes) == 0 {
+		return ""
+	}
+	return string(runes[0]) + strings.Repeat("*", len(runes)-1)
+}
+
+func toConsentResponse(item db.MemberConsent, signer consent.Signer) consentResponse {
+	recordedAt := item.UpdatedAt
+	return consentResponse{
+		Channel:          item.Channel,
+		Status:           item.Status,
+		Source:           item.Source,
+		UpdatedBy:        item.UpdatedBy,
+		RecordedAt:       &recordedAt,
+		UnsubscribeToken: signer.Token(item.MemberID, item.Channel),
+	}
+}
@@ -0,0 +1,148 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestMarketingConsentAndUnsubscribe(t *testing.T) {
+	t.Parallel()
+
+	router := newTestRouter(t)
+	superToken := loginForTest(t, router, "Super")
+	adminToken := loginForTest(t, router, "Admin")
+	userToken := loginForTest(t, router, "User")
+
+	createMember := func(name, phone string) uint {
+		member := performJSONRequest[testMember](t, router, superToken, http.MethodPost, "/api/v1/members", map[string]interface{}{
+			"name":    name,
+			"phone":   phone,
+			"channel": "wechat",
+		})
+		if member.Code != 200 {
+			t.Fatalf("create member code = %d, msg = %s", member.Code, member.Msg)
+		}
+		if order := performJSONRequest[testOrder](t, router, superToken, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+			"memberId":    member.Data.ID,
+			"amountCents": 1500,
+			"source":      "wechat",
+		}); order.Code != 200 {
+			t.Fatalf("create order code = %d, msg = %s", order.Code, order.Msg)
+		}
+		return member.Data.ID
+	}
+	callerID := createMember("Cora", "13800006601")
+	texterID := createMember("Tess", "13800006602")
+
+	consents := performJSONRequest[[]consentResponse](t, router, userToken, http.MethodGet,
+		fmt.Sprintf("/api/v1/members/%d/consents", callerID), nil)
+	if consents.Code != 200 || len(consents.Data) != 3 || consents.Data[2].Channel != "phone" || consents.Data[2].Status != "unknown" {
+		t.Fatalf("consents = %d %+v", consents.Code, consents.Data)
+	}
+	phoneToken := consents.Data[2].UnsubscribeToken
+
+	if denied := performJSONRequest[consentResponse](t, router, userToken, http.MethodPut,
+		fmt.Sprintf("/api/v1/members/%d/consents/sms", texterID), map[string]string{"status": "opted_out"}); denied.Code != 403 {
+		t.Fatalf("user update consent code = %d, want 403", denied.Code)
+	}
+	if invalid := performJSONRequest[consentResponse](t, router, adminToken, http.MethodPut,
+		fmt.Sprintf("/api/v1/members/%d/consents/email", texterID), map[string]string{"status": "opted_out"}); invalid.Code != 400 {
+		t.Fatalf("unknown channel code = %d, want 400", invalid.Code)
+	}
+	smsOut := performJSONRequest[consentResponse](t, router, adminToken, http.MethodPut,
+		fmt.Sprintf("/api/v1/members/%d/consents/sms", texterID), map[string]string{"status": "opted_out", "source": "paper_form"})
+	if smsOut.Code != 200 || smsOut.Data.Status != "opted_out" || smsOut.Data.Source != "paper_form" || smsOut.Data.UpdatedBy != "Admin" {
+		t.Fatalf("sms opt-out = %d %+v, msg = %s", smsOut.Code, smsOut.Data, smsOut.Msg)
+	}
+
+	statusPath := "/api/consent/unsubscribe?token=" + url.QueryEscape(phoneToken)
+	status := performJSONRequest[unsubscribeResponse](t, router, "", http.MethodGet, statusPath, nil)
+	if status.Code != 200 || status.Data.Channel != "phone" || status.Data.OptedOut || status.Data.MemberName != "C***" {
+		t.Fatalf("unsubscribe status = %d %+v, msg = %s", status.Code, status.Data, status.Msg)
+	}
+	if forged := performJSONRequest[unsubscribeResponse](t, router, "", http.MethodPost, "/api/consent/unsubscribe",
+		map[string]string{"token": phoneToken + "x"}); forged.Code != 400 {
+		t.Fatalf("forged token code = %d, want 400", forged.Code)
+	}
+	for i := 0; i < 2; i++ {
+		unsubscribed := performJSONRequest[unsubscribeResponse](t, router, "", http.MethodPost, "/api/consent/unsubscribe",
+			map[string]string{"token": phoneToken})
+		if unsubscribed.Code != 200 || !unsubscribed.Data.OptedOut {
+			t.Fatalf("unsubscribe #%d = %d %+v, msg = %s", i+1, unsubscribed.Code, unsubscribed.Data, unsubscribed.Msg)
+		}
+	}
+	after := performJSONRequest[[]consentResponse](t, router, adminToken, http.MethodGet,
+		fmt.Sprintf("/api/v1/members/%d/consents", callerID), nil)
+	if after.Code != 200 || after.Data[2].Status != "opted_out" || after.Data[2].Source != "unsubscribe_link" || after.Data[2].RecordedAt == nil {
+		t.Fatalf("consents after unsubscribe = %d %+v", after.Code, after.Data)
+	}
+
+	followupIDs := func(query string) []uint {
+		list := performJSONRequest[testFollowupList](t, router, userToken, http.MethodGet, "/api/v1/followups"+query, nil)
+		if list.Code != 200 {
+			t.Fatalf("followups%s code = %d, msg = %s", query, list.Code, list.Msg)
+		}
+		ids := make([]uint, 0, len(list.Data.Items))
+		for _, item := range list.Data.Items {
+			ids = append(ids, item.MemberID)
+		}
+		return ids
+	}
+	if got := followupIDs(""); fmt.Sprint(got) != fmt.Sprint([]uint{texterID}) {
+		t.Fatalf("phone followups = %v, want only %d", got, texterID)
+	}
+	if got := followupIDs("?contactChannel=sms"); fmt.Sprint(got) != fmt.Sprint([]uint{callerID}) {
+		t.Fatalf("sms followups = %v, want only %d", got, callerID)
+	}
+
+	userInfo := performJSONRequest[authSession](t, router, userToken, http.MethodGet, "/api/user/info", nil)
+	if optedOut := performJSONRequest[followupTaskResponse](t, router, adminToken, http.MethodPost, "/api/v1/followup-tasks",
+		map[string]interface{}{"memberId": callerID, "assigneeId": userInfo.Data.UserID}); optedOut.Code != 409 {
+		t.Fatalf("task for opted-out member code = %d, want 409", optedOut.Code)
+	}
+	task := performJSONRequest[followupTaskResponse](t, router, adminToken, http.MethodPost, "/api/v1/followup-tasks",
+		map[string]interface{}{"memberId": texterID, "assigneeId": userInfo.Data.UserID})
+	if task.Code != 200 {
+		t.Fatalf("create task code = %d, msg = %s", task.Code, task.Msg)
+	}
+	if done := performJSONRequest[followupTaskResponse](t, router, userToken, http.MethodPost,
+		fmt.Sprintf("/api/v1/followup-tasks/%d/complete", task.Data.ID), map[string]string{"outcome": "opted_out"}); done.Code != 200 {
+		t.Fatalf("complete task code = %d, msg = %s", done.Code, done.Msg)
+	}
+	if got := followupIDs(""); len(got) != 0 {
+		t.Fatalf("phone followups after opted_out outcome = %v, want none", got)
+	}
+
+	if invalid := performJSONRequest[campaignResponse](t, router, superToken, http.MethodPost, "/api/v1/campaigns",
+		map[string]interface{}{"name": "Spring", "channel": "wechat", "discountPct": 10, "contactChannel": "email"}); invalid.Code != 400 {
+		t.Fatalf("campaign with unknown contact channel code = %d, want 400", invalid.Code)
+	}
+	campaign := performJSONRequest[campaignResponse](t, router, superToken, http.MethodPost, "/api/v1/campaigns",
+		map[string]interface{}{"name": "Spring", "channel": "wechat", "discountPct": 10})
+	if campaign.Code != 200 || campaign.Data.ContactChannel != "sms" {
+		t.Fatalf("create campaign = %d %+v, msg = %s", campaign.Code, campaign.Data, campaign.Msg)
+	}
+	audience := performJSONRequest[testSegmentMembers](t, router, userToken, http.MethodGet,
+		fmt.Sprintf("/api/v1/campaigns/%d/audience", campaign.Data.ID), nil)
+	if audience.Code != 200 || audience.Data.Total != 1 || audience.Data.Records[0].ID != callerID {
+		t.Fatalf("campaign audience = %d %+v", audience.Code, audience.Data)
+	}
+
+	// The newer opt-in of the target loses to the source's sms opt-out.
+	targetID := createMember("Tessa", "13800006603")
+	if optIn := performJSONRequest[consentResponse](t, router, adminToken, http.MethodPut,
+		fmt.Sprintf("/api/v1/members/%d/consents/sms", targetID), map[string]string{"status": "opted_in"}); optIn.Code != 200 {
+		t.Fatalf("sms opt-in code = %d, msg = %s", optIn.Code, optIn.Msg)
+	}
+	if merged := performJSONRequest[map[string]interface{}](t, router, superToken, http.MethodPost, "/api/v1/members/merge",
+		map[string]interface{}{"targetId": targetID, "sourceIds": []uint{texterID}}); merged.Code != 200 {
+		t.Fatalf("merge code = %d, msg = %s", merged.Code, merged.Msg)
+	}
+	mergedConsents := performJSONRequest[[]consentResponse](t, router, adminToken, http.MethodGet,
+		fmt.Sprintf("/api/v1/members/%d/consents", targetID), nil)
+	if mergedConsents.Code != 200 || mergedConsents.Data[0].Status != "opted_out" || mergedConsents.Data[2].Status != "opted_out" {
+		t.Fatalf("consents after merge = %d %+v", mergedConsents.Code, mergedConsents.Data)
+	}
+}
@@ -0,0 +1,552 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"small-merchant-ops-hub-server/internal/db"
+)
+
+const (
+	followupAssignMark = "followup:assign"
+	maxNoteLength      = 1000
+	maxTaskNoteLength  = 500
+)
+
+var (
+	errFollowupTaskOpen     = errors.New("member already has an open follow-up task")
+	errFollowupTaskNotOpen  = errors.New("follow-up task is not open")
+	errAssigneeNotAvailable = errors.New("assignee not found or disabled")
+	errMemberOptedOut       = errors.New("member opted out of phone contact")
+)
+
+type createMemberNoteRequest struct {
+	Content string `json:"content"`
+}
+
+type memberNoteResponse struct {
+	ID        uint      `json:"id"`
+	MemberID  uint      `json:"memberId"`
+	Content   string    `json:"content"`
+	Author    string    `json:"author"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// saveFollowupTaskRequest creates a task; on update MemberID is ignored.
+type saveFollowupTaskRequest struct {
+	MemberID   uint   `json:"memberId"`
+	AssigneeID uint   `json:"assigneeId"`
+	DueAt      string `json:"dueAt"`
+	Note       string `json:"note"`
+}
+
+type completeFollowupTaskRequest struct {
+	Outcome string `json:"outcome"`
+	Note    string `json:"note"`
+}
+
+type followupTaskResponse struct {
+	ID           uint       `json:"id"`
+	MemberID     uint       `json:"memberId"`
+	MemberName   string     `json:"memberName"`
+	Phone        string     `json:"phone"`
+	AssigneeID   uint       `json:"assigneeId"`
+	AssigneeName string     `json:"assigneeName"`
+	Status       string     `json:"status"`
+	DueAt        *time.Time `json:"dueAt"`
+	Overdue      bool       `json:"overdue"`
+	Note         string     `json:"note"`
+	Outcome      string     `json:"outcome"`
+	OutcomeNote  string     `json:"outcomeNote"`
+	CreatedBy    string     `json:"createdBy"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	CompletedAt  *time.Time `json:"completedAt"`
+	CompletedBy  string     `json:"completedBy"`
+}
+
+// followupTaskRow is a task with the member fields lists show next to it.
+type followupTaskRow struct {
+	db.FollowupTask
+	MemberName  string
+	MemberPhone string
+}
+
+func listMemberNotesHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		memberID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid member id")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		notes := make([]db.MemberNote, 0)
+		if err := database.WithContext(ctx).Where("member_id = ?", memberID).Order("id DESC").Find(&notes).Error; err != nil {
+			fail(c, 500, "list notes failed")
+			return
+		}
+		result := make([]memberNoteResponse, 0, len(notes))
+		for _, note := range notes {
+			result = append(result, toMemberNoteResponse(note))
+		}
+		ok(c, result)
+	}
+}
+
+func createMemberNoteHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		memberID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid member id")
+			return
+		}
+
+		var req createMemberNoteRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid note payload")
+			return
+		}
+		req.Content = strings.TrimSpace(req.Content)
+		if req.Content == "" {
+			fail(c, 400, "content is required")
+			return
+		}
+		if len([]rune(req.Content)) > maxNoteLength {
+			fail(c, 400, "content must be at most 1000 characters")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var member db.Member
+		if err := database.WithContext(ctx).First(&member, memberID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "member not found")
+				return
+			}
+			fail(c, 500, "query member failed")
+			return
+		}
+
+		note := db.MemberNote{MemberID: member.ID, Content: req.Content, Author: sessionFromContext(c).UserName}
+		if err := database.WithContext(ctx).Create(&note).Error; err != nil {
+			fail(c, 500, "create note failed")
+			return
+		}
+		ok(c, toMemberNoteResponse(note))
+	}
+}
+
+// listFollowupTasksHandler pages follow-up tasks, open ones first by due date.
+// mine=true narrows to tasks assigned to the caller.
+func listFollowupTasksHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		current := parseIntWithBounds(c.Query("current"), 1, 1, 1000)
+		size := parseIntWithBounds(c.Query("size"), 20, 1, 200)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		query := database.WithContext(ctx).
+			Table("followup_tasks AS t").
+			Joins("JOIN members AS m ON m.id = t.member_id")
+		if status := strings.TrimSpace(strings.ToLower(c.Query("status"))); status != "" {
+			if status != db.FollowupTaskOpen && status != db.FollowupTaskDone {
+				fail(c, 400, "status must be open or done")
+				return
+			}
+			query = query.Where("t.status = ?", status)
+		}
+		if c.Query("mine") == "true" {
+			query = query.Where("t.assignee_id = ?", sessionFromContext(c).UserID)
+		} else if raw := strings.TrimSpace(c.Query("assigneeId")); raw != "" {
+			assigneeID, err := strconv.ParseUint(raw, 10, 64)
+			if err != nil || assigneeID == 0 {
+				fail(c, 400, "invalid assigneeId")
+				return
+			}
+			query = query.Where("t.assignee_id = ?", assigneeID)
+		}
+		if raw := strings.TrimSpace(c.Query("memberId")); raw != "" {
+			memberID, err := strconv.ParseUint(raw, 10, 64)
+			if err != nil || memberID == 0 {
+				fail(c, 400, "invalid memberId")
+				return
+			}
+			query = query.Where("t.member_id = ?", memberID)
+		}
+
+		var total int64
+		if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+			fail(c, 500, "count follow-up tasks failed")
+			return
+		}
+
+		rows := make([]followupTaskRow, 0, size)
+		if err := query.
+			Select("t.*, m.name AS member_name, m.phone AS member_phone").
+			Order("CASE WHEN t.status = 'open' THEN 0 ELSE 1 END, t.due_at IS NULL, t.due_at ASC, t.id DESC").
+			Offset((current - 1) * size).
+			Limit(size).
+			Scan(&rows).Error; err != nil {
+			fail(c, 500, "list follow-up tasks failed")
+			return
+		}
+
+		pii := piiViewFor(c)
+		now := time.Now()
+		records := make([]followupTaskResponse, 0, len(rows))
+		for _, row := range rows {
+			records = append(records, toFollowupTaskResponse(row, pii, now))
+		}
+		ok(c, paginatedData{
+			Records: records,
+			Current: current,
+			Size:    size,
+			Total:   int(total),
+		})
+	}
+}
+
+// createFollowupTaskHandler assigns a member to a staff user. A member has at
+// most one open task; the check and the insert share a transaction.
+func createFollowupTaskHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req saveFollowupTaskRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid follow-up task payload")
+			return
+		}
+		if req.MemberID == 0 {
+			fail(c, 400, "memberId is required")
+			return
+		}
+		dueAt, msg := normalizeFollowupTaskRequest(&req)
+		if msg != "" {
+			fail(c, 400, msg)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var member db.Member
+		if err := database.WithContext(ctx).First(&member, req.MemberID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "member not found")
+				return
+			}
+			fail(c, 500, "query member failed")
+			return
+		}
+
+		task := db.FollowupTask{
+			MemberID:   member.ID,
+			AssigneeID: req.AssigneeID,
+			Status:     db.FollowupTaskOpen,
+			DueAt:      dueAt,
+			Note:       req.Note,
+			CreatedBy:  sessionFromContext(c).UserName,
+		}
+		err := database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			assignee, err := findAssignee(tx, req.AssigneeID)
+			if err != nil {
+				return err
+			}
+			task.AssigneeName = assignee.UserName
+
+			var open int64
+			if err := tx.Model(&db.FollowupTask{}).
+				Where("member_id = ? AND status = ?", member.ID, db.FollowupTaskOpen).
+				Count(&open).Error; err != nil {
+				return err
+			}
+			if open > 0 {
+				return errFollowupTaskOpen
+			}
+			var optedOut int64
+			if err := tx.Model(&db.MemberConsent{}).
+				Where("member_id = ? AND channel = ? AND status = ?", member.ID, db.ConsentChannelPhone, db.ConsentOptedOut).
+				Count(&optedOut).Error; err != nil {
+				return err
+			}
+			if optedOut > 0 {
+				return errMemberOptedOut
+			}
+			return tx.Create(&task).Error
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, errAssigneeNotAvailable):
+				fail(c, 400, err.Error())
+			case errors.Is(err, errFollowupTaskOpen), errors.Is(err, errMemberOptedOut):
+				fail(c, 409, err.Error())
+			default:
+				fail(c, 500, "create follow-up task failed")
+			}
+			return
+		}
+
+		ok(c, toFollowupTaskResponse(followupTaskRow{FollowupTask: task, MemberName: member.Name, MemberPhone: member.Phone}, piiViewFor(c), time.Now()))
+	}
+}
+
+// updateFollowupTaskHandler reassigns an open task or moves its due date.
+func updateFollowupTaskHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		taskID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid follow-up task id")
+			return
+		}
+
+		var req saveFollowupTaskRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid follow-up task payload")
+			return
+		}
+		dueAt, msg := normalizeFollowupTaskRequest(&req)
+		if msg != "" {
+			fail(c, 400, msg)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var task db.FollowupTask
+		if err := database.WithContext(ctx).First(&task, taskID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "follow-up task not found")
+				return
+			}
+			fail(c, 500, "query follow-up task failed")
+			return
+		}
+
+		err := database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			assignee, err := findAssignee(tx, req.AssigneeID)
+			if err != nil {
+				return err
+			}
+			result := tx.Model(&db.FollowupTask{}).
+				Where("id = ? AND status = ?", task.ID, db.FollowupTaskOpen).
+				Updates(map[string]interface{}{
+					"assignee_id":   assignee.ID,
+					"assignee_name": assignee.UserName,
+					"due_at":        dueAt,
+					"note":          req.Note,
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errFollowupTaskNotOpen
+			}
+			task.AssigneeID = assignee.ID
+			task.AssigneeName = assignee.UserName
+			task.DueAt = dueAt
+			task.Note = req.Note
+			return nil
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, errAssigneeNotAvailable):
+				fail(c, 400, err.Error())
+			case errors.Is(err, errFollowupTaskNotOpen):
+				fail(c, 409, err.Error())
+			default:
+				fail(c, 500, "update follow-up task failed")
+			}
+			return
+		}
+
+		row, err := loadFollowupTaskRow(ctx, database, task.ID)
+		if err != nil {
+			fail(c, 500, "query follow-up task failed")
+			return
+		}
+		ok(c, toFollowupTaskResponse(row, piiViewFor(c), time.Now()))
+	}
+}
+
+// completeFollowupTaskHandler records the outcome of an open task. Only its
+// assignee, or someone who may assign tasks, can complete it. An opted_out
+// outcome also opts the member out of phone contact.
+func completeFollowupTaskHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		taskID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid follow-up task id")
+			return
+		}
+
+		var req completeFollowupTaskRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid follow-up outcome payload")
+			return
+		}
+		req.Outcome = strings.TrimSpace(strings.ToLower(req.Outcome))
+		req.Note = strings.TrimSpace(req.Note)
+		if !isSupportedFollowupOutcome(req.Outcome) {
+			fail(c, 400, "outcome must be reached, no_answer, purchased or opted_out")
+			return
+		}
+		if len([]rune(req.Note)) > maxTaskNoteLength {
+			fail(c, 400, "note must be at most 500 characters")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var task db.FollowupTask
+		if err := database.WithContext(ctx).First(&task, taskID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "follow-up task not found")
+				return
+			}
+			fail(c, 500, "query follow-up task failed")
+			return
+		}
+		session := sessionFromContext(c)
+		if int(task.AssigneeID) != session.UserID && !hasButton(session.Buttons, followupAssignMark) {
+			fail(c, 403, "forbidden")
+			return
+		}
+
+		now := time.Now()
+		err := database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&db.FollowupTask{}).
+				Where("id = ? AND status = ?", task.ID, db.FollowupTaskOpen).
+				Updates(map[string]interface{}{
+					"status":       db.FollowupTaskDone,
+					"outcome":      req.Outcome,
+					"outcome_note": req.Note,
+					"completed_at": now,
+					"completed_by": session.UserName,
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errFollowupTaskNotOpen
+			}
+			if req.Outcome != db.FollowupOutcomeOptedOut {
+				return nil
+			}
+			_, err := recordConsent(tx, db.MemberConsent{
+				MemberID:  task.MemberID,
+				Channel:   db.ConsentChannelPhone,
+				Status:    db.ConsentOptedOut,
+				Source:    consentSourceFollowup,
+				UpdatedBy: session.UserName,
+			})
+			return err
+		})
+		if err != nil {
+			if errors.Is(err, errFollowupTaskNotOpen) {
+				fail(c, 409, err.Error())
+				return
+			}
+			fail(c, 500, "complete follow-up task failed")
+			return
+		}
+
+		row, err := loadFollowupTaskRow(ctx, database, task.ID)
+		if err != nil {
+			fail(c, 500, "query follow-up task failed")
+			return
+		}
+		ok(c, toFollowupTaskResponse(row, piiViewFor(c), now))
+	}
+}
+
+// findAssignee loads an enabled user that tasks can be assigned to.
+func findAssignee(tx *gorm.DB, userID uint) (db.User, error) {
+	var user db.User
+	if err := tx.Where("id = ? AND status = ?", userID, db.UserStatusEnabled).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return db.User{}, errAssigneeNotAvailable
+		}
+		return db.User{}, err
+	}
+	return user, nil
+}
+
+func loadFollowupTaskRow(ctx context.Context, database *gorm.DB, taskID uint) (followupTaskRow, error) {
+	var row followupTaskRow
+	err := database.WithContext(ctx).
+		Table("followup_tasks AS t").
+		Select("t.*, m.name AS member_name, m.phone AS member_phone").
+		Joins("JOIN members AS m ON m.id = t.member_id").
+		Where("t.id = ?", taskID).
+		Take(&row).Error
+	return row, err
+}
+
+// normalizeFollowupTaskRequest trims req and parses its due date, returning a
+// validation message, or "" when the payload is usable.
+func normalizeFollowupTaskRequest(req *saveFollowupTaskRequest) (*time.Time, string) {
+	req.Note = strings.TrimSpace(req.Note)
+	if req.AssigneeID == 0 {
+		return nil, "assigneeId is required"
+	}
+	if len([]rune(req.Note)) > maxTaskNoteLength {
+		return nil, "note must be at most 500 characters"
+	}
+	dueAt, err := parseOptionalRFC3339(req.DueAt)
+	if err != nil {
+		return nil, "dueAt must be RFC3339 format"
+	}
+	return dueAt, ""
+}
+
+func isSupportedFollowupOutcome(outcome string) bool {
+	switch outcome {
+	case db.FollowupOutcomeReached, db.FollowupOutcomeNoAnswer, db.FollowupOutcomePurchased, db.FollowupOutcomeOptedOut:
+		return true
+	default:
+		return false
+	}
+}
+
+func toMemberNoteResponse(note db.MemberNote) memberNoteResponse {
+	return memberNoteResponse{
+		ID:        note.ID,
+		MemberID:  note.MemberID,
+		Content:   note.Content,
+		Author:    note.Author,
+		CreatedAt: note.CreatedAt,
+	}
+}
+
+func toFollowupTaskResponse(row followupTaskRow, pii piiView, now time.Time) followupTaskResponse {
+	task := row.FollowupTask
+	return followupTaskResponse{
+		ID:           task.ID,
+		MemberID:     task.MemberID,
+		MemberName:   row.MemberName,
+		Phone:        pii.Phone(row.MemberPhone),
+		AssigneeID:   task.AssigneeID,
+		AssigneeName: task.AssigneeName,
+		Status:       task.Status,
+		DueAt:        task.DueAt,
+		Overdue:      task.Status == db.FollowupTaskOpen && task.DueAt != nil && task.DueAt.Before(now),
+		Note:         task.Note,
+		Outcome:      task.Outcome,
+		OutcomeNote:  task.OutcomeNote,
+		CreatedBy:    task.CreatedBy,
+		CreatedAt:    task.CreatedAt,
+		CompletedAt:  task.CompletedAt,
+		CompletedBy:  task.CompletedBy,
+	}
+}
@@ -0,0 +1,154 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+type testFollowupList struct {
+	Items []struct {
+		MemberID   uint  `json:"memberId"`
+		OpenTaskID *uint `json:"openTaskId"`
+	} `json:"items"`
+}
+
+func TestFollowupTasksAndNotes(t *testing.T) {
+	t.Parallel()
+
+	router := newTestRouter(t)
+	superToken := loginForTest(t, router, "Super")
+	adminToken := loginForTest(t, router, "Admin")
+	userToken := loginForTest(t, router, "User")
+
+	userInfo := performJSONRequest[authSession](t, router, userToken, http.MethodGet, "/api/user/info", nil)
+	adminInfo := performJSONRequest[authSession](t, router, adminToken, http.MethodGet, "/api/user/info", nil)
+	if userInfo.Code != 200 || adminInfo.Code != 200 {
+		t.Fatalf("user info codes = %d/%d", userInfo.Code, adminInfo.Code)
+	}
+
+	createMember := func(name, phone string) uint {
+		member := performJSONRequest[testMember](t, router, superToken, http.MethodPost, "/api/v1/members", map[string]interface{}{
+			"name":    name,
+			"phone":   phone,
+			"channel": "wechat",
+		})
+		if member.Code != 200 {
+			t.Fatalf("create member code = %d, msg = %s", member.Code, member.Msg)
+		}
+		if order := performJSONRequest[testOrder](t, router, superToken, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+			"memberId":    member.Data.ID,
+			"amountCents": 1200,
+			"source":      "wechat",
+		}); order.Code != 200 {
+			t.Fatalf("create order code = %d, msg = %s", order.Code, order.Msg)
+		}
+		return member.Data.ID
+	}
+	amyID := createMember("Amy", "13800008801")
+	benID := createMember("Ben", "13800008802")
+
+	if denied := performJSONRequest[followupTaskResponse](t, router, userToken, http.MethodPost, "/api/v1/followup-tasks",
+		map[string]interface{}{"memberId": amyID, "assigneeId": userInfo.Data.UserID}); denied.Code != 403 {
+		t.Fatalf("user assign task code = %d, want 403", denied.Code)
+	}
+	if unknown := performJSONRequest[followupTaskResponse](t, router, adminToken, http.MethodPost, "/api/v1/followup-tasks",
+		map[string]interface{}{"memberId": amyID, "assigneeId": 9999}); unknown.Code != 400 {
+		t.Fatalf("unknown assignee code = %d, want 400", unknown.Code)
+	}
+	task := performJSONRequest[followupTaskResponse](t, router, adminToken, http.MethodPost, "/api/v1/followup-tasks", map[string]interface{}{
+		"memberId":   amyID,
+		"assigneeId": userInfo.Data.UserID,
+		"dueAt":      "2020-01-01T10:00:00Z",
+		"note":       "ask about the spring menu",
+	})
+	if task.Code != 200 || task.Data.Status != "open" || task.Data.AssigneeName != "User" || !task.Data.Overdue {
+		t.Fatalf("create task = %d %+v, msg = %s", task.Code, task.Data, task.Msg)
+	}
+	if duplicate := performJSONRequest[followupTaskResponse](t, router, adminToken, http.MethodPost, "/api/v1/followup-tasks",
+		map[string]interface{}{"memberId": amyID, "assigneeId": adminInfo.Data.UserID}); duplicate.Code != 409 {
+		t.Fatalf("second open task code = %d, want 409", duplicate.Code)
+	}
+	benTask := performJSONRequest[followupTaskResponse](t, router, adminToken, http.MethodPost, "/api/v1/followup-tasks",
+		map[string]interface{}{"memberId": benID, "assigneeId": adminInfo.Data.UserID})
+	if benTask.Code != 200 {
+		t.Fatalf("create ben task code = %d, msg = %s", benTask.Code, benTask.Msg)
+	}
+
+	all := performJSONRequest[testFollowupList](t, router, userToken, http.MethodGet, "/api/v1/followups", nil)
+	if all.Code != 200 || len(all.Data.Items) != 2 {
+		t.Fatalf("followups = %d %+v", all.Code, all.Data)
+	}
+	for _, item := range all.Data.Items {
+		if item.OpenTaskID == nil {
+			t.Fatalf("followup %d has no openTaskId", item.MemberID)
+		}
+	}
+
+	mine := performJSONRequest[struct {
+		Records []followupTaskResponse `json:"records"`
+		Total   int                    `json:"total"`
+	}](t, router, userToken, http.MethodGet, "/api/v1/followup-tasks?mine=true", nil)
+	if mine.Code != 200 || mine.Data.Total != 1 || mine.Data.Records[0].MemberID != amyID || mine.Data.Records[0].Phone != "+86138****8801" {
+		t.Fatalf("my tasks = %d %+v", mine.Code, mine.Data)
+	}
+
+	completePath := fmt.Sprintf("/api/v1/followup-tasks/%d/complete", task.Data.ID)
+	if invalid := performJSONRequest[followupTaskResponse](t, router, userToken, http.MethodPost, completePath,
+		map[string]string{"outcome": "maybe"}); invalid.Code != 400 {
+		t.Fatalf("invalid outcome code = %d, want 400", invalid.Code)
+	}
+	if notMine := performJSONRequest[followupTaskResponse](t, router, userToken, http.MethodPost,
+		fmt.Sprintf("/api/v1/followup-tasks/%d/complete", benTask.Data.ID), map[string]string{"outcome": "reached"}); notMine.Code != 403 {
+		t.Fatalf("complete someone else's task code = %d, want 403", notMine.Code)
+	}
+	done := performJSONRequest[followupTaskResponse](t, router, userToken, http.MethodPost, completePath,
+		map[string]string{"outcome": "purchased", "note": "ordered two boxes"})
+	if done.Code != 200 || done.Data.Status != "done" || done.Data.Outcome != "purchased" || done.Data.CompletedBy != "User" || done.Data.Overdue {
+		t.Fatalf("complete task = %d %+v, msg = %s", done.Code, done.Data, done.Msg)
+	}
+	if again := performJSONRequest[followupTaskResponse](t, router, userToken, http.MethodPost, completePath,
+		map[string]string{"outcome": "reached"}); again.Code != 409 {
+		t.Fatalf("complete twice code = %d, want 409", again.Code)
+	}
+	if reassign := performJSONRequest[followupTaskResponse](t, router, adminToken, http.MethodPut,
+		fmt.Sprintf("/api/v1/followup-tasks/%d", task.Data.ID), map[string]interface{}{"assigneeId": adminInfo.Data.UserID}); reassign.Code != 409 {
+		t.Fatalf("reassign done task code = %d, want 409", reassign.Code)
+	}
+
+	// Amy was just reached and Ben has an open task, so both drop out; with
+	// no cooldown only Ben's open task keeps him out.
+	excluded := performJSONRequest[testFollowupList](t, router, userToken, http.MethodGet, "/api/v1/followups?excludeTasked=true", nil)
+	if excluded.Code != 200 || len(excluded.Data.Items) != 0 {
+		t.Fatalf("followups excluding tasked = %d %+v", excluded.Code, excluded.Data)
+	}
+	noCooldown := performJSONRequest[testFollowupList](t, router, userToken, http.MethodGet,
+		"/api/v1/followups?excludeTasked=true&taskCooldownDays=0", nil)
+	if noCooldown.Code != 200 || len(noCooldown.Data.Items) != 1 || noCooldown.Data.Items[0].MemberID != amyID {
+		t.Fatalf("followups without cooldown = %d %+v", noCooldown.Code, noCooldown.Data)
+	}
+
+	notesPath := fmt.Sprintf("/api/v1/members/%d/notes", amyID)
+	if empty := performJSONRequest[memberNoteResponse](t, router, userToken, http.MethodPost, notesPath,
+		map[string]string{"content": "  "}); empty.Code != 400 {
+		t.Fatalf("empty note code = %d, want 400", empty.Code)
+	}
+	note := performJSONRequest[memberNoteResponse](t, router, userToken, http.MethodPost, notesPath,
+		map[string]string{"content": "prefers calls after 6pm"})
+	if note.Code != 200 || note.Data.Author != "User" {
+		t.Fatalf("create note = %d %+v, msg = %s", note.Code, note.Data, note.Msg)
+	}
+	notes := performJSONRequest[[]memberNoteResponse](t, router, adminToken, http.MethodGet, notesPath, nil)
+	if notes.Code != 200 || len(notes.Data) != 1 || notes.Data[0].Content != "prefers calls after 6pm" {
+		t.Fatalf("list notes = %d %+v", notes.Code, notes.Data)
+	}
+
+	detail := performJSONRequest[testMemberDetail](t, router, adminToken, http.MethodGet, fmt.Sprintf("/api/v1/members/%d", amyID), nil)
+	types := make(map[string]bool)
+	for _, event := range detail.Data.Timeline.Items {
+		types[event.Type] = true
+	}
+	if detail.Code != 200 || !types["note"] || !types["followup_task"] {
+		t.Fatalf("timeline types = %v, want note and followup_task", types)
+	}
+}
@@ -0,0 +1,160 @@
+package http
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	stdhttp "net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"small-merchant-ops-hub-server/internal/cache"
+)
+
+const (
+	idempotencyHeader    = "Idempotency-Key"
+	idempotencyKeyPrefix = "idempotency:"
+	maxIdempotencyKeyLen = 128
+	// maxIdempotencyBodyBytes bounds the body buffered for the fingerprint.
+	// It matches the member import's own cap so a keyed import still fits.
+	maxIdempotencyBodyBytes = maxMemberImportBytes + (1 << 20)
+)
+
+var (
+	// idempotencyTTL is how long a completed response is replayed for its key.
+	idempotencyTTL = 24 * time.Hour
+	// idempotencyPendingTTL bounds how long a crashed request can hold its key.
+	idempotencyPendingTTL = time.Minute
+)
+
+// idempotencyRecord is stored per user and key. Response is empty while the
+// first request is still running.
+type idempotencyRecord struct {
+	Fingerprint string          `json:"fingerprint"`
+	Response    json.RawMessage `json:"response,omitempty"`
+}
+
+// idempotencyWriter keeps a copy of the response body so it can be replayed.
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyWriter) WriteString(data string) (int, error) {
+	w.body.WriteString(data)
+	return w.ResponseWriter.WriteString(data)
+}
+
+// requireIdempotency makes create requests carrying an Idempotency-Key safe
+// to retry. The first request reserves the key with SetIfAbsent; a successful
+// apiResponse is then kept for idempotencyTTL and replayed to retries with the
+// same method, path and body. Reusing a key for another payload is rejected,
+// and failed requests release the key so a corrected retry can proceed.
+// It must run after requireRouteAccess because keys are scoped per user.
+func requireIdempotency(cacheStore cache.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimSpace(c.GetHeader(idempotencyHeader))
+		if key == "" || c.Request.Method != "POST" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			fail(c, 400, "Idempotency-Key must be at most 128 characters")
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(stdhttp.MaxBytesReader(c.Writer, c.Request.Body, maxIdempotencyBodyBytes))
+		if err != nil {
+			var tooLarge *stdhttp.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				fail(c, 413, fmt.Sprintf("request body must be at most %d MB", maxIdempotencyBodyBytes>>20))
+				c.Abort()
+				return
+			}
+			fail(c, 400, "read request body failed")
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		ctx := c.Request.Context()
+		cacheKey := idempotencyKeyPrefix + strconv.Itoa(sessionFromContext(c).UserID) + ":" + key
+		fingerprint := idempotencyFingerprint(c.Request.Method, c.Request.URL.Path, body)
+
+		pending, _ := json.Marshal(idempotencyRecord{Fingerprint: fingerprint})
+		reserved, err := cacheStore.SetIfAbsent(ctx, cacheKey, string(pending), idempotencyPendingTTL)
+		if err != nil {
+			fail(c, 500, "idempotency check failed")
+			c.Abort()
+			return
+		}
+		if !reserved {
+			replayIdempotentResponse(c, cacheStore, cacheKey, fingerprint)
+			c.Abort()
+			return
+		}
+
+		writer := &idempotencyWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		var envelope struct {
+			Code int `json:"code"`
+		}
+		if writer.Status() != 200 || json.Unmarshal(writer.body.Bytes(), &envelope) != nil || envelope.Code != 200 {
+			_ = cacheStore.Delete(ctx, cacheKey)
+			return
+		}
+		done, err := json.Marshal(idempotencyRecord{
+			Fingerprint: fingerprint,
+			Response:    writer.body.Bytes(),
+		})
+		if err != nil {
+			_ = cacheStore.Delete(ctx, cacheKey)
+			return
+		}
+		_ = cacheStore.Set(ctx, cacheKey, string(done), idempotencyTTL)
+	}
+}
+
+func replayIdempotentResponse(c *gin.Context, cacheStore cache.Store, cacheKey, fingerprint string) {
+	raw, found, err := cacheStore.Get(c.Request.Context(), cacheKey)
+	if err != nil {
+		fail(c, 500, "idempotency check failed")
+		return
+	}
+	var record idempotencyRecord
+	if !found || json.Unmarshal([]byte(raw), &record) != nil {
+		fail(c, 409, "Idempotency-Key state changed, please retry")
+		return
+	}
+	if record.Fingerprint != fingerprint {
+		fail(c, 422, "Idempotency-Key was already used with a different payload")
+		return
+	}
+	if len(record.Response) == 0 {
+		fail(c, 409, "a request with this Idempotency-Key is still in progress")
+		return
+	}
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(200, "application/json; charset=utf-8", record.Response)
+}
+
+func idempotencyFingerprint(method, path string, body []byte) string {
+	sum := sha256.New()
+	sum.Write([]byte(method + " " + path + "\n"))
+	sum.Write(body)
+	return hex.EncodeToString(sum.Sum(nil))
+}
@@ -0,0 +1,144 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"small-merchant-ops-hub-server/internal/db"
+)
+
+func TestCreateHandlersHonourIdempotencyKey(t *testing.T) {
+	t.Parallel()
+
+	router, database := newTestRouterWithDB(t)
+	token := loginForTest(t, router, "Super")
+	headers := func(key string) map[string]string {
+		return map[string]string{
+			"Authorization":   "Bearer " + token,
+			"Idempotency-Key": key,
+		}
+	}
+
+	memberPayload := map[string]interface{}{
+		"name":    "Jack",
+		"phone":   "13800009999",
+		"channel": "wechat",
+	}
+	member := performJSONRequestWithHeaders[testMember](t, router, http.MethodPost, "/api/v1/members", memberPayload, headers("member-1"))
+	if member.Code != 200 {
+		t.Fatalf("create member code = %d, msg = %s", member.Code, member.Msg)
+	}
+	replayedMember := performJSONRequestWithHeaders[testMember](t, router, http.MethodPost, "/api/v1/members", memberPayload, headers("member-1"))
+	if replayedMember.Code != 200 || replayedMember.Data.ID != member.Data.ID {
+		t.Fatalf("replayed member = %d %+v, want original id %d", replayedMember.Code, replayedMember.Data, member.Data.ID)
+	}
+
+	orderPayload := map[string]interface{}{
+		"memberId":    member.Data.ID,
+		"amountCents": int64(1800),
+		"source":      "miniapp",
+	}
+	first := performJSONRequestWithHeaders[testOrder](t, router, http.MethodPost, "/api/v1/orders", orderPayload, headers("order-1"))
+	if first.Code != 200 {
+		t.Fatalf("create order code = %d, msg = %s", first.Code, first.Msg)
+	}
+	retry := performJSONRequestWithHeaders[testOrder](t, router, http.MethodPost, "/api/v1/orders", orderPayload, headers("order-1"))
+	if retry.Code != 200 || retry.Data.ID != first.Data.ID {
+		t.Fatalf("retried order = %d %+v, want original id %d", retry.Code, retry.Data, first.Data.ID)
+	}
+
+	var orderCount int64
+	if err := database.Table("orders").Count(&orderCount).Error; err != nil {
+		t.Fatalf("count orders: %v", err)
+	}
+	if orderCount != 1 {
+		t.Fatalf("orders = %d, want 1 after retry", orderCount)
+	}
+
+	orderPayload["amountCents"] = int64(2000)
+	reused := performJSONRequestWithHeaders[testOrder](t, router, http.MethodPost, "/api/v1/orders", orderPayload, headers("order-1"))
+	if reused.Code != 422 {
+		t.Fatalf("reused key with other payload code = %d, want 422", reused.Code)
+	}
+	otherRoute := performJSONRequestWithHeaders[testMember](t, router, http.MethodPost, "/api/v1/members", memberPayload, headers("order-1"))
+	if otherRoute.Code != 422 {
+		t.Fatalf("reused key on other route code = %d, want 422", otherRoute.Code)
+	}
+
+	// A rejected request releases its key so the corrected payload can use it.
+	invalid := performJSONRequestWithHeaders[testOrder](t, router, http.MethodPost, "/api/v1/orders",
+		map[string]interface{}{"memberId": member.Data.ID, "source": "miniapp"}, headers("order-2"))
+	if invalid.Code != 400 {
+		t.Fatalf("invalid order code = %d, want 400", invalid.Code)
+	}
+	corrected := performJSONRequestWithHeaders[testOrder](t, router, http.MethodPost, "/api/v1/orders", orderPayload, headers("order-2"))
+	if corrected.Code != 200 || corrected.Data.ID == first.Data.ID {
+		t.Fatalf("corrected order = %d %+v, want a new order", corrected.Code, corrected.Data)
+	}
+
+	// Keys are scoped per user.
+	adminToken := loginForTest(t, router, "Admin")
+	adminOrder := performJSONRequestWithHeaders[testOrder](t, router, http.MethodPost, "/api/v1/orders", orderPayload, map[string]string{
+		"Authorization":   "Bearer " + adminToken,
+		"Idempotency-Key": "order-2",
+	})
+	if adminOrder.Code != 200 || adminOrder.Data.ID == corrected.Data.ID {
+		t.Fatalf("admin order with same key = %d %+v, want a new order", adminOrder.Code, adminOrder.Data)
+	}
+
+	withoutKey := performJSONRequest[testOrder](t, router, token, http.MethodPost, "/api/v1/orders", orderPayload)
+	again := performJSONRequest[testOrder](t, router, token, http.MethodPost, "/api/v1/orders", orderPayload)
+	if withoutKey.Data.ID == again.Data.ID {
+		t.Fatalf("requests without a key should not be deduplicated")
+	}
+
+	oversized := performJSONRequestWithHeaders[testMember](t, router, http.MethodPost, "/api/v1/members", map[string]interface{}{
+		"name":    strings.Repeat("x", maxIdempotencyBodyBytes),
+		"phone":   "13800009998",
+		"channel": "wechat",
+	}, headers("member-huge"))
+	if oversized.Code != 413 {
+		t.Fatalf("oversized keyed body code = %d, want 413", oversized.Code)
+	}
+}
+
+func TestPhoneRevealIgnoresIdempotencyKey(t *testing.T) {
+	t.Parallel()
+
+	router, database := newTestRouterWithDB(t)
+	token := loginForTest(t, router, "Super")
+	headers := map[string]string{
+		"Authorization":   "Bearer " + token,
+		"Idempotency-Key": "reveal-1",
+	}
+
+	member := performJSONRequest[testMember](t, router, token, http.MethodPost, "/api/v1/members", map[string]interface{}{
+		"name":    "Kate",
+		"phone":   "13800009997",
+		"channel": "wechat",
+	})
+	if member.Code != 200 {
+		t.Fatalf("create member code = %d, msg = %s", member.Code, member.Msg)
+	}
+
+	// Every reveal must leave an access log row, so a retried key runs the
+	// handler again instead of replaying the phone.
+	revealPath := "/api/v1/members/" + strconv.FormatUint(uint64(member.Data.ID), 10) + "/phone/reveal"
+	for i := 0; i < 2; i++ {
+		revealed := performJSONRequestWithHeaders[map[string]interface{}](t, router, http.MethodPost, revealPath,
+			map[string]string{"reason": "customer called"}, headers)
+		if revealed.Code != 200 {
+			t.Fatalf("reveal %d code = %d, msg = %s", i+1, revealed.Code, revealed.Msg)
+		}
+	}
+
+	var logged int64
+	if err := database.Model(&db.PIIAccessLog{}).Where("member_id = ?", member.Data.ID).Count(&logged).Error; err != nil {
+		t.Fatalf("count access logs: %v", err)
+	}
+	if logged != 2 {
+		t.Fatalf("access logs = %d, want one per reveal", logged)
+	}
+}
@@ -0,0 +1,507 @@
+package http
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"small-merchant-ops-hub-server/internal/db"
+)
+
+const (
+	memberRecentOrderLimit = 5
+
+	timelineMemberCreated = "member_created"
+	timelineOrderCreated  = "order_created"
+	timelineOrderStatus   = "order_status"
+	timelineRefund        = "refund"
+	timelineTagAdded      = "tag_added"
+	timelinePoints        = "points"
+	timelineTierChange    = "tier_change"
+	timelineNote          = "note"
+	timelineFollowupTask  = "followup_task"
+)
+
+var errInvalidTimelineCursor = errors.New("invalid cursor")
+
+type memberStatsResponse struct {
+	PaidOrderCount    int64      `json:"paidOrderCount"`
+	RevenueCents      int64      `json:"revenueCents"`
+	RefundedCents     int64      `json:"refundedCents"`
+	AverageOrderCents int64      `json:"averageOrderCents"`
+	FirstPaidAt       *time.Time `json:"firstPaidAt"`
+	LastPaidAt        *time.Time `json:"lastPaidAt"`
+}
+
+// memberCampaignExposure is a campaign that reached the member through an
+// order, either tagged with it or paid on its channel inside its window.
+type memberCampaignExposure struct {
+	CampaignID   uint       `json:"campaignId"`
+	Name         string     `json:"name"`
+	Channel      string     `json:"channel"`
+	OrderCount   int64      `json:"orderCount"`
+	FirstTouchAt *time.Time `json:"firstTouchAt"`
+}
+
+// memberTimelineEvent is one entry of the member timeline. Data holds the
+// payload of its Type, e.g. an orderResponse for order_created.
+type memberTimelineEvent struct {
+	Type string      `json:"type"`
+	ID   uint        `json:"id"`
+	At   time.Time   `json:"at"`
+	Data interface{} `json:"data"`
+}
+
+type memberTimelinePage struct {
+	Items      []memberTimelineEvent `json:"items"`
+	NextCursor string                `json:"nextCursor"`
+}
+
+type memberDetailResponse struct {
+	Member       memberResponse           `json:"member"`
+	Stats        memberStatsResponse      `json:"stats"`
+	RecentOrders []orderResponse          `json:"recentOrders"`
+	Campaigns    []memberCampaignExposure `json:"campaigns"`
+	Timeline     memberTimelinePage       `json:"timeline"`
+}
+
+type orderStatusEvent struct {
+	OrderID    uint   `json:"orderId"`
+	OrderNo    string `json:"orderNo"`
+	FromStatus string `json:"fromStatus"`
+	ToStatus   string `json:"toStatus"`
+	Note       string `json:"note"`
+	ChangedBy  string `json:"changedBy"`
+}
+
+type refundEvent struct {
+	refundResponse
+	OrderNo string `json:"orderNo"`
+}
+
+// timelineCursor is the (At, Type, ID) key of the last event of a page. Events
+// are ordered by that key, so each source only needs rows strictly after it.
+type timelineCursor struct {
+	At   time.Time
+	Type string
+	ID   uint
+}
+
+func (cur timelineCursor) encode() string {
+	raw := fmt.Sprintf("%d|%s|%d", cur.At.UnixNano(), cur.Type, cur.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func parseTimelineCursor(raw string) (*timelineCursor, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, errInvalidTimelineCursor
+	}
+	parts := strings.Split(string(decoded), "|")
+	if len(parts) != 3 {
+		return nil, errInvalidTimelineCursor
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, errInvalidTimelineCursor
+	}
+	id, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		return nil, errInvalidTimelineCursor
+	}
+	return &timelineCursor{At: time.Unix(0, nanos), Type: parts[1], ID: uint(id)}, nil
+}
+
+// after reports whether the event key (at, eventType, id) sorts after cur.
+func (cur *timelineCursor) after(at time.Time, eventType string, id uint) bool {
+	if cur == nil {
+		return true
+	}
+	return timelineLess(cur.At, cur.Type, cur.ID, at, eventType, id)
+}
+
+// where restricts one event source, whose rows all have eventType, to keys
+// after cur.
+func (cur *timelineCursor) where(query *gorm.DB, eventType, atColumn, idColumn string) *gorm.DB {
+	if cur == nil {
+		return query
+	}
+	switch {
+	case eventType < cur.Type:
+		return query.Where(atColumn+" > ?", cur.At)
+	case eventType > cur.Type:
+		return query.Where(atColumn+" >= ?", cur.At)
+	default:
+		return query.Where(atColumn+" > ? OR ("+atColumn+" = ? AND "+idColumn+" > ?)", cur.At, cur.At, cur.ID)
+	}
+}
+
+func timelineLess(leftAt time.Time, leftType string, leftID uint, rightAt time.Time, rightType string, rightID uint) bool {
+	if !leftAt.Equal(rightAt) {
+		return leftAt.Before(rightAt)
+	}
+	if leftType != rightType {
+		return leftType < rightType
+	}
+	return leftID < rightID
+}
+
+// memberDetailHandler returns everything known about one member: profile,
+// lifetime stats, recent orders, campaign exposures and a chronological
+// timeline paged with ?cursor=&limit=. Soft-deleted members stay viewable.
+func memberDetailHandler(database *gorm.DB, dialect db.Dialect) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		memberID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid member id")
+			return
+		}
+		cursor, err := parseTimelineCursor(c.Query("cursor"))
+		if err != nil {
+			fail(c, 400, err.Error())
+			return
+		}
+		limit := parseIntWithBounds(c.Query("limit"), 20, 1, 100)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		var member db.Member
+		if err := database.WithContext(ctx).Unscoped().Preload("Tags").First(&member, memberID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "member not found")
+				return
+			}
+			fail(c, 500, "query member failed")
+			return
+		}
+
+		stats, err := loadMemberStats(ctx, database, dialect, member.ID)
+		if err != nil {
+			fail(c, 500, "query member stats failed")
+			return
+		}
+
+		orders := make([]db.Order, 0, memberRecentOrderLimit)
+		if err := database.WithContext(ctx).
+			Preload("Items").
+			Where("member_id = ?", member.ID).
+			Order("created_at DESC, id DESC").
+			Limit(memberRecentOrderLimit).
+			Find(&orders).Error; err != nil {
+			fail(c, 500, "query member orders failed")
+			return
+		}
+		recentOrders := make([]orderResponse, 0, len(orders))
+		for _, order := range orders {
+			recentOrders = append(recentOrders, toOrderResponse(order, member.Name))
+		}
+
+		campaigns, err := loadMemberCampaignExposures(ctx, database, dialect, member.ID)
+		if err != nil {
+			fail(c, 500, "query member campaigns failed")
+			return
+		}
+
+		pii := piiViewFor(c)
+		timeline, err := loadMemberTimeline(ctx, database, member, pii, cursor, limit)
+		if err != nil {
+			fail(c, 500, "query member timeline failed")
+			return
+		}
+
+		ok(c, memberDetailResponse{
+			Member:       toMemberResponse(member, pii),
+			Stats:        stats,
+			RecentOrders: recentOrders,
+			Campaigns:    campaigns,
+			Timeline:     timeline,
+		})
+	}
+}
+
+func loadMemberStats(ctx context.Context, database *gorm.DB, dialect db.Dialect, memberID uint) (memberStatsResponse, error) {
+	var row struct {
+		PaidOrderCount int64
+		RevenueCents   int64
+		FirstPaidUnix  int64
+		LastPaidUnix   int64
+	}
+	if err := database.WithContext(ctx).
+		Model(&db.Order{}).
+		Select(
+			"COUNT(*) AS paid_order_count, COALESCE(SUM(amount_cents - refunded_cents), 0) AS revenue_cents, "+
+				"COALESCE(MIN("+dialect.EpochSeconds("paid_at")+"), 0) AS first_paid_unix, "+
+				"COALESCE(MAX("+dialect.EpochSeconds("paid_at")+"), 0) AS last_paid_unix",
+		).
+		Where("member_id = ? AND status = ?", memberID, "paid").
+		Scan(&row).Error; err != nil {
+		return memberStatsResponse{}, err
+	}
+
+	stats := memberStatsResponse{
+		PaidOrderCount: row.PaidOrderCount,
+		RevenueCents:   row.RevenueCents,
+		FirstPaidAt:    unixTimeOrNil(row.FirstPaidUnix),
+		LastPaidAt:     unixTimeOrNil(row.LastPaidUnix),
+	}
+	if row.PaidOrderCount > 0 {
+		stats.AverageOrderCents = row.RevenueCents / row.PaidOrderCount
+	}
+	if err := database.WithContext(ctx).
+		Table("refunds AS r").
+		Joins("JOIN orders AS o ON o.id = r.order_id").
+		Where("o.member_id = ?", memberID).
+		Select("COALESCE(SUM(r.amount_cents), 0)").
+		Scan(&stats.RefundedCents).Error; err != nil {
+		return memberStatsResponse{}, err
+	}
+	return stats, nil
+}
+
+func loadMemberCampaignExposures(ctx context.Context, database *gorm.DB, dialect db.Dialect, memberID uint) ([]memberCampaignExposure, error) {
+	var rows []struct {
+		CampaignID     uint
+		Name           string
+		Channel        string
+		OrderCount     int64
+		FirstTouchUnix int64
+	}
+	matchSQL := "JOIN campaigns AS c ON (" + attributionMatchSQL(attributionModeExplicit) + ") OR (" +
+		attributionMatchSQL(attributionModeChannelWindow) + ")"
+	if err := database.WithContext(ctx).
+		Table("orders AS o").
+		Select("c.id AS campaign_id, c.name, c.channel, COUNT(DISTINCT o.id) AS order_count, "+
+			"MIN("+dialect.EpochSeconds("o.paid_at")+") AS first_touch_unix").
+		Joins(matchSQL, "paid", "paid").
+		Where("o.member_id = ?", memberID).
+		Group("c.id, c.name, c.channel").
+		Order("first_touch_unix ASC, c.id ASC").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	exposures := make([]memberCampaignExposure, 0, len(rows))
+	for _, row := range rows {
+		exposures = append(exposures, memberCampaignExposure{
+			CampaignID:   row.CampaignID,
+			Name:         row.Name,
+			Channel:      row.Channel,
+			OrderCount:   row.OrderCount,
+			FirstTouchAt: unixTimeOrNil(row.FirstTouchUnix),
+		})
+	}
+	return exposures, nil
+}
+
+// loadMemberTimeline reads up to limit+1 events after cursor from every
+// source, merges them and keeps the first limit.
+func loadMemberTimeline(
+	ctx context.Context,
+	database *gorm.DB,
+	member db.Member,
+	pii piiView,
+	cursor *timelineCursor,
+	limit int,
+) (memberTimelinePage, error) {
+	events := make([]memberTimelineEvent, 0, limit+1)
+	if cursor.after(member.CreatedAt, timelineMemberCreated, member.ID) {
+		events = append(events, memberTimelineEvent{
+			Type: timelineMemberCreated,
+			ID:   member.ID,
+			At:   member.CreatedAt,
+			Data: gin.H{"channel": member.Channel},
+		})
+	}
+
+	orders := make([]db.Order, 0, limit+1)
+	if err := cursor.where(database.WithContext(ctx).Preload("Items"), timelineOrderCreated, "created_at", "id").
+		Where("member_id = ?", member.ID).
+		Order("created_at ASC, id ASC").
+		Limit(limit + 1).
+		Find(&orders).Error; err != nil {
+		return memberTimelinePage{}, err
+	}
+	for _, order := range orders {
+		events = append(events, memberTimelineEvent{
+			Type: timelineOrderCreated,
+			ID:   order.ID,
+			At:   order.CreatedAt,
+			Data: toOrderResponse(order, member.Name),
+		})
+	}
+
+	// The status an order was created with is already its order_created event.
+	var histories []struct {
+		db.OrderStatusHistory
+		OrderNo string
+	}
+	if err := cursor.where(database.WithContext(ctx).Table("order_status_histories AS h"), timelineOrderStatus, "h.created_at", "h.id").
+		Select("h.*, o.order_no").
+		Joins("JOIN orders AS o ON o.id = h.order_id").
+		Where("o.member_id = ? AND h.from_status <> ''", member.ID).
+		Order("h.created_at ASC, h.id ASC").
+		Limit(limit + 1).
+		Scan(&histories).Error; err != nil {
+		return memberTimelinePage{}, err
+	}
+	for _, history := range histories {
+		events = append(events, memberTimelineEvent{
+			Type: timelineOrderStatus,
+			ID:   history.ID,
+			At:   history.CreatedAt,
+			Data: orderStatusEvent{
+				OrderID:    history.OrderID,
+				OrderNo:    history.OrderNo,
+				FromStatus: history.FromStatus,
+				ToStatus:   history.ToStatus,
+				Note:       history.Note,
+				ChangedBy:  history.ChangedBy,
+			},
+		})
+	}
+
+	var refunds []struct {
+		db.Refund
+		OrderNo string
+	}
+	if err := cursor.where(database.WithContext(ctx).Table("refunds AS r"), timelineRefund, "r.created_at", "r.id").
+		Select("r.*, o.order_no").
+		Joins("JOIN orders AS o ON o.id = r.order_id").
+		Where("o.member_id = ?", member.ID).
+		Order("r.created_at ASC, r.id ASC").
+		Limit(limit + 1).
+		Scan(&refunds).Error; err != nil {
+		return memberTimelinePage{}, err
+	}
+	for _, refund := range refunds {
+		events = append(events, memberTimelineEvent{
+			Type: timelineRefund,
+			ID:   refund.ID,
+			At:   refund.CreatedAt,
+			Data: refundEvent{refundResponse: toRefundResponse(refund.Refund), OrderNo: refund.OrderNo},
+		})
+	}
+
+	var tags []struct {
+		db.Tag
+		TaggedAt time.Time
+	}
+	if err := cursor.where(database.WithContext(ctx).Table("member_tags AS mt"), timelineTagAdded, "mt.created_at", "mt.tag_id").
+		Select("t.*, mt.created_at AS tagged_at").
+		Joins("JOIN tags AS t ON t.id = mt.tag_id").
+		Where("mt.member_id = ?", member.ID).
+		Order("mt.created_at ASC, mt.tag_id ASC").
+		Limit(limit + 1).
+		Scan(&tags).Error; err != nil {
+		return memberTimelinePage{}, err
+	}
+	for _, tag := range tags {
+		events = append(events, memberTimelineEvent{
+			Type: timelineTagAdded,
+			ID:   tag.ID,
+			At:   tag.TaggedAt,
+			Data: toTagResponse(tag.Tag, 0),
+		})
+	}
+
+	entries := make([]db.PointsTransaction, 0, limit+1)
+	if err := cursor.where(database.WithContext(ctx), timelinePoints, "created_at", "id").
+		Where("member_id = ?", member.ID).
+		Order("created_at ASC, id ASC").
+		Limit(limit + 1).
+		Find(&entries).Error; err != nil {
+		return memberTimelinePage{}, err
+	}
+	for _, entry := range entries {
+		events = append(events, memberTimelineEvent{
+			Type: timelinePoints,
+			ID:   entry.ID,
+			At:   entry.CreatedAt,
+			Data: toPointsTransactionResponse(entry),
+		})
+	}
+
+	changes := make([]db.MemberTierChange, 0, limit+1)
+	if err := cursor.where(database.WithContext(ctx), timelineTierChange, "created_at", "id").
+		Where("member_id = ?", member.ID).
+		Order("created_at ASC, id ASC").
+		Limit(limit + 1).
+		Find(&changes).Error; err != nil {
+		return memberTimelinePage{}, err
+	}
+	for _, change := range changes {
+		events = append(events, memberTimelineEvent{
+			Type: timelineTierChange,
+			ID:   change.ID,
+			At:   change.CreatedAt,
+			Data: toTierChangeResponse(change),
+		})
+	}
+
+	notes := make([]db.MemberNote, 0, limit+1)
+	if err := cursor.where(database.WithContext(ctx), timelineNote, "created_at", "id").
+		Where("member_id = ?", member.ID).
+		Order("created_at ASC, id ASC").
+		Limit(limit + 1).
+		Find(&notes).Error; err != nil {
+		return memberTimelinePage{}, err
+	}
+	for _, note := range notes {
+		events = append(events, memberTimelineEvent{
+			Type: timelineNote,
+			ID:   note.ID,
+			At:   note.CreatedAt,
+			Data: toMemberNoteResponse(note),
+		})
+	}
+
+	// A task appears once, when it was assigned, carrying its current outcome.
+	tasks := make([]db.FollowupTask, 0, limit+1)
+	if err := cursor.where(database.WithContext(ctx), timelineFollowupTask, "created_at", "id").
+		Where("member_id = ?", member.ID).
+		Order("created_at ASC, id ASC").
+		Limit(limit + 1).
+		Find(&tasks).Error; err != nil {
+		return memberTimelinePage{}, err
+	}
+	now := time.Now()
+	for _, task := range tasks {
+		events = append(events, memberTimelineEvent{
+			Type: timelineFollowupTask,
+			ID:   task.ID,
+			At:   task.CreatedAt,
+			Data: toFollowupTaskResponse(followupTaskRow{FollowupTask: task, MemberName: member.Name, MemberPhone: member.Phone}, pii, now),
+		})
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return timelineLess(events[i].At, events[i].Type, events[i].ID, events[j].At, events[j].Type, events[j].ID)
+	})
+	page := memberTimelinePage{Items: events}
+	if len(events) > limit {
+		page.Items = events[:limit]
+		last := page.Items[limit-1]
+		page.NextCursor = timelineCursor{At: last.At, Type: last.Type, ID: last.ID}.encode()
+	}
+	return page, nil
+}
+
+func unixTimeOrNil(seconds int64) *time.Time {
+	if seconds <= 0 {
+		return nil
+	}
+	value := time.Unix(seconds, 0)
+	return &value
+}
@@ -0,0 +1,153 @@
+package http
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type testMemberDetail struct {
+	Member struct {
+		ID   uint      `json:"id"`
+		Tags []testTag `json:"tags"`
+	} `json:"member"`
+	Stats struct {
+		PaidOrderCount    int64      `json:"paidOrderCount"`
+		RevenueCents      int64      `json:"revenueCents"`
+		RefundedCents     int64      `json:"refundedCents"`
+		AverageOrderCents int64      `json:"averageOrderCents"`
+		FirstPaidAt       *time.Time `json:"firstPaidAt"`
+		LastPaidAt        *time.Time `json:"lastPaidAt"`
+	} `json:"stats"`
+	RecentOrders []testOrder `json:"recentOrders"`
+	Campaigns    []struct {
+		CampaignID uint  `json:"campaignId"`
+		OrderCount int64 `json:"orderCount"`
+	} `json:"campaigns"`
+	Timeline struct {
+		Items []struct {
+			Type string    `json:"type"`
+			ID   uint      `json:"id"`
+			At   time.Time `json:"at"`
+		} `json:"items"`
+		NextCursor string `json:"nextCursor"`
+	} `json:"timeline"`
+}
+
+func TestMemberDetailTimeline(t *testing.T) {
+	t.Parallel()
+
+	router := newTestRouter(t)
+	token := loginForTest(t, router, "Super")
+
+	member := performJSONRequest[testMember](t, router, token, http.MethodPost, "/api/v1/members", map[string]interface{}{
+		"name":    "Abby",
+		"phone":   "13800004401",
+		"channel": "wechat",
+	})
+	if member.Code != 200 {
+		t.Fatalf("create member code = %d, msg = %s", member.Code, member.Msg)
+	}
+	campaign := performJSONRequest[testCampaign](t, router, token, http.MethodPost, "/api/v1/campaigns", map[string]interface{}{
+		"name":        "Winter Return",
+		"channel":     "wechat",
+		"discountPct": 10,
+		"status":      "active",
+	})
+	if campaign.Code != 200 {
+		t.Fatalf("create campaign code = %d, msg = %s", campaign.Code, campaign.Msg)
+	}
+
+	createOrder := func(amountCents int64, status, source string) testOrder {
+		order := performJSONRequest[testOrder](t, router, token, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+			"memberId":    member.Data.ID,
+			"amountCents": amountCents,
+			"status":      status,
+			"source":      source,
+		})
+		if order.Code != 200 {
+			t.Fatalf("create order code = %d, msg = %s", order.Code, order.Msg)
+		}
+		return order.Data
+	}
+	createOrder(3000, "paid", "wechat")
+	pending := createOrder(1000, "pending", "miniapp")
+	refunded := createOrder(2000, "paid", "miniapp")
+	orderPath := func(orderID uint) string {
+		return "/api/v1/orders/" + strconv.FormatUint(uint64(orderID), 10)
+	}
+	if paid := performJSONRequest[testOrder](t, router, token, http.MethodPatch, orderPath(pending.ID)+"/status",
+		map[string]string{"status": "paid"}); paid.Code != 200 {
+		t.Fatalf("pay pending order code = %d, msg = %s", paid.Code, paid.Msg)
+	}
+	if refund := performJSONRequest[map[string]interface{}](t, router, token, http.MethodPost, orderPath(refunded.ID)+"/refunds",
+		map[string]interface{}{"amountCents": 500, "reason": "late delivery"}); refund.Code != 200 {
+		t.Fatalf("refund code = %d, msg = %s", refund.Code, refund.Msg)
+	}
+	vip := performJSONRequest[testTag](t, router, token, http.MethodPost, "/api/v1/tags", map[string]string{"name": "VIP"})
+	if tagged := performJSONRequest[map[string]interface{}](t, router, token, http.MethodPut,
+		"/api/v1/members/"+strconv.FormatUint(uint64(member.Data.ID), 10)+"/tags", map[string]interface{}{"tagIds": []uint{vip.Data.ID}}); tagged.Code != 200 {
+		t.Fatalf("tag member code = %d, msg = %s", tagged.Code, tagged.Msg)
+	}
+
+	detailPath := "/api/v1/members/" + strconv.FormatUint(uint64(member.Data.ID), 10)
+	detail := performJSONRequest[testMemberDetail](t, router, token, http.MethodGet, detailPath+"?limit=3", nil)
+	if detail.Code != 200 {
+		t.Fatalf("member detail code = %d, msg = %s", detail.Code, detail.Msg)
+	}
+	stats := detail.Data.Stats
+	if stats.PaidOrderCount != 3 || stats.RevenueCents != 5500 || stats.RefundedCents != 500 || stats.AverageOrderCents != 1833 ||
+		stats.FirstPaidAt == nil || stats.LastPaidAt == nil {
+		t.Fatalf("member stats = %+v, want 3 paid orders, 5500 net, 500 refunded", stats)
+	}
+	if len(detail.Data.RecentOrders) != 3 || detail.Data.RecentOrders[0].ID != refunded.ID {
+		t.Fatalf("recent orders = %+v, want newest first", detail.Data.RecentOrders)
+	}
+	if len(detail.Data.Campaigns) != 1 || detail.Data.Campaigns[0].CampaignID != campaign.Data.ID || detail.Data.Campaigns[0].OrderCount != 1 {
+		t.Fatalf("campaigns = %+v, want one exposure through the wechat order", detail.Data.Campaigns)
+	}
+	if len(detail.Data.Member.Tags) != 1 {
+		t.Fatalf("member tags = %+v, want VIP", detail.Data.Member.Tags)
+	}
+
+	// Walk the timeline page by page; together the pages hold every event once, oldest first.
+	types := make([]string, 0)
+	page := detail
+	for pages := 1; ; pages++ {
+		if len(page.Data.Timeline.Items) > 3 {
+			t.Fatalf("page %d has %d events, want at most 3", pages, len(page.Data.Timeline.Items))
+		}
+		for _, event := range page.Data.Timeline.Items {
+			types = append(types, event.Type)
+		}
+		if page.Data.Timeline.NextCursor == "" {
+			break
+		}
+		if pages > 5 {
+			t.Fatalf("timeline did not end after %d pages", pages)
+		}
+		page = performJSONRequest[testMemberDetail](t, router, token, http.MethodGet,
+			detailPath+"?limit=3&cursor="+url.QueryEscape(page.Data.Timeline.NextCursor), nil)
+		if page.Code != 200 {
+			t.Fatalf("timeline page code = %d, msg = %s", page.Code, page.Msg)
+		}
+	}
+	want := []string{"member_created", "order_created", "order_created", "order_created", "order_status", "refund", "tag_added"}
+	if len(types) != len(want) {
+		t.Fatalf("timeline types = %v, want %v", types, want)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Fatalf("timeline types = %v, want %v", types, want)
+		}
+	}
+
+	if invalid := performJSONRequest[testMemberDetail](t, router, token, http.MethodGet, detailPath+"?cursor=not-a-cursor", nil); invalid.Code != 400 {
+		t.Fatalf("invalid cursor code = %d, want 400", invalid.Code)
+	}
+	if missing := performJSONRequest[testMemberDetail](t, router, token, http.MethodGet, "/api/v1/members/9999", nil); missing.Code != 404 {
+		t.Fatalf("unknown member code = %d, want 404", missing.Code)
+	}
+}
@@ -0,0 +1,496 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	stdhttp "net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"small-merchant-ops-hub-server/internal/cache"
+	"small-merchant-ops-hub-server/internal/db"
+	"small-merchant-ops-hub-server/internal/phone"
+)
+
+const (
+	maxMemberImportBytes     = 5 << 20
+	maxMemberImportRows      = 10000
+	maxMemberImportErrors    = 100
+	memberImportBatchSize    = 500
+	memberImportErrorsPrefix = "member-import-errors:"
+)
+
+var (
+	// memberImportTimeout covers parsing, lookups and the write transaction
+	// for a full-size file.
+	memberImportTimeout = 30 * time.Second
+	// memberImportErrorsTTL is how long an error report can be downloaded.
+	memberImportErrorsTTL = 24 * time.Hour
+)
+
+type memberImportError struct {
+	Line    int    `json:"line"`
+	Phone   string `json:"phone"`
+	Message string `json:"message"`
+}
+
+type memberImportResponse struct {
+	DryRun        bool                `json:"dryRun"`
+	Total         int                 `json:"total"`
+	Created       int                 `json:"created"`
+	Updated       int                 `json:"updated"`
+	Failed        int                 `json:"failed"`
+	Errors        []memberImportError `json:"errors"`
+	ErrorReportID string              `json:"errorReportId,omitempty"`
+}
+
+// memberImportRow is one data row of an import file. Record keeps the raw
+// cells so failed rows can be written back out unchanged.
+type memberImportRow struct {
+	Line    int
+	Record  []string
+	Name    string
+	Phone   string
+	Channel string
+	Tags    []string
+	Error   string
+	Member  *db.Member
+}
+
+// memberImportColumns maps the header names to cell indexes; tags is optional.
+type memberImportColumns struct {
+	Name    int
+	Phone   int
+	Channel int
+	Tags    int
+}
+
+// importMembersHandler upserts members by phone from a CSV with the columns
+// name, phone, channel and optional tags ("|" or ";" separated tag names).
+// The file is sent as multipart field "file" or as the raw request body.
+// Invalid rows are skipped and reported; valid rows are written in one
+// transaction unless dryRun=true, in which case nothing is written.
+func importMembersHandler(database *gorm.DB, cacheStore cache.Store, phoneRegion string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dryRun := c.Query("dryRun") == "true"
+
+		content, err := readMemberImportFile(c)
+		if err != nil {
+			fail(c, 400, err.Error())
+			return
+		}
+		header, rows, err := parseMemberImportCSV(content, phoneRegion)
+		if err != nil {
+			fail(c, 400, err.Error())
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), memberImportTimeout)
+		defer cancel()
+
+		if err := matchImportedMembers(ctx, database, rows); err != nil {
+			fail(c, 500, "query members failed")
+			return
+		}
+
+		pii := piiViewFor(c)
+		result := memberImportResponse{DryRun: dryRun, Total: len(rows), Errors: make([]memberImportError, 0)}
+		valid := make([]*memberImportRow, 0, len(rows))
+		for _, row := range rows {
+			if row.Error != "" {
+				result.Failed++
+				if len(result.Errors) < maxMemberImportErrors {
+					result.Errors = append(result.Errors, memberImportError{Line: row.Line, Phone: pii.Phone(row.Phone), Message: row.Error})
+				}
+				continue
+			}
+			if row.Member != nil {
+				result.Updated++
+			} else {
+				result.Created++
+			}
+			valid = append(valid, row)
+		}
+
+		if !dryRun && len(valid) > 0 {
+			if err := database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				return writeImportedMembers(tx, valid)
+			}); err != nil {
+				fail(c, 500, "import members failed")
+				return
+			}
+			_ = cacheStore.Delete(ctx, summaryCacheKey)
+		}
+
+		if result.Failed > 0 {
+			report, err := buildMemberImportErrorCSV(header, rows, pii)
+			if err != nil {
+				fail(c, 500, "build error report failed")
+				return
+			}
+			reportID := newToken("import")
+			if err := cacheStore.Set(ctx, memberImportErrorsKey(c, reportID), report, memberImportErrorsTTL); err != nil {
+				fail(c, 500, "save error report failed")
+				return
+			}
+			result.ErrorReportID = reportID
+		}
+		ok(c, result)
+	}
+}
+
+// memberImportErrorsHandler downloads the failed rows of an import, with the
+// reason appended as an error column. Reports are only visible to their uploader.
+func memberImportErrorsHandler(cacheStore cache.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		report, found, err := cacheStore.Get(ctx, memberImportErrorsKey(c, c.Param("reportId")))
+		if err != nil {
+			fail(c, 500, "query error report failed")
+			return
+		}
+		if !found {
+			fail(c, 404, "error report not found or expired")
+			return
+		}
+
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", "attachment; filename=member-import-errors.csv")
+		c.String(stdhttp.StatusOK, report)
+	}
+}
+
+func memberImportErrorsKey(c *gin.Context, reportID string) string {
+	return memberImportErrorsPrefix + strconv.Itoa(sessionFromContext(c).UserID) + ":" + reportID
+}
+
+func readMemberImportFile(c *gin.Context) ([]byte, error) {
+	c.Request.Body = stdhttp.MaxBytesReader(c.Writer, c.Request.Body, maxMemberImportBytes+(1<<20))
+
+	var reader io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		header, err := c.FormFile("file")
+		if err != nil {
+			return nil, errors.New("multipart field file is required")
+		}
+		file, err := header.Open()
+		if err != nil {
+			return nil, errors.New("read import file failed")
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	content, err := io.ReadAll(io.LimitReader(reader, maxMemberImportBytes+1))
+	if err != nil {
+		return nil, errors.New("read import file failed")
+	}
+	if len(content) > maxMemberImportBytes {
+		return nil, fmt.Errorf("import file must be at most %d MB", maxMemberImportBytes>>20)
+	}
+	if len(bytes.TrimSpace(content)) == 0 {
+		return nil, errors.New("import file is empty")
+	}
+	return content, nil
+}
+
+// parseMemberImportCSV reads the header and validates each row on its own;
+// phones are normalized, and one seen earlier in the file marks the later row
+// as a duplicate.
+func parseMemberImportCSV(content []byte, phoneRegion string) ([]string, []*memberImportRow, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(content, []byte("\ufeff"))))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, errors.New("import file has no header row")
+	}
+	columns, err := parseMemberImportHeader(header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows := make([]*memberImportRow, 0)
+	firstLine := make(map[string]int)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid csv: %v", err)
+		}
+		line, _ := reader.FieldPos(0)
+		if isBlankRecord(record) {
+			continue
+		}
+		if len(rows) == maxMemberImportRows {
+			return nil, nil, fmt.Errorf("import file must have at most %d rows", maxMemberImportRows)
+		}
+
+		row := &memberImportRow{
+			Line:    line,
+			Record:  record,
+			Name:    cell(record, columns.Name),
+			Phone:   cell(record, columns.Phone),
+			Channel: cell(record, columns.Channel),
+			Tags:    splitImportTags(cell(record, columns.Tags)),
+		}
+		row.Error = validateMemberImportRow(row, phoneRegion)
+		if row.Error == "" {
+			if first, seen := firstLine[row.Phone]; seen {
+				row.Error = fmt.Sprintf("duplicate phone, first used on line %d", first)
+			} else {
+				firstLine[row.Phone] = row.Line
+			}
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil, nil, errors.New("import file has no data rows")
+	}
+	return header, rows, nil
+}
+
+func parseMemberImportHeader(header []string) (memberImportColumns, error) {
+	columns := memberImportColumns{Name: -1, Phone: -1, Channel: -1, Tags: -1}
+	for i, name := range header {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "name":
+			columns.Name = i
+		case "phone":
+			columns.Phone = i
+		case "channel":
+			columns.Channel = i
+		case "tags":
+			columns.Tags = i
+		}
+	}
+	if columns.Name < 0 || columns.Phone < 0 || columns.Channel < 0 {
+		return columns, errors.New("header must include name, phone and channel")
+	}
+	return columns, nil
+}
+
+func validateMemberImportRow(row *memberImportRow, phoneRegion string) string {
+	missing := make([]string, 0, 3)
+	if row.Name == "" {
+		missing = append(missing, "name")
+	}
+	if row.Phone == "" {
+		missing = append(missing, "phone")
+	}
+	if row.Channel == "" {
+		missing = append(missing, "channel")
+	}
+	if len(missing) > 0 {
+		return "missing " + strings.Join(missing, ", ")
+	}
+	switch {
+	case len([]rune(row.Name)) > 80:
+		return "name must be at most 80 characters"
+	case len([]rune(row.Channel)) > 30:
+		return "channel must be at most 30 characters"
+	}
+	for _, tag := range row.Tags {
+		if len([]rune(tag)) > 50 {
+			return fmt.Sprintf("tag %q must be at most 50 characters", tag)
+		}
+	}
+	normalized, err := phone.Normalize(row.Phone, phoneRegion)
+	if err != nil {
+		return err.Error()
+	}
+	row.Phone = normalized
+	return ""
+}
+
+// matchImportedMembers attaches the existing member to each valid row. Phones
+// of soft-deleted members are rejected because the unique index still holds them.
+func matchImportedMembers(ctx context.Context, database *gorm.DB, rows []*memberImportRow) error {
+	phones := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if row.Error == "" {
+			phones = append(phones, row.Phone)
+		}
+	}
+
+	existing := make(map[string]*db.Member, len(phones))
+	for start := 0; start < len(phones); start += memberImportBatchSize {
+		end := start + memberImportBatchSize
+		if end > len(phones) {
+			end = len(phones)
+		}
+		members := make([]db.Member, 0, end-start)
+		if err := database.WithContext(ctx).Unscoped().Where("phone IN ?", phones[start:end]).Find(&members).Error; err != nil {
+			return err
+		}
+		for i := range members {
+			existing[members[i].Phone] = &members[i]
+		}
+	}
+
+	for _, row := range rows {
+		if row.Error != "" {
+			continue
+		}
+		member, found := existing[row.Phone]
+		if !found {
+			continue
+		}
+		if member.DeletedAt.Valid {
+			row.Error = deletedPhoneOwnerMessage(member.ID)
+			continue
+		}
+		row.Member = member
+	}
+	return nil
+}
+
+// writeImportedMembers creates missing tags, inserts new members in batches,
+// updates existing ones and links tags without removing any the member has.
+func writeImportedMembers(tx *gorm.DB, rows []*memberImportRow) error {
+	tagIDs, err := ensureImportTags(tx, rows)
+	if err != nil {
+		return err
+	}
+
+	created := make([]db.Member, 0, len(rows))
+	createdRows := make([]*memberImportRow, 0, len(rows))
+	for _, row := range rows {
+		if row.Member != nil {
+			if err := tx.Model(row.Member).Updates(map[string]interface{}{
+				"name":    row.Name,
+				"channel": row.Channel,
+			}).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		created = append(created, db.Member{Name: row.Name, Phone: row.Phone, Channel: row.Channel})
+		createdRows = append(createdRows, row)
+	}
+	if len(created) > 0 {
+		if err := tx.CreateInBatches(&created, memberImportBatchSize).Error; err != nil {
+			return err
+		}
+		for i := range created {
+			createdRows[i].Member = &created[i]
+		}
+	}
+
+	links := make([]db.MemberTag, 0)
+	for _, row := range rows {
+		for _, tag := range row.Tags {
+			links = append(links, db.MemberTag{MemberID: row.Member.ID, TagID: tagIDs[tag]})
+		}
+	}
+	if len(links) == 0 {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&links, memberImportBatchSize).Error
+}
+
+func ensureImportTags(tx *gorm.DB, rows []*memberImportRow) (map[string]uint, error) {
+	names := make([]string, 0)
+	ids := make(map[string]uint)
+	for _, row := range rows {
+		for _, tag := range row.Tags {
+			if _, seen := ids[tag]; !seen {
+				ids[tag] = 0
+				names = append(names, tag)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return ids, nil
+	}
+
+	tags := make([]db.Tag, 0, len(names))
+	if err := tx.Where("name IN ?", names).Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		ids[tag.Name] = tag.ID
+	}
+	for _, name := range names {
+		if ids[name] != 0 {
+			continue
+		}
+		tag := db.Tag{Name: name}
+		if err := tx.Create(&tag).Error; err != nil {
+			return nil, err
+		}
+		ids[name] = tag.ID
+	}
+	return ids, nil
+}
+
+// buildMemberImportErrorCSV writes the failed rows as uploaded, with the phone
+// cell masked unless pii allows full phones.
+func buildMemberImportErrorCSV(header []string, rows []*memberImportRow, pii piiView) (string, error) {
+	columns, err := parseMemberImportHeader(header)
+	if err != nil {
+		return "", err
+	}
+	buffer := &bytes.Buffer{}
+	writer := csv.NewWriter(buffer)
+	if err := writer.Write(append([]string{"line"}, append(header, "error")...)); err != nil {
+		return "", err
+	}
+	for _, row := range rows {
+		if row.Error == "" {
+			continue
+		}
+		record := make([]string, len(header))
+		copy(record, row.Record)
+		record[columns.Phone] = pii.Phone(record[columns.Phone])
+		if err := writer.Write(append([]string{strconv.Itoa(row.Line)}, append(record, row.Error)...)); err != nil {
+			return "", err
+		}
+	}
+	writer.Flush()
+	return buffer.String(), writer.Error()
+}
+
+func splitImportTags(raw string) []string {
+	parts := strings.FieldsFunc(raw, func(r rune) bool { return r == '|' || r == ';' })
+	tags := make([]string, 0, len(parts))
+	seen := make(map[string]bool, len(parts))
+	for _, part := range parts {
+		tag := strings.TrimSpace(part)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+func cell(record []string, index int) string {
+	if index < 0 || index >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[index])
+}
+
+func isBlankRecord(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,163 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type testMemberImport struct {
+	DryRun  bool `json:"dryRun"`
+	Total   int  `json:"total"`
+	Created int  `json:"created"`
+	Updated int  `json:"updated"`
+	Failed  int  `json:"failed"`
+	Errors  []struct {
+		Line    int    `json:"line"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	ErrorReportID string `json:"errorReportId"`
+}
+
+const testMemberImportCSV = "\ufeffName,Phone,Channel,Tags\n" +
+	"Pat Lee,13800005501,douyin,VIP|Regular\n" +
+	"Quinn,13800005503,wechat,VIP\n" +
+	"Rosa,13800005504,,\n" +
+	"Sam,13800005503,wechat,\n" +
+	"Tina,13800005502,wechat,\n" +
+	",,,\n" +
+	"Uma,13800005505,miniapp,\n"
+
+func TestImportMembersFromCSV(t *testing.T) {
+	t.Parallel()
+
+	router, database := newTestRouterWithDB(t)
+	token := loginForTest(t, router, "Admin")
+	superToken := loginForTest(t, router, "Super")
+
+	existing := performJSONRequest[testMember](t, router, token, http.MethodPost, "/api/v1/members", map[string]interface{}{
+		"name":    "Pat",
+		"phone":   "13800005501",
+		"channel": "wechat",
+	})
+	removed := performJSONRequest[testMember](t, router, token, http.MethodPost, "/api/v1/members", map[string]interface{}{
+		"name":    "Tina",
+		"phone":   "13800005502",
+		"channel": "wechat",
+	})
+	if existing.Code != 200 || removed.Code != 200 {
+		t.Fatalf("create members = %d/%d", existing.Code, removed.Code)
+	}
+	if deleted := performJSONRequest[testMember](t, router, superToken, http.MethodDelete,
+		"/api/v1/members/"+strconv.FormatUint(uint64(removed.Data.ID), 10), nil); deleted.Code != 200 {
+		t.Fatalf("delete member code = %d, msg = %s", deleted.Code, deleted.Msg)
+	}
+	countMembers := func() int64 {
+		var count int64
+		if err := database.Table("members").Count(&count).Error; err != nil {
+			t.Fatalf("count members: %v", err)
+		}
+		return count
+	}
+
+	dryRun := postMemberImport(t, router, token, "/api/v1/members/import?dryRun=true", testMemberImportCSV, false)
+	if dryRun.Code != 200 || !dryRun.Data.DryRun || dryRun.Data.Total != 6 || dryRun.Data.Created != 2 ||
+		dryRun.Data.Updated != 1 || dryRun.Data.Failed != 3 {
+		t.Fatalf("dry run = %d %+v, msg = %s", dryRun.Code, dryRun.Data, dryRun.Msg)
+	}
+	wantErrors := map[int]string{4: "missing channel", 5: "duplicate phone", 6: "deleted member"}
+	for _, rowError := range dryRun.Data.Errors {
+		if !strings.Contains(rowError.Message, wantErrors[rowError.Line]) || wantErrors[rowError.Line] == "" {
+			t.Fatalf("line %d error = %q, want %q", rowError.Line, rowError.Message, wantErrors[rowError.Line])
+		}
+	}
+	if count := countMembers(); count != 2 {
+		t.Fatalf("members after dry run = %d, want 2", count)
+	}
+
+	imported := postMemberImport(t, router, token, "/api/v1/members/import", testMemberImportCSV, true)
+	if imported.Code != 200 || imported.Data.DryRun || imported.Data.Created != 2 || imported.Data.Updated != 1 ||
+		imported.Data.Failed != 3 || imported.Data.ErrorReportID == "" {
+		t.Fatalf("import = %d %+v, msg = %s", imported.Code, imported.Data, imported.Msg)
+	}
+	if count := countMembers(); count != 4 {
+		t.Fatalf("members after import = %d, want 4", count)
+	}
+	var channel string
+	if err := database.Table("members").Where("id = ?", existing.Data.ID).Select("channel").Scan(&channel).Error; err != nil {
+		t.Fatalf("query channel: %v", err)
+	}
+	if channel != "douyin" {
+		t.Fatalf("upserted channel = %q, want douyin", channel)
+	}
+
+	again := postMemberImport(t, router, token, "/api/v1/members/import", testMemberImportCSV, false)
+	if again.Code != 200 || again.Data.Created != 0 || again.Data.Updated != 3 {
+		t.Fatalf("second import = %d %+v, want 3 updates", again.Code, again.Data)
+	}
+	tags := performJSONRequest[[]testTag](t, router, token, http.MethodGet, "/api/v1/tags", nil)
+	tagMembers := make(map[string]int64)
+	for _, tag := range tags.Data {
+		tagMembers[tag.Name] = tag.MemberCount
+	}
+	if len(tagMembers) != 2 || tagMembers["VIP"] != 2 || tagMembers["Regular"] != 1 {
+		t.Fatalf("tags after import = %+v, want VIP x2 and Regular x1", tags.Data)
+	}
+
+	report := performRawRequest(t, router, token, http.MethodGet, "/api/v1/members/import/errors/"+imported.Data.ErrorReportID)
+	content, _ := io.ReadAll(report.Body)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 4 || lines[0] != "line,Name,Phone,Channel,Tags,error" || !strings.HasPrefix(lines[1], "4,Rosa,13800005504,,,missing channel") {
+		t.Fatalf("error report = %q", content)
+	}
+	otherUser := performJSONRequest[map[string]interface{}](t, router, superToken, http.MethodGet,
+		"/api/v1/members/import/errors/"+imported.Data.ErrorReportID, nil)
+	if otherUser.Code != 404 {
+		t.Fatalf("error report for another user code = %d, want 404", otherUser.Code)
+	}
+
+	if badHeader := postMemberImport(t, router, token, "/api/v1/members/import", "name,mobile\nVic,138\n", false); badHeader.Code != 400 {
+		t.Fatalf("missing columns code = %d, want 400", badHeader.Code)
+	}
+	userToken := loginForTest(t, router, "User")
+	if denied := postMemberImport(t, router, userToken, "/api/v1/members/import", testMemberImportCSV, false); denied.Code != 403 {
+		t.Fatalf("user import code = %d, want 403", denied.Code)
+	}
+}
+
+func postMemberImport(t *testing.T, router http.Handler, token, target, content string, asMultipart bool) testEnvelope[testMemberImport] {
+	t.Helper()
+
+	body := &bytes.Buffer{}
+	contentType := "text/csv"
+	if asMultipart {
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("file", "members.csv")
+		if err != nil {
+			t.Fatalf("create form file: %v", err)
+		}
+		_, _ = part.Write([]byte(content))
+		_ = writer.Close()
+		contentType = writer.FormDataContentType()
+	} else {
+		body.WriteString(content)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, target, body)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	var result testEnvelope[testMemberImport]
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("decode import response: %v; body = %s", err, rec.Body.String())
+	}
+	return result
+}
@@ -0,0 +1,319 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"small-merchant-ops-hub-server/internal/cache"
+	"small-merchant-ops-hub-server/internal/db"
+	"small-merchant-ops-hub-server/internal/phone"
+	"small-merchant-ops-hub-server/internal/tier"
+)
+
+const (
+	maxMergeSources = 50
+	tierMergeReason = "member merge"
+)
+
+type mergeMembersRequest struct {
+	TargetID  uint   `json:"targetId"`
+	SourceIDs []uint `json:"sourceIds"`
+}
+
+type mergeMembersResponse struct {
+	Member          memberResponse `json:"member"`
+	MergedMemberIDs []uint         `json:"mergedMemberIds"`
+	MovedOrders     int64          `json:"movedOrders"`
+}
+
+type duplicateMember struct {
+	memberResponse
+	OrderCount int64 `json:"orderCount"`
+}
+
+// duplicateMemberGroup is a set of active members whose phones normalize to
+// the same number. SuggestedTargetID is the member with the most orders.
+type duplicateMemberGroup struct {
+	Phone             string            `json:"phone"`
+	SuggestedTargetID uint              `json:"suggestedTargetId"`
+	Members           []duplicateMember `json:"members"`
+}
+
+var (
+	errMergeTargetNotFound = errors.New("target member not found")
+	errMergeSourceNotFound = errors.New("source member not found")
+	errMergePhoneConflict  = errors.New("normalized phone belongs to another member")
+)
+
+// memberDuplicatesHandler finds members stored with different spellings of
+// one phone, typically rows created before phones were normalized.
+func memberDuplicatesHandler(database *gorm.DB, phoneRegion string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		byPhone := make(map[string][]db.Member)
+		batch := make([]db.Member, 0, 500)
+		if err := database.WithContext(ctx).
+			Select("id, name, phone, channel, tier_code, points_balance, created_at").
+			FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+				for _, member := range batch {
+					normalized, err := phone.Normalize(member.Phone, phoneRegion)
+					if err != nil {
+						continue
+					}
+					byPhone[normalized] = append(byPhone[normalized], member)
+				}
+				return nil
+			}).Error; err != nil {
+			fail(c, 500, "scan members failed")
+			return
+		}
+
+		memberIDs := make([]uint, 0)
+		for normalized, members := range byPhone {
+			if len(members) < 2 {
+				delete(byPhone, normalized)
+				continue
+			}
+			for _, member := range members {
+				memberIDs = append(memberIDs, member.ID)
+			}
+		}
+
+		orderCounts := make(map[uint]int64, len(memberIDs))
+		if len(memberIDs) > 0 {
+			var rows []struct {
+				MemberID   uint
+				OrderCount int64
+			}
+			if err := database.WithContext(ctx).
+				Model(&db.Order{}).
+				Select("member_id, COUNT(*) AS order_count").
+				Where("member_id IN ?", memberIDs).
+				Group("member_id").
+				Scan(&rows).Error; err != nil {
+				fail(c, 500, "count member orders failed")
+				return
+			}
+			for _, row := range rows {
+				orderCounts[row.MemberID] = row.OrderCount
+			}
+		}
+
+		pii := piiViewFor(c)
+		groups := make([]duplicateMemberGroup, 0, len(byPhone))
+		for normalized, members := range byPhone {
+			group := duplicateMemberGroup{Phone: pii.Phone(normalized), Members: make([]duplicateMember, 0, len(members))}
+			for _, member := range members {
+				group.Members = append(group.Members, duplicateMember{
+					memberResponse: toMemberResponse(member, pii),
+					OrderCount:     orderCounts[member.ID],
+				})
+			}
+			sort.Slice(group.Members, func(i, j int) bool {
+				return group.Members[i].ID < group.Members[j].ID
+			})
+			best := group.Members[0]
+			for _, member := range group.Members[1:] {
+				if member.OrderCount > best.OrderCount {
+					best = member
+				}
+			}
+			group.SuggestedTargetID = best.ID
+			groups = append(groups, group)
+		}
+		sort.Slice(groups, func(i, j int) bool {
+			return groups[i].Phone < groups[j].Phone
+		})
+
+		ok(c, groups)
+	}
+}
+
+// mergeMembersHandler folds source members into a target member in one
+// transaction: orders, tags, points, notes, follow-up tasks, PII access logs
+// and tier changes move to the target, marketing consents combine with
+// opt-outs winning, and the target's tier is reassessed against its grown
+// spend. Each source is recorded in MemberMerge and soft-deleted with its
+// phone released, and the target phone is rewritten in normalized form.
+func mergeMembersHandler(database *gorm.DB, cacheStore cache.Store, phoneRegion string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req mergeMembersRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid merge payload")
+			return
+		}
+
+		sourceIDs := make([]uint, 0, len(req.SourceIDs))
+		seen := make(map[uint]bool, len(req.SourceIDs))
+		for _, id := range req.SourceIDs {
+			if id == 0 || id == req.TargetID || seen[id] {
+				continue
+			}
+			seen[id] = true
+			sourceIDs = append(sourceIDs, id)
+		}
+		if req.TargetID == 0 || len(sourceIDs) == 0 {
+			fail(c, 400, "targetId and at least one other sourceId are required")
+			return
+		}
+		if len(sourceIDs) > maxMergeSources {
+			fail(c, 400, "at most 50 members can be merged at once")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		mergedBy := sessionFromContext(c).UserName
+		var target db.Member
+		var movedOrders int64
+		err := database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.First(&target, req.TargetID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return errMergeTargetNotFound
+				}
+				return err
+			}
+			var sourceCount int64
+			if err := tx.Model(&db.Member{}).Where("id IN ?", sourceIDs).Count(&sourceCount).Error; err != nil {
+				return err
+			}
+			if sourceCount != int64(len(sourceIDs)) {
+				return errMergeSourceNotFound
+			}
+
+			moved := tx.Model(&db.Order{}).Where("member_id IN ?", sourceIDs).Update("member_id", target.ID)
+			if moved.Error != nil {
+				return moved.Error
+			}
+			movedOrders = moved.RowsAffected
+
+			if err := mergeMemberTags(tx, target.ID, sourceIDs); err != nil {
+				return err
+			}
+			if err := mergeMemberPoints(tx, target.ID, sourceIDs); err != nil {
+				return err
+			}
+			if err := mergeMemberConsents(tx, target.ID, sourceIDs); err != nil {
+				return err
+			}
+			for _, model := range []interface{}{&db.MemberNote{}, &db.FollowupTask{}, &db.PIIAccessLog{}, &db.MemberTierChange{}} {
+				if err := tx.Model(model).Where("member_id IN ?", sourceIDs).Update("member_id", target.ID).Error; err != nil {
+					return err
+				}
+			}
+			if err := retireMergedMembers(tx, target.ID, sourceIDs, mergedBy); err != nil {
+				return err
+			}
+			if _, err := tier.Reassess(tx, target.ID, time.Now(), tierMergeReason, mergedBy); err != nil {
+				return err
+			}
+
+			normalized, err := phone.Normalize(target.Phone, phoneRegion)
+			if err == nil && normalized != target.Phone {
+				if err := tx.Model(&target).Update("phone", normalized).Error; err != nil {
+					if strings.Contains(strings.ToLower(err.Error()), "unique") {
+						return errMergePhoneConflict
+					}
+					return err
+				}
+			}
+			return tx.Preload("Tags").First(&target, target.ID).Error
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, errMergeTargetNotFound), errors.Is(err, errMergeSourceNotFound):
+				fail(c, 404, err.Error())
+			case errors.Is(err, errMergePhoneConflict):
+				fail(c, 409, err.Error())
+			default:
+				fail(c, 500, "merge members failed")
+			}
+			return
+		}
+
+		_ = cacheStore.Delete(ctx, summaryCacheKey)
+		ok(c, mergeMembersResponse{
+			Member:          toMemberResponse(target, piiViewFor(c)),
+			MergedMemberIDs: sourceIDs,
+			MovedOrders:     movedOrders,
+		})
+	}
+}
+
+// retireMergedMembers records each source in MemberMerge and soft-deletes
+// it. Its phone is swapped for a placeholder first: the unique index still
+// covers deleted rows and the target may need that number.
+func retireMergedMembers(tx *gorm.DB, targetID uint, sourceIDs []uint, mergedBy string) error {
+	var sources []db.Member
+	if err := tx.Select("id, phone").Where("id IN ?", sourceIDs).Find(&sources).Error; err != nil {
+		return err
+	}
+	merges := make([]db.MemberMerge, 0, len(sources))
+	for _, source := range sources {
+		merges = append(merges, db.MemberMerge{
+			TargetID:    targetID,
+			SourceID:    source.ID,
+			SourcePhone: source.Phone,
+			MergedBy:    mergedBy,
+		})
+		if err := tx.Model(&db.Member{}).Where("id = ?", source.ID).Update("phone", fmt.Sprintf("merged:%d", source.ID)).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Create(&merges).Error; err != nil {
+		return err
+	}
+	return tx.Delete(&db.Member{}, sourceIDs).Error
+}
+
+// mergeMemberTags gives the target every tag of the sources and drops the
+// source links.
+func mergeMemberTags(tx *gorm.DB, targetID uint, sourceIDs []uint) error {
+	var tagIDs []uint
+	if err := tx.Model(&db.MemberTag{}).
+		Distinct("tag_id").
+		Where("member_id IN ?", sourceIDs).
+		Pluck("tag_id", &tagIDs).Error; err != nil {
+		return err
+	}
+	if len(tagIDs) > 0 {
+		links := make([]db.MemberTag, 0, len(tagIDs))
+		for _, tagID := range tagIDs {
+			links = append(links, db.MemberTag{MemberID: targetID, TagID: tagID})
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&links).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Where("member_id IN ?", sourceIDs).Delete(&db.MemberTag{}).Error
+}
+
+// mergeMemberPoints moves the source ledgers to the target and adds their
+// balances to it, so the target balance stays the sum of its ledger. Moved
+// rows keep the BalanceAfter of the member they were written for.
+func mergeMemberPoints(tx *gorm.DB, targetID uint, sourceIDs []uint) error {
+	var points int64
+	if err := tx.Model(&db.Member{}).
+		Select("COALESCE(SUM(points_balance), 0)").
+		Where("id IN ?", sourceIDs).
+		Scan(&points).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&db.PointsTransaction{}).Where("member_id IN ?", sourceIDs).Update("member_id", targetID).Error; err != nil {
+		return err
+	}
+	if points == 0 {
+		return nil
+	}
+	return tx.Model(&db.Member{}).Where("id = ?", targetID).Update("points_balance", gorm.Expr("points_balance + ?", points)).Error
+}
@@ -0,0 +1,175 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"small-merchant-ops-hub-server/internal/db"
+)
+
+type testDuplicateGroup struct {
+	Phone             string `json:"phone"`
+	SuggestedTargetID uint   `json:"suggestedTargetId"`
+	Members           []struct {
+		ID         uint  `json:"id"`
+		OrderCount int64 `json:"orderCount"`
+	} `json:"members"`
+}
+
+type testMergeResult struct {
+	Member struct {
+		ID    uint      `json:"id"`
+		Phone string    `json:"phone"`
+		Tags  []testTag `json:"tags"`
+	} `json:"member"`
+	MergedMemberIDs []uint `json:"mergedMemberIds"`
+	MovedOrders     int64  `json:"movedOrders"`
+}
+
+func TestMemberPhoneNormalizationAndMerge(t *testing.T) {
+	t.Parallel()
+
+	router, database := newTestRouterWithDB(t)
+	token := loginForTest(t, router, "Admin")
+	superToken := loginForTest(t, router, "Super")
+
+	created := performJSONRequest[struct {
+		ID    uint   `json:"id"`
+		Phone string `json:"phone"`
+	}](t, router, token, http.MethodPost, "/api/v1/members", map[string]interface{}{
+		"name":    "Wendy",
+		"phone":   "138 0000 1111",
+		"channel": "wechat",
+	})
+	if created.Code != 200 || created.Data.Phone != "+8613800001111" {
+		t.Fatalf("create member = %d %+v, want phone +8613800001111", created.Code, created.Data)
+	}
+	respelled := performJSONRequest[testMember](t, router, token, http.MethodPost, "/api/v1/members", map[string]interface{}{
+		"name":    "Wendy W",
+		"phone":   "+86 138-0000-1111",
+		"channel": "douyin",
+	})
+	if respelled.Code != 400 {
+		t.Fatalf("same phone spelled differently code = %d, want 400", respelled.Code)
+	}
+	invalid := performJSONRequest[testMember](t, router, token, http.MethodPost, "/api/v1/members", map[string]interface{}{
+		"name":    "Xavier",
+		"phone":   "call me",
+		"channel": "wechat",
+	})
+	if invalid.Code != 400 {
+		t.Fatalf("invalid phone code = %d, want 400", invalid.Code)
+	}
+
+	// Members stored before phones were normalized.
+	legacy := []db.Member{
+		{Name: "Wendy", Phone: "13800001111", Channel: "miniapp"},
+		{Name: "W.", Phone: "8613800001111", Channel: "douyin"},
+		{Name: "Yuri", Phone: "139 0000 2222", Channel: "wechat"},
+	}
+	if err := database.Create(&legacy).Error; err != nil {
+		t.Fatalf("create legacy members: %v", err)
+	}
+	for _, memberID := range []uint{legacy[0].ID, legacy[0].ID, legacy[1].ID} {
+		order := performJSONRequest[testOrder](t, router, token, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+			"memberId":    memberID,
+			"amountCents": int64(1200),
+			"source":      "wechat",
+		})
+		if order.Code != 200 {
+			t.Fatalf("create order code = %d, msg = %s", order.Code, order.Msg)
+		}
+	}
+	vip := performJSONRequest[testTag](t, router, token, http.MethodPost, "/api/v1/tags", map[string]string{"name": "VIP"})
+	if tagged := performJSONRequest[map[string]interface{}](t, router, token, http.MethodPut,
+		"/api/v1/members/"+strconv.FormatUint(uint64(legacy[1].ID), 10)+"/tags", map[string]interface{}{"tagIds": []uint{vip.Data.ID}}); tagged.Code != 200 {
+		t.Fatalf("tag member code = %d, msg = %s", tagged.Code, tagged.Msg)
+	}
+
+	// Three paid orders reach silver, which only the merged target will have.
+	if err := database.Create(&db.MembershipTier{Code: "silver", Name: "Silver", Level: 1, MinOrderCount: 3, WindowDays: 365}).Error; err != nil {
+		t.Fatalf("create tier: %v", err)
+	}
+	if err := database.Create(&db.PIIAccessLog{MemberID: legacy[1].ID, UserID: 1, UserName: "Super", Field: "phone", Reason: "callback"}).Error; err != nil {
+		t.Fatalf("create access log: %v", err)
+	}
+
+	duplicates := performJSONRequest[[]testDuplicateGroup](t, router, token, http.MethodGet, "/api/v1/members/duplicates", nil)
+	if duplicates.Code != 200 || len(duplicates.Data) != 1 {
+		t.Fatalf("duplicates = %d %+v, want one group", duplicates.Code, duplicates.Data)
+	}
+	group := duplicates.Data[0]
+	if group.Phone != "+8613800001111" || len(group.Members) != 3 || group.SuggestedTargetID != legacy[0].ID {
+		t.Fatalf("duplicate group = %+v, want 3 members with target %d", group, legacy[0].ID)
+	}
+
+	mergePayload := map[string]interface{}{
+		"targetId":  legacy[0].ID,
+		"sourceIds": []uint{created.Data.ID, legacy[1].ID, legacy[0].ID},
+	}
+	if denied := performJSONRequest[testMergeResult](t, router, token, http.MethodPost, "/api/v1/members/merge", mergePayload); denied.Code != 403 {
+		t.Fatalf("admin merge code = %d, want 403", denied.Code)
+	}
+	if missing := performJSONRequest[testMergeResult](t, router, superToken, http.MethodPost, "/api/v1/members/merge", map[string]interface{}{
+		"targetId":  legacy[0].ID,
+		"sourceIds": []uint{9999},
+	}); missing.Code != 404 {
+		t.Fatalf("merge unknown source code = %d, want 404", missing.Code)
+	}
+
+	merged := performJSONRequest[testMergeResult](t, router, superToken, http.MethodPost, "/api/v1/members/merge", mergePayload)
+	if merged.Code != 200 || merged.Data.MovedOrders != 1 || len(merged.Data.MergedMemberIDs) != 2 {
+		t.Fatalf("merge = %d %+v, msg = %s", merged.Code, merged.Data, merged.Msg)
+	}
+	if merged.Data.Member.Phone != "+8613800001111" || len(merged.Data.Member.Tags) != 1 || merged.Data.Member.Tags[0].ID != vip.Data.ID {
+		t.Fatalf("merged member = %+v, want normalized phone and the VIP tag", merged.Data.Member)
+	}
+
+	var active, retired, targetOrders, targetLogs int64
+	if err := database.Model(&db.Member{}).Where("id IN ?", []uint{created.Data.ID, legacy[1].ID}).Count(&active).Error; err != nil {
+		t.Fatalf("count sources: %v", err)
+	}
+	if err := database.Unscoped().Model(&db.Member{}).Where("id IN ?", []uint{created.Data.ID, legacy[1].ID}).Count(&retired).Error; err != nil {
+		t.Fatalf("count deleted sources: %v", err)
+	}
+	if err := database.Model(&db.Order{}).Where("member_id = ?", legacy[0].ID).Count(&targetOrders).Error; err != nil {
+		t.Fatalf("count target orders: %v", err)
+	}
+	if err := database.Model(&db.PIIAccessLog{}).Where("member_id = ?", legacy[0].ID).Count(&targetLogs).Error; err != nil {
+		t.Fatalf("count target access logs: %v", err)
+	}
+	if active != 0 || retired != 2 || targetOrders != 3 || targetLogs != 1 {
+		t.Fatalf("after merge active sources = %d, soft-deleted = %d, target orders = %d, target logs = %d; want 0, 2, 3 and 1",
+			active, retired, targetOrders, targetLogs)
+	}
+
+	var merges []db.MemberMerge
+	if err := database.Order("source_id ASC").Find(&merges).Error; err != nil {
+		t.Fatalf("load merges: %v", err)
+	}
+	if len(merges) != 2 || merges[0].SourceID != created.Data.ID || merges[0].SourcePhone != "+8613800001111" ||
+		merges[1].TargetID != legacy[0].ID || merges[1].MergedBy != "Super" {
+		t.Fatalf("merges = %+v", merges)
+	}
+	var target db.Member
+	if err := database.First(&target, legacy[0].ID).Error; err != nil {
+		t.Fatalf("load target: %v", err)
+	}
+	var tierChange db.MemberTierChange
+	if err := database.Where("member_id = ?", legacy[0].ID).Order("id DESC").First(&tierChange).Error; err != nil {
+		t.Fatalf("load tier change: %v", err)
+	}
+	if target.TierCode != "silver" || tierChange.ToTier != "silver" || tierChange.OrderCount != 3 || tierChange.Reason != "member merge" {
+		t.Fatalf("target tier = %q, change = %+v; want silver from the merge", target.TierCode, tierChange)
+	}
+	if restored := performJSONRequest[testMember](t, router, superToken, http.MethodPost,
+		"/api/v1/members/"+strconv.FormatUint(uint64(legacy[1].ID), 10)+"/restore", nil); restored.Code != 409 {
+		t.Fatalf("restore merged member code = %d, want 409", restored.Code)
+	}
+
+	after := performJSONRequest[[]testDuplicateGroup](t, router, token, http.MethodGet, "/api/v1/members/duplicates", nil)
+	if after.Code != 200 || len(after.Data) != 0 {
+		t.Fatalf("duplicates after merge = %+v, want none", after.Data)
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"context"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	stdhttp "net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -15,11 +17,48 @@ import (
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	"small-merchant-ops-hub-server/internal/cache"
+	"small-merchant-ops-hub-server/internal/consent"
 	"small-merchant-ops-hub-server/internal/db"
+	"small-merchant-ops-hub-server/internal/phone"
 )
 
 const summaryCacheKey = "merchant_ops:summary"
 
+// InvalidateSummary drops the cached summary so the next read recomputes it.
+// Background jobs that change summary inputs call it after their writes.
+func InvalidateSummary(ctx context.Context, cacheStore cache.Store) error {
+	return cacheStore.Delete(ctx, summaryCacheKey)
+}
+
+// Attribution modes decide which paid orders a campaign is credited with.
+// channel-window matches order source to campaign channel inside the campaign
+// window; explicit only counts orders tagged with the campaign id.
+const (
+	attributionModeChannelWindow = "channel-window"
+	attributionModeExplicit      = "explicit"
+)
+
+// Attribution models split each paid order's amount across the campaigns it
+// matches. Touches are ordered by campaign start (creation time when unset).
+const (
+	attributionModelLastTouch  = "last-touch"
+	attributionModelFirstTouch = "first-touch"
+	attributionModelLinear     = "linear"
+	attributionModelTimeDecay  = "time-decay"
+)
+
+// orderStatusTransitions is the order state machine: the statuses each status
+// may move to. refunded and cancelled are terminal.
+var orderStatusTransitions = map[string][]string{
+	"pending": {"paid", "cancelled"},
+	"paid":    {"refunded"},
+}
+
+// timeDecayHalfLife halves a touch's weight for every week between the
+// campaign start and the payment.
+const timeDecayHalfLife = 7 * 24 * time.Hour
+
+// createMemberRequest is also the payload of PUT /members/:id.
 type createMemberRequest struct {
 	Name    string `json:"name"`
 	Phone   string `json:"phone"`
@@ -27,51 +66,91 @@ type createMemberRequest struct {
 }
 
 type createOrderRequest struct {
-	OrderNo     string `json:"orderNo"`
-	MemberID    uint   `json:"memberId"`
+	OrderNo     string                   `json:"orderNo"`
+	MemberID    uint                     `json:"memberId"`
+	AmountCents int64                    `json:"amountCents"`
+	Status      string                   `json:"status"`
+	Source      string                   `json:"source"`
+	CampaignID  *uint                    `json:"campaignId"`
+	CouponCode  string                   `json:"couponCode"`
+	Items       []createOrderItemRequest `json:"items"`
+}
+
+type updateOrderStatusRequest struct {
+	Status string `json:"status"`
+	Note   string `json:"note"`
+}
+
+type createRefundRequest struct {
 	AmountCents int64  `json:"amountCents"`
-	Status      string `json:"status"`
-	Source      string `json:"source"`
+	Reason      string `json:"reason"`
 }
 
 type createCampaignRequest struct {
-	Name        string  `json:"name"`
-	Channel     string  `json:"channel"`
-	DiscountPct float64 `json:"discountPct"`
-	Status      string  `json:"status"`
-	StartAt     string  `json:"startAt"`
-	EndAt       string  `json:"endAt"`
+	Name           string  `json:"name"`
+	Channel        string  `json:"channel"`
+	DiscountPct    float64 `json:"discountPct"`
+	Status         string  `json:"status"`
+	StartAt        string  `json:"startAt"`
+	EndAt          string  `json:"endAt"`
+	CouponCode     string  `json:"couponCode"`
+	ContactChannel string  `json:"contactChannel"`
 }
 
 type memberResponse struct {
-	ID        uint      `json:"id"`
-	Name      string    `json:"name"`
-	Phone     string    `json:"phone"`
-	Channel   string    `json:"channel"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID            uint          `json:"id"`
+	Name          string        `json:"name"`
+	Phone         string        `json:"phone"`
+	PhoneMasked   bool          `json:"phoneMasked"`
+	Channel       string        `json:"channel"`
+	Tier          string        `json:"tier"`
+	PointsBalance int64         `json:"pointsBalance"`
+	CreatedAt     time.Time     `json:"createdAt"`
+	DeletedAt     *time.Time    `json:"deletedAt"`
+	Tags          []tagResponse `json:"tags,omitempty"`
 }
 
 type orderResponse struct {
-	ID          uint       `json:"id"`
-	OrderNo     string     `json:"orderNo"`
-	MemberID    uint       `json:"memberId"`
-	MemberName  string     `json:"memberName"`
-	AmountCents int64      `json:"amountCents"`
-	Status      string     `json:"status"`
-	Source      string     `json:"source"`
-	PaidAt      *time.Time `json:"paidAt"`
-	CreatedAt   time.Time  `json:"createdAt"`
+	ID            uint                `json:"id"`
+	OrderNo       string              `json:"orderNo"`
+	MemberID      uint                `json:"memberId"`
+	MemberName    string              `json:"memberName"`
+	AmountCents   int64               `json:"amountCents"`
+	Status        string              `json:"status"`
+	Source        string              `json:"source"`
+	PaidAt        *time.Time          `json:"paidAt"`
+	CampaignID    *uint               `json:"campaignId"`
+	CouponCode    string              `json:"couponCode"`
+	RefundedCents int64               `json:"refundedCents"`
+	Items         []orderItemResponse `json:"items"`
+	CreatedAt     time.Time           `json:"createdAt"`
+}
+
+type refundResponse struct {
+	ID          uint      `json:"id"`
+	OrderID     uint      `json:"orderId"`
+	AmountCents int64     `json:"amountCents"`
+	Reason      string    `json:"reason"`
+	Operator    string    `json:"operator"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type orderRefundPayload struct {
+	Refund refundResponse `json:"refund"`
+	Order  orderResponse  `json:"order"`
 }
 
 type campaignResponse struct {
-	ID          uint       `json:"id"`
-	Name        string     `json:"name"`
-	Channel     string     `json:"channel"`
-	DiscountPct float64    `json:"discountPct"`
-	Status      string     `json:"status"`
-	StartAt     *time.Time `json:"startAt"`
-	EndAt       *time.Time `json:"endAt"`
-	CreatedAt   time.Time  `json:"createdAt"`
+	ID             uint       `json:"id"`
+	Name           string     `json:"name"`
+	Channel        string     `json:"channel"`
+	DiscountPct    float64    `json:"discountPct"`
+	Status         string     `json:"status"`
+	StartAt        *time.Time `json:"startAt"`
+	EndAt          *time.Time `json:"endAt"`
+	CouponCode     string     `json:"couponCode"`
+	ContactChannel string     `json:"contactChannel"`
+	CreatedAt      time.Time  `json:"createdAt"`
 }
 
 type followupResponse struct {
@@ -88,17 +167,20 @@ type followupMemberResult struct {
 	PaidAmountCents  int64      `json:"paidAmountCents"`
 	LastPaidAt       *time.Time `json:"lastPaidAt"`
 	DaysSinceLastPay int        `json:"daysSinceLastPay"`
+	OpenTaskID       *uint      `json:"openTaskId"`
 }
 
 type summaryResponse struct {
-	MemberCount         int64             `json:"memberCount"`
-	OrderCount          int64             `json:"orderCount"`
-	PaidOrderCount      int64             `json:"paidOrderCount"`
-	RevenueCents        int64             `json:"revenueCents"`
-	RepurchaseCount     int64             `json:"repurchaseCount"`
-	RepurchaseRate      float64           `json:"repurchaseRate"`
-	ActiveCampaignCount int64             `json:"activeCampaignCount"`
-	ChannelBreakdown    []channelResponse `json:"channelBreakdown"`
+	MemberCount         int64               `json:"memberCount"`
+	OrderCount          int64               `json:"orderCount"`
+	PaidOrderCount      int64               `json:"paidOrderCount"`
+	RevenueCents        int64               `json:"revenueCents"`
+	RefundedCents       int64               `json:"refundedCents"`
+	RepurchaseCount     int64               `json:"repurchaseCount"`
+	RepurchaseRate      float64             `json:"repurchaseRate"`
+	ActiveCampaignCount int64               `json:"activeCampaignCount"`
+	ChannelBreakdown    []channelResponse   `json:"channelBreakdown"`
+	TierBreakdown       []tierCountResponse `json:"tierBreakdown"`
 }
 
 type channelResponse struct {
@@ -119,32 +201,108 @@ type campaignAttributionRow struct {
 	RepurchaseConvertedCount int64      `json:"repurchaseConvertedCount"`
 	RevenueCents             int64      `json:"revenueCents"`
 	ConversionRate           float64    `json:"conversionRate"`
+	AttributedOrders         float64    `json:"attributedOrders"`
+	AttributedRevenueCents   float64    `json:"attributedRevenueCents"`
 }
 
 type campaignAttributionPayload struct {
-	Rows []campaignAttributionRow `json:"rows"`
+	Mode  string                   `json:"mode"`
+	Model string                   `json:"model"`
+	Rows  []campaignAttributionRow `json:"rows"`
 }
 
-func registerMerchantRoutes(router *gin.Engine, database *gorm.DB, cacheStore cache.Store) {
-	api := router.Group("/api/v1")
+func registerMerchantRoutes(
+	router *gin.Engine,
+	database *gorm.DB,
+	cacheStore cache.Store,
+	sessions *sessionStore,
+	driver string,
+	phoneRegion string,
+	signer consent.Signer,
+) {
+	dialect := db.DialectFor(driver)
+	api := router.Group("/api/v1", requireRouteAccess(sessions, merchantRouteAccess))
+	// Only create routes replay responses; actions such as a phone reveal must
+	// run, and be logged, every time.
+	idempotent := requireIdempotency(cacheStore)
 	{
-		api.GET("/members", listMembersHandler(database))
-		api.POST("/members", createMemberHandler(database, cacheStore))
+		api.GET("/members", listMembersHandler(database, phoneRegion))
+		api.POST("/members", idempotent, createMemberHandler(database, cacheStore, phoneRegion))
+		api.POST("/members/import", idempotent, importMembersHandler(database, cacheStore, phoneRegion))
+		api.GET("/members/import/errors/:reportId", memberImportErrorsHandler(cacheStore))
+		api.GET("/members/duplicates", memberDuplicatesHandler(database, phoneRegion))
+		api.POST("/members/merge", mergeMembersHandler(database, cacheStore, phoneRegion))
+		api.GET("/members/:id", memberDetailHandler(database, dialect))
+		api.PUT("/members/:id", updateMemberHandler(database, cacheStore, phoneRegion))
+		api.DELETE("/members/:id", deleteMemberHandler(database, cacheStore))
+		api.POST("/members/:id/restore", restoreMemberHandler(database, cacheStore))
+		api.POST("/members/:id/phone/reveal", revealPhoneHandler(database))
+		api.GET("/pii-access-logs", listPIIAccessLogsHandler(database))
+		api.PUT("/members/:id/tags", setMemberTagsHandler(database))
+		api.GET("/members/:id/points", memberPointsHandler(database))
+		api.POST("/members/:id/points/redeem", redeemPointsHandler(database))
+
+		api.GET("/members/:id/consents", memberConsentsHandler(database, signer))
+		api.PUT("/members/:id/consents/:channel", updateMemberConsentHandler(database, signer))
+		api.GET("/members/:id/notes", listMemberNotesHandler(database))
+		api.POST("/members/:id/notes", idempotent, createMemberNoteHandler(database))
+		api.GET("/members/:id/tier-changes", memberTierChangesHandler(database))
+		api.GET("/tiers", listTiersHandler(database))
+		api.POST("/tiers", idempotent, createTierHandler(database))
+		api.POST("/tiers/recalculate", recalculateTiersHandler(database, cacheStore))
+		api.PUT("/tiers/:id", updateTierHandler(database))
+		api.DELETE("/tiers/:id", deleteTierHandler(database, cacheStore))
+
+		api.GET("/points-rules", listPointsRulesHandler(database))
+		api.POST("/points-rules", idempotent, createPointsRuleHandler(database))
+		api.PUT("/points-rules/:id", updatePointsRuleHandler(database))
+		api.DELETE("/points-rules/:id", deletePointsRuleHandler(database))
+
+		api.GET("/tags", listTagsHandler(database))
+		api.POST("/tags", idempotent, createTagHandler(database))
+		api.PUT("/tags/:id", updateTagHandler(database))
+		api.DELETE("/tags/:id", deleteTagHandler(database))
+
+		api.GET("/segments", listSegmentsHandler(database))
+		api.POST("/segments", idempotent, createSegmentHandler(database))
+		api.PUT("/segments/:id", updateSegmentHandler(database))
+		api.DELETE("/segments/:id", deleteSegmentHandler(database))
+		api.GET("/segments/:id/members", segmentMembersHandler(database))
 
 		api.GET("/orders", listOrdersHandler(database))
-		api.POST("/orders", createOrderHandler(database, cacheStore))
+		api.POST("/orders", idempotent, createOrderHandler(database, cacheStore))
+		api.PATCH("/orders/:id/status", updateOrderStatusHandler(database, cacheStore))
+		api.GET("/orders/:id/refunds", listOrderRefundsHandler(database))
+		api.POST("/orders/:id/refunds", idempotent, createOrderRefundHandler(database, cacheStore))
 
-		api.GET("/campaigns", listCampaignsHandler(database))
-		api.POST("/campaigns", createCampaignHandler(database, cacheStore))
+		api.GET("/products", listProductsHandler(database))
+		api.POST("/products", idempotent, createProductHandler(database))
+		api.GET("/products/:id", getProductHandler(database))
+		api.PUT("/products/:id", updateProductHandler(database))
+		api.DELETE("/products/:id", deleteProductHandler(database))
 
-		api.GET("/followups", listFollowupsHandler(database))
+		api.GET("/campaigns", listCampaignsHandler(database))
+		api.POST("/campaigns", idempotent, createCampaignHandler(database, cacheStore))
+		api.PUT("/campaigns/:id", updateCampaignHandler(database))
+		api.POST("/campaigns/:id/activate", campaignTransitionHandler(database, cacheStore, db.CampaignActionActivated))
+		api.POST("/campaigns/:id/close", campaignTransitionHandler(database, cacheStore, db.CampaignActionClosed))
+		api.POST("/campaigns/:id/clone", idempotent, cloneCampaignHandler(database))
+		api.GET("/campaigns/:id/changes", listCampaignChangesHandler(database))
+		api.GET("/campaigns/:id/audience", campaignAudienceHandler(database))
+
+		api.GET("/followups", listFollowupsHandler(database, dialect))
+		api.GET("/followup-tasks", listFollowupTasksHandler(database))
+		api.POST("/followup-tasks", idempotent, createFollowupTaskHandler(database))
+		api.PUT("/followup-tasks/:id", updateFollowupTaskHandler(database))
+		api.POST("/followup-tasks/:id/complete", completeFollowupTaskHandler(database))
 		api.GET("/reports/campaign-attribution", campaignAttributionHandler(database))
 		api.GET("/reports/campaign-attribution/export", campaignAttributionCSVHandler(database))
+		api.GET("/reports/product-sales", productSalesHandler(database))
 		api.GET("/summary", summaryHandler(database, cacheStore))
 	}
 }
 
-func createMemberHandler(database *gorm.DB, cacheStore cache.Store) gin.HandlerFunc {
+func createMemberHandler(database *gorm.DB, cacheStore cache.Store, phoneRegion string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req createMemberRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -160,6 +318,12 @@ func createMemberHandler(database *gorm.DB, cacheStore cache.Store) gin.HandlerF
 			fail(c, 400, "name, phone and channel are required")
 			return
 		}
+		normalized, err := phone.Normalize(req.Phone, phoneRegion)
+		if err != nil {
+			fail(c, 400, err.Error())
+			return
+		}
+		req.Phone = normalized
 
 		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
 		defer cancel()
@@ -171,7 +335,7 @@ func createMemberHandler(database *gorm.DB, cacheStore cache.Store) gin.HandlerF
 		}
 		if err := database.WithContext(ctx).Create(&member).Error; err != nil {
 			if strings.Contains(strings.ToLower(err.Error()), "unique") {
-				fail(c, 400, "phone already exists")
+				failPhoneTaken(c, database, req.Phone)
 				return
 			}
 			fail(c, 500, "create member failed")
@@ -179,11 +343,176 @@ func createMemberHandler(database *gorm.DB, cacheStore cache.Store) gin.HandlerF
 		}
 
 		_ = cacheStore.Delete(ctx, summaryCacheKey)
-		ok(c, toMemberResponse(member))
+		ok(c, toMemberResponse(member, piiViewFor(c)))
+	}
+}
+
+func updateMemberHandler(database *gorm.DB, cacheStore cache.Store, phoneRegion string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		memberID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid member id")
+			return
+		}
+
+		var req createMemberRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid member payload")
+			return
+		}
+
+		req.Name = strings.TrimSpace(req.Name)
+		req.Phone = strings.TrimSpace(req.Phone)
+		req.Channel = strings.TrimSpace(req.Channel)
+
+		if req.Name == "" || req.Phone == "" || req.Channel == "" {
+			fail(c, 400, "name, phone and channel are required")
+			return
+		}
+		normalized, err := phone.Normalize(req.Phone, phoneRegion)
+		if err != nil {
+			fail(c, 400, err.Error())
+			return
+		}
+		req.Phone = normalized
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var member db.Member
+		if err := database.WithContext(ctx).First(&member, memberID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "member not found")
+				return
+			}
+			fail(c, 500, "query member failed")
+			return
+		}
+
+		if err := database.WithContext(ctx).Model(&member).Updates(map[string]interface{}{
+			"name":    req.Name,
+			"phone":   req.Phone,
+			"channel": req.Channel,
+		}).Error; err != nil {
+			if strings.Contains(strings.ToLower(err.Error()), "unique") {
+				failPhoneTaken(c, database, req.Phone)
+				return
+			}
+			fail(c, 500, "update member failed")
+			return
+		}
+		member.Name = req.Name
+		member.Phone = req.Phone
+		member.Channel = req.Channel
+
+		_ = cacheStore.Delete(ctx, summaryCacheKey)
+		ok(c, toMemberResponse(member, piiViewFor(c)))
 	}
 }
 
-func listMembersHandler(database *gorm.DB) gin.HandlerFunc {
+// deleteMemberHandler soft-deletes a member; orders stay for historical revenue.
+func deleteMemberHandler(database *gorm.DB, cacheStore cache.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		memberID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid member id")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		result := database.WithContext(ctx).Delete(&db.Member{}, memberID)
+		if result.Error != nil {
+			fail(c, 500, "delete member failed")
+			return
+		}
+		if result.RowsAffected == 0 {
+			fail(c, 404, "member not found")
+			return
+		}
+
+		_ = cacheStore.Delete(ctx, summaryCacheKey)
+		ok(c, gin.H{"id": memberID})
+	}
+}
+
+// failPhoneTaken answers a unique violation on phone. The index still holds
+// soft-deleted members, which the normal list hides, so for those staff get a
+// 409 naming the member to restore instead of a bare duplicate error.
+func failPhoneTaken(c *gin.Context, database *gorm.DB, number string) {
+	var owner db.Member
+	err := database.WithContext(c.Request.Context()).
+		Unscoped().
+		Where("phone = ? AND deleted_at IS NOT NULL", number).
+		Take(&owner).Error
+	switch {
+	case err == nil:
+		fail(c, 409, deletedPhoneOwnerMessage(owner.ID))
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		fail(c, 400, "phone already exists")
+	default:
+		fail(c, 500, "query member failed")
+	}
+}
+
+func deletedPhoneOwnerMessage(memberID uint) string {
+	return fmt.Sprintf("phone belongs to deleted member %d, restore it with POST /api/v1/members/%d/restore", memberID, memberID)
+}
+
+func restoreMemberHandler(database *gorm.DB, cacheStore cache.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		memberID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid member id")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		// A merged member's orders and history live on the target now.
+		var merge db.MemberMerge
+		err := database.WithContext(ctx).Where("source_id = ?", memberID).Take(&merge).Error
+		switch {
+		case err == nil:
+			fail(c, 409, fmt.Sprintf("member was merged into member %d and cannot be restored", merge.TargetID))
+			return
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			fail(c, 500, "query member merge failed")
+			return
+		}
+
+		result := database.WithContext(ctx).
+			Unscoped().
+			Model(&db.Member{}).
+			Where("id = ? AND deleted_at IS NOT NULL", memberID).
+			Update("deleted_at", nil)
+		if result.Error != nil {
+			fail(c, 500, "restore member failed")
+			return
+		}
+		if result.RowsAffected == 0 {
+			fail(c, 404, "deleted member not found")
+			return
+		}
+
+		var member db.Member
+		if err := database.WithContext(ctx).First(&member, memberID).Error; err != nil {
+			fail(c, 500, "query member failed")
+			return
+		}
+
+		_ = cacheStore.Delete(ctx, summaryCacheKey)
+		ok(c, toMemberResponse(member, piiViewFor(c)))
+	}
+}
+
+// listMembersHandler lists active members; deleted=true lists soft-deleted
+// ones instead so they can be restored. Sessions that see masked phones only
+// match q against the whole number, otherwise a digit-by-digit substring
+// search would recover what the mask hides.
+func listMembersHandler(database *gorm.DB, phoneRegion string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
 		defer cancel()
@@ -192,9 +521,24 @@ func listMembersHandler(database *gorm.DB) gin.HandlerFunc {
 		limit := parseLimit(c.Query("limit"), 20)
 
 		query := database.WithContext(ctx).Model(&db.Member{}).Order("id DESC").Limit(limit)
+		if c.Query("deleted") == "true" {
+			query = query.Unscoped().Where("deleted_at IS NOT NULL")
+		}
 		if keyword != "" {
 			like := "%" + keyword + "%"
-			query = query.Where("name LIKE ? OR phone LIKE ?", like, like)
+			if piiViewFor(c).PhoneMasked() {
+				normalized, err := phone.Normalize(keyword, phoneRegion)
+				if err != nil {
+					query = query.Where("name LIKE ?", like)
+				} else {
+					query = query.Where("name LIKE ? OR phone = ?", like, normalized)
+				}
+			} else {
+				query = query.Where("name LIKE ? OR phone LIKE ?", like, like)
+			}
+		}
+		if tierCode, filtered := c.GetQuery("tier"); filtered {
+			query = query.Where("tier_code = ?", strings.ToLower(strings.TrimSpace(tierCode)))
 		}
 
 		members := make([]db.Member, 0, limit)
@@ -203,9 +547,10 @@ func listMembersHandler(database *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		pii := piiViewFor(c)
 		result := make([]memberResponse, 0, len(members))
 		for _, member := range members {
-			result = append(result, toMemberResponse(member))
+			result = append(result, toMemberResponse(member, pii))
 		}
 
 		ok(c, result)
@@ -223,16 +568,17 @@ func createOrderHandler(database *gorm.DB, cacheStore cache.Store) gin.HandlerFu
 		req.Source = strings.TrimSpace(req.Source)
 		req.Status = strings.TrimSpace(strings.ToLower(req.Status))
 		req.OrderNo = strings.TrimSpace(req.OrderNo)
+		req.CouponCode = normalizeCouponCode(req.CouponCode)
 
-		if req.MemberID == 0 || req.AmountCents <= 0 || req.Source == "" {
-			fail(c, 400, "memberId, amountCents and source are required")
+		if req.MemberID == 0 || req.Source == "" || req.AmountCents < 0 || (req.AmountCents == 0 && len(req.Items) == 0) {
+			fail(c, 400, "memberId, amountCents (or items) and source are required")
 			return
 		}
 		if req.Status == "" {
 			req.Status = "paid"
 		}
-		if !isSupportedOrderStatus(req.Status) {
-			fail(c, 400, "status must be pending, paid or refunded")
+		if !isInitialOrderStatus(req.Status) {
+			fail(c, 400, "status must be pending or paid")
 			return
 		}
 		if req.OrderNo == "" {
@@ -252,6 +598,41 @@ func createOrderHandler(database *gorm.DB, cacheStore cache.Store) gin.HandlerFu
 			return
 		}
 
+		campaignID, err := resolveOrderCampaign(ctx, database, req.CampaignID, req.CouponCode)
+		if err != nil {
+			switch {
+			case errors.Is(err, errCampaignNotFound), errors.Is(err, errCouponNotFound), errors.Is(err, errCouponMismatch):
+				fail(c, 400, err.Error())
+				return
+			}
+			fail(c, 500, "query campaign failed")
+			return
+		}
+
+		// Items are priced from their SKUs; the order total is their sum unless
+		// amountCents was given, e.g. after an order-level discount.
+		var items []db.OrderItem
+		if len(req.Items) > 0 {
+			items, err = buildOrderItems(ctx, database, req.Items)
+			if err != nil {
+				if errors.Is(err, errInvalidOrderItems) {
+					fail(c, 400, err.Error())
+					return
+				}
+				fail(c, 500, "query skus failed")
+				return
+			}
+			if req.AmountCents == 0 {
+				for _, item := range items {
+					req.AmountCents += item.AmountCents
+				}
+			}
+			if req.AmountCents <= 0 {
+				fail(c, 400, "amountCents must be positive")
+				return
+			}
+		}
+
 		var paidAt *time.Time
 		if req.Status == "paid" {
 			now := time.Now()
@@ -265,9 +646,29 @@ func createOrderHandler(database *gorm.DB, cacheStore cache.Store) gin.HandlerFu
 			Status:      req.Status,
 			Source:      req.Source,
 			PaidAt:      paidAt,
+			CampaignID:  campaignID,
+			CouponCode:  req.CouponCode,
+			Items:       items,
 		}
 
-		if err := database.WithContext(ctx).Create(&order).Error; err != nil {
+		changedBy := sessionFromContext(c).UserName
+		err = database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&order).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&db.OrderStatusHistory{
+				OrderID:   order.ID,
+				ToStatus:  order.Status,
+				ChangedBy: changedBy,
+			}).Error; err != nil {
+				return err
+			}
+			if order.Status != "paid" {
+				return nil
+			}
+			return awardOrderPoints(tx, order, changedBy)
+		})
+		if err != nil {
 			if strings.Contains(strings.ToLower(err.Error()), "unique") {
 				fail(c, 400, "orderNo already exists")
 				return
@@ -281,6 +682,133 @@ func createOrderHandler(database *gorm.DB, cacheStore cache.Store) gin.HandlerFu
 	}
 }
 
+// updateOrderStatusHandler moves an order along orderStatusTransitions. The
+// update is conditional on the status read, so concurrent transitions of the
+// same order cannot both succeed.
+func updateOrderStatusHandler(database *gorm.DB, cacheStore cache.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid order id")
+			return
+		}
+
+		var req updateOrderStatusRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid order status payload")
+			return
+		}
+		req.Status = strings.TrimSpace(strings.ToLower(req.Status))
+		req.Note = strings.TrimSpace(req.Note)
+		if !isSupportedOrderStatus(req.Status) {
+			fail(c, 400, "status must be pending, paid, refunded or cancelled")
+			return
+		}
+		if len([]rune(req.Note)) > 200 {
+			fail(c, 400, "note must be at most 200 characters")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var order db.Order
+		if err := database.WithContext(ctx).Preload("Member", withDeleted).Preload("Items").First(&order, orderID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "order not found")
+				return
+			}
+			fail(c, 500, "query order failed")
+			return
+		}
+		if !canTransitionOrderStatus(order.Status, req.Status) {
+			fail(c, 400, fmt.Sprintf("order cannot move from %s to %s", order.Status, req.Status))
+			return
+		}
+
+		// Entering paid stamps the payment time; cancelling clears it. A refund
+		// keeps PaidAt so the order stays in the period it was paid in, and
+		// writes whatever partial refunds left as one Refund row so the ledger
+		// and RefundedCents agree with createOrderRefundHandler.
+		paidAt := order.PaidAt
+		switch req.Status {
+		case "paid":
+			now := time.Now()
+			paidAt = &now
+		case "cancelled":
+			paidAt = nil
+		}
+
+		fromStatus := order.Status
+		changedBy := sessionFromContext(c).UserName
+		remainingCents := order.AmountCents - order.RefundedCents
+		err := database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			updates := map[string]interface{}{
+				"status":  req.Status,
+				"paid_at": paidAt,
+			}
+			query := tx.Model(&db.Order{}).Where("id = ? AND status = ?", order.ID, fromStatus)
+			if req.Status == "refunded" {
+				updates["refunded_cents"] = order.AmountCents
+				query = query.Where("refunded_cents = ?", order.RefundedCents)
+			}
+			result := query.Updates(updates)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errOrderStatusConflict
+			}
+			if err := tx.Create(&db.OrderStatusHistory{
+				OrderID:    order.ID,
+				FromStatus: fromStatus,
+				ToStatus:   req.Status,
+				Note:       req.Note,
+				ChangedBy:  changedBy,
+			}).Error; err != nil {
+				return err
+			}
+			switch req.Status {
+			case "paid":
+				return awardOrderPoints(tx, order, changedBy)
+			case "refunded":
+				if remainingCents > 0 {
+					reason := req.Note
+					if reason == "" {
+						reason = "refunded by status change"
+					}
+					if err := tx.Create(&db.Refund{
+						OrderID:     order.ID,
+						AmountCents: remainingCents,
+						Reason:      reason,
+						Operator:    changedBy,
+					}).Error; err != nil {
+						return err
+					}
+				}
+				return reverseOrderPoints(tx, order, order.AmountCents, changedBy)
+			}
+			return nil
+		})
+		if err != nil {
+			if errors.Is(err, errOrderStatusConflict) {
+				fail(c, 409, err.Error())
+				return
+			}
+			fail(c, 500, "update order status failed")
+			return
+		}
+
+		order.Status = req.Status
+		order.PaidAt = paidAt
+		if req.Status == "refunded" {
+			order.RefundedCents = order.AmountCents
+		}
+		_ = cacheStore.Delete(ctx, summaryCacheKey)
+		ok(c, toOrderResponse(order, order.Member.Name))
+	}
+}
+
 func listOrdersHandler(database *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
@@ -289,7 +817,7 @@ func listOrdersHandler(database *gorm.DB) gin.HandlerFunc {
 		limit := parseLimit(c.Query("limit"), 20)
 		memberID := parseUint(c.Query("memberId"))
 
-		query := database.WithContext(ctx).Model(&db.Order{}).Preload("Member").Order("id DESC").Limit(limit)
+		query := database.WithContext(ctx).Model(&db.Order{}).Preload("Member", withDeleted).Preload("Items").Order("id DESC").Limit(limit)
 		if memberID > 0 {
 			query = query.Where("member_id = ?", memberID)
 		}
@@ -309,61 +837,201 @@ func listOrdersHandler(database *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-func createCampaignHandler(database *gorm.DB, cacheStore cache.Store) gin.HandlerFunc {
+// createOrderRefundHandler records a partial or full refund of a paid order.
+// The order's RefundedCents is raised with a guarded update so concurrent
+// refunds can never exceed the paid amount; the last refund that brings it to
+// the full amount also moves the order to refunded.
+func createOrderRefundHandler(database *gorm.DB, cacheStore cache.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var req createCampaignRequest
+		orderID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid order id")
+			return
+		}
+
+		var req createRefundRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			fail(c, 400, "invalid campaign payload")
+			fail(c, 400, "invalid refund payload")
+			return
+		}
+		req.Reason = strings.TrimSpace(req.Reason)
+		if req.AmountCents <= 0 {
+			fail(c, 400, "amountCents must be positive")
+			return
+		}
+		if len([]rune(req.Reason)) > 200 {
+			fail(c, 400, "reason must be at most 200 characters")
 			return
 		}
 
-		req.Name = strings.TrimSpace(req.Name)
-		req.Channel = strings.TrimSpace(req.Channel)
-		req.Status = strings.TrimSpace(strings.ToLower(req.Status))
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
 
-		if req.Name == "" || req.Channel == "" {
-			fail(c, 400, "name and channel are required")
+		var order db.Order
+		if err := database.WithContext(ctx).Preload("Member", withDeleted).Preload("Items").First(&order, orderID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "order not found")
+				return
+			}
+			fail(c, 500, "query order failed")
 			return
 		}
-		if req.DiscountPct <= 0 || req.DiscountPct > 100 {
-			fail(c, 400, "discountPct must be in (0, 100]")
+		if order.Status != "paid" {
+			fail(c, 400, "only paid orders can be refunded")
 			return
 		}
-		if req.Status == "" {
-			req.Status = "active"
-		}
-		if !isSupportedCampaignStatus(req.Status) {
-			fail(c, 400, "status must be draft, active or closed")
+		refundable := order.AmountCents - order.RefundedCents
+		if req.AmountCents > refundable {
+			fail(c, 400, fmt.Sprintf("amountCents exceeds refundable %d", refundable))
 			return
 		}
 
-		startAt, err := parseOptionalRFC3339(req.StartAt)
+		operator := sessionFromContext(c).UserName
+		refund := db.Refund{
+			OrderID:     order.ID,
+			AmountCents: req.AmountCents,
+			Reason:      req.Reason,
+			Operator:    operator,
+		}
+		// Whether this refund completes the order is decided inside the
+		// transaction, so concurrent partials that add up to the full amount
+		// still move it to refunded.
+		var refundedCents int64
+		err := database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&db.Order{}).
+				Where("id = ? AND status = ? AND refunded_cents + ? <= amount_cents", order.ID, "paid", req.AmountCents).
+				Update("refunded_cents", gorm.Expr("refunded_cents + ?", req.AmountCents))
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errRefundConflict
+			}
+			if err := tx.Create(&refund).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&db.Order{}).Where("id = ?", order.ID).Select("refunded_cents").Scan(&refundedCents).Error; err != nil {
+				return err
+			}
+			if err := reverseOrderPoints(tx, order, refundedCents, operator); err != nil {
+				return err
+			}
+			if refundedCents != order.AmountCents {
+				return nil
+			}
+			result = tx.Model(&db.Order{}).Where("id = ? AND status = ?", order.ID, "paid").Update("status", "refunded")
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errRefundConflict
+			}
+			return tx.Create(&db.OrderStatusHistory{
+				OrderID:    order.ID,
+				FromStatus: "paid",
+				ToStatus:   "refunded",
+				Note:       "fully refunded",
+				ChangedBy:  operator,
+			}).Error
+		})
 		if err != nil {
-			fail(c, 400, "startAt must be RFC3339 format")
+			if errors.Is(err, errRefundConflict) {
+				fail(c, 409, err.Error())
+				return
+			}
+			fail(c, 500, "create refund failed")
 			return
 		}
-		endAt, err := parseOptionalRFC3339(req.EndAt)
-		if err != nil {
-			fail(c, 400, "endAt must be RFC3339 format")
+
+		order.RefundedCents = refundedCents
+		if refundedCents == order.AmountCents {
+			order.Status = "refunded"
+		}
+		_ = cacheStore.Delete(ctx, summaryCacheKey)
+		ok(c, orderRefundPayload{
+			Refund: toRefundResponse(refund),
+			Order:  toOrderResponse(order, order.Member.Name),
+		})
+	}
+}
+
+func listOrderRefundsHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid order id")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		refunds := make([]db.Refund, 0)
+		if err := database.WithContext(ctx).Where("order_id = ?", orderID).Order("id ASC").Find(&refunds).Error; err != nil {
+			fail(c, 500, "list refunds failed")
 			return
 		}
-		if startAt != nil && endAt != nil && endAt.Before(*startAt) {
-			fail(c, 400, "endAt cannot be earlier than startAt")
+
+		result := make([]refundResponse, 0, len(refunds))
+		for _, refund := range refunds {
+			result = append(result, toRefundResponse(refund))
+		}
+		ok(c, result)
+	}
+}
+
+func createCampaignHandler(database *gorm.DB, cacheStore cache.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req createCampaignRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid campaign payload")
+			return
+		}
+		if strings.TrimSpace(req.Status) == "" {
+			req.Status = "active"
+		}
+		startAt, endAt, msg := normalizeCampaignRequest(&req)
+		if msg != "" {
+			fail(c, 400, msg)
 			return
 		}
 
 		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
 		defer cancel()
 
+		if req.CouponCode != "" {
+			taken, err := couponCodeTaken(ctx, database, req.CouponCode, 0)
+			if err != nil {
+				fail(c, 500, "query campaign failed")
+				return
+			}
+			if taken {
+				fail(c, 400, "couponCode already exists")
+				return
+			}
+		}
+
 		campaign := db.Campaign{
-			Name:        req.Name,
-			Channel:     req.Channel,
-			DiscountPct: req.DiscountPct,
-			Status:      req.Status,
-			StartAt:     startAt,
-			EndAt:       endAt,
+			Name:           req.Name,
+			Channel:        req.Channel,
+			DiscountPct:    req.DiscountPct,
+			Status:         req.Status,
+			StartAt:        startAt,
+			EndAt:          endAt,
+			CouponCode:     req.CouponCode,
+			ContactChannel: req.ContactChannel,
 		}
-		if err := database.WithContext(ctx).Create(&campaign).Error; err != nil {
+		err := database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&campaign).Error; err != nil {
+				return err
+			}
+			return tx.Create(&db.CampaignChange{
+				CampaignID: campaign.ID,
+				Action:     db.CampaignActionCreated,
+				ChangedBy:  sessionFromContext(c).UserName,
+			}).Error
+		})
+		if err != nil {
 			fail(c, 500, "create campaign failed")
 			return
 		}
@@ -404,7 +1072,91 @@ func listCampaignsHandler(database *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-func listFollowupsHandler(database *gorm.DB) gin.HandlerFunc {
+// campaignAudienceHandler pages the members a campaign targets: members
+// acquired on its channel, without those who opted out of its contact channel.
+func campaignAudienceHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		campaignID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid campaign id")
+			return
+		}
+		current := parseIntWithBounds(c.Query("current"), 1, 1, 1000)
+		size := parseIntWithBounds(c.Query("size"), 20, 1, 200)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		var campaign db.Campaign
+		if err := database.WithContext(ctx).First(&campaign, campaignID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "campaign not found")
+				return
+			}
+			fail(c, 500, "query campaign failed")
+			return
+		}
+
+		query := database.WithContext(ctx).
+			Model(&db.Member{}).
+			Where("channel = ?", campaign.Channel).
+			Where("id NOT IN (?)", optedOutMemberIDs(database, campaign.ContactChannel))
+
+		var total int64
+		if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+			fail(c, 500, "count campaign audience failed")
+			return
+		}
+
+		members := make([]db.Member, 0, size)
+		if err := query.
+			Order("id ASC").
+			Offset((current - 1) * size).
+			Limit(size).
+			Find(&members).Error; err != nil {
+			fail(c, 500, "list campaign audience failed")
+			return
+		}
+
+		pii := piiViewFor(c)
+		records := make([]memberResponse, 0, len(members))
+		for _, member := range members {
+			records = append(records, toMemberResponse(member, pii))
+		}
+		ok(c, paginatedData{
+			Records: records,
+			Current: current,
+			Size:    size,
+			Total:   int(total),
+		})
+	}
+}
+
+// followupSQL holds the dialect-specific clauses of the follow-up query.
+type followupSQL struct {
+	Select string
+	Having string
+	Order  string
+}
+
+func buildFollowupSQL(dialect db.Dialect) followupSQL {
+	lastPaid := "MAX(" + dialect.EpochSeconds("o.paid_at") + ")"
+	return followupSQL{
+		Select: "m.id AS member_id, m.name AS member_name, m.phone AS phone, m.channel AS channel, " +
+			"COUNT(o.id) AS paid_order_count, COALESCE(SUM(o.amount_cents - o.refunded_cents), 0) AS paid_amount_cents, " +
+			lastPaid + " AS last_paid_unix",
+		Having: "COUNT(o.id) = 1 OR " + lastPaid + " <= ?",
+		Order:  lastPaid + " ASC",
+	}
+}
+
+// listFollowupsHandler lists members due for a repurchase call. Members who
+// opted out of contactChannel (default phone) are never listed. With
+// excludeTasked=true, members with an open follow-up task or one completed in
+// the last taskCooldownDays (default 7) are left out.
+func listFollowupsHandler(database *gorm.DB, dialect db.Dialect) gin.HandlerFunc {
+	clauses := buildFollowupSQL(dialect)
+
 	return func(c *gin.Context) {
 		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
 		defer cancel()
@@ -412,6 +1164,14 @@ func listFollowupsHandler(database *gorm.DB) gin.HandlerFunc {
 		days := parseDays(c.Query("days"), 30)
 		limit := parseLimit(c.Query("limit"), 50)
 		channel := strings.TrimSpace(c.Query("channel"))
+		contactChannel := strings.TrimSpace(strings.ToLower(c.Query("contactChannel")))
+		if contactChannel == "" {
+			contactChannel = db.ConsentChannelPhone
+		}
+		if !isSupportedConsentChannel(contactChannel) {
+			fail(c, 400, "contactChannel must be sms, wechat or phone")
+			return
+		}
 		cutoff := time.Now().AddDate(0, 0, -days)
 
 		type followupRow struct {
@@ -427,30 +1187,51 @@ func listFollowupsHandler(database *gorm.DB) gin.HandlerFunc {
 		rows := make([]followupRow, 0, limit)
 		query := database.WithContext(ctx).
 			Table("members AS m").
-			Select(`
-				m.id AS member_id,
-				m.name AS member_name,
-				m.phone AS phone,
-				m.channel AS channel,
-				COUNT(o.id) AS paid_order_count,
-				COALESCE(SUM(o.amount_cents), 0) AS paid_amount_cents,
-				MAX(CAST(strftime('%s', o.paid_at) AS INTEGER)) AS last_paid_unix
-			`).
+			Select(clauses.Select).
+			Where("m.deleted_at IS NULL").
+			Where("m.id NOT IN (?)", optedOutMemberIDs(database, contactChannel)).
 			Joins("LEFT JOIN orders AS o ON o.member_id = m.id AND o.status = ?", "paid").
 			Group("m.id, m.name, m.phone, m.channel").
-			Having("COUNT(o.id) = 1 OR MAX(CAST(strftime('%s', o.paid_at) AS INTEGER)) <= ?", cutoff.Unix()).
-			Order("MAX(CAST(strftime('%s', o.paid_at) AS INTEGER)) ASC").
+			Having(clauses.Having, cutoff.Unix()).
+			Order(clauses.Order).
 			Limit(limit)
 
 		if channel != "" {
 			query = query.Where("m.channel = ?", channel)
 		}
+		if c.Query("excludeTasked") == "true" {
+			cooldownDays := parseIntWithBounds(c.Query("taskCooldownDays"), 7, 0, 365)
+			query = query.Where("m.id NOT IN (?)", database.
+				Model(&db.FollowupTask{}).
+				Select("member_id").
+				Where("status = ? OR completed_at >= ?", db.FollowupTaskOpen, time.Now().AddDate(0, 0, -cooldownDays)))
+		}
 
 		if err := query.Scan(&rows).Error; err != nil {
 			fail(c, 500, "list followups failed")
 			return
 		}
 
+		memberIDs := make([]uint, 0, len(rows))
+		for _, row := range rows {
+			memberIDs = append(memberIDs, row.MemberID)
+		}
+		openTasks := make(map[uint]uint, len(rows))
+		if len(memberIDs) > 0 {
+			var tasks []db.FollowupTask
+			if err := database.WithContext(ctx).
+				Select("id, member_id").
+				Where("member_id IN ? AND status = ?", memberIDs, db.FollowupTaskOpen).
+				Find(&tasks).Error; err != nil {
+				fail(c, 500, "list follow-up tasks failed")
+				return
+			}
+			for _, task := range tasks {
+				openTasks[task.MemberID] = task.ID
+			}
+		}
+
+		pii := piiViewFor(c)
 		items := make([]followupMemberResult, 0, len(rows))
 		for _, row := range rows {
 			var lastPaidAt *time.Time
@@ -466,16 +1247,20 @@ func listFollowupsHandler(database *gorm.DB) gin.HandlerFunc {
 					daysSinceLastPay = 0
 				}
 			}
-			items = append(items, followupMemberResult{
+			item := followupMemberResult{
 				MemberID:         row.MemberID,
 				MemberName:       row.MemberName,
-				Phone:            row.Phone,
+				Phone:            pii.Phone(row.Phone),
 				Channel:          row.Channel,
 				PaidOrderCount:   row.PaidOrderCount,
 				PaidAmountCents:  row.PaidAmountCents,
 				LastPaidAt:       lastPaidAt,
 				DaysSinceLastPay: daysSinceLastPay,
-			})
+			}
+			if taskID, found := openTasks[row.MemberID]; found {
+				item.OpenTaskID = &taskID
+			}
+			items = append(items, item)
 		}
 
 		ok(c, followupResponse{
@@ -520,17 +1305,29 @@ func summaryHandler(database *gorm.DB, cacheStore cache.Store) gin.HandlerFunc {
 		var paid paidAgg
 		if err := database.WithContext(ctx).
 			Model(&db.Order{}).
-			Select("COUNT(*) AS paid_order_count, COALESCE(SUM(amount_cents), 0) AS revenue_cents").
+			Select("COUNT(*) AS paid_order_count, COALESCE(SUM(amount_cents - refunded_cents), 0) AS revenue_cents").
 			Where("status = ?", "paid").
 			Scan(&paid).Error; err != nil {
 			fail(c, 500, "aggregate orders failed")
 			return
 		}
 
+		var refunded struct {
+			RefundedCents int64 `gorm:"column:refunded_cents"`
+		}
+		if err := database.WithContext(ctx).
+			Model(&db.Refund{}).
+			Select("COALESCE(SUM(amount_cents), 0) AS refunded_cents").
+			Scan(&refunded).Error; err != nil {
+			fail(c, 500, "aggregate refunds failed")
+			return
+		}
+
+		// Repurchase is measured against active members, like memberCount.
 		sub := database.WithContext(ctx).
 			Model(&db.Order{}).
 			Select("member_id").
-			Where("status = ?", "paid").
+			Where("status = ? AND member_id IN (?)", "paid", database.Model(&db.Member{}).Select("id")).
 			Group("member_id").
 			Having("COUNT(*) >= 2")
 
@@ -563,6 +1360,17 @@ func summaryHandler(database *gorm.DB, cacheStore cache.Store) gin.HandlerFunc {
 			})
 		}
 
+		tierRows := make([]tierCountResponse, 0)
+		if err := database.WithContext(ctx).
+			Model(&db.Member{}).
+			Select("tier_code AS tier, COUNT(*) AS member_count").
+			Group("tier_code").
+			Order("member_count DESC").
+			Scan(&tierRows).Error; err != nil {
+			fail(c, 500, "aggregate tiers failed")
+			return
+		}
+
 		repurchaseRate := 0.0
 		if memberCount > 0 {
 			repurchaseRate = math.Round((float64(repurchaseCount)/float64(memberCount))*10000) / 100
@@ -573,10 +1381,12 @@ func summaryHandler(database *gorm.DB, cacheStore cache.Store) gin.HandlerFunc {
 			OrderCount:          orderCount,
 			PaidOrderCount:      paid.PaidOrderCount,
 			RevenueCents:        paid.RevenueCents,
+			RefundedCents:       refunded.RefundedCents,
 			RepurchaseCount:     repurchaseCount,
 			RepurchaseRate:      repurchaseRate,
 			ActiveCampaignCount: activeCampaignCount,
 			ChannelBreakdown:    channelBreakdown,
+			TierBreakdown:       tierRows,
 		}
 
 		setSummaryToCache(ctx, cacheStore, result)
@@ -586,26 +1396,40 @@ func summaryHandler(database *gorm.DB, cacheStore cache.Store) gin.HandlerFunc {
 
 func campaignAttributionHandler(database *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		filter, err := parseCampaignAttributionFilter(c)
+		if err != nil {
+			fail(c, 400, err.Error())
+			return
+		}
+
 		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 		defer cancel()
 
-		rows, err := loadCampaignAttributionRows(ctx, database, c)
+		rows, err := loadCampaignAttributionRows(ctx, database, filter)
 		if err != nil {
 			fail(c, 500, err.Error())
 			return
 		}
 		ok(c, campaignAttributionPayload{
-			Rows: rows,
+			Mode:  filter.Mode,
+			Model: filter.Model,
+			Rows:  rows,
 		})
 	}
 }
 
 func campaignAttributionCSVHandler(database *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		filter, err := parseCampaignAttributionFilter(c)
+		if err != nil {
+			fail(c, 400, err.Error())
+			return
+		}
+
 		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 		defer cancel()
 
-		rows, err := loadCampaignAttributionRows(ctx, database, c)
+		rows, err := loadCampaignAttributionRows(ctx, database, filter)
 		if err != nil {
 			fail(c, 500, err.Error())
 			return
@@ -623,40 +1447,76 @@ func campaignAttributionCSVHandler(database *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-func toMemberResponse(member db.Member) memberResponse {
+func toMemberResponse(member db.Member, pii piiView) memberResponse {
+	var deletedAt *time.Time
+	if member.DeletedAt.Valid {
+		deletedAt = &member.DeletedAt.Time
+	}
+	var tags []tagResponse
+	for _, tag := range member.Tags {
+		tags = append(tags, toTagResponse(tag, 0))
+	}
 	return memberResponse{
-		ID:        member.ID,
-		Name:      member.Name,
-		Phone:     member.Phone,
-		Channel:   member.Channel,
-		CreatedAt: member.CreatedAt,
+		ID:            member.ID,
+		Name:          member.Name,
+		Phone:         pii.Phone(member.Phone),
+		PhoneMasked:   pii.PhoneMasked(),
+		Channel:       member.Channel,
+		Tier:          member.TierCode,
+		PointsBalance: member.PointsBalance,
+		CreatedAt:     member.CreatedAt,
+		DeletedAt:     deletedAt,
+		Tags:          tags,
 	}
 }
 
+// withDeleted preloads soft-deleted members too, so historical orders keep
+// their member name.
+func withDeleted(tx *gorm.DB) *gorm.DB {
+	return tx.Unscoped()
+}
+
 func toOrderResponse(order db.Order, memberName string) orderResponse {
 	return orderResponse{
-		ID:          order.ID,
-		OrderNo:     order.OrderNo,
-		MemberID:    order.MemberID,
-		MemberName:  memberName,
-		AmountCents: order.AmountCents,
-		Status:      order.Status,
-		Source:      order.Source,
-		PaidAt:      order.PaidAt,
-		CreatedAt:   order.CreatedAt,
+		ID:            order.ID,
+		OrderNo:       order.OrderNo,
+		MemberID:      order.MemberID,
+		MemberName:    memberName,
+		AmountCents:   order.AmountCents,
+		Status:        order.Status,
+		Source:        order.Source,
+		PaidAt:        order.PaidAt,
+		CampaignID:    order.CampaignID,
+		CouponCode:    order.CouponCode,
+		RefundedCents: order.RefundedCents,
+		Items:         toOrderItemResponses(order.Items),
+		CreatedAt:     order.CreatedAt,
+	}
+}
+
+func toRefundResponse(refund db.Refund) refundResponse {
+	return refundResponse{
+		ID:          refund.ID,
+		OrderID:     refund.OrderID,
+		AmountCents: refund.AmountCents,
+		Reason:      refund.Reason,
+		Operator:    refund.Operator,
+		CreatedAt:   refund.CreatedAt,
 	}
 }
 
 func toCampaignResponse(campaign db.Campaign) campaignResponse {
 	return campaignResponse{
-		ID:          campaign.ID,
-		Name:        campaign.Name,
-		Channel:     campaign.Channel,
-		DiscountPct: campaign.DiscountPct,
-		Status:      campaign.Status,
-		StartAt:     campaign.StartAt,
-		EndAt:       campaign.EndAt,
-		CreatedAt:   campaign.CreatedAt,
+		ID:             campaign.ID,
+		Name:           campaign.Name,
+		Channel:        campaign.Channel,
+		DiscountPct:    campaign.DiscountPct,
+		Status:         campaign.Status,
+		StartAt:        campaign.StartAt,
+		EndAt:          campaign.EndAt,
+		CouponCode:     campaign.CouponCode,
+		ContactChannel: campaign.ContactChannel,
+		CreatedAt:      campaign.CreatedAt,
 	}
 }
 
@@ -705,6 +1565,12 @@ func parseUint(raw string) uint {
 	return uint(value)
 }
 
+// parseIDParam reads a positive numeric :id path parameter.
+func parseIDParam(c *gin.Context) (uint, bool) {
+	id := parseUint(c.Param("id"))
+	return id, id > 0
+}
+
 func parseOptionalRFC3339(raw string) (*time.Time, error) {
 	raw = strings.TrimSpace(raw)
 	if raw == "" {
@@ -719,13 +1585,35 @@ func parseOptionalRFC3339(raw string) (*time.Time, error) {
 
 func isSupportedOrderStatus(status string) bool {
 	switch status {
-	case "pending", "paid", "refunded":
+	case "pending", "paid", "refunded", "cancelled":
 		return true
 	default:
 		return false
 	}
 }
 
+// isInitialOrderStatus reports whether an order may be created in status;
+// refunded and cancelled orders are only reached through a transition or a
+// refund, which keep the history and refund ledger in step.
+func isInitialOrderStatus(status string) bool {
+	return status == "pending" || status == "paid"
+}
+
+func canTransitionOrderStatus(from, to string) bool {
+	for _, next := range orderStatusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// errOrderStatusConflict reports that the order changed status while a transition was applied.
+var errOrderStatusConflict = errors.New("order status changed, please retry")
+
+// errRefundConflict reports that the order changed while a refund was applied.
+var errRefundConflict = errors.New("order changed during refund, please retry")
+
 func isSupportedCampaignStatus(status string) bool {
 	switch status {
 	case "draft", "active", "closed":
@@ -735,6 +1623,52 @@ func isSupportedCampaignStatus(status string) bool {
 	}
 }
 
+// normalizeCouponCode makes coupon codes case-insensitive.
+func normalizeCouponCode(raw string) string {
+	return strings.ToUpper(strings.TrimSpace(raw))
+}
+
+// Errors returned by resolveOrderCampaign for payloads that cannot be attributed.
+var (
+	errCampaignNotFound = errors.New("campaign not found")
+	errCouponNotFound   = errors.New("couponCode not found")
+	errCouponMismatch   = errors.New("couponCode does not belong to campaignId")
+)
+
+// resolveOrderCampaign returns the campaign an order is explicitly attributed
+// to. A coupon code resolves to its campaign and must agree with campaignId
+// when both are given; neither means the order carries no explicit campaign.
+func resolveOrderCampaign(ctx context.Context, database *gorm.DB, campaignID *uint, couponCode string) (*uint, error) {
+	if campaignID != nil && *campaignID == 0 {
+		campaignID = nil
+	}
+	if campaignID == nil && couponCode == "" {
+		return nil, nil
+	}
+
+	query := database.WithContext(ctx).Model(&db.Campaign{})
+	if couponCode != "" {
+		query = query.Where("coupon_code = ?", couponCode)
+	} else {
+		query = query.Where("id = ?", *campaignID)
+	}
+
+	var campaign db.Campaign
+	if err := query.First(&campaign).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if couponCode != "" {
+				return nil, errCouponNotFound
+			}
+			return nil, errCampaignNotFound
+		}
+		return nil, err
+	}
+	if campaignID != nil && *campaignID != campaign.ID {
+		return nil, errCouponMismatch
+	}
+	return &campaign.ID, nil
+}
+
 func generateOrderNo(memberID uint) string {
 	return fmt.Sprintf("ORD-%d-%d", memberID, time.Now().UnixNano())
 }
@@ -759,106 +1693,165 @@ func setSummaryToCache(ctx context.Context, cacheStore cache.Store, payload summ
 	_ = cacheStore.Set(ctx, summaryCacheKey, string(raw), 45*time.Second)
 }
 
-func loadCampaignAttributionRows(
-	ctx context.Context,
-	database *gorm.DB,
-	c *gin.Context,
-) ([]campaignAttributionRow, error) {
-	limit := parseLimit(c.Query("limit"), 100)
-	status := strings.TrimSpace(strings.ToLower(c.Query("status")))
-	channel := strings.TrimSpace(c.Query("channel"))
-	keyword := strings.TrimSpace(c.Query("q"))
+// campaignAttributionFilter selects which campaigns appear in the attribution report.
+type campaignAttributionFilter struct {
+	Mode    string
+	Model   string
+	Limit   int
+	Status  string
+	Channel string
+	Keyword string
+	From    *time.Time
+	To      *time.Time
+}
+
+func parseCampaignAttributionFilter(c *gin.Context) (campaignAttributionFilter, error) {
+	filter := campaignAttributionFilter{
+		Mode:    strings.TrimSpace(strings.ToLower(c.Query("mode"))),
+		Model:   strings.TrimSpace(strings.ToLower(c.Query("model"))),
+		Limit:   parseLimit(c.Query("limit"), 100),
+		Status:  strings.TrimSpace(strings.ToLower(c.Query("status"))),
+		Channel: strings.TrimSpace(c.Query("channel")),
+		Keyword: strings.TrimSpace(c.Query("q")),
+	}
 
-	from, err := parseOptionalRFC3339(c.Query("from"))
+	if filter.Mode == "" {
+		filter.Mode = attributionModeChannelWindow
+	}
+	if filter.Mode != attributionModeChannelWindow && filter.Mode != attributionModeExplicit {
+		return filter, fmt.Errorf("mode must be channel-window or explicit")
+	}
+	if filter.Model == "" {
+		filter.Model = attributionModelLastTouch
+	}
+	if !isSupportedAttributionModel(filter.Model) {
+		return filter, fmt.Errorf("model must be last-touch, first-touch, linear or time-decay")
+	}
+
+	var err error
+	filter.From, err = parseOptionalRFC3339(c.Query("from"))
 	if err != nil {
-		return nil, fmt.Errorf("from must be RFC3339 format")
+		return filter, fmt.Errorf("from must be RFC3339 format")
 	}
-	to, err := parseOptionalRFC3339(c.Query("to"))
+	filter.To, err = parseOptionalRFC3339(c.Query("to"))
 	if err != nil {
-		return nil, fmt.Errorf("to must be RFC3339 format")
+		return filter, fmt.Errorf("to must be RFC3339 format")
 	}
-	if from != nil && to != nil && to.Before(*from) {
-		return nil, fmt.Errorf("to cannot be earlier than from")
+	if filter.From != nil && filter.To != nil && filter.To.Before(*filter.From) {
+		return filter, fmt.Errorf("to cannot be earlier than from")
 	}
+	return filter, nil
+}
 
-	query := database.WithContext(ctx).Model(&db.Campaign{}).Order("id DESC").Limit(limit)
-	if status != "" {
-		query = query.Where("status = ?", status)
+// loadCampaignAttributionRows computes every campaign metric with set-based
+// queries: one for the campaigns, one for target members per contact channel and one
+// grouped join of campaigns to their paid orders. The join follows filter.Mode:
+// orders inside the channel and window, or orders tagged with the campaign id.
+// Fractional credit under filter.Model is added by applyAttributionModel.
+func loadCampaignAttributionRows(
+	ctx context.Context,
+	database *gorm.DB,
+	filter campaignAttributionFilter,
+) ([]campaignAttributionRow, error) {
+	query := database.WithContext(ctx).Model(&db.Campaign{}).Order("id DESC").Limit(filter.Limit)
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
 	}
-	if channel != "" {
-		query = query.Where("channel = ?", channel)
+	if filter.Channel != "" {
+		query = query.Where("channel = ?", filter.Channel)
 	}
-	if keyword != "" {
-		query = query.Where("name LIKE ?", "%"+keyword+"%")
+	if filter.Keyword != "" {
+		query = query.Where("name LIKE ?", "%"+filter.Keyword+"%")
 	}
-	if from != nil {
-		query = query.Where("created_at >= ?", *from)
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
 	}
-	if to != nil {
-		query = query.Where("created_at <= ?", *to)
+	if filter.To != nil {
+		query = query.Where("created_at <= ?", *filter.To)
 	}
 
-	campaigns := make([]db.Campaign, 0, limit)
+	campaigns := make([]db.Campaign, 0, filter.Limit)
 	if err := query.Find(&campaigns).Error; err != nil {
 		return nil, fmt.Errorf("list campaigns failed")
 	}
+	if len(campaigns) == 0 {
+		return []campaignAttributionRow{}, nil
+	}
 
-	repurchaseMembersSubQuery := database.WithContext(ctx).
-		Model(&db.Order{}).
-		Select("member_id").
-		Where("status = ?", "paid").
-		Group("member_id").
-		Having("COUNT(*) >= 2")
-
-	rows := make([]campaignAttributionRow, 0, len(campaigns))
+	campaignIDs := make([]uint, 0, len(campaigns))
+	channelsByContact := make(map[string][]string)
 	for _, campaign := range campaigns {
-		var targetMemberCount int64
+		campaignIDs = append(campaignIDs, campaign.ID)
+		channelsByContact[campaign.ContactChannel] = append(channelsByContact[campaign.ContactChannel], campaign.Channel)
+	}
+
+	// Target members are counted per contact channel, since members who
+	// opted out of it are not part of the campaign audience.
+	type channelTarget struct {
+		Channel     string `gorm:"column:channel"`
+		MemberCount int64  `gorm:"column:member_count"`
+	}
+	targetByChannel := make(map[[2]string]int64)
+	for contactChannel, channels := range channelsByContact {
+		targets := make([]channelTarget, 0)
 		if err := database.WithContext(ctx).
 			Model(&db.Member{}).
-			Where("channel = ?", campaign.Channel).
-			Count(&targetMemberCount).Error; err != nil {
+			Select("channel, COUNT(*) AS member_count").
+			Where("channel IN ?", channels).
+			Where("id NOT IN (?)", optedOutMemberIDs(database, contactChannel)).
+			Group("channel").
+			Scan(&targets).Error; err != nil {
 			return nil, fmt.Errorf("count target members failed")
 		}
-
-		orderScope := database.WithContext(ctx).
-			Model(&db.Order{}).
-			Where("status = ? AND source = ?", "paid", campaign.Channel)
-		if campaign.StartAt != nil {
-			orderScope = orderScope.Where("paid_at >= ?", *campaign.StartAt)
-		}
-		if campaign.EndAt != nil {
-			orderScope = orderScope.Where("paid_at <= ?", *campaign.EndAt)
-		}
-
-		var paidOrderCount int64
-		if err := orderScope.Count(&paidOrderCount).Error; err != nil {
-			return nil, fmt.Errorf("count paid orders failed")
+		for _, target := range targets {
+			targetByChannel[[2]string{target.Channel, contactChannel}] = target.MemberCount
 		}
+	}
 
-		type revenueAgg struct {
-			RevenueCents int64 `gorm:"column:revenue_cents"`
-		}
-		var revenue revenueAgg
-		if err := orderScope.Select("COALESCE(SUM(amount_cents), 0) AS revenue_cents").Scan(&revenue).Error; err != nil {
-			return nil, fmt.Errorf("aggregate revenue failed")
-		}
+	repurchaseMembersSubQuery := database.WithContext(ctx).
+		Model(&db.Order{}).
+		Select("member_id").
+		Where("status = ?", "paid").
+		Group("member_id").
+		Having("COUNT(*) >= 2")
 
-		var convertedMemberCount int64
-		if err := orderScope.Distinct("member_id").Count(&convertedMemberCount).Error; err != nil {
-			return nil, fmt.Errorf("count converted members failed")
-		}
+	type campaignOrderAgg struct {
+		CampaignID               uint  `gorm:"column:campaign_id"`
+		PaidOrderCount           int64 `gorm:"column:paid_order_count"`
+		RevenueCents             int64 `gorm:"column:revenue_cents"`
+		ConvertedMemberCount     int64 `gorm:"column:converted_member_count"`
+		RepurchaseConvertedCount int64 `gorm:"column:repurchase_converted_count"`
+	}
+	aggs := make([]campaignOrderAgg, 0, len(campaigns))
+	if err := database.WithContext(ctx).
+		Table("campaigns AS c").
+		Select(`
+			c.id AS campaign_id,
+			COUNT(o.id) AS paid_order_count,
+			COALESCE(SUM(o.amount_cents - o.refunded_cents), 0) AS revenue_cents,
+			COUNT(DISTINCT o.member_id) AS converted_member_count,
+			COUNT(DISTINCT rp.member_id) AS repurchase_converted_count
+		`).
+		Joins("JOIN orders AS o ON "+attributionMatchSQL(filter.Mode), "paid").
+		Joins("LEFT JOIN (?) AS rp ON rp.member_id = o.member_id", repurchaseMembersSubQuery).
+		Where("c.id IN ?", campaignIDs).
+		Group("c.id").
+		Scan(&aggs).Error; err != nil {
+		return nil, fmt.Errorf("aggregate campaign orders failed")
+	}
+	aggByCampaign := make(map[uint]campaignOrderAgg, len(aggs))
+	for _, agg := range aggs {
+		aggByCampaign[agg.CampaignID] = agg
+	}
 
-		var repurchaseConvertedCount int64
-		if err := orderScope.
-			Where("member_id IN (?)", repurchaseMembersSubQuery).
-			Distinct("member_id").
-			Count(&repurchaseConvertedCount).Error; err != nil {
-			return nil, fmt.Errorf("count repurchase converted members failed")
-		}
+	rows := make([]campaignAttributionRow, 0, len(campaigns))
+	for _, campaign := range campaigns {
+		targetMemberCount := targetByChannel[[2]string{campaign.Channel, campaign.ContactChannel}]
+		agg := aggByCampaign[campaign.ID]
 
 		conversionRate := 0.0
 		if targetMemberCount > 0 {
-			conversionRate = math.Round((float64(convertedMemberCount)/float64(targetMemberCount))*10000) / 100
+			conversionRate = math.Round((float64(agg.ConvertedMemberCount)/float64(targetMemberCount))*10000) / 100
 		}
 
 		rows = append(rows, campaignAttributionRow{
@@ -869,17 +1862,171 @@ func loadCampaignAttributionRows(
 			StartAt:                  campaign.StartAt,
 			EndAt:                    campaign.EndAt,
 			TargetMemberCount:        targetMemberCount,
-			PaidOrderCount:           paidOrderCount,
-			ConvertedMemberCount:     convertedMemberCount,
-			RepurchaseConvertedCount: repurchaseConvertedCount,
-			RevenueCents:             revenue.RevenueCents,
+			PaidOrderCount:           agg.PaidOrderCount,
+			ConvertedMemberCount:     agg.ConvertedMemberCount,
+			RepurchaseConvertedCount: agg.RepurchaseConvertedCount,
+			RevenueCents:             agg.RevenueCents,
 			ConversionRate:           conversionRate,
 		})
 	}
 
+	if err := applyAttributionModel(ctx, database, filter, campaignIDs, rows); err != nil {
+		return nil, err
+	}
 	return rows, nil
 }
 
+// attributionMatchSQL is the join condition between campaigns c and paid
+// orders o for an attribution mode; it takes the paid status as its argument.
+func attributionMatchSQL(mode string) string {
+	if mode == attributionModeExplicit {
+		return "o.campaign_id = c.id AND o.status = ?"
+	}
+	return `o.source = c.channel AND o.status = ?
+			AND (c.start_at IS NULL OR o.paid_at >= c.start_at)
+			AND (c.end_at IS NULL OR o.paid_at <= c.end_at)`
+}
+
+// attributionTouch is one campaign an order matched, with the time it touched.
+type attributionTouch struct {
+	CampaignID uint
+	TouchedAt  time.Time
+}
+
+// applyAttributionModel fills the fractional order and revenue credit of rows.
+// Every paid order credited to a listed campaign is split across all campaigns
+// it matches, including ones outside the filter, so shares never exceed one.
+func applyAttributionModel(
+	ctx context.Context,
+	database *gorm.DB,
+	filter campaignAttributionFilter,
+	campaignIDs []uint,
+	rows []campaignAttributionRow,
+) error {
+	matchSQL := "JOIN campaigns AS c ON " + attributionMatchSQL(filter.Mode)
+	creditedOrdersSubQuery := database.WithContext(ctx).
+		Table("orders AS o").
+		Select("o.id").
+		Joins(matchSQL, "paid").
+		Where("c.id IN ?", campaignIDs)
+
+	type orderTouch struct {
+		OrderID           uint       `gorm:"column:order_id"`
+		AmountCents       int64      `gorm:"column:amount_cents"`
+		PaidAt            *time.Time `gorm:"column:paid_at"`
+		CampaignID        uint       `gorm:"column:campaign_id"`
+		CampaignStartAt   *time.Time `gorm:"column:campaign_start_at"`
+		CampaignCreatedAt time.Time  `gorm:"column:campaign_created_at"`
+	}
+	orderTouches := make([]orderTouch, 0)
+	if err := database.WithContext(ctx).
+		Table("orders AS o").
+		Select(`
+			o.id AS order_id,
+			o.amount_cents - o.refunded_cents AS amount_cents,
+			o.paid_at AS paid_at,
+			c.id AS campaign_id,
+			c.start_at AS campaign_start_at,
+			c.created_at AS campaign_created_at
+		`).
+		Joins(matchSQL, "paid").
+		Where("o.id IN (?)", creditedOrdersSubQuery).
+		Order("o.id, c.id").
+		Scan(&orderTouches).Error; err != nil {
+		return fmt.Errorf("load attribution touches failed")
+	}
+
+	orders := make([]float64, len(rows))
+	revenue := make([]float64, len(rows))
+	rowIndex := make(map[uint]int, len(rows))
+	for i, row := range rows {
+		rowIndex[row.CampaignID] = i
+	}
+
+	for start := 0; start < len(orderTouches); {
+		end := start
+		for end < len(orderTouches) && orderTouches[end].OrderID == orderTouches[start].OrderID {
+			end++
+		}
+
+		order := orderTouches[start]
+		touches := make([]attributionTouch, 0, end-start)
+		for _, item := range orderTouches[start:end] {
+			touchedAt := item.CampaignCreatedAt
+			if item.CampaignStartAt != nil {
+				touchedAt = *item.CampaignStartAt
+			}
+			touches = append(touches, attributionTouch{CampaignID: item.CampaignID, TouchedAt: touchedAt})
+		}
+
+		for campaignID, weight := range attributionWeights(filter.Model, touches, order.PaidAt) {
+			if i, listed := rowIndex[campaignID]; listed {
+				orders[i] += weight
+				revenue[i] += weight * float64(order.AmountCents)
+			}
+		}
+		start = end
+	}
+
+	for i := range rows {
+		rows[i].AttributedOrders = math.Round(orders[i]*100) / 100
+		rows[i].AttributedRevenueCents = math.Round(revenue[i]*100) / 100
+	}
+	return nil
+}
+
+// attributionWeights returns the share of one order each touching campaign
+// earns under model; the shares sum to one. Ties on touch time are broken by
+// campaign id so reports are stable.
+func attributionWeights(model string, touches []attributionTouch, paidAt *time.Time) map[uint]float64 {
+	weights := make(map[uint]float64, len(touches))
+	if len(touches) == 0 {
+		return weights
+	}
+
+	ordered := append([]attributionTouch(nil), touches...)
+	sort.Slice(ordered, func(i, j int) bool {
+		if !ordered[i].TouchedAt.Equal(ordered[j].TouchedAt) {
+			return ordered[i].TouchedAt.Before(ordered[j].TouchedAt)
+		}
+		return ordered[i].CampaignID < ordered[j].CampaignID
+	})
+
+	switch model {
+	case attributionModelFirstTouch:
+		weights[ordered[0].CampaignID] = 1
+	case attributionModelLinear:
+		for _, touch := range ordered {
+			weights[touch.CampaignID] += 1 / float64(len(ordered))
+		}
+	case attributionModelTimeDecay:
+		raw := make([]float64, len(ordered))
+		total := 0.0
+		for i, touch := range ordered {
+			raw[i] = 1
+			if paidAt != nil && paidAt.After(touch.TouchedAt) {
+				raw[i] = math.Pow(0.5, float64(paidAt.Sub(touch.TouchedAt))/float64(timeDecayHalfLife))
+			}
+			total += raw[i]
+		}
+		for i, touch := range ordered {
+			weights[touch.CampaignID] += raw[i] / total
+		}
+	default:
+		weights[ordered[len(ordered)-1].CampaignID] = 1
+	}
+	return weights
+}
+
+func isSupportedAttributionModel(model string) bool {
+	switch model {
+	case attributionModelLastTouch, attributionModelFirstTouch, attributionModelLinear, attributionModelTimeDecay:
+		return true
+	default:
+		return false
+	}
+}
+
 func buildCampaignAttributionCSV(rows []campaignAttributionRow) (string, error) {
 	buffer := bytes.NewBuffer(nil)
 	writer := csv.NewWriter(buffer)
@@ -897,6 +2044,8 @@ func buildCampaignAttributionCSV(rows []campaignAttributionRow) (string, error)
 		"repurchase_converted_count",
 		"revenue_cents",
 		"conversion_rate",
+		"attributed_orders",
+		"attributed_revenue_cents",
 	}
 	if err := writer.Write(header); err != nil {
 		return "", err
@@ -916,6 +2065,8 @@ func buildCampaignAttributionCSV(rows []campaignAttributionRow) (string, error)
 			strconv.FormatInt(row.RepurchaseConvertedCount, 10),
 			strconv.FormatInt(row.RevenueCents, 10),
 			strconv.FormatFloat(row.ConversionRate, 'f', 2, 64),
+			strconv.FormatFloat(row.AttributedOrders, 'f', 2, 64),
+			strconv.FormatFloat(row.AttributedRevenueCents, 'f', 2, 64),
 		}
 		if err := writer.Write(record); err != nil {
 			return "", err
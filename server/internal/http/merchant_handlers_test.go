@@ -0,0 +1,80 @@
+package http
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"small-merchant-ops-hub-server/internal/db"
+)
+
+func TestBuildFollowupSQL(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		dialect db.Dialect
+		want    followupSQL
+	}{
+		{
+			dialect: db.DialectSQLite,
+			want: followupSQL{
+				Select: "m.id AS member_id, m.name AS member_name, m.phone AS phone, m.channel AS channel, " +
+					"COUNT(o.id) AS paid_order_count, COALESCE(SUM(o.amount_cents - o.refunded_cents), 0) AS paid_amount_cents, " +
+					"MAX(CAST(strftime('%s', o.paid_at) AS INTEGER)) AS last_paid_unix",
+				Having: "COUNT(o.id) = 1 OR MAX(CAST(strftime('%s', o.paid_at) AS INTEGER)) <= ?",
+				Order:  "MAX(CAST(strftime('%s', o.paid_at) AS INTEGER)) ASC",
+			},
+		},
+		{
+			dialect: db.DialectPostgres,
+			want: followupSQL{
+				Select: "m.id AS member_id, m.name AS member_name, m.phone AS phone, m.channel AS channel, " +
+					"COUNT(o.id) AS paid_order_count, COALESCE(SUM(o.amount_cents - o.refunded_cents), 0) AS paid_amount_cents, " +
+					"MAX(CAST(EXTRACT(EPOCH FROM o.paid_at) AS BIGINT)) AS last_paid_unix",
+				Having: "COUNT(o.id) = 1 OR MAX(CAST(EXTRACT(EPOCH FROM o.paid_at) AS BIGINT)) <= ?",
+				Order:  "MAX(CAST(EXTRACT(EPOCH FROM o.paid_at) AS BIGINT)) ASC",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		got := buildFollowupSQL(tt.dialect)
+		if got != tt.want {
+			t.Fatalf("%s followup sql:\n got  %+v\n want %+v", tt.dialect, got, tt.want)
+		}
+	}
+}
+
+func TestAttributionWeights(t *testing.T) {
+	t.Parallel()
+
+	paidAt := time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)
+	touches := []attributionTouch{
+		{CampaignID: 3, TouchedAt: paidAt.Add(-7 * 24 * time.Hour)},
+		{CampaignID: 1, TouchedAt: paidAt.Add(-14 * 24 * time.Hour)},
+		{CampaignID: 2, TouchedAt: paidAt.Add(-7 * 24 * time.Hour)},
+	}
+
+	tests := []struct {
+		model string
+		want  map[uint]float64
+	}{
+		{model: attributionModelLastTouch, want: map[uint]float64{3: 1}},
+		{model: attributionModelFirstTouch, want: map[uint]float64{1: 1}},
+		{model: attributionModelLinear, want: map[uint]float64{1: 1.0 / 3, 2: 1.0 / 3, 3: 1.0 / 3}},
+		// Two weeks earlier weighs 0.25 against 0.5 for each one-week touch.
+		{model: attributionModelTimeDecay, want: map[uint]float64{1: 0.2, 2: 0.4, 3: 0.4}},
+	}
+
+	for _, tt := range tests {
+		got := attributionWeights(tt.model, touches, &paidAt)
+		if len(got) != len(tt.want) {
+			t.Fatalf("%s weights = %v, want %v", tt.model, got, tt.want)
+		}
+		for campaignID, want := range tt.want {
+			if math.Abs(got[campaignID]-want) > 1e-9 {
+				t.Fatalf("%s weight of campaign %d = %v, want %v", tt.model, campaignID, got[campaignID], want)
+			}
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"small-merchant-ops-hub-server/internal/db"
+)
+
+const (
+	phoneViewMark   = "member:phone:view"
+	maxRevealReason = 200
+)
+
+// piiView decides which personal fields a session may read in full. Handlers
+// build one per request with piiViewFor and pass it to the response mappers.
+type piiView struct {
+	fullPhone bool
+}
+
+type revealPhoneRequest struct {
+	Reason string `json:"reason"`
+}
+
+type revealPhoneResponse struct {
+	MemberID uint   `json:"memberId"`
+	Phone    string `json:"phone"`
+}
+
+type piiAccessLogResponse struct {
+	ID        uint      `json:"id"`
+	MemberID  uint      `json:"memberId"`
+	UserID    int       `json:"userId"`
+	UserName  string    `json:"userName"`
+	Field     string    `json:"field"`
+	Reason    string    `json:"reason"`
+	ClientIP  string    `json:"clientIp"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func piiViewFor(c *gin.Context) piiView {
+	return piiView{fullPhone: hasButton(sessionFromContext(c).Buttons, phoneViewMark)}
+}
+
+// Phone returns value unchanged for sessions holding member:phone:view and
+// masked otherwise.
+func (v piiView) Phone(value string) string {
+	if v.fullPhone {
+		return value
+	}
+	return maskPhone(value)
+}
+
+// PhoneMasked reports whether Phone hides part of the number.
+func (v piiView) PhoneMasked() bool {
+	return !v.fullPhone
+}
+
+// maskPhone keeps the last four characters and everything before the four
+// ahead of them, e.g. 13800001111 -> 138****1111 and +8613800001111 ->
+// +86138****1111. Short values keep at most their last two characters.
+func maskPhone(value string) string {
+	if value == "" {
+		return ""
+	}
+	runes := []rune(value)
+	if len(runes) < 9 {
+		keep := len(runes) / 4
+		return strings.Repeat("*", len(runes)-keep) + string(runes[len(runes)-keep:])
+	}
+	return string(runes[:len(runes)-8]) + "****" + string(runes[len(runes)-4:])
+}
+
+// revealPhoneHandler returns one member's full phone and records who asked
+// and why. The log row is written first so no phone leaves unaudited.
+func revealPhoneHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		memberID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid member id")
+			return
+		}
+
+		var req revealPhoneRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid reveal payload")
+			return
+		}
+		req.Reason = strings.TrimSpace(req.Reason)
+		if req.Reason == "" {
+			fail(c, 400, "reason is required")
+			return
+		}
+		if len([]rune(req.Reason)) > maxRevealReason {
+			fail(c, 400, "reason must be at most 200 characters")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var member db.Member
+		if err := database.WithContext(ctx).First(&member, memberID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "member not found")
+				return
+			}
+			fail(c, 500, "query member failed")
+			return
+		}
+
+		session := sessionFromContext(c)
+		entry := db.PIIAccessLog{
+			MemberID: member.ID,
+			UserID:   session.UserID,
+			UserName: session.UserName,
+			Field:    "phone",
+			Reason:   req.Reason,
+			ClientIP: c.ClientIP(),
+		}
+		if err := database.WithContext(ctx).Create(&entry).Error; err != nil {
+			fail(c, 500, "write access log failed")
+			return
+		}
+
+		ok(c, revealPhoneResponse{MemberID: member.ID, Phone: member.Phone})
+	}
+}
+
+func listPIIAccessLogsHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		current := parseIntWithBounds(c.Query("current"), 1, 1, 1000)
+		size := parseIntWithBounds(c.Query("size"), 20, 1, 200)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		query := database.WithContext(ctx).Model(&db.PIIAccessLog{})
+		if raw := strings.TrimSpace(c.Query("memberId")); raw != "" {
+			memberID, err := strconv.ParseUint(raw, 10, 64)
+			if err != nil || memberID == 0 {
+				fail(c, 400, "invalid memberId")
+				return
+			}
+			query = query.Where("member_id = ?", memberID)
+		}
+		if userName := strings.TrimSpace(c.Query("userName")); userName != "" {
+			query = query.Where("user_name = ?", userName)
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			fail(c, 500, "count access logs failed")
+			return
+		}
+
+		logs := make([]db.PIIAccessLog, 0, size)
+		if err := query.Order("id DESC").Offset((current - 1) * size).Limit(size).Find(&logs).Error; err != nil {
+			fail(c, 500, "list access logs failed")
+			return
+		}
+
+		records := make([]piiAccessLogResponse, 0, len(logs))
+		for _, entry := range logs {
+			records = append(records, piiAccessLogResponse{
+				ID:        entry.ID,
+				MemberID:  entry.MemberID,
+				UserID:    entry.UserID,
+				UserName:  entry.UserName,
+				Field:     entry.Field,
+				Reason:    entry.Reason,
+				ClientIP:  entry.ClientIP,
+				CreatedAt: entry.CreatedAt,
+			})
+		}
+		ok(c, paginatedData{
+			Records: records,
+			Current: current,
+			Size:    size,
+			Total:   int(total),
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package http
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+type testPhoneMember struct {
+	ID          uint   `json:"id"`
+	Phone       string `json:"phone"`
+	PhoneMasked bool   `json:"phoneMasked"`
+}
+
+func TestMaskPhone(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"13800001111":    "138****1111",
+		"+8613800001111": "+86138****1111",
+		"+85291234567":   "+852****4567",
+		"12345678":       "******78",
+		"1234":           "***4",
+		"":               "",
+	}
+	for raw, want := range tests {
+		if got := maskPhone(raw); got != want {
+			t.Fatalf("maskPhone(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
+
+func TestMemberPhoneMaskingAndReveal(t *testing.T) {
+	t.Parallel()
+
+	router := newTestRouter(t)
+	adminToken := loginForTest(t, router, "Admin")
+	userToken := loginForTest(t, router, "User")
+	superToken := loginForTest(t, router, "Super")
+
+	member := performJSONRequest[testPhoneMember](t, router, adminToken, http.MethodPost, "/api/v1/members", map[string]interface{}{
+		"name":    "Zoe",
+		"phone":   "13800001111",
+		"channel": "wechat",
+	})
+	if member.Code != 200 || member.Data.Phone != "+8613800001111" || member.Data.PhoneMasked {
+		t.Fatalf("admin create member = %d %+v, want full phone", member.Code, member.Data)
+	}
+	order := performJSONRequest[testOrder](t, router, adminToken, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+		"memberId":    member.Data.ID,
+		"amountCents": int64(900),
+		"source":      "wechat",
+	})
+	if order.Code != 200 {
+		t.Fatalf("create order code = %d, msg = %s", order.Code, order.Msg)
+	}
+
+	listed := performJSONRequest[[]testPhoneMember](t, router, userToken, http.MethodGet, "/api/v1/members", nil)
+	if listed.Code != 200 || len(listed.Data) != 1 || listed.Data[0].Phone != "+86138****1111" || !listed.Data[0].PhoneMasked {
+		t.Fatalf("user list members = %d %+v, want masked phone", listed.Code, listed.Data)
+	}
+	// Without member:phone:view a phone only matches in full, so a substring
+	// search cannot narrow the masked digits.
+	searchAs := func(token, q string) int {
+		found := performJSONRequest[[]testPhoneMember](t, router, token, http.MethodGet, "/api/v1/members?q="+url.QueryEscape(q), nil)
+		if found.Code != 200 {
+			t.Fatalf("search %q code = %d, msg = %s", q, found.Code, found.Msg)
+		}
+		return len(found.Data)
+	}
+	if got := searchAs(userToken, "138000"); got != 0 {
+		t.Fatalf("user phone substring search found %d members, want 0", got)
+	}
+	if got := searchAs(userToken, "138 0000 1111"); got != 1 {
+		t.Fatalf("user full phone search found %d members, want 1", got)
+	}
+	if got := searchAs(userToken, "Zo"); got != 1 {
+		t.Fatalf("user name search found %d members, want 1", got)
+	}
+	if got := searchAs(adminToken, "138000"); got != 1 {
+		t.Fatalf("admin phone substring search found %d members, want 1", got)
+	}
+
+	followups := performJSONRequest[struct {
+		Items []struct {
+			Phone string `json:"phone"`
+		} `json:"items"`
+	}](t, router, userToken, http.MethodGet, "/api/v1/followups", nil)
+	if followups.Code != 200 || len(followups.Data.Items) != 1 || followups.Data.Items[0].Phone != "+86138****1111" {
+		t.Fatalf("user followups = %d %+v, want masked phone", followups.Code, followups.Data)
+	}
+
+	revealPath := "/api/v1/members/" + strconv.FormatUint(uint64(member.Data.ID), 10) + "/phone/reveal"
+	if missingReason := performJSONRequest[testPhoneMember](t, router, userToken, http.MethodPost, revealPath,
+		map[string]string{"reason": " "}); missingReason.Code != 400 {
+		t.Fatalf("reveal without reason code = %d, want 400", missingReason.Code)
+	}
+	revealed := performJSONRequest[struct {
+		MemberID uint   `json:"memberId"`
+		Phone    string `json:"phone"`
+	}](t, router, userToken, http.MethodPost, revealPath, map[string]string{"reason": "customer called about delivery"})
+	if revealed.Code != 200 || revealed.Data.Phone != "+8613800001111" {
+		t.Fatalf("reveal = %d %+v, msg = %s", revealed.Code, revealed.Data, revealed.Msg)
+	}
+	if missing := performJSONRequest[testPhoneMember](t, router, userToken, http.MethodPost, "/api/v1/members/9999/phone/reveal",
+		map[string]string{"reason": "lookup"}); missing.Code != 404 {
+		t.Fatalf("reveal unknown member code = %d, want 404", missing.Code)
+	}
+
+	if denied := performJSONRequest[map[string]interface{}](t, router, userToken, http.MethodGet, "/api/v1/pii-access-logs", nil); denied.Code != 403 {
+		t.Fatalf("user access logs code = %d, want 403", denied.Code)
+	}
+	logs := performJSONRequest[struct {
+		Records []struct {
+			MemberID uint   `json:"memberId"`
+			UserName string `json:"userName"`
+			Field    string `json:"field"`
+			Reason   string `json:"reason"`
+		} `json:"records"`
+		Total int `json:"total"`
+	}](t, router, superToken, http.MethodGet, "/api/v1/pii-access-logs?memberId="+strconv.FormatUint(uint64(member.Data.ID), 10), nil)
+	if logs.Code != 200 || logs.Data.Total != 1 {
+		t.Fatalf("access logs = %d %+v, msg = %s", logs.Code, logs.Data, logs.Msg)
+	}
+	entry := logs.Data.Records[0]
+	if entry.UserName != "User" || entry.Field != "phone" || entry.Reason != "customer called about delivery" {
+		t.Fatalf("access log entry = %+v", entry)
+	}
+}
@@ -0,0 +1,449 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"small-merchant-ops-hub-server/internal/db"
+)
+
+const maxRedeemPoints = 1_000_000
+
+var errInsufficientPoints = errors.New("insufficient points")
+
+type savePointsRuleRequest struct {
+	Name          string `json:"name"`
+	Channel       string `json:"channel"`
+	UnitCents     int64  `json:"unitCents"`
+	PointsPerUnit int64  `json:"pointsPerUnit"`
+	BonusPoints   int64  `json:"bonusPoints"`
+	Enabled       *bool  `json:"enabled"`
+}
+
+type redeemPointsRequest struct {
+	Points int64  `json:"points"`
+	Reason string `json:"reason"`
+}
+
+type pointsRuleResponse struct {
+	ID            uint      `json:"id"`
+	Name          string    `json:"name"`
+	Channel       string    `json:"channel"`
+	UnitCents     int64     `json:"unitCents"`
+	PointsPerUnit int64     `json:"pointsPerUnit"`
+	BonusPoints   int64     `json:"bonusPoints"`
+	Enabled       bool      `json:"enabled"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+type pointsTransactionResponse struct {
+	ID           uint      `json:"id"`
+	MemberID     uint      `json:"memberId"`
+	OrderID      *uint     `json:"orderId"`
+	Kind         string    `json:"kind"`
+	Points       int64     `json:"points"`
+	BalanceAfter int64     `json:"balanceAfter"`
+	Reason       string    `json:"reason"`
+	Operator     string    `json:"operator"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+type memberPointsResponse struct {
+	MemberID uint  `json:"memberId"`
+	Balance  int64 `json:"balance"`
+	paginatedData
+}
+
+// orderPoints is what the enabled rules grant for an order of amountCents
+// paid through source.
+func orderPoints(rules []db.PointsRule, source string, amountCents int64) int64 {
+	var points int64
+	for _, rule := range rules {
+		if !rule.Enabled || (rule.Channel != "" && rule.Channel != source) {
+			continue
+		}
+		if rule.UnitCents > 0 {
+			points += amountCents / rule.UnitCents * rule.PointsPerUnit
+		}
+		points += rule.BonusPoints
+	}
+	return points
+}
+
+// applyPoints adds entry.Points to the member balance and appends entry to the
+// ledger. With guard set the update only matches while the balance covers a
+// deduction, so concurrent redemptions can never overdraw it; earn and reverse
+// entries run unguarded and may leave a negative balance when points earned by
+// a refunded order were already spent.
+func applyPoints(tx *gorm.DB, entry *db.PointsTransaction, guard bool) error {
+	query := tx.Unscoped().Model(&db.Member{}).Where("id = ?", entry.MemberID)
+	if guard {
+		query = query.Where("points_balance + ? >= 0", entry.Points)
+	}
+	result := query.Update("points_balance", gorm.Expr("points_balance + ?", entry.Points))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInsufficientPoints
+	}
+	if err := tx.Unscoped().Model(&db.Member{}).
+		Where("id = ?", entry.MemberID).
+		Select("points_balance").
+		Scan(&entry.BalanceAfter).Error; err != nil {
+		return err
+	}
+	return tx.Create(entry).Error
+}
+
+// awardOrderPoints credits the points of a freshly paid order. It runs inside
+// the transaction that moves the order to paid, which happens once per order.
+func awardOrderPoints(tx *gorm.DB, order db.Order, operator string) error {
+	var rules []db.PointsRule
+	if err := tx.Where("enabled = ?", true).Order("id ASC").Find(&rules).Error; err != nil {
+		return err
+	}
+	points := orderPoints(rules, order.Source, order.AmountCents)
+	if points <= 0 {
+		return nil
+	}
+	orderID := order.ID
+	return applyPoints(tx, &db.PointsTransaction{
+		MemberID: order.MemberID,
+		OrderID:  &orderID,
+		Kind:     db.PointsKindEarn,
+		Points:   points,
+		Reason:   "order " + order.OrderNo + " paid",
+		Operator: operator,
+	}, false)
+}
+
+// reverseOrderPoints takes back the share of an order's earned points that
+// matches refundedCents/AmountCents. The share is computed from totals rather
+// than per refund, so rounding never drifts and a full refund reverses
+// exactly what was earned.
+func reverseOrderPoints(tx *gorm.DB, order db.Order, refundedCents int64, operator string) error {
+	var totals struct {
+		Earned   int64
+		Reversed int64
+	}
+	if err := tx.Model(&db.PointsTransaction{}).
+		Select("COALESCE(SUM(CASE WHEN kind = ? THEN points ELSE 0 END), 0) AS earned, "+
+			"COALESCE(SUM(CASE WHEN kind = ? THEN -points ELSE 0 END), 0) AS reversed",
+			db.PointsKindEarn, db.PointsKindReverse).
+		Where("order_id = ?", order.ID).
+		Scan(&totals).Error; err != nil {
+		return err
+	}
+	if totals.Earned <= 0 || order.AmountCents <= 0 {
+		return nil
+	}
+	if refundedCents > order.AmountCents {
+		refundedCents = order.AmountCents
+	}
+	points := totals.Earned*refundedCents/order.AmountCents - totals.Reversed
+	if points <= 0 {
+		return nil
+	}
+	orderID := order.ID
+	return applyPoints(tx, &db.PointsTransaction{
+		MemberID: order.MemberID,
+		OrderID:  &orderID,
+		Kind:     db.PointsKindReverse,
+		Points:   -points,
+		Reason:   "order " + order.OrderNo + " refunded",
+		Operator: operator,
+	}, false)
+}
+
+// redeemPointsHandler spends member points. The balance check and the
+// deduction are one guarded update, so two redemptions racing for the same
+// points cannot both succeed.
+func redeemPointsHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		memberID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid member id")
+			return
+		}
+
+		var req redeemPointsRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid redeem payload")
+			return
+		}
+		req.Reason = strings.TrimSpace(req.Reason)
+		if req.Points <= 0 || req.Points > maxRedeemPoints {
+			fail(c, 400, "points must be in [1, 1000000]")
+			return
+		}
+		if len([]rune(req.Reason)) > 200 {
+			fail(c, 400, "reason must be at most 200 characters")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var member db.Member
+		if err := database.WithContext(ctx).First(&member, memberID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "member not found")
+				return
+			}
+			fail(c, 500, "query member failed")
+			return
+		}
+
+		entry := db.PointsTransaction{
+			MemberID: member.ID,
+			Kind:     db.PointsKindRedeem,
+			Points:   -req.Points,
+			Reason:   req.Reason,
+			Operator: sessionFromContext(c).UserName,
+		}
+		if err := database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return applyPoints(tx, &entry, true)
+		}); err != nil {
+			if errors.Is(err, errInsufficientPoints) {
+				fail(c, 409, err.Error())
+				return
+			}
+			fail(c, 500, "redeem points failed")
+			return
+		}
+		ok(c, toPointsTransactionResponse(entry))
+	}
+}
+
+// memberPointsHandler returns a member's balance and its ledger, newest first.
+func memberPointsHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		memberID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid member id")
+			return
+		}
+		current := parseIntWithBounds(c.Query("current"), 1, 1, 1000)
+		size := parseIntWithBounds(c.Query("size"), 20, 1, 200)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var member db.Member
+		if err := database.WithContext(ctx).Unscoped().First(&member, memberID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "member not found")
+				return
+			}
+			fail(c, 500, "query member failed")
+			return
+		}
+
+		query := database.WithContext(ctx).Model(&db.PointsTransaction{}).Where("member_id = ?", member.ID)
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			fail(c, 500, "count points transactions failed")
+			return
+		}
+		entries := make([]db.PointsTransaction, 0, size)
+		if err := query.Order("id DESC").Offset((current - 1) * size).Limit(size).Find(&entries).Error; err != nil {
+			fail(c, 500, "list points transactions failed")
+			return
+		}
+
+		records := make([]pointsTransactionResponse, 0, len(entries))
+		for _, entry := range entries {
+			records = append(records, toPointsTransactionResponse(entry))
+		}
+		ok(c, memberPointsResponse{
+			MemberID: member.ID,
+			Balance:  member.PointsBalance,
+			paginatedData: paginatedData{
+				Records: records,
+				Current: current,
+				Size:    size,
+				Total:   int(total),
+			},
+		})
+	}
+}
+
+func listPointsRulesHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		rules := make([]db.PointsRule, 0)
+		if err := database.WithContext(ctx).Order("id ASC").Find(&rules).Error; err != nil {
+			fail(c, 500, "list points rules failed")
+			return
+		}
+		result := make([]pointsRuleResponse, 0, len(rules))
+		for _, rule := range rules {
+			result = append(result, toPointsRuleResponse(rule))
+		}
+		ok(c, result)
+	}
+}
+
+func createPointsRuleHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req savePointsRuleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid points rule payload")
+			return
+		}
+		if msg := normalizePointsRuleRequest(&req); msg != "" {
+			fail(c, 400, msg)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		rule := db.PointsRule{
+			Name:          req.Name,
+			Channel:       req.Channel,
+			UnitCents:     req.UnitCents,
+			PointsPerUnit: req.PointsPerUnit,
+			BonusPoints:   req.BonusPoints,
+			Enabled:       *req.Enabled,
+		}
+		if err := database.WithContext(ctx).Create(&rule).Error; err != nil {
+			fail(c, 500, "create points rule failed")
+			return
+		}
+		ok(c, toPointsRuleResponse(rule))
+	}
+}
+
+func updatePointsRuleHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ruleID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid points rule id")
+			return
+		}
+
+		var req savePointsRuleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid points rule payload")
+			return
+		}
+		if msg := normalizePointsRuleRequest(&req); msg != "" {
+			fail(c, 400, msg)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var rule db.PointsRule
+		if err := database.WithContext(ctx).First(&rule, ruleID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "points rule not found")
+				return
+			}
+			fail(c, 500, "query points rule failed")
+			return
+		}
+		if err := database.WithContext(ctx).Model(&rule).Updates(map[string]interface{}{
+			"name":            req.Name,
+			"channel":         req.Channel,
+			"unit_cents":      req.UnitCents,
+			"points_per_unit": req.PointsPerUnit,
+			"bonus_points":    req.BonusPoints,
+			"enabled":         *req.Enabled,
+		}).Error; err != nil {
+			fail(c, 500, "update points rule failed")
+			return
+		}
+		rule.Name = req.Name
+		rule.Channel = req.Channel
+		rule.UnitCents = req.UnitCents
+		rule.PointsPerUnit = req.PointsPerUnit
+		rule.BonusPoints = req.BonusPoints
+		rule.Enabled = *req.Enabled
+		ok(c, toPointsRuleResponse(rule))
+	}
+}
+
+func deletePointsRuleHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ruleID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid points rule id")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		result := database.WithContext(ctx).Delete(&db.PointsRule{}, ruleID)
+		if result.Error != nil {
+			fail(c, 500, "delete points rule failed")
+			return
+		}
+		if result.RowsAffected == 0 {
+			fail(c, 404, "points rule not found")
+			return
+		}
+		ok(c, gin.H{"id": ruleID})
+	}
+}
+
+// normalizePointsRuleRequest trims req, defaults Enabled to true and returns a
+// validation message, or "" when the rule is usable.
+func normalizePointsRuleRequest(req *savePointsRuleRequest) string {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Channel = strings.TrimSpace(req.Channel)
+	if req.Enabled == nil {
+		enabled := true
+		req.Enabled = &enabled
+	}
+	switch {
+	case req.Name == "":
+		return "name is required"
+	case req.UnitCents < 0 || req.PointsPerUnit < 0 || req.BonusPoints < 0:
+		return "unitCents, pointsPerUnit and bonusPoints cannot be negative"
+	case (req.UnitCents > 0) != (req.PointsPerUnit > 0):
+		return "unitCents and pointsPerUnit must be set together"
+	case req.UnitCents == 0 && req.BonusPoints == 0:
+		return "rule must grant pointsPerUnit or bonusPoints"
+	}
+	return ""
+}
+
+func toPointsRuleResponse(rule db.PointsRule) pointsRuleResponse {
+	return pointsRuleResponse{
+		ID:            rule.ID,
+		Name:          rule.Name,
+		Channel:       rule.Channel,
+		UnitCents:     rule.UnitCents,
+		PointsPerUnit: rule.PointsPerUnit,
+		BonusPoints:   rule.BonusPoints,
+		Enabled:       rule.Enabled,
+		CreatedAt:     rule.CreatedAt,
+		UpdatedAt:     rule.UpdatedAt,
+	}
+}
+
+func toPointsTransactionResponse(entry db.PointsTransaction) pointsTransactionResponse {
+	return pointsTransactionResponse{
+		ID:           entry.ID,
+		MemberID:     entry.MemberID,
+		OrderID:      entry.OrderID,
+		Kind:         entry.Kind,
+		Points:       entry.Points,
+		BalanceAfter: entry.BalanceAfter,
+		Reason:       entry.Reason,
+		Operator:     entry.Operator,
+		CreatedAt:    entry.CreatedAt,
+	}
+}
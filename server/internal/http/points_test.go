@@ -0,0 +1,168 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"small-merchant-ops-hub-server/internal/db"
+)
+
+type testPointsLedger struct {
+	Balance int64 `json:"balance"`
+	Records []struct {
+		Kind         string `json:"kind"`
+		Points       int64  `json:"points"`
+		BalanceAfter int64  `json:"balanceAfter"`
+	} `json:"records"`
+	Total int `json:"total"`
+}
+
+func TestOrderPoints(t *testing.T) {
+	t.Parallel()
+
+	rules := []db.PointsRule{
+		{Name: "base", UnitCents: 100, PointsPerUnit: 1, Enabled: true},
+		{Name: "wechat bonus", Channel: "wechat", BonusPoints: 50, Enabled: true},
+		{Name: "paused", UnitCents: 10, PointsPerUnit: 1, Enabled: false},
+	}
+	tests := []struct {
+		source      string
+		amountCents int64
+		want        int64
+	}{
+		{"wechat", 3050, 80},
+		{"miniapp", 3050, 30},
+		{"miniapp", 99, 0},
+	}
+	for _, tt := range tests {
+		if got := orderPoints(rules, tt.source, tt.amountCents); got != tt.want {
+			t.Fatalf("orderPoints(%s, %d) = %d, want %d", tt.source, tt.amountCents, got, tt.want)
+		}
+	}
+}
+
+func TestPointsEarnReverseAndRedeem(t *testing.T) {
+	t.Parallel()
+
+	router := newTestRouter(t)
+	superToken := loginForTest(t, router, "Super")
+	adminToken := loginForTest(t, router, "Admin")
+
+	if denied := performJSONRequest[pointsRuleResponse](t, router, adminToken, http.MethodPost, "/api/v1/points-rules",
+		map[string]interface{}{"name": "base", "unitCents": 100, "pointsPerUnit": 1}); denied.Code != 403 {
+		t.Fatalf("admin create rule code = %d, want 403", denied.Code)
+	}
+	if invalid := performJSONRequest[pointsRuleResponse](t, router, superToken, http.MethodPost, "/api/v1/points-rules",
+		map[string]interface{}{"name": "broken", "unitCents": 100}); invalid.Code != 400 {
+		t.Fatalf("rule without pointsPerUnit code = %d, want 400", invalid.Code)
+	}
+	for _, rule := range []map[string]interface{}{
+		{"name": "base", "unitCents": 100, "pointsPerUnit": 1},
+		{"name": "wechat bonus", "channel": "wechat", "bonusPoints": 50},
+	} {
+		if created := performJSONRequest[pointsRuleResponse](t, router, superToken, http.MethodPost, "/api/v1/points-rules", rule); created.Code != 200 || !created.Data.Enabled {
+			t.Fatalf("create rule = %d %+v, msg = %s", created.Code, created.Data, created.Msg)
+		}
+	}
+
+	member := performJSONRequest[testMember](t, router, adminToken, http.MethodPost, "/api/v1/members", map[string]interface{}{
+		"name":    "Pia",
+		"phone":   "13800005501",
+		"channel": "wechat",
+	})
+	if member.Code != 200 {
+		t.Fatalf("create member code = %d, msg = %s", member.Code, member.Msg)
+	}
+	memberPath := "/api/v1/members/" + strconv.FormatUint(uint64(member.Data.ID), 10)
+
+	wechat := performJSONRequest[testOrder](t, router, adminToken, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+		"memberId":    member.Data.ID,
+		"amountCents": 3050,
+		"status":      "paid",
+		"source":      "wechat",
+	})
+	pending := performJSONRequest[testOrder](t, router, adminToken, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+		"memberId":    member.Data.ID,
+		"amountCents": 2000,
+		"status":      "pending",
+		"source":      "miniapp",
+	})
+	if wechat.Code != 200 || pending.Code != 200 {
+		t.Fatalf("create orders = %d/%d", wechat.Code, pending.Code)
+	}
+	orderPath := func(orderID uint) string {
+		return "/api/v1/orders/" + strconv.FormatUint(uint64(orderID), 10)
+	}
+	if paid := performJSONRequest[testOrder](t, router, adminToken, http.MethodPatch, orderPath(pending.Data.ID)+"/status",
+		map[string]string{"status": "paid"}); paid.Code != 200 {
+		t.Fatalf("pay order code = %d, msg = %s", paid.Code, paid.Msg)
+	}
+
+	balance := func() int64 {
+		t.Helper()
+		ledger := performJSONRequest[testPointsLedger](t, router, adminToken, http.MethodGet, memberPath+"/points", nil)
+		if ledger.Code != 200 {
+			t.Fatalf("points ledger code = %d, msg = %s", ledger.Code, ledger.Msg)
+		}
+		return ledger.Data.Balance
+	}
+	if got := balance(); got != 100 {
+		t.Fatalf("balance after paid orders = %d, want 80 + 20", got)
+	}
+
+	// Half of the wechat order takes back half of its 80 points; refunding the
+	// rest reverses the remainder exactly.
+	refund := func(amountCents int64) {
+		t.Helper()
+		if refunded := performJSONRequest[map[string]interface{}](t, router, adminToken, http.MethodPost, orderPath(wechat.Data.ID)+"/refunds",
+			map[string]interface{}{"amountCents": amountCents}); refunded.Code != 200 {
+			t.Fatalf("refund code = %d, msg = %s", refunded.Code, refunded.Msg)
+		}
+	}
+	refund(1525)
+	if got := balance(); got != 60 {
+		t.Fatalf("balance after half refund = %d, want 60", got)
+	}
+	refund(1525)
+	if got := balance(); got != 20 {
+		t.Fatalf("balance after full refund = %d, want 20", got)
+	}
+
+	redeemPath := memberPath + "/points/redeem"
+	redeemed := performJSONRequest[pointsTransactionResponse](t, router, adminToken, http.MethodPost, redeemPath,
+		map[string]interface{}{"points": 15, "reason": "coffee voucher"})
+	if redeemed.Code != 200 || redeemed.Data.Points != -15 || redeemed.Data.BalanceAfter != 5 || redeemed.Data.Operator != "Admin" {
+		t.Fatalf("redeem = %d %+v, msg = %s", redeemed.Code, redeemed.Data, redeemed.Msg)
+	}
+	if overdraft := performJSONRequest[pointsTransactionResponse](t, router, adminToken, http.MethodPost, redeemPath,
+		map[string]interface{}{"points": 6}); overdraft.Code != 409 {
+		t.Fatalf("overdraft redeem code = %d, want 409", overdraft.Code)
+	}
+	if zero := performJSONRequest[pointsTransactionResponse](t, router, adminToken, http.MethodPost, redeemPath,
+		map[string]interface{}{"points": 0}); zero.Code != 400 {
+		t.Fatalf("zero redeem code = %d, want 400", zero.Code)
+	}
+
+	ledger := performJSONRequest[testPointsLedger](t, router, adminToken, http.MethodGet, memberPath+"/points", nil)
+	want := []struct {
+		kind   string
+		points int64
+	}{{"redeem", -15}, {"reverse", -40}, {"reverse", -40}, {"earn", 20}, {"earn", 80}}
+	if ledger.Code != 200 || ledger.Data.Total != len(want) {
+		t.Fatalf("ledger = %d %+v", ledger.Code, ledger.Data)
+	}
+	for i, entry := range want {
+		if got := ledger.Data.Records[i]; got.Kind != entry.kind || got.Points != entry.points {
+			t.Fatalf("ledger[%d] = %+v, want %s %d", i, got, entry.kind, entry.points)
+		}
+	}
+
+	listed := performJSONRequest[[]struct {
+		ID            uint  `json:"id"`
+		PointsBalance int64 `json:"pointsBalance"`
+	}](t, router, adminToken, http.MethodGet, "/api/v1/members", nil)
+	if listed.Code != 200 || len(listed.Data) != 1 || listed.Data[0].PointsBalance != 5 {
+		t.Fatalf("member list = %d %+v, want pointsBalance 5", listed.Code, listed.Data)
+	}
+}
@@ -0,0 +1,543 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"small-merchant-ops-hub-server/internal/db"
+)
+
+type saveProductRequest struct {
+	Name     string           `json:"name"`
+	Category string           `json:"category"`
+	Status   string           `json:"status"`
+	SKUs     []saveSKURequest `json:"skus"`
+}
+
+type saveSKURequest struct {
+	Code       string `json:"code"`
+	Name       string `json:"name"`
+	PriceCents int64  `json:"priceCents"`
+}
+
+type createOrderItemRequest struct {
+	SKUID          uint   `json:"skuId"`
+	Quantity       int    `json:"quantity"`
+	UnitPriceCents *int64 `json:"unitPriceCents"`
+}
+
+type productResponse struct {
+	ID        uint          `json:"id"`
+	Name      string        `json:"name"`
+	Category  string        `json:"category"`
+	Status    string        `json:"status"`
+	SKUs      []skuResponse `json:"skus"`
+	CreatedAt time.Time     `json:"createdAt"`
+	UpdatedAt time.Time     `json:"updatedAt"`
+}
+
+type skuResponse struct {
+	ID         uint   `json:"id"`
+	Code       string `json:"code"`
+	Name       string `json:"name"`
+	PriceCents int64  `json:"priceCents"`
+}
+
+type orderItemResponse struct {
+	ID             uint  `json:"id"`
+	ProductID      uint  `json:"productId"`
+	SKUID          uint  `json:"skuId"`
+	Quantity       int   `json:"quantity"`
+	UnitPriceCents int64 `json:"unitPriceCents"`
+	AmountCents    int64 `json:"amountCents"`
+}
+
+// productSalesRow is one product of the sales report. SalesCents sums line
+// amounts of paid orders before order-level refunds.
+type productSalesRow struct {
+	ProductID            uint   `json:"productId"`
+	ProductName          string `json:"productName"`
+	Category             string `json:"category"`
+	Quantity             int64  `json:"quantity"`
+	OrderCount           int64  `json:"orderCount"`
+	BuyerCount           int64  `json:"buyerCount"`
+	RepurchaseBuyerCount int64  `json:"repurchaseBuyerCount"`
+	SalesCents           int64  `json:"salesCents"`
+}
+
+// errProductHasOrders blocks deleting a product that order items still reference.
+var errProductHasOrders = errors.New("product has orders, set it inactive instead")
+
+func listProductsHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		limit := parseLimit(c.Query("limit"), 20)
+		keyword := strings.TrimSpace(c.Query("q"))
+		status := strings.TrimSpace(strings.ToLower(c.Query("status")))
+		category := strings.TrimSpace(c.Query("category"))
+
+		query := database.WithContext(ctx).Model(&db.Product{}).Preload("SKUs").Order("id DESC").Limit(limit)
+		if keyword != "" {
+			query = query.Where("name LIKE ?", "%"+keyword+"%")
+		}
+		if status != "" {
+			query = query.Where("status = ?", status)
+		}
+		if category != "" {
+			query = query.Where("category = ?", category)
+		}
+
+		products := make([]db.Product, 0, limit)
+		if err := query.Find(&products).Error; err != nil {
+			fail(c, 500, "list products failed")
+			return
+		}
+
+		result := make([]productResponse, 0, len(products))
+		for _, product := range products {
+			result = append(result, toProductResponse(product))
+		}
+		ok(c, result)
+	}
+}
+
+func getProductHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid product id")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var product db.Product
+		if err := database.WithContext(ctx).Preload("SKUs").First(&product, productID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "product not found")
+				return
+			}
+			fail(c, 500, "query product failed")
+			return
+		}
+		ok(c, toProductResponse(product))
+	}
+}
+
+func createProductHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req saveProductRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid product payload")
+			return
+		}
+		normalizeSaveProductRequest(&req)
+		if req.Status == "" {
+			req.Status = db.ProductStatusActive
+		}
+		if msg := validateSaveProductRequest(req); msg != "" {
+			fail(c, 400, msg)
+			return
+		}
+		if len(req.SKUs) == 0 {
+			fail(c, 400, "at least one sku is required")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		product := db.Product{
+			Name:     req.Name,
+			Category: req.Category,
+			Status:   req.Status,
+		}
+		for _, sku := range req.SKUs {
+			product.SKUs = append(product.SKUs, db.SKU{
+				Code:       sku.Code,
+				Name:       sku.Name,
+				PriceCents: sku.PriceCents,
+			})
+		}
+		if err := database.WithContext(ctx).Create(&product).Error; err != nil {
+			if strings.Contains(strings.ToLower(err.Error()), "unique") {
+				fail(c, 400, "sku code already exists")
+				return
+			}
+			fail(c, 500, "create product failed")
+			return
+		}
+		ok(c, toProductResponse(product))
+	}
+}
+
+// updateProductHandler saves the product fields and upserts SKUs by code.
+// SKUs missing from the payload are kept because past order items use them.
+func updateProductHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid product id")
+			return
+		}
+
+		var req saveProductRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid product payload")
+			return
+		}
+		normalizeSaveProductRequest(&req)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var product db.Product
+		if err := database.WithContext(ctx).Preload("SKUs").First(&product, productID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "product not found")
+				return
+			}
+			fail(c, 500, "query product failed")
+			return
+		}
+		if req.Status == "" {
+			req.Status = product.Status
+		}
+		if msg := validateSaveProductRequest(req); msg != "" {
+			fail(c, 400, msg)
+			return
+		}
+
+		existing := make(map[string]db.SKU, len(product.SKUs))
+		for _, sku := range product.SKUs {
+			existing[sku.Code] = sku
+		}
+
+		err := database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&product).Updates(map[string]interface{}{
+				"name":     req.Name,
+				"category": req.Category,
+				"status":   req.Status,
+			}).Error; err != nil {
+				return err
+			}
+			for _, item := range req.SKUs {
+				if sku, found := existing[item.Code]; found {
+					if err := tx.Model(&sku).Updates(map[string]interface{}{
+						"name":        item.Name,
+						"price_cents": item.PriceCents,
+					}).Error; err != nil {
+						return err
+					}
+					continue
+				}
+				if err := tx.Create(&db.SKU{
+					ProductID:  product.ID,
+					Code:       item.Code,
+					Name:       item.Name,
+					PriceCents: item.PriceCents,
+				}).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			if strings.Contains(strings.ToLower(err.Error()), "unique") {
+				fail(c, 400, "sku code already exists")
+				return
+			}
+			fail(c, 500, "update product failed")
+			return
+		}
+
+		if err := database.WithContext(ctx).Preload("SKUs").First(&product, product.ID).Error; err != nil {
+			fail(c, 500, "query product failed")
+			return
+		}
+		ok(c, toProductResponse(product))
+	}
+}
+
+func deleteProductHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid product id")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var product db.Product
+		if err := database.WithContext(ctx).First(&product, productID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "product not found")
+				return
+			}
+			fail(c, 500, "query product failed")
+			return
+		}
+
+		err := database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var itemCount int64
+			if err := tx.Model(&db.OrderItem{}).Where("product_id = ?", product.ID).Count(&itemCount).Error; err != nil {
+				return err
+			}
+			if itemCount > 0 {
+				return errProductHasOrders
+			}
+			if err := tx.Where("product_id = ?", product.ID).Delete(&db.SKU{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&product).Error
+		})
+		if err != nil {
+			if errors.Is(err, errProductHasOrders) {
+				fail(c, 400, err.Error())
+				return
+			}
+			fail(c, 500, "delete product failed")
+			return
+		}
+		ok(c, gin.H{"id": product.ID})
+	}
+}
+
+// productSalesHandler ranks products by paid line-item sales. from/to bound
+// the payment time of the orders.
+func productSalesHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := parseLimit(c.Query("limit"), 50)
+		category := strings.TrimSpace(c.Query("category"))
+		from, err := parseOptionalRFC3339(c.Query("from"))
+		if err != nil {
+			fail(c, 400, "from must be RFC3339 format")
+			return
+		}
+		to, err := parseOptionalRFC3339(c.Query("to"))
+		if err != nil {
+			fail(c, 400, "to must be RFC3339 format")
+			return
+		}
+		if from != nil && to != nil && to.Before(*from) {
+			fail(c, 400, "to cannot be earlier than from")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		scope := func(query *gorm.DB) *gorm.DB {
+			query = query.
+				Joins("JOIN orders AS o ON o.id = oi.order_id AND o.status = ?", "paid").
+				Joins("JOIN products AS p ON p.id = oi.product_id")
+			if category != "" {
+				query = query.Where("p.category = ?", category)
+			}
+			if from != nil {
+				query = query.Where("o.paid_at >= ?", *from)
+			}
+			if to != nil {
+				query = query.Where("o.paid_at <= ?", *to)
+			}
+			return query
+		}
+
+		rows := make([]productSalesRow, 0, limit)
+		if err := scope(database.WithContext(ctx).Table("order_items AS oi")).
+			Select(`
+				p.id AS product_id,
+				p.name AS product_name,
+				p.category AS category,
+				COALESCE(SUM(oi.quantity), 0) AS quantity,
+				COUNT(DISTINCT o.id) AS order_count,
+				COUNT(DISTINCT o.member_id) AS buyer_count,
+				COALESCE(SUM(oi.amount_cents), 0) AS sales_cents
+			`).
+			Group("p.id, p.name, p.category").
+			Order("sales_cents DESC, p.id ASC").
+			Limit(limit).
+			Scan(&rows).Error; err != nil {
+			fail(c, 500, "aggregate product sales failed")
+			return
+		}
+		if len(rows) == 0 {
+			ok(c, rows)
+			return
+		}
+
+		productIDs := make([]uint, 0, len(rows))
+		for _, row := range rows {
+			productIDs = append(productIDs, row.ProductID)
+		}
+
+		repeatBuyers := scope(database.WithContext(ctx).Table("order_items AS oi")).
+			Select("oi.product_id AS product_id, o.member_id AS member_id").
+			Where("oi.product_id IN ?", productIDs).
+			Group("oi.product_id, o.member_id").
+			Having("COUNT(DISTINCT o.id) >= 2")
+
+		type repurchaseAgg struct {
+			ProductID  uint  `gorm:"column:product_id"`
+			BuyerCount int64 `gorm:"column:buyer_count"`
+		}
+		aggs := make([]repurchaseAgg, 0, len(rows))
+		if err := database.WithContext(ctx).
+			Table("(?) AS rb", repeatBuyers).
+			Select("rb.product_id AS product_id, COUNT(*) AS buyer_count").
+			Group("rb.product_id").
+			Scan(&aggs).Error; err != nil {
+			fail(c, 500, "aggregate product repurchase failed")
+			return
+		}
+		repurchaseByProduct := make(map[uint]int64, len(aggs))
+		for _, agg := range aggs {
+			repurchaseByProduct[agg.ProductID] = agg.BuyerCount
+		}
+		for i := range rows {
+			rows[i].RepurchaseBuyerCount = repurchaseByProduct[rows[i].ProductID]
+		}
+
+		ok(c, rows)
+	}
+}
+
+// buildOrderItems prices the requested lines from their SKUs. A line without
+// unitPriceCents uses the SKU list price; SKUs of inactive products are rejected.
+func buildOrderItems(ctx context.Context, database *gorm.DB, items []createOrderItemRequest) ([]db.OrderItem, error) {
+	skuIDs := make([]uint, 0, len(items))
+	for _, item := range items {
+		if item.SKUID == 0 || item.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: each item needs skuId and a positive quantity", errInvalidOrderItems)
+		}
+		if item.UnitPriceCents != nil && *item.UnitPriceCents < 0 {
+			return nil, fmt.Errorf("%w: unitPriceCents cannot be negative", errInvalidOrderItems)
+		}
+		skuIDs = append(skuIDs, item.SKUID)
+	}
+
+	type pricedSKU struct {
+		ID            uint   `gorm:"column:id"`
+		ProductID     uint   `gorm:"column:product_id"`
+		PriceCents    int64  `gorm:"column:price_cents"`
+		ProductStatus string `gorm:"column:product_status"`
+	}
+	skus := make([]pricedSKU, 0, len(skuIDs))
+	if err := database.WithContext(ctx).
+		Table("skus AS s").
+		Select("s.id, s.product_id, s.price_cents, p.status AS product_status").
+		Joins("JOIN products AS p ON p.id = s.product_id").
+		Where("s.id IN ?", skuIDs).
+		Scan(&skus).Error; err != nil {
+		return nil, err
+	}
+	skuByID := make(map[uint]pricedSKU, len(skus))
+	for _, sku := range skus {
+		skuByID[sku.ID] = sku
+	}
+
+	orderItems := make([]db.OrderItem, 0, len(items))
+	for _, item := range items {
+		sku, found := skuByID[item.SKUID]
+		if !found {
+			return nil, fmt.Errorf("%w: sku %d not found", errInvalidOrderItems, item.SKUID)
+		}
+		if sku.ProductStatus != db.ProductStatusActive {
+			return nil, fmt.Errorf("%w: sku %d is not on sale", errInvalidOrderItems, item.SKUID)
+		}
+		unitPrice := sku.PriceCents
+		if item.UnitPriceCents != nil {
+			unitPrice = *item.UnitPriceCents
+		}
+		orderItems = append(orderItems, db.OrderItem{
+			ProductID:      sku.ProductID,
+			SKUID:          sku.ID,
+			Quantity:       item.Quantity,
+			UnitPriceCents: unitPrice,
+			AmountCents:    unitPrice * int64(item.Quantity),
+		})
+	}
+	return orderItems, nil
+}
+
+// errInvalidOrderItems marks order lines that cannot be priced.
+var errInvalidOrderItems = errors.New("invalid items")
+
+func normalizeSaveProductRequest(req *saveProductRequest) {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Category = strings.TrimSpace(req.Category)
+	req.Status = strings.TrimSpace(strings.ToLower(req.Status))
+	for i := range req.SKUs {
+		req.SKUs[i].Code = strings.TrimSpace(req.SKUs[i].Code)
+		req.SKUs[i].Name = strings.TrimSpace(req.SKUs[i].Name)
+	}
+}
+
+func validateSaveProductRequest(req saveProductRequest) string {
+	if req.Name == "" {
+		return "name is required"
+	}
+	if req.Status != db.ProductStatusActive && req.Status != db.ProductStatusInactive {
+		return "status must be active or inactive"
+	}
+	codes := make(map[string]bool, len(req.SKUs))
+	for _, sku := range req.SKUs {
+		if sku.Code == "" {
+			return "sku code is required"
+		}
+		if sku.PriceCents < 0 {
+			return "sku priceCents cannot be negative"
+		}
+		if codes[sku.Code] {
+			return "duplicate sku code " + sku.Code
+		}
+		codes[sku.Code] = true
+	}
+	return ""
+}
+
+func toProductResponse(product db.Product) productResponse {
+	skus := make([]skuResponse, 0, len(product.SKUs))
+	for _, sku := range product.SKUs {
+		skus = append(skus, skuResponse{
+			ID:         sku.ID,
+			Code:       sku.Code,
+			Name:       sku.Name,
+			PriceCents: sku.PriceCents,
+		})
+	}
+	return productResponse{
+		ID:        product.ID,
+		Name:      product.Name,
+		Category:  product.Category,
+		Status:    product.Status,
+		SKUs:      skus,
+		CreatedAt: product.CreatedAt,
+		UpdatedAt: product.UpdatedAt,
+	}
+}
+
+func toOrderItemResponses(items []db.OrderItem) []orderItemResponse {
+	result := make([]orderItemResponse, 0, len(items))
+	for _, item := range items {
+		result = append(result, orderItemResponse{
+			ID:             item.ID,
+			ProductID:      item.ProductID,
+			SKUID:          item.SKUID,
+			Quantity:       item.Quantity,
+			UnitPriceCents: item.UnitPriceCents,
+			AmountCents:    item.AmountCents,
+		})
+	}
+	return result
+}
@@ -0,0 +1,190 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+type testSKU struct {
+	ID         uint   `json:"id"`
+	Code       string `json:"code"`
+	PriceCents int64  `json:"priceCents"`
+}
+
+type testProduct struct {
+	ID     uint      `json:"id"`
+	Name   string    `json:"name"`
+	Status string    `json:"status"`
+	SKUs   []testSKU `json:"skus"`
+}
+
+type testProductSalesRow struct {
+	ProductID            uint  `json:"productId"`
+	Quantity             int64 `json:"quantity"`
+	OrderCount           int64 `json:"orderCount"`
+	BuyerCount           int64 `json:"buyerCount"`
+	RepurchaseBuyerCount int64 `json:"repurchaseBuyerCount"`
+	SalesCents           int64 `json:"salesCents"`
+}
+
+func TestProductCatalogAndSales(t *testing.T) {
+	t.Parallel()
+
+	router := newTestRouter(t)
+	token := loginForTest(t, router, "Admin")
+
+	coffee := performJSONRequest[testProduct](t, router, token, http.MethodPost, "/api/v1/products", map[string]interface{}{
+		"name":     "Cold Brew",
+		"category": "drinks",
+		"skus": []map[string]interface{}{
+			{"code": "CB-S", "name": "Small", "priceCents": 1500},
+			{"code": "CB-L", "name": "Large", "priceCents": 2200},
+		},
+	})
+	if coffee.Code != 200 || coffee.Data.Status != "active" || len(coffee.Data.SKUs) != 2 {
+		t.Fatalf("create product = %d %+v, msg = %s", coffee.Code, coffee.Data, coffee.Msg)
+	}
+	cake := performJSONRequest[testProduct](t, router, token, http.MethodPost, "/api/v1/products", map[string]interface{}{
+		"name":     "Cheesecake",
+		"category": "dessert",
+		"skus":     []map[string]interface{}{{"code": "CK-1", "priceCents": 3000}},
+	})
+	if cake.Code != 200 {
+		t.Fatalf("create cake code = %d, msg = %s", cake.Code, cake.Msg)
+	}
+	duplicate := performJSONRequest[testProduct](t, router, token, http.MethodPost, "/api/v1/products", map[string]interface{}{
+		"name": "Copy",
+		"skus": []map[string]interface{}{{"code": "CB-S", "priceCents": 1}},
+	})
+	if duplicate.Code != 400 {
+		t.Fatalf("duplicate sku code = %d, want 400", duplicate.Code)
+	}
+
+	skuByCode := make(map[string]uint)
+	for _, sku := range append(coffee.Data.SKUs, cake.Data.SKUs...) {
+		skuByCode[sku.Code] = sku.ID
+	}
+
+	members := make([]uint, 0, 2)
+	for i, name := range []string{"Hana", "Ivan"} {
+		member := performJSONRequest[testMember](t, router, token, http.MethodPost, "/api/v1/members", map[string]interface{}{
+			"name":    name,
+			"phone":   fmt.Sprintf("1380000880%d", i),
+			"channel": "wechat",
+		})
+		if member.Code != 200 {
+			t.Fatalf("create member code = %d, msg = %s", member.Code, member.Msg)
+		}
+		members = append(members, member.Data.ID)
+	}
+
+	type itemOrder struct {
+		ID          uint  `json:"id"`
+		AmountCents int64 `json:"amountCents"`
+		Items       []struct {
+			ProductID   uint  `json:"productId"`
+			AmountCents int64 `json:"amountCents"`
+		} `json:"items"`
+	}
+	createOrder := func(memberID uint, payload map[string]interface{}) testEnvelope[itemOrder] {
+		payload["memberId"] = memberID
+		payload["source"] = "wechat"
+		return performJSONRequest[itemOrder](t, router, token, http.MethodPost, "/api/v1/orders", payload)
+	}
+
+	derived := createOrder(members[0], map[string]interface{}{
+		"items": []map[string]interface{}{
+			{"skuId": skuByCode["CB-S"], "quantity": 2},
+			{"skuId": skuByCode["CK-1"], "quantity": 1},
+		},
+	})
+	if derived.Code != 200 || derived.Data.AmountCents != 6000 || len(derived.Data.Items) != 2 {
+		t.Fatalf("derived order = %d %+v, msg = %s", derived.Code, derived.Data, derived.Msg)
+	}
+	discounted := createOrder(members[0], map[string]interface{}{
+		"amountCents": int64(2000),
+		"items":       []map[string]interface{}{{"skuId": skuByCode["CB-L"], "quantity": 1}},
+	})
+	if discounted.Code != 200 || discounted.Data.AmountCents != 2000 {
+		t.Fatalf("discounted order = %d %+v, msg = %s", discounted.Code, discounted.Data, discounted.Msg)
+	}
+	custom := createOrder(members[1], map[string]interface{}{
+		"items": []map[string]interface{}{{"skuId": skuByCode["CB-S"], "quantity": 1, "unitPriceCents": 1000}},
+	})
+	if custom.Code != 200 || custom.Data.AmountCents != 1000 {
+		t.Fatalf("custom price order = %d %+v, msg = %s", custom.Code, custom.Data, custom.Msg)
+	}
+	if missing := createOrder(members[1], map[string]interface{}{
+		"items": []map[string]interface{}{{"skuId": 9999, "quantity": 1}},
+	}); missing.Code != 400 {
+		t.Fatalf("unknown sku order code = %d, want 400", missing.Code)
+	}
+	if empty := createOrder(members[1], map[string]interface{}{}); empty.Code != 400 {
+		t.Fatalf("order without amount or items code = %d, want 400", empty.Code)
+	}
+
+	sales := performJSONRequest[[]testProductSalesRow](t, router, token, http.MethodGet, "/api/v1/reports/product-sales", nil)
+	if sales.Code != 200 || len(sales.Data) != 2 {
+		t.Fatalf("product sales = %d %+v, msg = %s", sales.Code, sales.Data, sales.Msg)
+	}
+	top := sales.Data[0]
+	if top.ProductID != coffee.Data.ID || top.Quantity != 4 || top.OrderCount != 3 || top.BuyerCount != 2 ||
+		top.RepurchaseBuyerCount != 1 || top.SalesCents != 6200 {
+		t.Fatalf("coffee sales = %+v, want 4 units over 3 orders, 2 buyers, 1 repeat, 6200 cents", top)
+	}
+	if sales.Data[1].ProductID != cake.Data.ID || sales.Data[1].SalesCents != 3000 || sales.Data[1].RepurchaseBuyerCount != 0 {
+		t.Fatalf("cake sales = %+v, want 3000 cents without repeat buyers", sales.Data[1])
+	}
+
+	updated := performJSONRequest[testProduct](t, router, token, http.MethodPut,
+		fmt.Sprintf("/api/v1/products/%d", coffee.Data.ID), map[string]interface{}{
+			"name":   "Cold Brew",
+			"status": "inactive",
+			"skus": []map[string]interface{}{
+				{"code": "CB-S", "name": "Small", "priceCents": 1600},
+				{"code": "CB-XL", "name": "Extra Large", "priceCents": 2800},
+			},
+		})
+	if updated.Code != 200 || updated.Data.Status != "inactive" || len(updated.Data.SKUs) != 3 {
+		t.Fatalf("update product = %d %+v, msg = %s", updated.Code, updated.Data, updated.Msg)
+	}
+	if inactive := createOrder(members[1], map[string]interface{}{
+		"items": []map[string]interface{}{{"skuId": skuByCode["CB-S"], "quantity": 1}},
+	}); inactive.Code != 400 {
+		t.Fatalf("inactive product order code = %d, want 400", inactive.Code)
+	}
+
+	referenced := performJSONRequest[map[string]interface{}](t, router, token, http.MethodDelete,
+		fmt.Sprintf("/api/v1/products/%d", coffee.Data.ID), nil)
+	if referenced.Code != 400 {
+		t.Fatalf("delete sold product code = %d, want 400", referenced.Code)
+	}
+	unsold := performJSONRequest[testProduct](t, router, token, http.MethodPost, "/api/v1/products", map[string]interface{}{
+		"name": "Muffin",
+		"skus": []map[string]interface{}{{"code": "MF-1", "priceCents": 800}},
+	})
+	removed := performJSONRequest[map[string]interface{}](t, router, token, http.MethodDelete,
+		fmt.Sprintf("/api/v1/products/%d", unsold.Data.ID), nil)
+	if removed.Code != 200 {
+		t.Fatalf("delete unsold product code = %d, msg = %s", removed.Code, removed.Msg)
+	}
+	gone := performJSONRequest[testProduct](t, router, token, http.MethodGet,
+		fmt.Sprintf("/api/v1/products/%d", unsold.Data.ID), nil)
+	if gone.Code != 404 {
+		t.Fatalf("get deleted product code = %d, want 404", gone.Code)
+	}
+
+	userToken := loginForTest(t, router, "User")
+	listed := performJSONRequest[[]testProduct](t, router, userToken, http.MethodGet, "/api/v1/products", nil)
+	if listed.Code != 200 || len(listed.Data) != 2 {
+		t.Fatalf("user list products = %d, len %d", listed.Code, len(listed.Data))
+	}
+	denied := performJSONRequest[testProduct](t, router, userToken, http.MethodPost, "/api/v1/products", map[string]interface{}{
+		"name": "Tea",
+		"skus": []map[string]interface{}{{"code": "TEA-1", "priceCents": 900}},
+	})
+	if denied.Code != 403 {
+		t.Fatalf("user create product code = %d, want 403", denied.Code)
+	}
+}
@@ -9,9 +9,29 @@ import (
 	"gorm.io/gorm"
 	"small-merchant-ops-hub-server/internal/cache"
 	"small-merchant-ops-hub-server/internal/config"
+	"small-merchant-ops-hub-server/internal/consent"
 )
 
+// PinnedCacheKeyPrefixes lists the cache keys the router keeps state under,
+// such as sessions and idempotency records, for cache.New to pin.
+func PinnedCacheKeyPrefixes() []string {
+	return []string{
+		accessSessionKeyPrefix,
+		refreshSessionKeyPrefix,
+		userSessionsKeyPrefix,
+		userSessionsLockPrefix,
+		idempotencyKeyPrefix,
+		memberImportErrorsPrefix,
+	}
+}
+
 func NewRouter(db *gorm.DB, cacheStore cache.Store, cfg config.Config) *gin.Engine {
+	return newRouter(db, cacheStore, newSessionStore(cacheStore), cfg)
+}
+
+// newRouter wires the routes around an explicit session store so tests can
+// tune session TTLs without touching package state.
+func newRouter(db *gorm.DB, cacheStore cache.Store, sessions *sessionStore, cfg config.Config) *gin.Engine {
 	router := gin.New()
 	router.Use(gin.Logger(), gin.Recovery(), corsMiddleware(cfg.CORSAllowOrigin))
 
@@ -42,16 +62,23 @@ func NewRouter(db *gorm.DB, cacheStore cache.Store, cfg config.Config) *gin.Engi
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
+		payload := gin.H{
 			"ok":    true,
 			"env":   cfg.Env,
 			"db":    cfg.DatabaseDriver(),
 			"cache": cfg.CacheMode,
-		})
+		}
+		if provider, ok := cacheStore.(cache.StatsProvider); ok {
+			payload["cacheStats"] = provider.Stats()
+		}
+		c.JSON(http.StatusOK, payload)
 	})
 
-	registerAuthRoutes(router)
-	registerMerchantRoutes(router, db, cacheStore)
+	registerAuthRoutes(router, db, sessions)
+	registerSystemRoutes(router, db, sessions)
+	signer := consent.NewSigner(cfg.ConsentSigningSecret)
+	registerConsentRoutes(router, db, signer)
+	registerMerchantRoutes(router, db, cacheStore, sessions, cfg.DatabaseDriver(), cfg.PhoneDefaultRegion, signer)
 
 	return router
 }
@@ -63,8 +90,8 @@ func corsMiddleware(allowOrigin string) gin.HandlerFunc {
 
 	return func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", allowOrigin)
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, Idempotency-Key")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 
 		if c.Request.Method == http.MethodOptions {
 			c.AbortWithStatus(http.StatusNoContent)
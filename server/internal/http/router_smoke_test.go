@@ -7,9 +7,14 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 	"small-merchant-ops-hub-server/internal/cache"
 	"small-merchant-ops-hub-server/internal/config"
 	"small-merchant-ops-hub-server/internal/db"
@@ -27,9 +32,11 @@ type testMember struct {
 }
 
 type testOrder struct {
-	ID          uint  `json:"id"`
-	AmountCents int64 `json:"amountCents"`
-	MemberID    uint  `json:"memberId"`
+	ID          uint       `json:"id"`
+	AmountCents int64      `json:"amountCents"`
+	MemberID    uint       `json:"memberId"`
+	Status      string     `json:"status"`
+	PaidAt      *time.Time `json:"paidAt"`
 }
 
 type testSummary struct {
@@ -37,6 +44,7 @@ type testSummary struct {
 	OrderCount          int64   `json:"orderCount"`
 	PaidOrderCount      int64   `json:"paidOrderCount"`
 	RevenueCents        int64   `json:"revenueCents"`
+	RefundedCents       int64   `json:"refundedCents"`
 	RepurchaseCount     int64   `json:"repurchaseCount"`
 	RepurchaseRate      float64 `json:"repurchaseRate"`
 	ActiveCampaignCount int64   `json:"activeCampaignCount"`
@@ -86,7 +94,7 @@ func TestMerchantFlowSmoke(t *testing.T) {
 		t.Fatalf("open db: %v", err)
 	}
 
-	cacheStore, err := cache.New(cfg)
+	cacheStore, err := cache.New(cfg, PinnedCacheKeyPrefixes()...)
 	if err != nil {
 		t.Fatalf("open cache: %v", err)
 	}
@@ -95,8 +103,9 @@ func TestMerchantFlowSmoke(t *testing.T) {
 	})
 
 	router := NewRouter(database, cacheStore, cfg)
+	token := loginForTest(t, router, "Super")
 
-	member := performJSONRequest[testMember](t, router, http.MethodPost, "/api/v1/members", map[string]interface{}{
+	member := performJSONRequest[testMember](t, router, token, http.MethodPost, "/api/v1/members", map[string]interface{}{
 		"name":    "Alice",
 		"phone":   "13800001111",
 		"channel": "wechat",
@@ -105,7 +114,7 @@ func TestMerchantFlowSmoke(t *testing.T) {
 		t.Fatalf("create member code = %d, msg = %s", member.Code, member.Msg)
 	}
 
-	firstOrder := performJSONRequest[testOrder](t, router, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+	firstOrder := performJSONRequest[testOrder](t, router, token, http.MethodPost, "/api/v1/orders", map[string]interface{}{
 		"memberId":    member.Data.ID,
 		"amountCents": int64(1200),
 		"status":      "paid",
@@ -115,12 +124,12 @@ func TestMerchantFlowSmoke(t *testing.T) {
 		t.Fatalf("create first order code = %d, msg = %s", firstOrder.Code, firstOrder.Msg)
 	}
 
-	summaryBefore := performJSONRequest[testSummary](t, router, http.MethodGet, "/api/v1/summary", nil)
+	summaryBefore := performJSONRequest[testSummary](t, router, token, http.MethodGet, "/api/v1/summary", nil)
 	if summaryBefore.Data.RepurchaseCount != 0 {
 		t.Fatalf("repurchase before second order = %d, want 0", summaryBefore.Data.RepurchaseCount)
 	}
 
-	secondOrder := performJSONRequest[testOrder](t, router, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+	secondOrder := performJSONRequest[testOrder](t, router, token, http.MethodPost, "/api/v1/orders", map[string]interface{}{
 		"memberId":    member.Data.ID,
 		"amountCents": int64(3400),
 		"status":      "paid",
@@ -130,7 +139,7 @@ func TestMerchantFlowSmoke(t *testing.T) {
 		t.Fatalf("create second order code = %d, msg = %s", secondOrder.Code, secondOrder.Msg)
 	}
 
-	member2 := performJSONRequest[testMember](t, router, http.MethodPost, "/api/v1/members", map[string]interface{}{
+	member2 := performJSONRequest[testMember](t, router, token, http.MethodPost, "/api/v1/members", map[string]interface{}{
 		"name":    "Bob",
 		"phone":   "13800002222",
 		"channel": "douyin",
@@ -139,7 +148,7 @@ func TestMerchantFlowSmoke(t *testing.T) {
 		t.Fatalf("create second member code = %d, msg = %s", member2.Code, member2.Msg)
 	}
 
-	thirdOrder := performJSONRequest[testOrder](t, router, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+	thirdOrder := performJSONRequest[testOrder](t, router, token, http.MethodPost, "/api/v1/orders", map[string]interface{}{
 		"memberId":    member2.Data.ID,
 		"amountCents": int64(9900),
 		"status":      "paid",
@@ -149,7 +158,7 @@ func TestMerchantFlowSmoke(t *testing.T) {
 		t.Fatalf("create third order code = %d, msg = %s", thirdOrder.Code, thirdOrder.Msg)
 	}
 
-	campaign := performJSONRequest[testCampaign](t, router, http.MethodPost, "/api/v1/campaigns", map[string]interface{}{
+	campaign := performJSONRequest[testCampaign](t, router, token, http.MethodPost, "/api/v1/campaigns", map[string]interface{}{
 		"name":        "Spring Repurchase",
 		"channel":     "wechat",
 		"discountPct": 12.5,
@@ -159,7 +168,7 @@ func TestMerchantFlowSmoke(t *testing.T) {
 		t.Fatalf("create campaign code = %d, msg = %s", campaign.Code, campaign.Msg)
 	}
 
-	summaryAfter := performJSONRequest[testSummary](t, router, http.MethodGet, "/api/v1/summary", nil)
+	summaryAfter := performJSONRequest[testSummary](t, router, token, http.MethodGet, "/api/v1/summary", nil)
 	if summaryAfter.Data.MemberCount != 2 {
 		t.Fatalf("memberCount = %d, want 2", summaryAfter.Data.MemberCount)
 	}
@@ -182,22 +191,22 @@ func TestMerchantFlowSmoke(t *testing.T) {
 		t.Fatalf("activeCampaignCount = %d, want 1", summaryAfter.Data.ActiveCampaignCount)
 	}
 
-	memberList := performJSONRequest[[]testMember](t, router, http.MethodGet, "/api/v1/members", nil)
+	memberList := performJSONRequest[[]testMember](t, router, token, http.MethodGet, "/api/v1/members", nil)
 	if len(memberList.Data) != 2 {
 		t.Fatalf("members length = %d, want 2", len(memberList.Data))
 	}
 
-	orderList := performJSONRequest[[]testOrder](t, router, http.MethodGet, "/api/v1/orders", nil)
+	orderList := performJSONRequest[[]testOrder](t, router, token, http.MethodGet, "/api/v1/orders", nil)
 	if len(orderList.Data) != 3 {
 		t.Fatalf("orders length = %d, want 3", len(orderList.Data))
 	}
 
-	campaignList := performJSONRequest[[]testCampaign](t, router, http.MethodGet, "/api/v1/campaigns", nil)
+	campaignList := performJSONRequest[[]testCampaign](t, router, token, http.MethodGet, "/api/v1/campaigns", nil)
 	if len(campaignList.Data) != 1 {
 		t.Fatalf("campaigns length = %d, want 1", len(campaignList.Data))
 	}
 
-	followupList := performJSONRequest[testFollowupPayload](t, router, http.MethodGet, "/api/v1/followups", nil)
+	followupList := performJSONRequest[testFollowupPayload](t, router, token, http.MethodGet, "/api/v1/followups", nil)
 	if len(followupList.Data.Items) != 1 {
 		t.Fatalf("followups length = %d, want 1", len(followupList.Data.Items))
 	}
@@ -208,7 +217,7 @@ func TestMerchantFlowSmoke(t *testing.T) {
 		t.Fatalf("followup paidOrderCount = %d, want 1", followupList.Data.Items[0].PaidOrderCount)
 	}
 
-	attribution := performJSONRequest[testAttributionPayload](t, router, http.MethodGet, "/api/v1/reports/campaign-attribution", nil)
+	attribution := performJSONRequest[testAttributionPayload](t, router, token, http.MethodGet, "/api/v1/reports/campaign-attribution", nil)
 	if len(attribution.Data.Rows) != 1 {
 		t.Fatalf("attribution rows = %d, want 1", len(attribution.Data.Rows))
 	}
@@ -225,7 +234,7 @@ func TestMerchantFlowSmoke(t *testing.T) {
 		t.Fatalf("attribution convertedMemberCount = %d, want 1", attribution.Data.Rows[0].ConvertedMemberCount)
 	}
 
-	csvResp := performRawRequest(t, router, http.MethodGet, "/api/v1/reports/campaign-attribution/export")
+	csvResp := performRawRequest(t, router, token, http.MethodGet, "/api/v1/reports/campaign-attribution/export")
 	if !strings.Contains(csvResp.Header.Get("Content-Type"), "text/csv") {
 		t.Fatalf("csv content-type = %q, want text/csv", csvResp.Header.Get("Content-Type"))
 	}
@@ -242,9 +251,603 @@ func TestMerchantFlowSmoke(t *testing.T) {
 	}
 }
 
+func TestMerchantRoutesRequireAuthMark(t *testing.T) {
+	t.Parallel()
+
+	router := newTestRouter(t)
+
+	for _, route := range router.Routes() {
+		if !strings.HasPrefix(route.Path, "/api/v1/") {
+			continue
+		}
+		if _, declared := merchantRouteAccess[route.Method+" "+route.Path]; !declared {
+			t.Fatalf("route %s %s has no access rule", route.Method, route.Path)
+		}
+	}
+
+	memberPayload := map[string]interface{}{
+		"name":    "Carol",
+		"phone":   "13800003333",
+		"channel": "wechat",
+	}
+
+	anonymous := performJSONRequest[map[string]interface{}](t, router, "", http.MethodGet, "/api/v1/summary", nil)
+	if anonymous.Code != 401 {
+		t.Fatalf("anonymous summary code = %d, want 401", anonymous.Code)
+	}
+	invalidToken := performJSONRequest[map[string]interface{}](t, router, "token-invalid", http.MethodPost, "/api/v1/members", memberPayload)
+	if invalidToken.Code != 401 {
+		t.Fatalf("invalid token create member code = %d, want 401", invalidToken.Code)
+	}
+
+	userToken := loginForTest(t, router, "User")
+	userSummary := performJSONRequest[testSummary](t, router, userToken, http.MethodGet, "/api/v1/summary", nil)
+	if userSummary.Code != 200 {
+		t.Fatalf("user summary code = %d, msg = %s", userSummary.Code, userSummary.Msg)
+	}
+	userFollowups := performJSONRequest[testFollowupPayload](t, router, userToken, http.MethodGet, "/api/v1/followups", nil)
+	if userFollowups.Code != 200 {
+		t.Fatalf("user followups code = %d, msg = %s", userFollowups.Code, userFollowups.Msg)
+	}
+	userMember := performJSONRequest[map[string]interface{}](t, router, userToken, http.MethodPost, "/api/v1/members", memberPayload)
+	if userMember.Code != 403 {
+		t.Fatalf("user create member code = %d, want 403", userMember.Code)
+	}
+	userOrder := performJSONRequest[map[string]interface{}](t, router, userToken, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+		"memberId":    1,
+		"amountCents": int64(1200),
+		"source":      "wechat",
+	})
+	if userOrder.Code != 403 {
+		t.Fatalf("user create order code = %d, want 403", userOrder.Code)
+	}
+
+	adminToken := loginForTest(t, router, "Admin")
+	adminMember := performJSONRequest[testMember](t, router, adminToken, http.MethodPost, "/api/v1/members", memberPayload)
+	if adminMember.Code != 200 {
+		t.Fatalf("admin create member code = %d, msg = %s", adminMember.Code, adminMember.Msg)
+	}
+	adminCampaign := performJSONRequest[map[string]interface{}](t, router, adminToken, http.MethodPost, "/api/v1/campaigns", map[string]interface{}{
+		"name":        "Admin Campaign",
+		"channel":     "wechat",
+		"discountPct": 10,
+	})
+	if adminCampaign.Code != 403 {
+		t.Fatalf("admin create campaign code = %d, want 403", adminCampaign.Code)
+	}
+	adminExport := performJSONRequest[map[string]interface{}](t, router, adminToken, http.MethodGet, "/api/v1/reports/campaign-attribution/export", nil)
+	if adminExport.Code != 403 {
+		t.Fatalf("admin export code = %d, want 403", adminExport.Code)
+	}
+
+	superToken := loginForTest(t, router, "Super")
+	superExport := performRawRequest(t, router, superToken, http.MethodGet, "/api/v1/reports/campaign-attribution/export")
+	if !strings.Contains(superExport.Header.Get("Content-Type"), "text/csv") {
+		t.Fatalf("super export content-type = %q, want text/csv", superExport.Header.Get("Content-Type"))
+	}
+}
+
+func TestOrderStatusTransitions(t *testing.T) {
+	t.Parallel()
+
+	router, database := newTestRouterWithDB(t)
+	token := loginForTest(t, router, "Admin")
+
+	member := performJSONRequest[testMember](t, router, token, http.MethodPost, "/api/v1/members", map[string]interface{}{
+		"name":    "Frank",
+		"phone":   "13800006666",
+		"channel": "wechat",
+	})
+	if member.Code != 200 {
+		t.Fatalf("create member code = %d, msg = %s", member.Code, member.Msg)
+	}
+	createOrder := func(status string) testOrder {
+		order := performJSONRequest[testOrder](t, router, token, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+			"memberId":    member.Data.ID,
+			"amountCents": int64(2500),
+			"status":      status,
+			"source":      "wechat",
+		})
+		if order.Code != 200 {
+			t.Fatalf("create %s order code = %d, msg = %s", status, order.Code, order.Msg)
+		}
+		return order.Data
+	}
+	patchStatus := func(orderID uint, status string) testEnvelope[testOrder] {
+		return performJSONRequest[testOrder](t, router, token, http.MethodPatch,
+			"/api/v1/orders/"+strconv.FormatUint(uint64(orderID), 10)+"/status",
+			map[string]string{"status": status, "note": "checked by phone"})
+	}
+
+	for _, status := range []string{"refunded", "cancelled", "shipped"} {
+		created := performJSONRequest[testOrder](t, router, token, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+			"memberId":    member.Data.ID,
+			"amountCents": int64(2500),
+			"status":      status,
+			"source":      "wechat",
+		})
+		if created.Code != 400 {
+			t.Fatalf("create %s order code = %d, want 400", status, created.Code)
+		}
+	}
+
+	pending := createOrder("pending")
+	if pending.PaidAt != nil {
+		t.Fatalf("pending order paidAt = %v, want nil", pending.PaidAt)
+	}
+
+	// Warm the summary cache so the transitions below must invalidate it.
+	before := performJSONRequest[testSummary](t, router, token, http.MethodGet, "/api/v1/summary", nil)
+	if before.Data.PaidOrderCount != 0 {
+		t.Fatalf("paidOrderCount before = %d, want 0", before.Data.PaidOrderCount)
+	}
+
+	paid := patchStatus(pending.ID, "paid")
+	if paid.Code != 200 || paid.Data.Status != "paid" || paid.Data.PaidAt == nil {
+		t.Fatalf("pending -> paid = %d %+v, msg = %s", paid.Code, paid.Data, paid.Msg)
+	}
+	afterPaid := performJSONRequest[testSummary](t, router, token, http.MethodGet, "/api/v1/summary", nil)
+	if afterPaid.Data.PaidOrderCount != 1 || afterPaid.Data.RevenueCents != 2500 {
+		t.Fatalf("summary after paid = %+v, want 1 paid order worth 2500", afterPaid.Data)
+	}
+
+	if again := patchStatus(pending.ID, "paid"); again.Code != 400 {
+		t.Fatalf("paid -> paid code = %d, want 400", again.Code)
+	}
+	if backwards := patchStatus(pending.ID, "pending"); backwards.Code != 400 {
+		t.Fatalf("paid -> pending code = %d, want 400", backwards.Code)
+	}
+
+	refunded := patchStatus(pending.ID, "refunded")
+	if refunded.Code != 200 || refunded.Data.Status != "refunded" || refunded.Data.PaidAt == nil {
+		t.Fatalf("paid -> refunded = %d %+v, msg = %s", refunded.Code, refunded.Data, refunded.Msg)
+	}
+	afterRefund := performJSONRequest[testSummary](t, router, token, http.MethodGet, "/api/v1/summary", nil)
+	if afterRefund.Data.PaidOrderCount != 0 {
+		t.Fatalf("paidOrderCount after refund = %d, want 0", afterRefund.Data.PaidOrderCount)
+	}
+	if terminal := patchStatus(pending.ID, "paid"); terminal.Code != 400 {
+		t.Fatalf("refunded -> paid code = %d, want 400", terminal.Code)
+	}
+
+	cancelled := patchStatus(createOrder("pending").ID, "cancelled")
+	if cancelled.Code != 200 || cancelled.Data.Status != "cancelled" || cancelled.Data.PaidAt != nil {
+		t.Fatalf("pending -> cancelled = %d %+v, msg = %s", cancelled.Code, cancelled.Data, cancelled.Msg)
+	}
+
+	if invalid := patchStatus(pending.ID, "shipped"); invalid.Code != 400 {
+		t.Fatalf("unknown status code = %d, want 400", invalid.Code)
+	}
+	if missing := patchStatus(9999, "paid"); missing.Code != 404 {
+		t.Fatalf("missing order code = %d, want 404", missing.Code)
+	}
+
+	var history []db.OrderStatusHistory
+	if err := database.Where("order_id = ?", pending.ID).Order("id").Find(&history).Error; err != nil {
+		t.Fatalf("load history: %v", err)
+	}
+	want := [][2]string{{"", "pending"}, {"pending", "paid"}, {"paid", "refunded"}}
+	if len(history) != len(want) {
+		t.Fatalf("history = %+v, want %d entries", history, len(want))
+	}
+	for i, entry := range history {
+		if entry.FromStatus != want[i][0] || entry.ToStatus != want[i][1] || entry.ChangedBy != "Admin" {
+			t.Fatalf("history[%d] = %+v, want %s -> %s by Admin", i, entry, want[i][0], want[i][1])
+		}
+	}
+
+	userToken := loginForTest(t, router, "User")
+	denied := performJSONRequest[testOrder](t, router, userToken, http.MethodPatch,
+		"/api/v1/orders/"+strconv.FormatUint(uint64(pending.ID), 10)+"/status", map[string]string{"status": "paid"})
+	if denied.Code != 403 {
+		t.Fatalf("user patch status code = %d, want 403", denied.Code)
+	}
+}
+
+func TestOrderRefunds(t *testing.T) {
+	t.Parallel()
+
+	router := newTestRouter(t)
+	token := loginForTest(t, router, "Admin")
+
+	member := performJSONRequest[testMember](t, router, token, http.MethodPost, "/api/v1/members", map[string]interface{}{
+		"name":    "Gina",
+		"phone":   "13800007777",
+		"channel": "wechat",
+	})
+	if member.Code != 200 {
+		t.Fatalf("create member code = %d, msg = %s", member.Code, member.Msg)
+	}
+	createOrder := func(status string) testOrder {
+		order := performJSONRequest[testOrder](t, router, token, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+			"memberId":    member.Data.ID,
+			"amountCents": int64(5000),
+			"status":      status,
+			"source":      "wechat",
+		})
+		if order.Code != 200 {
+			t.Fatalf("create %s order code = %d, msg = %s", status, order.Code, order.Msg)
+		}
+		return order.Data
+	}
+	type refundPayload struct {
+		Refund struct {
+			AmountCents int64  `json:"amountCents"`
+			Operator    string `json:"operator"`
+		} `json:"refund"`
+		Order struct {
+			Status        string `json:"status"`
+			RefundedCents int64  `json:"refundedCents"`
+		} `json:"order"`
+	}
+	refund := func(token string, orderID uint, amountCents int64) testEnvelope[refundPayload] {
+		return performJSONRequest[refundPayload](t, router, token, http.MethodPost,
+			"/api/v1/orders/"+strconv.FormatUint(uint64(orderID), 10)+"/refunds",
+			map[string]interface{}{"amountCents": amountCents, "reason": "damaged item"})
+	}
+
+	order := createOrder("paid")
+
+	partial := refund(token, order.ID, 2000)
+	if partial.Code != 200 || partial.Data.Order.RefundedCents != 2000 || partial.Data.Order.Status != "paid" {
+		t.Fatalf("partial refund = %d %+v, msg = %s", partial.Code, partial.Data, partial.Msg)
+	}
+	if partial.Data.Refund.Operator != "Admin" {
+		t.Fatalf("refund operator = %q, want Admin", partial.Data.Refund.Operator)
+	}
+
+	summary := performJSONRequest[testSummary](t, router, token, http.MethodGet, "/api/v1/summary", nil)
+	if summary.Data.RevenueCents != 3000 || summary.Data.PaidOrderCount != 1 {
+		t.Fatalf("summary after partial refund = %+v, want 1 paid order netting 3000", summary.Data)
+	}
+	type netFollowup struct {
+		MemberID        uint  `json:"memberId"`
+		PaidAmountCents int64 `json:"paidAmountCents"`
+	}
+	followups := performJSONRequest[struct {
+		Items []netFollowup `json:"items"`
+	}](t, router, token, http.MethodGet, "/api/v1/followups", nil)
+	if len(followups.Data.Items) != 1 || followups.Data.Items[0].PaidAmountCents != 3000 {
+		t.Fatalf("followups after partial refund = %+v, want net 3000", followups.Data.Items)
+	}
+
+	if over := refund(token, order.ID, 3001); over.Code != 400 {
+		t.Fatalf("over refund code = %d, want 400", over.Code)
+	}
+	if zero := refund(token, order.ID, 0); zero.Code != 400 {
+		t.Fatalf("zero refund code = %d, want 400", zero.Code)
+	}
+
+	rest := refund(token, order.ID, 3000)
+	if rest.Code != 200 || rest.Data.Order.Status != "refunded" || rest.Data.Order.RefundedCents != 5000 {
+		t.Fatalf("final refund = %d %+v, msg = %s", rest.Code, rest.Data, rest.Msg)
+	}
+	if afterFull := refund(token, order.ID, 1); afterFull.Code != 400 {
+		t.Fatalf("refund of refunded order code = %d, want 400", afterFull.Code)
+	}
+	if pending := refund(token, createOrder("pending").ID, 100); pending.Code != 400 {
+		t.Fatalf("refund of pending order code = %d, want 400", pending.Code)
+	}
+
+	summary = performJSONRequest[testSummary](t, router, token, http.MethodGet, "/api/v1/summary", nil)
+	if summary.Data.RevenueCents != 0 || summary.Data.PaidOrderCount != 0 {
+		t.Fatalf("summary after full refund = %+v, want no paid revenue", summary.Data)
+	}
+
+	refunds := performJSONRequest[[]map[string]interface{}](t, router, token, http.MethodGet,
+		"/api/v1/orders/"+strconv.FormatUint(uint64(order.ID), 10)+"/refunds", nil)
+	if refunds.Code != 200 || len(refunds.Data) != 2 {
+		t.Fatalf("list refunds = %d %+v, want 2 refunds", refunds.Code, refunds.Data)
+	}
+
+	// A full refund by status change books what partial refunds left, so the
+	// ledger total and the order's refundedCents agree either way.
+	byStatus := createOrder("paid")
+	if partial := refund(token, byStatus.ID, 1500); partial.Code != 200 {
+		t.Fatalf("partial refund before status change code = %d, msg = %s", partial.Code, partial.Msg)
+	}
+	patched := performJSONRequest[testOrder](t, router, token, http.MethodPatch,
+		"/api/v1/orders/"+strconv.FormatUint(uint64(byStatus.ID), 10)+"/status", map[string]string{"status": "refunded"})
+	if patched.Code != 200 || patched.Data.Status != "refunded" {
+		t.Fatalf("paid -> refunded = %d %+v, msg = %s", patched.Code, patched.Data, patched.Msg)
+	}
+	byStatusRefunds := performJSONRequest[[]struct {
+		AmountCents int64  `json:"amountCents"`
+		Reason      string `json:"reason"`
+	}](t, router, token, http.MethodGet, "/api/v1/orders/"+strconv.FormatUint(uint64(byStatus.ID), 10)+"/refunds", nil)
+	if byStatusRefunds.Code != 200 || len(byStatusRefunds.Data) != 2 {
+		t.Fatalf("refunds after status change = %d %+v, want 2", byStatusRefunds.Code, byStatusRefunds.Data)
+	}
+	var ledgerCents int64
+	for _, entry := range byStatusRefunds.Data {
+		ledgerCents += entry.AmountCents
+	}
+	if ledgerCents != 5000 {
+		t.Fatalf("refund ledger after status change = %d, want 5000", ledgerCents)
+	}
+	summary = performJSONRequest[testSummary](t, router, token, http.MethodGet, "/api/v1/summary", nil)
+	if summary.Data.RefundedCents != 10000 || summary.Data.RevenueCents != 0 {
+		t.Fatalf("summary after status refund = %+v, want 10000 refunded and no revenue", summary.Data)
+	}
+
+	userToken := loginForTest(t, router, "User")
+	if denied := refund(userToken, createOrder("paid").ID, 100); denied.Code != 403 {
+		t.Fatalf("user refund code = %d, want 403", denied.Code)
+	}
+}
+
+func TestConcurrentPartialRefundsCompleteOrder(t *testing.T) {
+	t.Parallel()
+
+	router, database := newTestRouterWithDB(t)
+	token := loginForTest(t, router, "Admin")
+
+	member := performJSONRequest[testMember](t, router, token, http.MethodPost, "/api/v1/members", map[string]interface{}{
+		"name":    "Hana",
+		"phone":   "13800007878",
+		"channel": "wechat",
+	})
+	if member.Code != 200 {
+		t.Fatalf("create member code = %d, msg = %s", member.Code, member.Msg)
+	}
+	order := performJSONRequest[testOrder](t, router, token, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+		"memberId":    member.Data.ID,
+		"amountCents": int64(5000),
+		"status":      "paid",
+		"source":      "wechat",
+	})
+	if order.Code != 200 {
+		t.Fatalf("create order code = %d, msg = %s", order.Code, order.Msg)
+	}
+	refundTarget := "/api/v1/orders/" + strconv.FormatUint(uint64(order.Data.ID), 10) + "/refunds"
+
+	// Hold the first refund after it has checked the order but before it
+	// writes, so the second one runs in between like a concurrent request.
+	var held atomic.Bool
+	blocked := make(chan struct{})
+	release := make(chan struct{})
+	if err := database.Callback().Update().Before("gorm:update").Register("test:hold_first_refund", func(tx *gorm.DB) {
+		if values, isMap := tx.Statement.Dest.(map[string]interface{}); isMap {
+			if _, refunding := values["refunded_cents"]; refunding && held.CompareAndSwap(false, true) {
+				close(blocked)
+				<-release
+			}
+		}
+	}); err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	first := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		req := httptest.NewRequest(http.MethodPost, refundTarget, strings.NewReader(`{"amountCents":2000}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		first <- rec
+	}()
+	<-blocked
+
+	second := performJSONRequest[testOrder](t, router, token, http.MethodPost, refundTarget, map[string]interface{}{"amountCents": 3000})
+	close(release)
+	if second.Code != 200 {
+		t.Fatalf("second refund code = %d, msg = %s", second.Code, second.Msg)
+	}
+
+	var firstResult testEnvelope[struct {
+		Order struct {
+			Status        string `json:"status"`
+			RefundedCents int64  `json:"refundedCents"`
+		} `json:"order"`
+	}]
+	if err := json.Unmarshal((<-first).Body.Bytes(), &firstResult); err != nil {
+		t.Fatalf("decode first refund: %v", err)
+	}
+	if firstResult.Code != 200 || firstResult.Data.Order.Status != "refunded" || firstResult.Data.Order.RefundedCents != 5000 {
+		t.Fatalf("first refund = %d %+v, msg = %s; want the order fully refunded", firstResult.Code, firstResult.Data, firstResult.Msg)
+	}
+
+	var stored db.Order
+	if err := database.First(&stored, order.Data.ID).Error; err != nil {
+		t.Fatalf("load order: %v", err)
+	}
+	if stored.Status != "refunded" || stored.RefundedCents != 5000 {
+		t.Fatalf("stored order = %s with %d refunded, want refunded with 5000", stored.Status, stored.RefundedCents)
+	}
+	var history int64
+	if err := database.Model(&db.OrderStatusHistory{}).Where("order_id = ? AND to_status = ?", order.Data.ID, "refunded").Count(&history).Error; err != nil {
+		t.Fatalf("count history: %v", err)
+	}
+	if history != 1 {
+		t.Fatalf("refunded history entries = %d, want 1", history)
+	}
+}
+
+func TestMemberUpdateDeleteRestore(t *testing.T) {
+	t.Parallel()
+
+	router := newTestRouter(t)
+	token := loginForTest(t, router, "Super")
+
+	createMember := func(name, phone string) testMember {
+		member := performJSONRequest[testMember](t, router, token, http.MethodPost, "/api/v1/members", map[string]interface{}{
+			"name":    name,
+			"phone":   phone,
+			"channel": "wechat",
+		})
+		if member.Code != 200 {
+			t.Fatalf("create member %s code = %d, msg = %s", name, member.Code, member.Msg)
+		}
+		return member.Data
+	}
+	kate := createMember("Kate", "13800010001")
+	leo := createMember("Lo", "13800010002")
+	for _, amount := range []int64{1000, 2000} {
+		order := performJSONRequest[testOrder](t, router, token, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+			"memberId":    kate.ID,
+			"amountCents": amount,
+			"source":      "wechat",
+		})
+		if order.Code != 200 {
+			t.Fatalf("create order code = %d, msg = %s", order.Code, order.Msg)
+		}
+	}
+	memberPath := func(id uint) string {
+		return "/api/v1/members/" + strconv.FormatUint(uint64(id), 10)
+	}
+
+	renamed := performJSONRequest[testMember](t, router, token, http.MethodPut, memberPath(leo.ID), map[string]interface{}{
+		"name":    "Leo",
+		"phone":   "13800010002",
+		"channel": "douyin",
+	})
+	if renamed.Code != 200 || renamed.Data.Name != "Leo" {
+		t.Fatalf("update member = %d %+v, msg = %s", renamed.Code, renamed.Data, renamed.Msg)
+	}
+	takenPhone := performJSONRequest[testMember](t, router, token, http.MethodPut, memberPath(leo.ID), map[string]interface{}{
+		"name":    "Leo",
+		"phone":   "13800010001",
+		"channel": "douyin",
+	})
+	if takenPhone.Code != 400 {
+		t.Fatalf("update to taken phone code = %d, want 400", takenPhone.Code)
+	}
+
+	if adminDelete := performJSONRequest[map[string]interface{}](t, router, loginForTest(t, router, "Admin"),
+		http.MethodDelete, memberPath(kate.ID), nil); adminDelete.Code != 403 {
+		t.Fatalf("admin delete member code = %d, want 403", adminDelete.Code)
+	}
+	deleted := performJSONRequest[map[string]interface{}](t, router, token, http.MethodDelete, memberPath(kate.ID), nil)
+	if deleted.Code != 200 {
+		t.Fatalf("delete member code = %d, msg = %s", deleted.Code, deleted.Msg)
+	}
+	if again := performJSONRequest[map[string]interface{}](t, router, token, http.MethodDelete, memberPath(kate.ID), nil); again.Code != 404 {
+		t.Fatalf("delete deleted member code = %d, want 404", again.Code)
+	}
+
+	members := performJSONRequest[[]testMember](t, router, token, http.MethodGet, "/api/v1/members", nil)
+	if len(members.Data) != 1 || members.Data[0].ID != leo.ID {
+		t.Fatalf("members after delete = %+v, want only Leo", members.Data)
+	}
+	deletedMembers := performJSONRequest[[]testMember](t, router, token, http.MethodGet, "/api/v1/members?deleted=true", nil)
+	if len(deletedMembers.Data) != 1 || deletedMembers.Data[0].ID != kate.ID {
+		t.Fatalf("deleted members = %+v, want only Kate", deletedMembers.Data)
+	}
+
+	summary := performJSONRequest[testSummary](t, router, token, http.MethodGet, "/api/v1/summary", nil)
+	if summary.Data.MemberCount != 1 || summary.Data.RevenueCents != 3000 || summary.Data.RepurchaseCount != 0 {
+		t.Fatalf("summary after delete = %+v, want 1 member, revenue 3000 kept, no repurchase", summary.Data)
+	}
+	followups := performJSONRequest[testFollowupPayload](t, router, token, http.MethodGet, "/api/v1/followups", nil)
+	for _, item := range followups.Data.Items {
+		if item.MemberID == kate.ID {
+			t.Fatalf("followups should skip deleted member: %+v", followups.Data.Items)
+		}
+	}
+	orders := performJSONRequest[[]struct {
+		MemberName string `json:"memberName"`
+	}](t, router, token, http.MethodGet, "/api/v1/orders", nil)
+	if len(orders.Data) != 2 || orders.Data[0].MemberName != "Kate" {
+		t.Fatalf("orders after delete = %+v, want Kate's orders kept", orders.Data)
+	}
+	blocked := performJSONRequest[testOrder](t, router, token, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+		"memberId":    kate.ID,
+		"amountCents": int64(500),
+		"source":      "wechat",
+	})
+	if blocked.Code != 400 {
+		t.Fatalf("order for deleted member code = %d, want 400", blocked.Code)
+	}
+
+	// The deleted member still holds the phone; staff are pointed at restore.
+	recreated := performJSONRequest[testMember](t, router, token, http.MethodPost, "/api/v1/members", map[string]interface{}{
+		"name":    "Kate",
+		"phone":   "13800010001",
+		"channel": "wechat",
+	})
+	if recreated.Code != 409 || !strings.Contains(recreated.Msg, memberPath(kate.ID)+"/restore") {
+		t.Fatalf("recreate deleted member's phone = %d, msg = %s; want 409 pointing to restore", recreated.Code, recreated.Msg)
+	}
+	if moved := performJSONRequest[testMember](t, router, token, http.MethodPut, memberPath(leo.ID), map[string]interface{}{
+		"name":    "Leo",
+		"phone":   "13800010001",
+		"channel": "douyin",
+	}); moved.Code != 409 {
+		t.Fatalf("update to deleted member's phone code = %d, want 409", moved.Code)
+	}
+
+	restored := performJSONRequest[testMember](t, router, token, http.MethodPost, memberPath(kate.ID)+"/restore", nil)
+	if restored.Code != 200 || restored.Data.ID != kate.ID {
+		t.Fatalf("restore member = %d %+v, msg = %s", restored.Code, restored.Data, restored.Msg)
+	}
+	if again := performJSONRequest[testMember](t, router, token, http.MethodPost, memberPath(kate.ID)+"/restore", nil); again.Code != 404 {
+		t.Fatalf("restore active member code = %d, want 404", again.Code)
+	}
+	summary = performJSONRequest[testSummary](t, router, token, http.MethodGet, "/api/v1/summary", nil)
+	if summary.Data.MemberCount != 2 || summary.Data.RepurchaseCount != 1 {
+		t.Fatalf("summary after restore = %+v, want 2 members and 1 repurchase", summary.Data)
+	}
+}
+
+// newTestRouter builds a router on a fresh local sqlite database and cache.
+func newTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+
+	router, _ := newTestRouterWithDB(t)
+	return router
+}
+
+// newTestRouterWithDB is newTestRouter for tests that also inspect the database.
+func newTestRouterWithDB(t *testing.T) (*gin.Engine, *gorm.DB) {
+	t.Helper()
+
+	cfg := config.Config{
+		Env:             "local",
+		Port:            "8080",
+		SQLitePath:      filepath.Join(t.TempDir(), "app.db"),
+		CacheMode:       "local",
+		CORSAllowOrigin: "*",
+	}
+
+	database, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+
+	cacheStore, err := cache.New(cfg, PinnedCacheKeyPrefixes()...)
+	if err != nil {
+		t.Fatalf("open cache: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = cacheStore.Close()
+	})
+
+	return NewRouter(database, cacheStore, cfg), database
+}
+
+func loginForTest(t *testing.T, router http.Handler, userName string) string {
+	t.Helper()
+
+	return loginWithPasswordForTest(t, router, userName, "123456")
+}
+
+func loginWithPasswordForTest(t *testing.T, router http.Handler, userName, password string) string {
+	t.Helper()
+
+	login := performJSONRequest[authLoginData](t, router, "", http.MethodPost, "/api/auth/login", map[string]string{
+		"userName": userName,
+		"password": password,
+	})
+	if login.Code != 200 || login.Data.Token == "" {
+		t.Fatalf("login %s code = %d, msg = %s", userName, login.Code, login.Msg)
+	}
+	return login.Data.Token
+}
+
 func performJSONRequest[T any](
 	t *testing.T,
 	router http.Handler,
+	token string,
 	method, target string,
 	payload interface{},
 ) testEnvelope[T] {
@@ -265,6 +868,9 @@ func performJSONRequest[T any](
 	if payload != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
 	rec := httptest.NewRecorder()
 	router.ServeHTTP(rec, req)
 
@@ -282,10 +888,14 @@ func performJSONRequest[T any](
 func performRawRequest(
 	t *testing.T,
 	router http.Handler,
+	token string,
 	method, target string,
 ) *http.Response {
 	t.Helper()
 	req := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
 	rec := httptest.NewRecorder()
 	router.ServeHTTP(rec, req)
 	return rec.Result()
@@ -0,0 +1,508 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"small-merchant-ops-hub-server/internal/db"
+)
+
+type saveTagRequest struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+type setMemberTagsRequest struct {
+	TagIDs []uint `json:"tagIds"`
+}
+
+type saveSegmentRequest struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Rule        segmentRule `json:"rule"`
+}
+
+type tagResponse struct {
+	ID          uint      `json:"id"`
+	Name        string    `json:"name"`
+	Color       string    `json:"color"`
+	MemberCount int64     `json:"memberCount"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type segmentResponse struct {
+	ID          uint            `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Rule        json.RawMessage `json:"rule"`
+	CreatedBy   string          `json:"createdBy"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	UpdatedAt   time.Time       `json:"updatedAt"`
+}
+
+// errUnknownTag marks tag ids that do not exist.
+var errUnknownTag = errors.New("unknown tag")
+
+func listTagsHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		// Only active members count toward a tag.
+		rows := make([]tagResponse, 0)
+		if err := database.WithContext(ctx).
+			Table("tags AS t").
+			Select("t.id, t.name, t.color, t.created_at, COUNT(m.id) AS member_count").
+			Joins("LEFT JOIN member_tags AS mt ON mt.tag_id = t.id").
+			Joins("LEFT JOIN members AS m ON m.id = mt.member_id AND m.deleted_at IS NULL").
+			Group("t.id, t.name, t.color, t.created_at").
+			Order("t.id ASC").
+			Scan(&rows).Error; err != nil {
+			fail(c, 500, "list tags failed")
+			return
+		}
+		ok(c, rows)
+	}
+}
+
+func createTagHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req saveTagRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid tag payload")
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		req.Color = strings.TrimSpace(req.Color)
+		if req.Name == "" {
+			fail(c, 400, "name is required")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		tag := db.Tag{Name: req.Name, Color: req.Color}
+		if err := database.WithContext(ctx).Create(&tag).Error; err != nil {
+			if strings.Contains(strings.ToLower(err.Error()), "unique") {
+				fail(c, 400, "tag name already exists")
+				return
+			}
+			fail(c, 500, "create tag failed")
+			return
+		}
+		ok(c, toTagResponse(tag, 0))
+	}
+}
+
+func updateTagHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tagID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid tag id")
+			return
+		}
+
+		var req saveTagRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid tag payload")
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		req.Color = strings.TrimSpace(req.Color)
+		if req.Name == "" {
+			fail(c, 400, "name is required")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var tag db.Tag
+		if err := database.WithContext(ctx).First(&tag, tagID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "tag not found")
+				return
+			}
+			fail(c, 500, "query tag failed")
+			return
+		}
+		if err := database.WithContext(ctx).Model(&tag).Updates(map[string]interface{}{
+			"name":  req.Name,
+			"color": req.Color,
+		}).Error; err != nil {
+			if strings.Contains(strings.ToLower(err.Error()), "unique") {
+				fail(c, 400, "tag name already exists")
+				return
+			}
+			fail(c, 500, "update tag failed")
+			return
+		}
+		tag.Name = req.Name
+		tag.Color = req.Color
+
+		var memberCount int64
+		if err := database.WithContext(ctx).
+			Table("member_tags AS mt").
+			Joins("JOIN members AS m ON m.id = mt.member_id AND m.deleted_at IS NULL").
+			Where("mt.tag_id = ?", tag.ID).
+			Count(&memberCount).Error; err != nil {
+			fail(c, 500, "count tag members failed")
+			return
+		}
+		ok(c, toTagResponse(tag, memberCount))
+	}
+}
+
+func deleteTagHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tagID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid tag id")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var deleted int64
+		err := database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("tag_id = ?", tagID).Delete(&db.MemberTag{}).Error; err != nil {
+				return err
+			}
+			result := tx.Delete(&db.Tag{}, tagID)
+			deleted = result.RowsAffected
+			return result.Error
+		})
+		if err != nil {
+			fail(c, 500, "delete tag failed")
+			return
+		}
+		if deleted == 0 {
+			fail(c, 404, "tag not found")
+			return
+		}
+		ok(c, gin.H{"id": tagID})
+	}
+}
+
+// setMemberTagsHandler replaces the tags of a member with tagIds.
+func setMemberTagsHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		memberID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid member id")
+			return
+		}
+
+		var req setMemberTagsRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid member tags payload")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var member db.Member
+		if err := database.WithContext(ctx).First(&member, memberID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "member not found")
+				return
+			}
+			fail(c, 500, "query member failed")
+			return
+		}
+
+		tags, err := findTagsByIDs(ctx, database, req.TagIDs)
+		if err != nil {
+			if errors.Is(err, errUnknownTag) {
+				fail(c, 400, err.Error())
+				return
+			}
+			fail(c, 500, "query tags failed")
+			return
+		}
+		if err := database.WithContext(ctx).Model(&member).Association("Tags").Replace(tags); err != nil {
+			fail(c, 500, "save member tags failed")
+			return
+		}
+
+		member.Tags = tags
+		ok(c, toMemberResponse(member, piiViewFor(c)))
+	}
+}
+
+func listSegmentsHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		segments := make([]db.Segment, 0)
+		if err := database.WithContext(ctx).Order("id DESC").Find(&segments).Error; err != nil {
+			fail(c, 500, "list segments failed")
+			return
+		}
+
+		result := make([]segmentResponse, 0, len(segments))
+		for _, segment := range segments {
+			result = append(result, toSegmentResponse(segment))
+		}
+		ok(c, result)
+	}
+}
+
+func createSegmentHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req saveSegmentRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid segment payload")
+			return
+		}
+		rule, msg := normalizeSaveSegmentRequest(&req)
+		if msg != "" {
+			fail(c, 400, msg)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		segment := db.Segment{
+			Name:        req.Name,
+			Description: req.Description,
+			Rule:        rule,
+			CreatedBy:   sessionFromContext(c).UserName,
+		}
+		if err := database.WithContext(ctx).Create(&segment).Error; err != nil {
+			if strings.Contains(strings.ToLower(err.Error()), "unique") {
+				fail(c, 400, "segment name already exists")
+				return
+			}
+			fail(c, 500, "create segment failed")
+			return
+		}
+		ok(c, toSegmentResponse(segment))
+	}
+}
+
+func updateSegmentHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		segmentID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid segment id")
+			return
+		}
+
+		var req saveSegmentRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid segment payload")
+			return
+		}
+		rule, msg := normalizeSaveSegmentRequest(&req)
+		if msg != "" {
+			fail(c, 400, msg)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var segment db.Segment
+		if err := database.WithContext(ctx).First(&segment, segmentID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "segment not found")
+				return
+			}
+			fail(c, 500, "query segment failed")
+			return
+		}
+		if err := database.WithContext(ctx).Model(&segment).Updates(map[string]interface{}{
+			"name":        req.Name,
+			"description": req.Description,
+			"rule":        rule,
+		}).Error; err != nil {
+			if strings.Contains(strings.ToLower(err.Error()), "unique") {
+				fail(c, 400, "segment name already exists")
+				return
+			}
+			fail(c, 500, "update segment failed")
+			return
+		}
+		segment.Name = req.Name
+		segment.Description = req.Description
+		segment.Rule = rule
+		ok(c, toSegmentResponse(segment))
+	}
+}
+
+func deleteSegmentHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		segmentID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid segment id")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		result := database.WithContext(ctx).Delete(&db.Segment{}, segmentID)
+		if result.Error != nil {
+			fail(c, 500, "delete segment failed")
+			return
+		}
+		if result.RowsAffected == 0 {
+			fail(c, 404, "segment not found")
+			return
+		}
+		ok(c, gin.H{"id": segmentID})
+	}
+}
+
+// segmentMembersHandler evaluates a saved segment and pages its live audience.
+func segmentMembersHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		segmentID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid segment id")
+			return
+		}
+		current := parseIntWithBounds(c.Query("current"), 1, 1, 1000)
+		size := parseIntWithBounds(c.Query("size"), 20, 1, 200)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		var segment db.Segment
+		if err := database.WithContext(ctx).First(&segment, segmentID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "segment not found")
+				return
+			}
+			fail(c, 500, "query segment failed")
+			return
+		}
+
+		var rule segmentRule
+		if err := json.Unmarshal([]byte(segment.Rule), &rule); err != nil {
+			fail(c, 500, "stored segment rule is invalid")
+			return
+		}
+		where, args, err := compileSegmentRule(rule, time.Now())
+		if err != nil {
+			fail(c, 500, "stored segment rule is invalid")
+			return
+		}
+
+		query := database.WithContext(ctx).
+			Table(segmentAudienceSQL).
+			Where("m.deleted_at IS NULL").
+			Where(where, args...)
+
+		var total int64
+		if err := query.Session(&gorm.Session{}).Select("COUNT(*)").Scan(&total).Error; err != nil {
+			fail(c, 500, "count segment members failed")
+			return
+		}
+
+		members := make([]db.Member, 0, size)
+		if err := query.
+			Select("m.*").
+			Order("m.id ASC").
+			Offset((current - 1) * size).
+			Limit(size).
+			Scan(&members).Error; err != nil {
+			fail(c, 500, "list segment members failed")
+			return
+		}
+
+		pii := piiViewFor(c)
+		records := make([]memberResponse, 0, len(members))
+		for _, member := range members {
+			records = append(records, toMemberResponse(member, pii))
+		}
+		ok(c, paginatedData{
+			Records: records,
+			Current: current,
+			Size:    size,
+			Total:   int(total),
+		})
+	}
+}
+
+func findTagsByIDs(ctx context.Context, database *gorm.DB, ids []uint) ([]db.Tag, error) {
+	unique := make([]uint, 0, len(ids))
+	seen := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	tags := make([]db.Tag, 0, len(unique))
+	if len(unique) == 0 {
+		return tags, nil
+	}
+	if err := database.WithContext(ctx).Where("id IN ?", unique).Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	if len(tags) != len(unique) {
+		found := make(map[uint]bool, len(tags))
+		for _, tag := range tags {
+			found[tag.ID] = true
+		}
+		for _, id := range unique {
+			if !found[id] {
+				return nil, fmt.Errorf("%w: %d", errUnknownTag, id)
+			}
+		}
+	}
+	return tags, nil
+}
+
+// normalizeSaveSegmentRequest trims the request and checks that the rule
+// compiles, returning the rule as stored JSON or a validation message.
+func normalizeSaveSegmentRequest(req *saveSegmentRequest) (string, string) {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Description = strings.TrimSpace(req.Description)
+	if req.Name == "" {
+		return "", "name is required"
+	}
+	if _, _, err := compileSegmentRule(req.Rule, time.Now()); err != nil {
+		return "", err.Error()
+	}
+	raw, err := json.Marshal(req.Rule)
+	if err != nil {
+		return "", "invalid rule"
+	}
+	return string(raw), ""
+}
+
+func toTagResponse(tag db.Tag, memberCount int64) tagResponse {
+	return tagResponse{
+		ID:          tag.ID,
+		Name:        tag.Name,
+		Color:       tag.Color,
+		MemberCount: memberCount,
+		CreatedAt:   tag.CreatedAt,
+	}
+}
+
+func toSegmentResponse(segment db.Segment) segmentResponse {
+	return segmentResponse{
+		ID:          segment.ID,
+		Name:        segment.Name,
+		Description: segment.Description,
+		Rule:        json.RawMessage(segment.Rule),
+		CreatedBy:   segment.CreatedBy,
+		CreatedAt:   segment.CreatedAt,
+		UpdatedAt:   segment.UpdatedAt,
+	}
+}
@@ -0,0 +1,228 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testTag struct {
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	MemberCount int64  `json:"memberCount"`
+}
+
+type testSegment struct {
+	ID   uint            `json:"id"`
+	Name string          `json:"name"`
+	Rule json.RawMessage `json:"rule"`
+}
+
+type testSegmentMembers struct {
+	Records []testMember `json:"records"`
+	Total   int          `json:"total"`
+}
+
+func TestCompileSegmentRule(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	var rule segmentRule
+	if err := json.Unmarshal([]byte(`{"op":"and","rules":[
+		{"field":"channel","cmp":"eq","value":"douyin"},
+		{"op":"or","rules":[
+			{"field":"paid_order_count","cmp":"gte","value":3},
+			{"field":"tag","cmp":"has","value":7}]},
+		{"field":"days_since_last_paid","cmp":"gt","value":60}]}`), &rule); err != nil {
+		t.Fatalf("unmarshal rule: %v", err)
+	}
+
+	where, args, err := compileSegmentRule(rule, now)
+	if err != nil {
+		t.Fatalf("compile rule: %v", err)
+	}
+	wantWhere := "(m.channel = ? AND (COALESCE(s.paid_order_count, 0) >= ? OR " +
+		"EXISTS (SELECT 1 FROM member_tags AS mt WHERE mt.member_id = m.id AND mt.tag_id = ?)) AND s.last_paid_at < ?)"
+	if where != wantWhere {
+		t.Fatalf("where = %q, want %q", where, wantWhere)
+	}
+	wantArgs := []interface{}{"douyin", int64(3), uint(7), now.AddDate(0, 0, -60)}
+	if fmt.Sprint(args) != fmt.Sprint(wantArgs) {
+		t.Fatalf("args = %v, want %v", args, wantArgs)
+	}
+
+	invalid := []string{
+		`{}`,
+		`{"op":"xor","rules":[{"field":"channel","cmp":"eq","value":"wechat"}]}`,
+		`{"op":"and","rules":[]}`,
+		`{"field":"phone","cmp":"eq","value":"138"}`,
+		`{"field":"channel","cmp":"gt","value":"wechat"}`,
+		`{"field":"paid_order_count","cmp":"gte","value":"three"}`,
+		`{"field":"days_since_last_paid","cmp":"eq","value":30}`,
+		`{"op":"and","rules":[{"op":"and","rules":[{"op":"and","rules":[{"op":"and","rules":[{"op":"and","rules":[
+			{"field":"channel","cmp":"eq","value":"wechat"}]}]}]}]}]}`,
+	}
+	for _, raw := range invalid {
+		var invalidRule segmentRule
+		if err := json.Unmarshal([]byte(raw), &invalidRule); err != nil {
+			t.Fatalf("unmarshal %s: %v", raw, err)
+		}
+		if _, _, err := compileSegmentRule(invalidRule, now); !errors.Is(err, errInvalidSegmentRule) {
+			t.Fatalf("compile %s err = %v, want errInvalidSegmentRule", raw, err)
+		}
+	}
+
+	many := segmentRule{Op: "or"}
+	for i := 0; i <= maxSegmentRuleConditions; i++ {
+		many.Rules = append(many.Rules, segmentRule{Field: "channel", Cmp: "eq", Value: json.RawMessage(`"wechat"`)})
+	}
+	if _, _, err := compileSegmentRule(many, now); !errors.Is(err, errInvalidSegmentRule) {
+		t.Fatalf("compile %d conditions err = %v, want errInvalidSegmentRule", len(many.Rules), err)
+	}
+}
+
+func TestTagsAndSegmentAudience(t *testing.T) {
+	t.Parallel()
+
+	router, database := newTestRouterWithDB(t)
+	token := loginForTest(t, router, "Admin")
+
+	createMember := func(name, phone, channel string, paidOrders int, lastPaid time.Time) uint {
+		member := performJSONRequest[testMember](t, router, token, http.MethodPost, "/api/v1/members", map[string]interface{}{
+			"name":    name,
+			"phone":   phone,
+			"channel": channel,
+		})
+		if member.Code != 200 {
+			t.Fatalf("create member %s code = %d, msg = %s", name, member.Code, member.Msg)
+		}
+		for i := 0; i < paidOrders; i++ {
+			order := performJSONRequest[testOrder](t, router, token, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+				"memberId":    member.Data.ID,
+				"amountCents": int64(1000),
+				"source":      channel,
+			})
+			if order.Code != 200 {
+				t.Fatalf("create order for %s code = %d, msg = %s", name, order.Code, order.Msg)
+			}
+		}
+		if err := database.Table("orders").Where("member_id = ?", member.Data.ID).Update("paid_at", lastPaid).Error; err != nil {
+			t.Fatalf("backdate orders for %s: %v", name, err)
+		}
+		return member.Data.ID
+	}
+
+	now := time.Now()
+	lapsed := createMember("Kate", "13800007701", "douyin", 3, now.AddDate(0, 0, -90))
+	createMember("Leo", "13800007702", "douyin", 3, now.AddDate(0, 0, -10))
+	fewOrders := createMember("Mia", "13800007703", "douyin", 2, now.AddDate(0, 0, -90))
+	createMember("Nate", "13800007704", "wechat", 4, now.AddDate(0, 0, -90))
+	removed := createMember("Olga", "13800007705", "douyin", 3, now.AddDate(0, 0, -90))
+	superToken := loginForTest(t, router, "Super")
+	if deleted := performJSONRequest[testMember](t, router, superToken, http.MethodDelete,
+		fmt.Sprintf("/api/v1/members/%d", removed), nil); deleted.Code != 200 {
+		t.Fatalf("delete member code = %d, msg = %s", deleted.Code, deleted.Msg)
+	}
+
+	vip := performJSONRequest[testTag](t, router, token, http.MethodPost, "/api/v1/tags", map[string]string{"name": "VIP", "color": "#f5a623"})
+	if vip.Code != 200 {
+		t.Fatalf("create tag code = %d, msg = %s", vip.Code, vip.Msg)
+	}
+	if duplicate := performJSONRequest[testTag](t, router, token, http.MethodPost, "/api/v1/tags", map[string]string{"name": "VIP"}); duplicate.Code != 400 {
+		t.Fatalf("duplicate tag code = %d, want 400", duplicate.Code)
+	}
+	tagged := performJSONRequest[map[string]interface{}](t, router, token, http.MethodPut,
+		fmt.Sprintf("/api/v1/members/%d/tags", fewOrders), map[string]interface{}{"tagIds": []uint{vip.Data.ID, vip.Data.ID}})
+	if tagged.Code != 200 {
+		t.Fatalf("set member tags code = %d, msg = %s", tagged.Code, tagged.Msg)
+	}
+	if unknown := performJSONRequest[map[string]interface{}](t, router, token, http.MethodPut,
+		fmt.Sprintf("/api/v1/members/%d/tags", fewOrders), map[string]interface{}{"tagIds": []uint{9999}}); unknown.Code != 400 {
+		t.Fatalf("unknown tag code = %d, want 400", unknown.Code)
+	}
+	tags := performJSONRequest[[]testTag](t, router, token, http.MethodGet, "/api/v1/tags", nil)
+	if tags.Code != 200 || len(tags.Data) != 1 || tags.Data[0].MemberCount != 1 {
+		t.Fatalf("list tags = %d %+v, want VIP with 1 member", tags.Code, tags.Data)
+	}
+
+	segment := performJSONRequest[testSegment](t, router, token, http.MethodPost, "/api/v1/segments", map[string]interface{}{
+		"name": "Lapsed douyin regulars",
+		"rule": json.RawMessage(`{"op":"and","rules":[
+			{"field":"channel","cmp":"eq","value":"douyin"},
+			{"field":"paid_order_count","cmp":"gte","value":3},
+			{"field":"days_since_last_paid","cmp":"gt","value":60}]}`),
+	})
+	if segment.Code != 200 || !strings.Contains(string(segment.Data.Rule), `"paid_order_count"`) {
+		t.Fatalf("create segment = %d %+v, msg = %s", segment.Code, segment.Data, segment.Msg)
+	}
+	audience := func(segmentID uint) []uint {
+		t.Helper()
+
+		result := performJSONRequest[testSegmentMembers](t, router, token, http.MethodGet,
+			fmt.Sprintf("/api/v1/segments/%d/members?size=10", segmentID), nil)
+		if result.Code != 200 || result.Data.Total != len(result.Data.Records) {
+			t.Fatalf("segment members = %d %+v, msg = %s", result.Code, result.Data, result.Msg)
+		}
+		ids := make([]uint, 0, len(result.Data.Records))
+		for _, member := range result.Data.Records {
+			ids = append(ids, member.ID)
+		}
+		return ids
+	}
+	if got := audience(segment.Data.ID); fmt.Sprint(got) != fmt.Sprint([]uint{lapsed}) {
+		t.Fatalf("audience = %v, want only %d", got, lapsed)
+	}
+
+	updated := performJSONRequest[testSegment](t, router, token, http.MethodPut,
+		fmt.Sprintf("/api/v1/segments/%d", segment.Data.ID), map[string]interface{}{
+			"name": "Lapsed douyin regulars or VIP",
+			"rule": json.RawMessage(fmt.Sprintf(`{"op":"and","rules":[
+				{"field":"channel","cmp":"eq","value":"douyin"},
+				{"field":"days_since_last_paid","cmp":"gt","value":60},
+				{"op":"or","rules":[
+					{"field":"paid_order_count","cmp":"gte","value":3},
+					{"field":"tag","cmp":"has","value":%d}]}]}`, vip.Data.ID)),
+		})
+	if updated.Code != 200 {
+		t.Fatalf("update segment code = %d, msg = %s", updated.Code, updated.Msg)
+	}
+	if got := audience(segment.Data.ID); fmt.Sprint(got) != fmt.Sprint([]uint{lapsed, fewOrders}) {
+		t.Fatalf("audience after update = %v, want %d and %d", got, lapsed, fewOrders)
+	}
+
+	invalid := performJSONRequest[testSegment](t, router, token, http.MethodPost, "/api/v1/segments", map[string]interface{}{
+		"name": "Broken",
+		"rule": json.RawMessage(`{"field":"phone","cmp":"eq","value":"138"}`),
+	})
+	if invalid.Code != 400 {
+		t.Fatalf("invalid rule code = %d, want 400", invalid.Code)
+	}
+
+	if removedTag := performJSONRequest[map[string]interface{}](t, router, token, http.MethodDelete,
+		fmt.Sprintf("/api/v1/tags/%d", vip.Data.ID), nil); removedTag.Code != 200 {
+		t.Fatalf("delete tag code = %d, msg = %s", removedTag.Code, removedTag.Msg)
+	}
+	var links int64
+	if err := database.Table("member_tags").Count(&links).Error; err != nil {
+		t.Fatalf("count member tags: %v", err)
+	}
+	if links != 0 {
+		t.Fatalf("member_tags = %d after tag delete, want 0", links)
+	}
+
+	userToken := loginForTest(t, router, "User")
+	if denied := performJSONRequest[testSegment](t, router, userToken, http.MethodPost, "/api/v1/segments", map[string]interface{}{
+		"name": "Mine",
+		"rule": json.RawMessage(`{"field":"channel","cmp":"eq","value":"wechat"}`),
+	}); denied.Code != 403 {
+		t.Fatalf("user create segment code = %d, want 403", denied.Code)
+	}
+	if listed := performJSONRequest[testSegmentMembers](t, router, userToken, http.MethodGet,
+		fmt.Sprintf("/api/v1/segments/%d/members", segment.Data.ID), nil); listed.Code != 200 {
+		t.Fatalf("user list segment members code = %d, msg = %s", listed.Code, listed.Msg)
+	}
+}
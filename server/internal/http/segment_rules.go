@@ -0,0 +1,195 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	maxSegmentRuleDepth      = 5
+	maxSegmentRuleConditions = 50
+)
+
+// segmentRule is a node of a segment rule tree. A group sets Op ("and"/"or")
+// and Rules; a condition sets Field, Cmp and Value, for example
+//
+//	{"op":"and","rules":[
+//	  {"field":"channel","cmp":"eq","value":"douyin"},
+//	  {"field":"paid_order_count","cmp":"gte","value":3},
+//	  {"field":"days_since_last_paid","cmp":"gt","value":60}]}
+type segmentRule struct {
+	Op    string          `json:"op,omitempty"`
+	Rules []segmentRule   `json:"rules,omitempty"`
+	Field string          `json:"field,omitempty"`
+	Cmp   string          `json:"cmp,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// errInvalidSegmentRule marks rule trees that cannot be compiled.
+var errInvalidSegmentRule = errors.New("invalid rule")
+
+// segmentAudienceSQL is the FROM clause rules are compiled against: members m
+// with their paid-order aggregates s (net of refunds).
+const segmentAudienceSQL = `members AS m LEFT JOIN (
+	SELECT member_id,
+		COUNT(*) AS paid_order_count,
+		SUM(amount_cents - refunded_cents) AS paid_amount_cents,
+		MAX(paid_at) AS last_paid_at
+	FROM orders
+	WHERE status = 'paid'
+	GROUP BY member_id
+) AS s ON s.member_id = m.id`
+
+var segmentNumericSQL = map[string]string{
+	"paid_order_count":  "COALESCE(s.paid_order_count, 0)",
+	"paid_amount_cents": "COALESCE(s.paid_amount_cents, 0)",
+}
+
+var segmentCompareSQL = map[string]string{
+	"eq":  "=",
+	"neq": "<>",
+	"gt":  ">",
+	"gte": ">=",
+	"lt":  "<",
+	"lte": "<=",
+}
+
+// compileSegmentRule turns a rule tree into a WHERE fragment over
+// segmentAudienceSQL. now anchors relative day conditions.
+func compileSegmentRule(rule segmentRule, now time.Time) (string, []interface{}, error) {
+	conditions := 0
+	return compileSegmentNode(rule, now, 1, &conditions)
+}
+
+func compileSegmentNode(rule segmentRule, now time.Time, depth int, conditions *int) (string, []interface{}, error) {
+	if depth > maxSegmentRuleDepth {
+		return "", nil, fmt.Errorf("%w: nesting deeper than %d", errInvalidSegmentRule, maxSegmentRuleDepth)
+	}
+
+	if rule.Op != "" {
+		joiner := ""
+		switch strings.ToLower(rule.Op) {
+		case "and":
+			joiner = " AND "
+		case "or":
+			joiner = " OR "
+		default:
+			return "", nil, fmt.Errorf("%w: op must be and or or", errInvalidSegmentRule)
+		}
+		if len(rule.Rules) == 0 {
+			return "", nil, fmt.Errorf("%w: %s group has no rules", errInvalidSegmentRule, rule.Op)
+		}
+
+		parts := make([]string, 0, len(rule.Rules))
+		args := make([]interface{}, 0)
+		for _, child := range rule.Rules {
+			part, childArgs, err := compileSegmentNode(child, now, depth+1, conditions)
+			if err != nil {
+				return "", nil, err
+			}
+			parts = append(parts, part)
+			args = append(args, childArgs...)
+		}
+		return "(" + strings.Join(parts, joiner) + ")", args, nil
+	}
+
+	*conditions++
+	if *conditions > maxSegmentRuleConditions {
+		return "", nil, fmt.Errorf("%w: more than %d conditions", errInvalidSegmentRule, maxSegmentRuleConditions)
+	}
+	return compileSegmentCondition(rule, now)
+}
+
+func compileSegmentCondition(rule segmentRule, now time.Time) (string, []interface{}, error) {
+	field := strings.ToLower(strings.TrimSpace(rule.Field))
+	cmp := strings.ToLower(strings.TrimSpace(rule.Cmp))
+
+	switch field {
+	case "channel":
+		switch cmp {
+		case "eq", "neq":
+			var value string
+			if err := json.Unmarshal(rule.Value, &value); err != nil {
+				return "", nil, fmt.Errorf("%w: channel value must be a string", errInvalidSegmentRule)
+			}
+			return "m.channel " + segmentCompareSQL[cmp] + " ?", []interface{}{value}, nil
+		case "in":
+			var values []string
+			if err := json.Unmarshal(rule.Value, &values); err != nil || len(values) == 0 {
+				return "", nil, fmt.Errorf("%w: channel in needs a non-empty string list", errInvalidSegmentRule)
+			}
+			return "m.channel IN ?", []interface{}{values}, nil
+		}
+		return "", nil, fmt.Errorf("%w: channel supports eq, neq and in", errInvalidSegmentRule)
+
+	case "tier":
+		switch cmp {
+		case "eq", "neq":
+			var value string
+			if err := json.Unmarshal(rule.Value, &value); err != nil {
+				return "", nil, fmt.Errorf("%w: tier value must be a tier code", errInvalidSegmentRule)
+			}
+			return "m.tier_code " + segmentCompareSQL[cmp] + " ?", []interface{}{strings.ToLower(value)}, nil
+		case "in":
+			var values []string
+			if err := json.Unmarshal(rule.Value, &values); err != nil || len(values) == 0 {
+				return "", nil, fmt.Errorf("%w: tier in needs a non-empty code list", errInvalidSegmentRule)
+			}
+			for i := range values {
+				values[i] = strings.ToLower(values[i])
+			}
+			return "m.tier_code IN ?", []interface{}{values}, nil
+		}
+		return "", nil, fmt.Errorf("%w: tier supports eq, neq and in", errInvalidSegmentRule)
+
+	case "tag":
+		var tagID uint
+		if err := json.Unmarshal(rule.Value, &tagID); err != nil || tagID == 0 {
+			return "", nil, fmt.Errorf("%w: tag value must be a tag id", errInvalidSegmentRule)
+		}
+		exists := "EXISTS (SELECT 1 FROM member_tags AS mt WHERE mt.member_id = m.id AND mt.tag_id = ?)"
+		switch cmp {
+		case "has":
+			return exists, []interface{}{tagID}, nil
+		case "not_has":
+			return "NOT " + exists, []interface{}{tagID}, nil
+		}
+		return "", nil, fmt.Errorf("%w: tag supports has and not_has", errInvalidSegmentRule)
+
+	case "paid_order_count", "paid_amount_cents":
+		operator, supported := segmentCompareSQL[cmp]
+		if !supported {
+			return "", nil, fmt.Errorf("%w: %s supports eq, neq, gt, gte, lt and lte", errInvalidSegmentRule, field)
+		}
+		var value int64
+		if err := json.Unmarshal(rule.Value, &value); err != nil {
+			return "", nil, fmt.Errorf("%w: %s value must be an integer", errInvalidSegmentRule, field)
+		}
+		return segmentNumericSQL[field] + " " + operator + " ?", []interface{}{value}, nil
+
+	case "days_since_last_paid":
+		var days int
+		if err := json.Unmarshal(rule.Value, &days); err != nil || days < 0 {
+			return "", nil, fmt.Errorf("%w: days_since_last_paid value must be a non-negative integer", errInvalidSegmentRule)
+		}
+		// More days since the last payment means an earlier last_paid_at, so
+		// the comparison flips. Members who never paid match none of these.
+		cutoff := now.AddDate(0, 0, -days)
+		switch cmp {
+		case "gt":
+			return "s.last_paid_at < ?", []interface{}{cutoff}, nil
+		case "gte":
+			return "s.last_paid_at <= ?", []interface{}{cutoff}, nil
+		case "lt":
+			return "s.last_paid_at > ?", []interface{}{cutoff}, nil
+		case "lte":
+			return "s.last_paid_at >= ?", []interface{}{cutoff}, nil
+		}
+		return "", nil, fmt.Errorf("%w: days_since_last_paid supports gt, gte, lt and lte", errInvalidSegmentRule)
+	}
+
+	return "", nil, fmt.Errorf("%w: unknown field %q", errInvalidSegmentRule, rule.Field)
+}
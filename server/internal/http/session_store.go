@@ -0,0 +1,253 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"small-merchant-ops-hub-server/internal/cache"
+)
+
+const (
+	accessSessionKeyPrefix  = "auth:session:"
+	refreshSessionKeyPrefix = "auth:refresh:"
+	userSessionsKeyPrefix   = "auth:user_sessions:"
+	userSessionsLockPrefix  = "auth:user_sessions_lock:"
+)
+
+// The per-user index is updated read-modify-write, so every replica takes a
+// short lock in the shared cache first. The TTL frees the lock if a replica
+// dies holding it; indexLockWait bounds how long a request queues for it.
+const (
+	indexLockTTL   = 5 * time.Second
+	indexLockWait  = 3 * time.Second
+	indexLockRetry = 10 * time.Millisecond
+)
+
+var errIndexLockBusy = errors.New("user session index is locked")
+
+type authSessionEntry struct {
+	Session   authSession `json:"session"`
+	ExpiresAt time.Time   `json:"expiresAt"`
+}
+
+// userSessionRef points from the per-user index to one stored session key.
+type userSessionRef struct {
+	Key       string    `json:"key"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// sessionStore keeps access and refresh sessions in cache.Store so tokens
+// survive restarts and are shared by every replica. Each user also has an
+// index of their session keys, so revoking by user never scans the store.
+type sessionStore struct {
+	cache      cache.Store
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+func newSessionStore(cacheStore cache.Store) *sessionStore {
+	return &sessionStore{
+		cache:      cacheStore,
+		accessTTL:  authSessionTTL,
+		refreshTTL: refreshSessionTTL,
+	}
+}
+
+func (s *sessionStore) currentSession(c *gin.Context) (authSession, bool) {
+	token := parseAuthToken(c.GetHeader("Authorization"))
+	if token == "" {
+		return authSession{}, false
+	}
+	return s.load(c.Request.Context(), accessSessionKeyPrefix+token)
+}
+
+func (s *sessionStore) saveSession(ctx context.Context, token string, session authSession) error {
+	return s.store(ctx, accessSessionKeyPrefix+token, session, s.accessTTL)
+}
+
+func (s *sessionStore) removeSession(ctx context.Context, token string) error {
+	return s.cache.Delete(ctx, accessSessionKeyPrefix+token)
+}
+
+func (s *sessionStore) currentRefreshSession(ctx context.Context, refreshToken string) (authSession, bool) {
+	return s.load(ctx, refreshSessionKeyPrefix+refreshToken)
+}
+
+func (s *sessionStore) saveRefreshSession(ctx context.Context, refreshToken string, session authSession) error {
+	return s.store(ctx, refreshSessionKeyPrefix+refreshToken, session, s.refreshTTL)
+}
+
+func (s *sessionStore) removeRefreshSession(ctx context.Context, refreshToken string) error {
+	return s.cache.Delete(ctx, refreshSessionKeyPrefix+refreshToken)
+}
+
+// removeRefreshSessionsByUserID revokes every refresh token of a user and keeps
+// their access tokens in the index.
+func (s *sessionStore) removeRefreshSessionsByUserID(ctx context.Context, userID int) error {
+	return s.removeIndexed(ctx, userID, refreshSessionKeyPrefix)
+}
+
+// removeSessionsByUserID revokes every access and refresh token of a user so
+// account or permission changes take effect on the next request.
+func (s *sessionStore) removeSessionsByUserID(ctx context.Context, userID int) error {
+	return s.removeIndexed(ctx, userID, "")
+}
+
+func (s *sessionStore) load(ctx context.Context, key string) (authSession, bool) {
+	raw, found, err := s.cache.Get(ctx, key)
+	if err != nil || !found {
+		return authSession{}, false
+	}
+	var entry authSessionEntry
+	if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+		return authSession{}, false
+	}
+	if time.Now().After(entry.ExpiresAt) {
+		_ = s.cache.Delete(ctx, key)
+		return authSession{}, false
+	}
+	return entry.Session, true
+}
+
+func (s *sessionStore) store(ctx context.Context, key string, session authSession, ttl time.Duration) error {
+	// A non-positive TTL means the session is born expired; redis would keep it forever.
+	if ttl <= 0 {
+		return nil
+	}
+	expiresAt := time.Now().Add(ttl)
+	raw, err := json.Marshal(authSessionEntry{
+		Session:   session,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Index the key before writing the session, so a token that exists can
+	// always be revoked by user. A failed write leaves only a dangling ref.
+	unlock, err := s.lockIndex(ctx, session.UserID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	refs, err := s.loadIndex(ctx, session.UserID)
+	if err != nil {
+		return err
+	}
+	refs = append(refs, userSessionRef{Key: key, ExpiresAt: expiresAt})
+	if err := s.saveIndex(ctx, session.UserID, refs); err != nil {
+		return err
+	}
+	return s.cache.Set(ctx, key, string(raw), ttl)
+}
+
+// removeIndexed deletes the user's indexed sessions whose key starts with
+// prefix; an empty prefix removes all of them.
+func (s *sessionStore) removeIndexed(ctx context.Context, userID int, prefix string) error {
+	unlock, err := s.lockIndex(ctx, userID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	refs, err := s.loadIndex(ctx, userID)
+	if err != nil {
+		return err
+	}
+	kept := make([]userSessionRef, 0, len(refs))
+	for _, ref := range refs {
+		if !strings.HasPrefix(ref.Key, prefix) {
+			kept = append(kept, ref)
+			continue
+		}
+		if err := s.cache.Delete(ctx, ref.Key); err != nil {
+			return err
+		}
+	}
+	return s.saveIndex(ctx, userID, kept)
+}
+
+// lockIndex takes the user's index lock in the shared cache, waiting up to
+// indexLockWait. The returned func releases it unless it already expired and
+// someone else holds it now.
+func (s *sessionStore) lockIndex(ctx context.Context, userID int) (func(), error) {
+	key := userSessionsLockPrefix + strconv.Itoa(userID)
+	owner := newToken("lock")
+	deadline := time.Now().Add(indexLockWait)
+	for {
+		acquired, err := s.cache.SetIfAbsent(ctx, key, owner, indexLockTTL)
+		if err != nil {
+			return nil, err
+		}
+		if acquired {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, errIndexLockBusy
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(indexLockRetry):
+		}
+	}
+
+	return func() {
+		// Release even when the request context was cancelled mid-update.
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		_, _ = s.cache.CompareAndDelete(releaseCtx, key, owner)
+	}, nil
+}
+
+// loadIndex returns the user's session refs with expired ones pruned.
+func (s *sessionStore) loadIndex(ctx context.Context, userID int) ([]userSessionRef, error) {
+	raw, found, err := s.cache.Get(ctx, userSessionsKey(userID))
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return []userSessionRef{}, nil
+	}
+	var refs []userSessionRef
+	if err := json.Unmarshal([]byte(raw), &refs); err != nil {
+		return []userSessionRef{}, nil
+	}
+
+	now := time.Now()
+	live := make([]userSessionRef, 0, len(refs))
+	for _, ref := range refs {
+		if ref.ExpiresAt.After(now) {
+			live = append(live, ref)
+		}
+	}
+	return live, nil
+}
+
+func (s *sessionStore) saveIndex(ctx context.Context, userID int, refs []userSessionRef) error {
+	key := userSessionsKey(userID)
+	if len(refs) == 0 {
+		return s.cache.Delete(ctx, key)
+	}
+
+	var latest time.Time
+	for _, ref := range refs {
+		if ref.ExpiresAt.After(latest) {
+			latest = ref.ExpiresAt
+		}
+	}
+	raw, err := json.Marshal(refs)
+	if err != nil {
+		return err
+	}
+	return s.cache.Set(ctx, key, string(raw), time.Until(latest))
+}
+
+func userSessionsKey(userID int) string {
+	return userSessionsKeyPrefix + strconv.Itoa(userID)
+}
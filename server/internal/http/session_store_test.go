@@ -0,0 +1,182 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"small-merchant-ops-hub-server/internal/cache"
+	"small-merchant-ops-hub-server/internal/config"
+	"small-merchant-ops-hub-server/internal/db"
+)
+
+func TestSessionStoreSharedThroughCache(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Config{
+		Env:             "local",
+		Port:            "8080",
+		SQLitePath:      filepath.Join(t.TempDir(), "app.db"),
+		CacheMode:       "local",
+		CORSAllowOrigin: "*",
+	}
+
+	database, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+
+	cacheStore, err := cache.New(cfg, PinnedCacheKeyPrefixes()...)
+	if err != nil {
+		t.Fatalf("open cache: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = cacheStore.Close()
+	})
+
+	// Two routers over one cache behave like two replicas, or one process before and after a restart.
+	first := NewRouter(database, cacheStore, cfg)
+	second := NewRouter(database, cacheStore, cfg)
+
+	login := performJSONRequest[authLoginData](t, first, "", http.MethodPost, "/api/auth/login", map[string]string{
+		"userName": "Admin",
+		"password": "123456",
+	})
+	if login.Code != 200 {
+		t.Fatalf("login code = %d, msg = %s", login.Code, login.Msg)
+	}
+
+	info := performJSONRequest[authSession](t, second, login.Data.Token, http.MethodGet, "/api/user/info", nil)
+	if info.Code != 200 || info.Data.UserName != "Admin" {
+		t.Fatalf("info on second router code = %d, data = %+v", info.Code, info.Data)
+	}
+
+	refreshed := performJSONRequest[authLoginData](t, second, "", http.MethodPost, "/api/auth/refresh", map[string]string{
+		"refreshToken": login.Data.RefreshToken,
+	})
+	if refreshed.Code != 200 {
+		t.Fatalf("refresh on second router code = %d, msg = %s", refreshed.Code, refreshed.Msg)
+	}
+
+	sessions := newSessionStore(cacheStore)
+	ctx := context.Background()
+	if err := sessions.removeRefreshSessionsByUserID(ctx, info.Data.UserID); err != nil {
+		t.Fatalf("remove refresh sessions: %v", err)
+	}
+	if _, found := sessions.currentRefreshSession(ctx, refreshed.Data.RefreshToken); found {
+		t.Fatalf("refresh token should be revoked through the user index")
+	}
+	stillValid := performJSONRequest[authSession](t, first, refreshed.Data.Token, http.MethodGet, "/api/user/info", nil)
+	if stillValid.Code != 200 {
+		t.Fatalf("access token after refresh revocation code = %d, want 200", stillValid.Code)
+	}
+
+	if err := sessions.removeSessionsByUserID(ctx, info.Data.UserID); err != nil {
+		t.Fatalf("remove sessions: %v", err)
+	}
+	for _, token := range []string{login.Data.Token, refreshed.Data.Token} {
+		revoked := performJSONRequest[map[string]interface{}](t, first, token, http.MethodGet, "/api/user/info", nil)
+		if revoked.Code != 401 {
+			t.Fatalf("access token after user revocation code = %d, want 401", revoked.Code)
+		}
+	}
+	if _, found, _ := cacheStore.Get(ctx, userSessionsKey(info.Data.UserID)); found {
+		t.Fatalf("user session index should be removed once empty")
+	}
+}
+
+func TestSessionIndexKeepsConcurrentLoginsAcrossReplicas(t *testing.T) {
+	t.Parallel()
+
+	cacheStore, err := cache.New(config.Config{CacheMode: "local"})
+	if err != nil {
+		t.Fatalf("open cache: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = cacheStore.Close()
+	})
+
+	// Each store stands in for one replica; only the cache is shared. Slow
+	// reads widen the gap between reading and writing back the index.
+	shared := slowGetStore{Store: cacheStore, delay: time.Millisecond}
+	replicas := []*sessionStore{newSessionStore(shared), newSessionStore(shared)}
+	ctx := context.Background()
+	const loginsPerReplica = 20
+	tokens := make([]string, 0, len(replicas)*loginsPerReplica)
+	for i := 0; i < cap(tokens); i++ {
+		tokens = append(tokens, newToken("access"))
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(tokens))
+	for i, token := range tokens {
+		wg.Add(1)
+		go func(store *sessionStore, token string) {
+			defer wg.Done()
+			errs <- store.saveSession(ctx, token, authSession{UserID: 7, UserName: "Admin"})
+		}(replicas[i%len(replicas)], token)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("save session: %v", err)
+		}
+	}
+
+	if err := replicas[1].removeSessionsByUserID(ctx, 7); err != nil {
+		t.Fatalf("remove sessions: %v", err)
+	}
+	for _, token := range tokens {
+		if _, found, _ := cacheStore.Get(ctx, accessSessionKeyPrefix+token); found {
+			t.Fatalf("session %s survived user revocation; the index lost it", token)
+		}
+	}
+}
+
+// slowGetStore delays every Get result, like the reply leg of a round trip
+// to redis, so the value read can go stale before the caller acts on it.
+type slowGetStore struct {
+	cache.Store
+	delay time.Duration
+}
+
+func (s slowGetStore) Get(ctx context.Context, key string) (string, bool, error) {
+	value, found, err := s.Store.Get(ctx, key)
+	time.Sleep(s.delay)
+	return value, found, err
+}
+
+func TestSessionNotStoredWhenIndexUnavailable(t *testing.T) {
+	t.Parallel()
+
+	cacheStore, err := cache.New(config.Config{CacheMode: "local"})
+	if err != nil {
+		t.Fatalf("open cache: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = cacheStore.Close()
+	})
+
+	sessions := newSessionStore(lockFailingStore{Store: cacheStore})
+	ctx := context.Background()
+	if err := sessions.saveSession(ctx, "orphan", authSession{UserID: 7}); err == nil {
+		t.Fatalf("saveSession without the index lock should fail")
+	}
+	if _, found, _ := cacheStore.Get(ctx, accessSessionKeyPrefix+"orphan"); found {
+		t.Fatalf("a session that is not indexed could never be revoked by user")
+	}
+}
+
+// lockFailingStore cannot take locks, like redis refusing SET NX.
+type lockFailingStore struct {
+	cache.Store
+}
+
+func (lockFailingStore) SetIfAbsent(context.Context, string, string, time.Duration) (bool, error) {
+	return false, errors.New("lock unavailable")
+}
@@ -0,0 +1,913 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"small-merchant-ops-hub-server/internal/db"
+)
+
+const minPasswordLength = 6
+
+type saveUserRequest struct {
+	UserName   string   `json:"userName"`
+	Password   string   `json:"password"`
+	NickName   string   `json:"nickName"`
+	UserEmail  string   `json:"userEmail"`
+	UserPhone  string   `json:"userPhone"`
+	UserGender string   `json:"userGender"`
+	Status     string   `json:"status"`
+	UserRoles  []string `json:"userRoles"`
+}
+
+type userStatusRequest struct {
+	Status string `json:"status"`
+}
+
+type resetPasswordRequest struct {
+	Password string `json:"password"`
+}
+
+type saveRoleRequest struct {
+	RoleName    string `json:"roleName"`
+	RoleCode    string `json:"roleCode"`
+	Description string `json:"description"`
+	Enabled     *bool  `json:"enabled"`
+}
+
+type roleStatusRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+type roleButtonsRequest struct {
+	Buttons []string `json:"buttons"`
+}
+
+var (
+	errUnknownRole   = errors.New("unknown role")
+	errLastSuperUser = errors.New("at least one enabled R_SUPER user must remain")
+)
+
+func registerSystemRoutes(router *gin.Engine, database *gorm.DB, sessions *sessionStore) {
+	system := router.Group("/api", requireRouteAccess(sessions, systemRouteAccess))
+	{
+		system.GET("/permission/list", permissionListHandler(database))
+
+		system.POST("/user", createUserHandler(database))
+		system.PUT("/user/:id", updateUserHandler(database, sessions))
+		system.PUT("/user/:id/status", updateUserStatusHandler(database, sessions))
+		system.PUT("/user/:id/password", resetUserPasswordHandler(database, sessions))
+		system.DELETE("/user/:id", deleteUserHandler(database, sessions))
+
+		system.POST("/role", createRoleHandler(database))
+		system.PUT("/role/:id", updateRoleHandler(database, sessions))
+		system.PUT("/role/:id/status", updateRoleStatusHandler(database, sessions))
+		system.DELETE("/role/:id", deleteRoleHandler(database, sessions))
+		system.GET("/role/:id/buttons", roleButtonsHandler(database))
+		system.PUT("/role/:id/buttons", updateRoleButtonsHandler(database, sessions))
+	}
+}
+
+func permissionListHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		permissions := make([]db.Permission, 0)
+		if err := database.WithContext(ctx).Order("id ASC").Find(&permissions).Error; err != nil {
+			fail(c, 500, "list permissions failed")
+			return
+		}
+		ok(c, toAuthMarkItems(permissions))
+	}
+}
+
+func createUserHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req saveUserRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid user payload")
+			return
+		}
+
+		normalizeSaveUserRequest(&req)
+		if req.Status == "" {
+			req.Status = db.UserStatusEnabled
+		}
+		if msg := validateSaveUserRequest(req); msg != "" {
+			fail(c, 400, msg)
+			return
+		}
+		if len(req.Password) < minPasswordLength {
+			fail(c, 400, fmt.Sprintf("password must be at least %d characters", minPasswordLength))
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		roles, err := findRolesByCodes(ctx, database, req.UserRoles)
+		if err != nil {
+			if errors.Is(err, errUnknownRole) {
+				fail(c, 400, err.Error())
+				return
+			}
+			fail(c, 500, "query roles failed")
+			return
+		}
+		taken, err := userNameTaken(ctx, database, req.UserName, 0)
+		if err != nil {
+			fail(c, 500, "query user failed")
+			return
+		}
+		if taken {
+			fail(c, 400, "userName already exists")
+			return
+		}
+
+		hash, err := db.HashPassword(req.Password)
+		if err != nil {
+			fail(c, 500, "hash password failed")
+			return
+		}
+
+		operator := sessionFromContext(c).UserName
+		user := db.User{
+			UserName:     req.UserName,
+			NickName:     req.NickName,
+			Email:        req.UserEmail,
+			Phone:        req.UserPhone,
+			Gender:       req.UserGender,
+			PasswordHash: hash,
+			Status:       req.Status,
+			CreatedBy:    operator,
+			UpdatedBy:    operator,
+			Roles:        roles,
+		}
+		if err := database.WithContext(ctx).Omit("Roles.*").Create(&user).Error; err != nil {
+			fail(c, 500, "create user failed")
+			return
+		}
+
+		ok(c, toUserListItem(user))
+	}
+}
+
+func updateUserHandler(database *gorm.DB, sessions *sessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid user id")
+			return
+		}
+
+		var req saveUserRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid user payload")
+			return
+		}
+		normalizeSaveUserRequest(&req)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var user db.User
+		if err := database.WithContext(ctx).Preload("Roles").First(&user, userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "user not found")
+				return
+			}
+			fail(c, 500, "query user failed")
+			return
+		}
+
+		if req.Status == "" {
+			req.Status = user.Status
+		}
+		if req.UserRoles == nil {
+			req.UserRoles = roleCodes(user.Roles)
+		}
+		if msg := validateSaveUserRequest(req); msg != "" {
+			fail(c, 400, msg)
+			return
+		}
+
+		session := sessionFromContext(c)
+		if int(user.ID) == session.UserID && req.Status != db.UserStatusEnabled {
+			fail(c, 400, "cannot disable your own account")
+			return
+		}
+
+		roles, err := findRolesByCodes(ctx, database, req.UserRoles)
+		if err != nil {
+			if errors.Is(err, errUnknownRole) {
+				fail(c, 400, err.Error())
+				return
+			}
+			fail(c, 500, "query roles failed")
+			return
+		}
+		taken, err := userNameTaken(ctx, database, req.UserName, user.ID)
+		if err != nil {
+			fail(c, 500, "query user failed")
+			return
+		}
+		if taken {
+			fail(c, 400, "userName already exists")
+			return
+		}
+
+		revoke := req.Status != user.Status || !sameStrings(roleCodes(user.Roles), roleCodes(roles))
+		err = database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&user).Updates(map[string]interface{}{
+				"user_name":  req.UserName,
+				"nick_name":  req.NickName,
+				"email":      req.UserEmail,
+				"phone":      req.UserPhone,
+				"gender":     req.UserGender,
+				"status":     req.Status,
+				"updated_by": session.UserName,
+			}).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&user).Association("Roles").Replace(roles); err != nil {
+				return err
+			}
+			if !revoke {
+				return nil
+			}
+			return ensureSuperUserRemains(tx)
+		})
+		if err != nil {
+			if errors.Is(err, errLastSuperUser) {
+				fail(c, 409, err.Error())
+				return
+			}
+			fail(c, 500, "update user failed")
+			return
+		}
+		if revoke {
+			if err := sessions.removeSessionsByUserID(ctx, int(user.ID)); err != nil {
+				fail(c, 500, "revoke user sessions failed")
+				return
+			}
+		}
+
+		user.Roles = roles
+		ok(c, toUserListItem(user))
+	}
+}
+
+func updateUserStatusHandler(database *gorm.DB, sessions *sessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid user id")
+			return
+		}
+
+		var req userStatusRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid status payload")
+			return
+		}
+		req.Status = strings.TrimSpace(req.Status)
+		if !isSupportedUserStatus(req.Status) {
+			fail(c, 400, "status must be 1 (enabled) or 2 (disabled)")
+			return
+		}
+
+		session := sessionFromContext(c)
+		if int(userID) == session.UserID && req.Status != db.UserStatusEnabled {
+			fail(c, 400, "cannot disable your own account")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var updated int64
+		err := database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&db.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+				"status":     req.Status,
+				"updated_by": session.UserName,
+			})
+			if result.Error != nil {
+				return result.Error
+			}
+			updated = result.RowsAffected
+			if updated == 0 || req.Status == db.UserStatusEnabled {
+				return nil
+			}
+			return ensureSuperUserRemains(tx)
+		})
+		if err != nil {
+			if errors.Is(err, errLastSuperUser) {
+				fail(c, 409, err.Error())
+				return
+			}
+			fail(c, 500, "update user status failed")
+			return
+		}
+		if updated == 0 {
+			fail(c, 404, "user not found")
+			return
+		}
+		if req.Status != db.UserStatusEnabled {
+			if err := sessions.removeSessionsByUserID(ctx, int(userID)); err != nil {
+				fail(c, 500, "revoke user sessions failed")
+				return
+			}
+		}
+
+		ok(c, gin.H{
+			"success": true,
+		})
+	}
+}
+
+func resetUserPasswordHandler(database *gorm.DB, sessions *sessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid user id")
+			return
+		}
+
+		var req resetPasswordRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid password payload")
+			return
+		}
+		req.Password = strings.TrimSpace(req.Password)
+		if len(req.Password) < minPasswordLength {
+			fail(c, 400, fmt.Sprintf("password must be at least %d characters", minPasswordLength))
+			return
+		}
+
+		hash, err := db.HashPassword(req.Password)
+		if err != nil {
+			fail(c, 500, "hash password failed")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		result := database.WithContext(ctx).Model(&db.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"password_hash": hash,
+			"updated_by":    sessionFromContext(c).UserName,
+		})
+		if result.Error != nil {
+			fail(c, 500, "reset password failed")
+			return
+		}
+		if result.RowsAffected == 0 {
+			fail(c, 404, "user not found")
+			return
+		}
+		if err := sessions.removeSessionsByUserID(ctx, int(userID)); err != nil {
+			fail(c, 500, "revoke user sessions failed")
+			return
+		}
+
+		ok(c, gin.H{
+			"success": true,
+		})
+	}
+}
+
+func deleteUserHandler(database *gorm.DB, sessions *sessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid user id")
+			return
+		}
+		if int(userID) == sessionFromContext(c).UserID {
+			fail(c, 400, "cannot delete your own account")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var deleted int64
+		err := database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("user_id = ?", userID).Delete(&db.UserRole{}).Error; err != nil {
+				return err
+			}
+			result := tx.Delete(&db.User{}, userID)
+			if result.Error != nil {
+				return result.Error
+			}
+			deleted = result.RowsAffected
+			if deleted == 0 {
+				return nil
+			}
+			return ensureSuperUserRemains(tx)
+		})
+		if err != nil {
+			if errors.Is(err, errLastSuperUser) {
+				fail(c, 409, err.Error())
+				return
+			}
+			fail(c, 500, "delete user failed")
+			return
+		}
+		if deleted == 0 {
+			fail(c, 404, "user not found")
+			return
+		}
+		if err := sessions.removeSessionsByUserID(ctx, int(userID)); err != nil {
+			fail(c, 500, "revoke user sessions failed")
+			return
+		}
+
+		ok(c, gin.H{
+			"success": true,
+		})
+	}
+}
+
+func createRoleHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req saveRoleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid role payload")
+			return
+		}
+
+		normalizeSaveRoleRequest(&req)
+		if req.RoleName == "" || req.RoleCode == "" {
+			fail(c, 400, "roleName and roleCode are required")
+			return
+		}
+		enabled := true
+		if req.Enabled != nil {
+			enabled = *req.Enabled
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		role := db.Role{
+			Code:        req.RoleCode,
+			Name:        req.RoleName,
+			Description: req.Description,
+			Enabled:     enabled,
+		}
+		if err := database.WithContext(ctx).Create(&role).Error; err != nil {
+			if strings.Contains(strings.ToLower(err.Error()), "unique") {
+				fail(c, 400, "roleCode already exists")
+				return
+			}
+			fail(c, 500, "create role failed")
+			return
+		}
+
+		ok(c, toRoleListItem(role))
+	}
+}
+
+func updateRoleHandler(database *gorm.DB, sessions *sessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roleID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid role id")
+			return
+		}
+
+		var req saveRoleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid role payload")
+			return
+		}
+		normalizeSaveRoleRequest(&req)
+		if req.RoleName == "" {
+			fail(c, 400, "roleName is required")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		role, found, err := findRole(ctx, database, roleID)
+		if err != nil {
+			fail(c, 500, "query role failed")
+			return
+		}
+		if !found {
+			fail(c, 404, "role not found")
+			return
+		}
+
+		if req.RoleCode == "" {
+			req.RoleCode = role.Code
+		}
+		if req.RoleCode != role.Code && isBuiltinRole(role.Code) {
+			fail(c, 400, "built-in roleCode cannot be changed")
+			return
+		}
+		enabled := role.Enabled
+		if req.Enabled != nil {
+			enabled = *req.Enabled
+		}
+		if !enabled && role.Code == "R_SUPER" {
+			fail(c, 400, "R_SUPER cannot be disabled")
+			return
+		}
+
+		revoke := enabled != role.Enabled || req.RoleCode != role.Code
+		if err := database.WithContext(ctx).Model(&role).Updates(map[string]interface{}{
+			"code":        req.RoleCode,
+			"name":        req.RoleName,
+			"description": req.Description,
+			"enabled":     enabled,
+		}).Error; err != nil {
+			if strings.Contains(strings.ToLower(err.Error()), "unique") {
+				fail(c, 400, "roleCode already exists")
+				return
+			}
+			fail(c, 500, "update role failed")
+			return
+		}
+		role.Code = req.RoleCode
+		role.Name = req.RoleName
+		role.Description = req.Description
+		role.Enabled = enabled
+		if revoke {
+			if err := removeSessionsByRoleID(ctx, database, sessions, role.ID); err != nil {
+				fail(c, 500, "revoke role sessions failed")
+				return
+			}
+		}
+
+		ok(c, toRoleListItem(role))
+	}
+}
+
+func updateRoleStatusHandler(database *gorm.DB, sessions *sessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roleID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid role id")
+			return
+		}
+
+		var req roleStatusRequest
+		if err := c.ShouldBindJSON(&req); err != nil || req.Enabled == nil {
+			fail(c, 400, "enabled is required")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		role, found, err := findRole(ctx, database, roleID)
+		if err != nil {
+			fail(c, 500, "query role failed")
+			return
+		}
+		if !found {
+			fail(c, 404, "role not found")
+			return
+		}
+		if !*req.Enabled && role.Code == "R_SUPER" {
+			fail(c, 400, "R_SUPER cannot be disabled")
+			return
+		}
+
+		if err := database.WithContext(ctx).Model(&role).Update("enabled", *req.Enabled).Error; err != nil {
+			fail(c, 500, "update role status failed")
+			return
+		}
+		if err := removeSessionsByRoleID(ctx, database, sessions, role.ID); err != nil {
+			fail(c, 500, "revoke role sessions failed")
+			return
+		}
+
+		ok(c, gin.H{
+			"success": true,
+		})
+	}
+}
+
+func deleteRoleHandler(database *gorm.DB, sessions *sessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roleID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid role id")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		role, found, err := findRole(ctx, database, roleID)
+		if err != nil {
+			fail(c, 500, "query role failed")
+			return
+		}
+		if !found {
+			fail(c, 404, "role not found")
+			return
+		}
+		if isBuiltinRole(role.Code) {
+			fail(c, 400, "built-in role cannot be deleted")
+			return
+		}
+
+		// Collect members before the join rows disappear.
+		userIDs, err := roleUserIDs(ctx, database, role.ID)
+		if err != nil {
+			fail(c, 500, "query role users failed")
+			return
+		}
+		err = database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("role_id = ?", role.ID).Delete(&db.UserRole{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("role_id = ?", role.ID).Delete(&db.RolePermission{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&role).Error
+		})
+		if err != nil {
+			fail(c, 500, "delete role failed")
+			return
+		}
+		for _, userID := range userIDs {
+			if err := sessions.removeSessionsByUserID(ctx, int(userID)); err != nil {
+				fail(c, 500, "revoke role sessions failed")
+				return
+			}
+		}
+
+		ok(c, gin.H{
+			"success": true,
+		})
+	}
+}
+
+func roleButtonsHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roleID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid role id")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var role db.Role
+		if err := database.WithContext(ctx).Preload("Permissions").First(&role, roleID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "role not found")
+				return
+			}
+			fail(c, 500, "query role failed")
+			return
+		}
+		ok(c, toAuthMarkItems(role.Permissions))
+	}
+}
+
+func updateRoleButtonsHandler(database *gorm.DB, sessions *sessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roleID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid role id")
+			return
+		}
+
+		var req roleButtonsRequest
+		if err := c.ShouldBindJSON(&req); err != nil || req.Buttons == nil {
+			fail(c, 400, "buttons is required")
+			return
+		}
+		marks := uniqueTrimmed(req.Buttons)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		role, found, err := findRole(ctx, database, roleID)
+		if err != nil {
+			fail(c, 500, "query role failed")
+			return
+		}
+		if !found {
+			fail(c, 404, "role not found")
+			return
+		}
+
+		permissions := make([]db.Permission, 0, len(marks))
+		if len(marks) > 0 {
+			if err := database.WithContext(ctx).Where("mark IN ?", marks).Order("id ASC").Find(&permissions).Error; err != nil {
+				fail(c, 500, "query permissions failed")
+				return
+			}
+		}
+		if len(permissions) != len(marks) {
+			fail(c, 400, "buttons contain unknown auth marks")
+			return
+		}
+
+		if err := database.WithContext(ctx).Model(&role).Association("Permissions").Replace(permissions); err != nil {
+			fail(c, 500, "update role buttons failed")
+			return
+		}
+		if err := removeSessionsByRoleID(ctx, database, sessions, role.ID); err != nil {
+			fail(c, 500, "revoke role sessions failed")
+			return
+		}
+
+		ok(c, toAuthMarkItems(permissions))
+	}
+}
+
+func findRole(ctx context.Context, database *gorm.DB, roleID uint) (db.Role, bool, error) {
+	var role db.Role
+	if err := database.WithContext(ctx).First(&role, roleID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return db.Role{}, false, nil
+		}
+		return db.Role{}, false, err
+	}
+	return role, true, nil
+}
+
+func findRolesByCodes(ctx context.Context, database *gorm.DB, codes []string) ([]db.Role, error) {
+	codes = uniqueTrimmed(codes)
+	roles := make([]db.Role, 0, len(codes))
+	if len(codes) == 0 {
+		return roles, nil
+	}
+	if err := database.WithContext(ctx).Where("code IN ?", codes).Order("id ASC").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		found := false
+		for _, role := range roles {
+			if role.Code == code {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %s", errUnknownRole, code)
+		}
+	}
+	return roles, nil
+}
+
+func userNameTaken(ctx context.Context, database *gorm.DB, userName string, exceptID uint) (bool, error) {
+	var count int64
+	err := database.WithContext(ctx).
+		Model(&db.User{}).
+		Where("LOWER(user_name) = ? AND id <> ?", strings.ToLower(userName), exceptID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func roleUserIDs(ctx context.Context, database *gorm.DB, roleID uint) ([]uint, error) {
+	userIDs := make([]uint, 0)
+	err := database.WithContext(ctx).Model(&db.UserRole{}).Where("role_id = ?", roleID).Pluck("user_id", &userIDs).Error
+	return userIDs, err
+}
+
+// ensureSuperUserRemains returns errLastSuperUser when no enabled user holds
+// R_SUPER. Handlers call it after their change, inside the same transaction,
+// so a change that would lock everyone out of system management rolls back.
+func ensureSuperUserRemains(tx *gorm.DB) error {
+	var count int64
+	if err := tx.Model(&db.User{}).
+		Joins("JOIN user_roles AS ur ON ur.user_id = users.id").
+		Joins("JOIN roles AS r ON r.id = ur.role_id").
+		Where("r.code = ? AND users.status = ?", "R_SUPER", db.UserStatusEnabled).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errLastSuperUser
+	}
+	return nil
+}
+
+// removeSessionsByRoleID revokes the sessions of every user holding the role.
+func removeSessionsByRoleID(ctx context.Context, database *gorm.DB, sessions *sessionStore, roleID uint) error {
+	userIDs, err := roleUserIDs(ctx, database, roleID)
+	if err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		if err := sessions.removeSessionsByUserID(ctx, int(userID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func normalizeSaveUserRequest(req *saveUserRequest) {
+	req.UserName = strings.TrimSpace(req.UserName)
+	req.Password = strings.TrimSpace(req.Password)
+	req.NickName = strings.TrimSpace(req.NickName)
+	req.UserEmail = strings.TrimSpace(req.UserEmail)
+	req.UserPhone = strings.TrimSpace(req.UserPhone)
+	req.UserGender = strings.TrimSpace(req.UserGender)
+	req.Status = strings.TrimSpace(req.Status)
+	if req.NickName == "" {
+		req.NickName = req.UserName
+	}
+}
+
+func validateSaveUserRequest(req saveUserRequest) string {
+	if req.UserName == "" {
+		return "userName is required"
+	}
+	if len(req.UserName) > 50 {
+		return "userName must be at most 50 characters"
+	}
+	if !isSupportedUserStatus(req.Status) {
+		return "status must be 1 (enabled) or 2 (disabled)"
+	}
+	if req.UserGender != "" && req.UserGender != "1" && req.UserGender != "2" {
+		return "userGender must be 1 or 2"
+	}
+	return ""
+}
+
+func normalizeSaveRoleRequest(req *saveRoleRequest) {
+	req.RoleName = strings.TrimSpace(req.RoleName)
+	req.RoleCode = strings.ToUpper(strings.TrimSpace(req.RoleCode))
+	req.Description = strings.TrimSpace(req.Description)
+}
+
+func isSupportedUserStatus(status string) bool {
+	return status == db.UserStatusEnabled || status == db.UserStatusDisabled
+}
+
+func isBuiltinRole(code string) bool {
+	switch code {
+	case "R_SUPER", "R_ADMIN", "R_USER":
+		return true
+	default:
+		return false
+	}
+}
+
+func roleCodes(roles []db.Role) []string {
+	codes := make([]string, 0, len(roles))
+	for _, role := range roles {
+		codes = append(codes, role.Code)
+	}
+	return codes
+}
+
+func toAuthMarkItems(permissions []db.Permission) []authMarkItem {
+	items := make([]authMarkItem, 0, len(permissions))
+	for _, permission := range permissions {
+		items = append(items, authMarkItem{
+			Title:    permission.Title,
+			AuthMark: permission.Mark,
+		})
+	}
+	return items
+}
+
+func uniqueTrimmed(values []string) []string {
+	result := make([]string, 0, len(values))
+	seen := map[string]bool{}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		result = append(result, value)
+	}
+	return result
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := map[string]int{}
+	for _, value := range a {
+		counts[value]++
+	}
+	for _, value := range b {
+		counts[value]--
+		if counts[value] < 0 {
+			return false
+		}
+	}
+	return true
+}
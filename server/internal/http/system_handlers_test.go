@@ -0,0 +1,221 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestSystemManagementRoutes(t *testing.T) {
+	t.Parallel()
+
+	router := newTestRouter(t)
+	superToken := loginForTest(t, router, "Super")
+	adminToken := loginForTest(t, router, "Admin")
+
+	newUser := map[string]interface{}{
+		"userName":  "ops1",
+		"password":  "ops-pass",
+		"userRoles": []string{"R_USER"},
+	}
+
+	adminCreate := performJSONRequest[map[string]interface{}](t, router, adminToken, http.MethodPost, "/api/user", newUser)
+	if adminCreate.Code != 403 {
+		t.Fatalf("admin create user code = %d, want 403", adminCreate.Code)
+	}
+
+	permissions := performJSONRequest[[]authMarkItem](t, router, superToken, http.MethodGet, "/api/permission/list", nil)
+	if permissions.Code != 200 || len(permissions.Data) == 0 {
+		t.Fatalf("permission list code = %d, len = %d", permissions.Code, len(permissions.Data))
+	}
+
+	created := performJSONRequest[userListItem](t, router, superToken, http.MethodPost, "/api/user", newUser)
+	if created.Code != 200 {
+		t.Fatalf("create user code = %d, msg = %s", created.Code, created.Msg)
+	}
+	if created.Data.Status != "1" || created.Data.CreateBy != "Super" {
+		t.Fatalf("created user = %+v, want enabled and created by Super", created.Data)
+	}
+	duplicate := performJSONRequest[map[string]interface{}](t, router, superToken, http.MethodPost, "/api/user", newUser)
+	if duplicate.Code != 400 {
+		t.Fatalf("duplicate user code = %d, want 400", duplicate.Code)
+	}
+	userPath := fmt.Sprintf("/api/user/%d", created.Data.ID)
+
+	opsToken := loginWithPasswordForTest(t, router, "ops1", "ops-pass")
+	opsMember := performJSONRequest[map[string]interface{}](t, router, opsToken, http.MethodPost, "/api/v1/members", map[string]interface{}{
+		"name":    "Dave",
+		"phone":   "13800004444",
+		"channel": "wechat",
+	})
+	if opsMember.Code != 403 {
+		t.Fatalf("ops create member code = %d, want 403", opsMember.Code)
+	}
+
+	roles := performJSONRequest[authPaginated[roleListItem]](t, router, superToken, http.MethodGet, "/api/role/list?roleCode=R_USER", nil)
+	if roles.Code != 200 || len(roles.Data.Records) != 1 {
+		t.Fatalf("role list code = %d, records = %d", roles.Code, len(roles.Data.Records))
+	}
+	userRoleButtonsPath := fmt.Sprintf("/api/role/%d/buttons", roles.Data.Records[0].RoleID)
+
+	unknownButtons := performJSONRequest[map[string]interface{}](t, router, superToken, http.MethodPut, userRoleButtonsPath, map[string]interface{}{
+		"buttons": []string{"followup:view", "does:not-exist"},
+	})
+	if unknownButtons.Code != 400 {
+		t.Fatalf("unknown buttons code = %d, want 400", unknownButtons.Code)
+	}
+	buttons := performJSONRequest[[]authMarkItem](t, router, superToken, http.MethodPut, userRoleButtonsPath, map[string]interface{}{
+		"buttons": []string{"followup:view", "member:create"},
+	})
+	if buttons.Code != 200 || len(buttons.Data) != 2 {
+		t.Fatalf("update role buttons code = %d, data = %+v", buttons.Code, buttons.Data)
+	}
+
+	revoked := performJSONRequest[map[string]interface{}](t, router, opsToken, http.MethodGet, "/api/v1/summary", nil)
+	if revoked.Code != 401 {
+		t.Fatalf("token after role button change code = %d, want 401", revoked.Code)
+	}
+	opsToken = loginWithPasswordForTest(t, router, "ops1", "ops-pass")
+	opsInfo := performJSONRequest[authSession](t, router, opsToken, http.MethodGet, "/api/user/info", nil)
+	if !containsString(opsInfo.Data.Buttons, "member:create") {
+		t.Fatalf("ops buttons missing member:create: %+v", opsInfo.Data.Buttons)
+	}
+
+	updated := performJSONRequest[userListItem](t, router, superToken, http.MethodPut, userPath, map[string]interface{}{
+		"userName":  "ops1",
+		"nickName":  "Ops One",
+		"userRoles": []string{"R_ADMIN"},
+	})
+	if updated.Code != 200 || updated.Data.NickName != "Ops One" || !containsString(updated.Data.UserRoles, "R_ADMIN") {
+		t.Fatalf("update user code = %d, data = %+v", updated.Code, updated.Data)
+	}
+	revoked = performJSONRequest[map[string]interface{}](t, router, opsToken, http.MethodGet, "/api/user/info", nil)
+	if revoked.Code != 401 {
+		t.Fatalf("token after role change code = %d, want 401", revoked.Code)
+	}
+
+	reset := performJSONRequest[map[string]bool](t, router, superToken, http.MethodPut, userPath+"/password", map[string]string{
+		"password": "new-pass",
+	})
+	if reset.Code != 200 {
+		t.Fatalf("reset password code = %d, msg = %s", reset.Code, reset.Msg)
+	}
+	oldPassword := performJSONRequest[map[string]interface{}](t, router, "", http.MethodPost, "/api/auth/login", map[string]string{
+		"userName": "ops1",
+		"password": "ops-pass",
+	})
+	if oldPassword.Code != 401 {
+		t.Fatalf("login with old password code = %d, want 401", oldPassword.Code)
+	}
+	opsToken = loginWithPasswordForTest(t, router, "ops1", "new-pass")
+
+	disabled := performJSONRequest[map[string]bool](t, router, superToken, http.MethodPut, userPath+"/status", map[string]string{
+		"status": "2",
+	})
+	if disabled.Code != 200 {
+		t.Fatalf("disable user code = %d, msg = %s", disabled.Code, disabled.Msg)
+	}
+	revoked = performJSONRequest[map[string]interface{}](t, router, opsToken, http.MethodGet, "/api/user/info", nil)
+	if revoked.Code != 401 {
+		t.Fatalf("token after disable code = %d, want 401", revoked.Code)
+	}
+	disabledLogin := performJSONRequest[map[string]interface{}](t, router, "", http.MethodPost, "/api/auth/login", map[string]string{
+		"userName": "ops1",
+		"password": "new-pass",
+	})
+	if disabledLogin.Code != 403 {
+		t.Fatalf("disabled login code = %d, want 403", disabledLogin.Code)
+	}
+
+	selfDisable := performJSONRequest[map[string]interface{}](t, router, superToken, http.MethodPut, "/api/user/1/status", map[string]string{
+		"status": "2",
+	})
+	if selfDisable.Code != 400 {
+		t.Fatalf("self disable code = %d, want 400", selfDisable.Code)
+	}
+
+	role := performJSONRequest[roleListItem](t, router, superToken, http.MethodPost, "/api/role", map[string]interface{}{
+		"roleName": "Store Ops",
+		"roleCode": "r_ops",
+	})
+	if role.Code != 200 || role.Data.RoleCode != "R_OPS" || !role.Data.Enabled {
+		t.Fatalf("create role code = %d, data = %+v", role.Code, role.Data)
+	}
+	rolePath := fmt.Sprintf("/api/role/%d", role.Data.RoleID)
+	renamed := performJSONRequest[roleListItem](t, router, superToken, http.MethodPut, rolePath, map[string]interface{}{
+		"roleName":    "Store Operations",
+		"description": "Front desk staff",
+	})
+	if renamed.Code != 200 || renamed.Data.RoleName != "Store Operations" || renamed.Data.RoleCode != "R_OPS" {
+		t.Fatalf("update role code = %d, data = %+v", renamed.Code, renamed.Data)
+	}
+	deletedRole := performJSONRequest[map[string]bool](t, router, superToken, http.MethodDelete, rolePath, nil)
+	if deletedRole.Code != 200 {
+		t.Fatalf("delete role code = %d, msg = %s", deletedRole.Code, deletedRole.Msg)
+	}
+	builtinDelete := performJSONRequest[map[string]interface{}](t, router, superToken, http.MethodDelete, fmt.Sprintf("/api/role/%d", roles.Data.Records[0].RoleID), nil)
+	if builtinDelete.Code != 400 {
+		t.Fatalf("delete built-in role code = %d, want 400", builtinDelete.Code)
+	}
+
+	deletedUser := performJSONRequest[map[string]bool](t, router, superToken, http.MethodDelete, userPath, nil)
+	if deletedUser.Code != 200 {
+		t.Fatalf("delete user code = %d, msg = %s", deletedUser.Code, deletedUser.Msg)
+	}
+	users := performJSONRequest[authPaginated[userListItem]](t, router, superToken, http.MethodGet, "/api/user/list?userName=ops1", nil)
+	if users.Data.Total != 0 {
+		t.Fatalf("user list after delete total = %d, want 0", users.Data.Total)
+	}
+}
+
+func TestLastSuperUserIsKept(t *testing.T) {
+	t.Parallel()
+
+	router := newTestRouter(t)
+	superToken := loginForTest(t, router, "Super")
+
+	demoteSelf := map[string]interface{}{
+		"userName":  "Super",
+		"userRoles": []string{"R_ADMIN"},
+	}
+	if demoted := performJSONRequest[userListItem](t, router, superToken, http.MethodPut, "/api/user/1", demoteSelf); demoted.Code != 409 {
+		t.Fatalf("demote last super code = %d, want 409", demoted.Code)
+	}
+
+	backup := performJSONRequest[userListItem](t, router, superToken, http.MethodPost, "/api/user", map[string]interface{}{
+		"userName":  "root2",
+		"password":  "root-pass",
+		"userRoles": []string{"R_SUPER"},
+	})
+	if backup.Code != 200 {
+		t.Fatalf("create backup super code = %d, msg = %s", backup.Code, backup.Msg)
+	}
+	backupPath := fmt.Sprintf("/api/user/%d", backup.Data.ID)
+	if disabled := performJSONRequest[map[string]bool](t, router, superToken, http.MethodPut, backupPath+"/status",
+		map[string]string{"status": "2"}); disabled.Code != 200 {
+		t.Fatalf("disable backup super code = %d, msg = %s", disabled.Code, disabled.Msg)
+	}
+	if demoted := performJSONRequest[userListItem](t, router, superToken, http.MethodPut, "/api/user/1", demoteSelf); demoted.Code != 409 {
+		t.Fatalf("demote with only a disabled backup code = %d, want 409", demoted.Code)
+	}
+
+	if enabled := performJSONRequest[map[string]bool](t, router, superToken, http.MethodPut, backupPath+"/status",
+		map[string]string{"status": "1"}); enabled.Code != 200 {
+		t.Fatalf("enable backup super code = %d, msg = %s", enabled.Code, enabled.Msg)
+	}
+	if demoted := performJSONRequest[userListItem](t, router, superToken, http.MethodPut, "/api/user/1", demoteSelf); demoted.Code != 200 {
+		t.Fatalf("demote with an enabled backup code = %d, msg = %s", demoted.Code, demoted.Msg)
+	}
+
+	backupToken := loginWithPasswordForTest(t, router, "root2", "root-pass")
+	if demoted := performJSONRequest[userListItem](t, router, backupToken, http.MethodPut, backupPath, map[string]interface{}{
+		"userName":  "root2",
+		"userRoles": []string{"R_USER"},
+	}); demoted.Code != 409 {
+		t.Fatalf("demote new last super code = %d, want 409", demoted.Code)
+	}
+	if disabled := performJSONRequest[map[string]bool](t, router, backupToken, http.MethodPut, "/api/user/1/status",
+		map[string]string{"status": "2"}); disabled.Code != 200 {
+		t.Fatalf("disable demoted user code = %d, msg = %s", disabled.Code, disabled.Msg)
+	}
+}
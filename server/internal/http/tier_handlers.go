@@ -0,0 +1,374 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"small-merchant-ops-hub-server/internal/cache"
+	"small-merchant-ops-hub-server/internal/db"
+	"small-merchant-ops-hub-server/internal/tier"
+)
+
+const (
+	defaultTierWindowDays = 365
+	maxTierWindowDays     = 3650
+	tierDeletedReason     = "tier deleted"
+)
+
+type saveTierRequest struct {
+	Code          string `json:"code"`
+	Name          string `json:"name"`
+	Level         int    `json:"level"`
+	MinPaidCents  int64  `json:"minPaidCents"`
+	MinOrderCount int64  `json:"minOrderCount"`
+	WindowDays    int    `json:"windowDays"`
+}
+
+type tierResponse struct {
+	ID            uint      `json:"id"`
+	Code          string    `json:"code"`
+	Name          string    `json:"name"`
+	Level         int       `json:"level"`
+	MinPaidCents  int64     `json:"minPaidCents"`
+	MinOrderCount int64     `json:"minOrderCount"`
+	WindowDays    int       `json:"windowDays"`
+	MemberCount   int64     `json:"memberCount"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+type tierChangeResponse struct {
+	ID         uint      `json:"id"`
+	MemberID   uint      `json:"memberId"`
+	FromTier   string    `json:"fromTier"`
+	ToTier     string    `json:"toTier"`
+	PaidCents  int64     `json:"paidCents"`
+	OrderCount int64     `json:"orderCount"`
+	Reason     string    `json:"reason"`
+	ChangedBy  string    `json:"changedBy"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type tierCountResponse struct {
+	Tier        string `json:"tier"`
+	MemberCount int64  `json:"memberCount"`
+}
+
+func listTiersHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		tiers := make([]db.MembershipTier, 0)
+		if err := database.WithContext(ctx).Order("level ASC").Find(&tiers).Error; err != nil {
+			fail(c, 500, "list tiers failed")
+			return
+		}
+		counts, err := tierMemberCounts(ctx, database)
+		if err != nil {
+			fail(c, 500, "count tier members failed")
+			return
+		}
+
+		result := make([]tierResponse, 0, len(tiers))
+		for _, item := range tiers {
+			result = append(result, toTierResponse(item, counts[item.Code]))
+		}
+		ok(c, result)
+	}
+}
+
+func createTierHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req saveTierRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid tier payload")
+			return
+		}
+		if msg := normalizeTierRequest(&req); msg != "" {
+			fail(c, 400, msg)
+			return
+		}
+		if req.Code == "" {
+			fail(c, 400, "code is required")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		item := db.MembershipTier{
+			Code:          req.Code,
+			Name:          req.Name,
+			Level:         req.Level,
+			MinPaidCents:  req.MinPaidCents,
+			MinOrderCount: req.MinOrderCount,
+			WindowDays:    req.WindowDays,
+		}
+		if err := database.WithContext(ctx).Create(&item).Error; err != nil {
+			if strings.Contains(strings.ToLower(err.Error()), "unique") {
+				fail(c, 400, "tier code or level already exists")
+				return
+			}
+			fail(c, 500, "create tier failed")
+			return
+		}
+		ok(c, toTierResponse(item, 0))
+	}
+}
+
+// updateTierHandler edits a tier's name, level and thresholds. The code is
+// stored on members, so it cannot change; members move at the next
+// recalculation.
+func updateTierHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tierID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid tier id")
+			return
+		}
+
+		var req saveTierRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "invalid tier payload")
+			return
+		}
+		if msg := normalizeTierRequest(&req); msg != "" {
+			fail(c, 400, msg)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		var item db.MembershipTier
+		if err := database.WithContext(ctx).First(&item, tierID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "tier not found")
+				return
+			}
+			fail(c, 500, "query tier failed")
+			return
+		}
+		if req.Code != "" && req.Code != item.Code {
+			fail(c, 400, "code cannot be changed")
+			return
+		}
+		if err := database.WithContext(ctx).Model(&item).Updates(map[string]interface{}{
+			"name":            req.Name,
+			"level":           req.Level,
+			"min_paid_cents":  req.MinPaidCents,
+			"min_order_count": req.MinOrderCount,
+			"window_days":     req.WindowDays,
+		}).Error; err != nil {
+			if strings.Contains(strings.ToLower(err.Error()), "unique") {
+				fail(c, 400, "tier level already exists")
+				return
+			}
+			fail(c, 500, "update tier failed")
+			return
+		}
+		item.Name = req.Name
+		item.Level = req.Level
+		item.MinPaidCents = req.MinPaidCents
+		item.MinOrderCount = req.MinOrderCount
+		item.WindowDays = req.WindowDays
+
+		counts, err := tierMemberCounts(ctx, database)
+		if err != nil {
+			fail(c, 500, "count tier members failed")
+			return
+		}
+		ok(c, toTierResponse(item, counts[item.Code]))
+	}
+}
+
+// deleteTierHandler removes a tier and drops its members to no tier, with a
+// change row each; the next recalculation places them again.
+func deleteTierHandler(database *gorm.DB, cacheStore cache.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tierID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid tier id")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		var item db.MembershipTier
+		if err := database.WithContext(ctx).First(&item, tierID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fail(c, 404, "tier not found")
+				return
+			}
+			fail(c, 500, "query tier failed")
+			return
+		}
+
+		changedBy := sessionFromContext(c).UserName
+		err := database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Delete(&item).Error; err != nil {
+				return err
+			}
+			var memberIDs []uint
+			if err := tx.Unscoped().Model(&db.Member{}).Where("tier_code = ?", item.Code).Pluck("id", &memberIDs).Error; err != nil {
+				return err
+			}
+			for _, memberID := range memberIDs {
+				if _, err := tier.Apply(tx, db.MemberTierChange{
+					MemberID:  memberID,
+					FromTier:  item.Code,
+					Reason:    tierDeletedReason,
+					ChangedBy: changedBy,
+				}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			fail(c, 500, "delete tier failed")
+			return
+		}
+
+		_ = cacheStore.Delete(ctx, summaryCacheKey)
+		ok(c, gin.H{"id": tierID})
+	}
+}
+
+// recalculateTiersHandler runs the nightly tier recalculation on demand.
+func recalculateTiersHandler(database *gorm.DB, cacheStore cache.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		result, err := tier.Recalculate(ctx, database, time.Now(), sessionFromContext(c).UserName)
+		if err != nil {
+			fail(c, 500, "recalculate tiers failed")
+			return
+		}
+
+		_ = cacheStore.Delete(ctx, summaryCacheKey)
+		ok(c, result)
+	}
+}
+
+// memberTierChangesHandler lists a member's tier moves, newest first.
+func memberTierChangesHandler(database *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		memberID, valid := parseIDParam(c)
+		if !valid {
+			fail(c, 400, "invalid member id")
+			return
+		}
+		limit := parseLimit(c.Query("limit"), 20)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		changes := make([]db.MemberTierChange, 0, limit)
+		if err := database.WithContext(ctx).
+			Where("member_id = ?", memberID).
+			Order("id DESC").
+			Limit(limit).
+			Find(&changes).Error; err != nil {
+			fail(c, 500, "list tier changes failed")
+			return
+		}
+
+		result := make([]tierChangeResponse, 0, len(changes))
+		for _, change := range changes {
+			result = append(result, toTierChangeResponse(change))
+		}
+		ok(c, result)
+	}
+}
+
+// tierMemberCounts counts active members per tier code; "" is no tier.
+func tierMemberCounts(ctx context.Context, database *gorm.DB) (map[string]int64, error) {
+	var rows []tierCountResponse
+	if err := database.WithContext(ctx).
+		Model(&db.Member{}).
+		Select("tier_code AS tier, COUNT(*) AS member_count").
+		Group("tier_code").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Tier] = row.MemberCount
+	}
+	return counts, nil
+}
+
+// normalizeTierRequest trims req, defaults WindowDays and returns a
+// validation message, or "" when the tier is usable.
+func normalizeTierRequest(req *saveTierRequest) string {
+	req.Code = strings.ToLower(strings.TrimSpace(req.Code))
+	req.Name = strings.TrimSpace(req.Name)
+	if req.WindowDays == 0 {
+		req.WindowDays = defaultTierWindowDays
+	}
+	switch {
+	case !isTierCode(req.Code):
+		return "code may only contain a-z, 0-9, - and _ (at most 30)"
+	case req.Name == "":
+		return "name is required"
+	case req.Level <= 0:
+		return "level must be positive"
+	case req.MinPaidCents < 0 || req.MinOrderCount < 0:
+		return "minPaidCents and minOrderCount cannot be negative"
+	case req.MinPaidCents == 0 && req.MinOrderCount == 0:
+		return "minPaidCents or minOrderCount is required"
+	case req.WindowDays < 0 || req.WindowDays > maxTierWindowDays:
+		return "windowDays must be in [1, 3650]"
+	}
+	return ""
+}
+
+// isTierCode accepts "" so updates may omit the code.
+func isTierCode(code string) bool {
+	if len(code) > 30 {
+		return false
+	}
+	for _, r := range code {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+func toTierResponse(item db.MembershipTier, memberCount int64) tierResponse {
+	return tierResponse{
+		ID:            item.ID,
+		Code:          item.Code,
+		Name:          item.Name,
+		Level:         item.Level,
+		MinPaidCents:  item.MinPaidCents,
+		MinOrderCount: item.MinOrderCount,
+		WindowDays:    item.WindowDays,
+		MemberCount:   memberCount,
+		CreatedAt:     item.CreatedAt,
+		UpdatedAt:     item.UpdatedAt,
+	}
+}
+
+func toTierChangeResponse(change db.MemberTierChange) tierChangeResponse {
+	return tierChangeResponse{
+		ID:         change.ID,
+		MemberID:   change.MemberID,
+		FromTier:   change.FromTier,
+		ToTier:     change.ToTier,
+		PaidCents:  change.PaidCents,
+		OrderCount: change.OrderCount,
+		Reason:     change.Reason,
+		ChangedBy:  change.ChangedBy,
+		CreatedAt:  change.CreatedAt,
+	}
+}
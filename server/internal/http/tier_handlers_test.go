@@ -0,0 +1,132 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+type testTierMember struct {
+	ID   uint   `json:"id"`
+	Tier string `json:"tier"`
+}
+
+func TestMembershipTiers(t *testing.T) {
+	t.Parallel()
+
+	router := newTestRouter(t)
+	superToken := loginForTest(t, router, "Super")
+	adminToken := loginForTest(t, router, "Admin")
+
+	if denied := performJSONRequest[tierResponse](t, router, adminToken, http.MethodPost, "/api/v1/tiers",
+		map[string]interface{}{"code": "silver", "name": "Silver", "level": 1, "minPaidCents": 10000}); denied.Code != 403 {
+		t.Fatalf("admin create tier code = %d, want 403", denied.Code)
+	}
+	if invalid := performJSONRequest[tierResponse](t, router, superToken, http.MethodPost, "/api/v1/tiers",
+		map[string]interface{}{"code": "Black Card", "name": "Black", "level": 3, "minPaidCents": 1}); invalid.Code != 400 {
+		t.Fatalf("tier with spaces in code = %d, want 400", invalid.Code)
+	}
+	silver := performJSONRequest[tierResponse](t, router, superToken, http.MethodPost, "/api/v1/tiers",
+		map[string]interface{}{"code": "silver", "name": "Silver", "level": 1, "minPaidCents": 10000})
+	if silver.Code != 200 || silver.Data.WindowDays != 365 {
+		t.Fatalf("create silver = %d %+v, msg = %s", silver.Code, silver.Data, silver.Msg)
+	}
+	gold := performJSONRequest[tierResponse](t, router, superToken, http.MethodPost, "/api/v1/tiers",
+		map[string]interface{}{"code": "gold", "name": "Gold", "level": 2, "minPaidCents": 50000, "minOrderCount": 3})
+	if gold.Code != 200 {
+		t.Fatalf("create gold code = %d, msg = %s", gold.Code, gold.Msg)
+	}
+	if clash := performJSONRequest[tierResponse](t, router, superToken, http.MethodPost, "/api/v1/tiers",
+		map[string]interface{}{"code": "black", "name": "Black", "level": 2, "minPaidCents": 90000}); clash.Code != 400 {
+		t.Fatalf("duplicate level code = %d, want 400", clash.Code)
+	}
+
+	createMember := func(name, phone string, amounts ...int64) uint {
+		member := performJSONRequest[testMember](t, router, superToken, http.MethodPost, "/api/v1/members", map[string]interface{}{
+			"name":    name,
+			"phone":   phone,
+			"channel": "wechat",
+		})
+		if member.Code != 200 {
+			t.Fatalf("create member code = %d, msg = %s", member.Code, member.Msg)
+		}
+		for _, amount := range amounts {
+			if order := performJSONRequest[testOrder](t, router, superToken, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+				"memberId":    member.Data.ID,
+				"amountCents": amount,
+				"source":      "wechat",
+			}); order.Code != 200 {
+				t.Fatalf("create order code = %d, msg = %s", order.Code, order.Msg)
+			}
+		}
+		return member.Data.ID
+	}
+	goldID := createMember("Gia", "13800007701", 1000, 1000, 1000)
+	silverID := createMember("Sam", "13800007702", 20000)
+	createMember("Nia", "13800007703", 500)
+
+	recalculated := performJSONRequest[struct {
+		Evaluated int `json:"evaluated"`
+		Upgraded  int `json:"upgraded"`
+	}](t, router, superToken, http.MethodPost, "/api/v1/tiers/recalculate", nil)
+	if recalculated.Code != 200 || recalculated.Data.Evaluated != 3 || recalculated.Data.Upgraded != 2 {
+		t.Fatalf("recalculate = %d %+v, msg = %s", recalculated.Code, recalculated.Data, recalculated.Msg)
+	}
+
+	golds := performJSONRequest[[]testTierMember](t, router, adminToken, http.MethodGet, "/api/v1/members?tier=gold", nil)
+	if golds.Code != 200 || len(golds.Data) != 1 || golds.Data[0].ID != goldID || golds.Data[0].Tier != "gold" {
+		t.Fatalf("gold members = %d %+v", golds.Code, golds.Data)
+	}
+	untiered := performJSONRequest[[]testTierMember](t, router, adminToken, http.MethodGet, "/api/v1/members?tier=", nil)
+	if untiered.Code != 200 || len(untiered.Data) != 1 {
+		t.Fatalf("members without tier = %d %+v", untiered.Code, untiered.Data)
+	}
+
+	summary := performJSONRequest[struct {
+		TierBreakdown []tierCountResponse `json:"tierBreakdown"`
+	}](t, router, adminToken, http.MethodGet, "/api/v1/summary", nil)
+	breakdown := make(map[string]int64)
+	for _, row := range summary.Data.TierBreakdown {
+		breakdown[row.Tier] = row.MemberCount
+	}
+	if summary.Code != 200 || breakdown["gold"] != 1 || breakdown["silver"] != 1 || breakdown[""] != 1 {
+		t.Fatalf("summary tier breakdown = %d %+v", summary.Code, summary.Data.TierBreakdown)
+	}
+
+	segment := performJSONRequest[testSegment](t, router, adminToken, http.MethodPost, "/api/v1/segments", map[string]interface{}{
+		"name": "Gold and silver",
+		"rule": map[string]interface{}{"field": "tier", "cmp": "in", "value": []string{"gold", "silver"}},
+	})
+	if segment.Code != 200 {
+		t.Fatalf("create tier segment code = %d, msg = %s", segment.Code, segment.Msg)
+	}
+	audience := performJSONRequest[testSegmentMembers](t, router, adminToken, http.MethodGet,
+		fmt.Sprintf("/api/v1/segments/%d/members", segment.Data.ID), nil)
+	if audience.Code != 200 || audience.Data.Total != 2 {
+		t.Fatalf("tier segment audience = %d %+v", audience.Code, audience.Data)
+	}
+
+	changes := performJSONRequest[[]tierChangeResponse](t, router, adminToken, http.MethodGet,
+		fmt.Sprintf("/api/v1/members/%d/tier-changes", silverID), nil)
+	if changes.Code != 200 || len(changes.Data) != 1 || changes.Data[0].ToTier != "silver" || changes.Data[0].ChangedBy != "Super" {
+		t.Fatalf("tier changes = %d %+v", changes.Code, changes.Data)
+	}
+
+	if renamed := performJSONRequest[tierResponse](t, router, superToken, http.MethodPut, fmt.Sprintf("/api/v1/tiers/%d", gold.Data.ID),
+		map[string]interface{}{"code": "platinum", "name": "Gold", "level": 2, "minPaidCents": 50000}); renamed.Code != 400 {
+		t.Fatalf("changing tier code = %d, want 400", renamed.Code)
+	}
+	if deleted := performJSONRequest[map[string]interface{}](t, router, superToken, http.MethodDelete,
+		fmt.Sprintf("/api/v1/tiers/%d", gold.Data.ID), nil); deleted.Code != 200 {
+		t.Fatalf("delete tier code = %d, msg = %s", deleted.Code, deleted.Msg)
+	}
+	tiers := performJSONRequest[[]tierResponse](t, router, adminToken, http.MethodGet, "/api/v1/tiers", nil)
+	if tiers.Code != 200 || len(tiers.Data) != 1 || tiers.Data[0].Code != "silver" || tiers.Data[0].MemberCount != 1 {
+		t.Fatalf("tiers after delete = %d %+v", tiers.Code, tiers.Data)
+	}
+	dropped := performJSONRequest[[]tierChangeResponse](t, router, adminToken, http.MethodGet,
+		fmt.Sprintf("/api/v1/members/%d/tier-changes", goldID), nil)
+	if dropped.Code != 200 || len(dropped.Data) != 2 || dropped.Data[0].FromTier != "gold" || dropped.Data[0].ToTier != "" {
+		t.Fatalf("gold member changes after delete = %d %+v", dropped.Code, dropped.Data)
+	}
+}
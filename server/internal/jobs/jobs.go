@@ -0,0 +1,148 @@
+// Package jobs runs background work inside the server process on a schedule.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Job is one unit of scheduled work. Next returns the first run time after
+// now; Run gets a context that is cancelled when the scheduler stops.
+type Job struct {
+	Name string
+	Next func(now time.Time) time.Time
+	Run  func(ctx context.Context) error
+}
+
+// Scheduler runs each job in its own goroutine. Runs of one job never
+// overlap: the next run time is computed after the previous run returns.
+type Scheduler struct {
+	jobs []Job
+	now  func() time.Time
+
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// NewScheduler returns a scheduler for jobs; nothing runs until Start.
+func NewScheduler(jobs ...Job) *Scheduler {
+	return &Scheduler{jobs: jobs, now: time.Now}
+}
+
+// Start launches the jobs; calling it again does nothing.
+func (s *Scheduler) Start() {
+	s.startOnce.Do(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.cancel = cancel
+		for _, job := range s.jobs {
+			s.wg.Add(1)
+			go s.loop(ctx, job)
+		}
+	})
+}
+
+// Stop cancels running jobs and waits for them to return. It is safe to call
+// more than once.
+func (s *Scheduler) Stop() {
+	s.stopOnce.Do(func() {
+		if s.cancel != nil {
+			s.cancel()
+		}
+		s.wg.Wait()
+	})
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	defer s.wg.Done()
+
+	for {
+		wait := job.Next(s.now()).Sub(s.now())
+		if wait < 0 {
+			wait = 0
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		started := s.now()
+		if err := job.Run(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("job %s failed after %s: %v", job.Name, s.now().Sub(started).Round(time.Millisecond), err)
+		}
+	}
+}
+
+// Every schedules a job interval after the previous run.
+func Every(interval time.Duration) func(time.Time) time.Time {
+	return func(now time.Time) time.Time {
+		return now.Add(interval)
+	}
+}
+
+// DailyAt schedules a job once a day at hour:00 in now's location.
+func DailyAt(hour int) func(time.Time) time.Time {
+	return func(now time.Time) time.Time {
+		next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+		if !next.After(now) {
+			next = next.AddDate(0, 0, 1)
+		}
+		return next
+	}
+}
+
+// Locker is the part of a shared cache that Exclusive needs; cache.Store
+// satisfies it.
+type Locker interface {
+	SetIfAbsent(ctx context.Context, key, value string, ttl time.Duration) (bool, error)
+	CompareAndDelete(ctx context.Context, key, value string) (bool, error)
+}
+
+// Exclusive wraps run so that when several replicas share locker, only the
+// one that takes key runs; the others skip that run. The lock expires after
+// ttl so a replica that dies mid-run cannot hold it, and is released after
+// run unless it already expired and another replica took it.
+func Exclusive(locker Locker, key string, ttl time.Duration, run func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		owner, err := lockOwner()
+		if err != nil {
+			return err
+		}
+		acquired, err := locker.SetIfAbsent(ctx, key, owner, ttl)
+		if err != nil {
+			return fmt.Errorf("acquire lock %s: %w", key, err)
+		}
+		if !acquired {
+			return nil
+		}
+		defer func() {
+			// The run's context may be cancelled by now; release with a
+			// short one of its own so shutdown frees the lock.
+			releaseCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			_, _ = locker.CompareAndDelete(releaseCtx, key, owner)
+		}()
+		return run(ctx)
+	}
+}
+
+// lockOwner returns a random token identifying one lock holder.
+func lockOwner() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate lock owner: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
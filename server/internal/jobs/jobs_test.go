@@ -0,0 +1,166 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDailyAt(t *testing.T) {
+	t.Parallel()
+
+	next := DailyAt(3)
+	loc := time.FixedZone("CST", 8*3600)
+	tests := []struct {
+		now  time.Time
+		want time.Time
+	}{
+		{time.Date(2026, 3, 1, 1, 30, 0, 0, loc), time.Date(2026, 3, 1, 3, 0, 0, 0, loc)},
+		{time.Date(2026, 3, 1, 3, 0, 0, 0, loc), time.Date(2026, 3, 2, 3, 0, 0, 0, loc)},
+		{time.Date(2026, 3, 31, 23, 0, 0, 0, loc), time.Date(2026, 4, 1, 3, 0, 0, 0, loc)},
+	}
+	for _, tt := range tests {
+		if got := next(tt.now); !got.Equal(tt.want) {
+			t.Fatalf("DailyAt(3)(%s) = %s, want %s", tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestSchedulerRunsUntilStopped(t *testing.T) {
+	t.Parallel()
+
+	var runs atomic.Int32
+	cancelled := make(chan struct{})
+	scheduler := NewScheduler(
+		Job{
+			Name: "tick",
+			Next: Every(5 * time.Millisecond),
+			Run: func(context.Context) error {
+				runs.Add(1)
+				return nil
+			},
+		},
+		Job{
+			Name: "blocking",
+			Next: Every(time.Millisecond),
+			Run: func(ctx context.Context) error {
+				<-ctx.Done()
+				close(cancelled)
+				return ctx.Err()
+			},
+		},
+	)
+	scheduler.Start()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for runs.Load() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("tick ran %d times, want at least 3", runs.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	scheduler.Stop()
+	scheduler.Stop()
+	select {
+	case <-cancelled:
+	default:
+		t.Fatalf("blocking job was not cancelled by Stop")
+	}
+	stopped := runs.Load()
+	time.Sleep(20 * time.Millisecond)
+	if runs.Load() != stopped {
+		t.Fatalf("tick kept running after Stop")
+	}
+}
+
+// memoryLocker is a Locker without expiry, enough to test Exclusive.
+type memoryLocker struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func (l *memoryLocker) Get(_ context.Context, key string) (string, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	value, found := l.values[key]
+	return value, found, nil
+}
+
+func (l *memoryLocker) SetIfAbsent(_ context.Context, key, value string, _ time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, found := l.values[key]; found {
+		return false, nil
+	}
+	l.values[key] = value
+	return true, nil
+}
+
+func (l *memoryLocker) CompareAndDelete(_ context.Context, key, value string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if current, found := l.values[key]; !found || current != value {
+		return false, nil
+	}
+	delete(l.values, key)
+	return true, nil
+}
+
+func TestExclusiveRunsOneHolderAtATime(t *testing.T) {
+	t.Parallel()
+
+	locker := &memoryLocker{values: make(map[string]string)}
+	var runs atomic.Int32
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	first := Exclusive(locker, "lock:test", time.Minute, func(context.Context) error {
+		runs.Add(1)
+		close(entered)
+		<-release
+		return nil
+	})
+	second := Exclusive(locker, "lock:test", time.Minute, func(context.Context) error {
+		runs.Add(1)
+		return nil
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- first(context.Background()) }()
+	<-entered
+	if err := second(context.Background()); err != nil || runs.Load() != 1 {
+		t.Fatalf("second run while locked: err = %v, runs = %d, want skipped", err, runs.Load())
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+
+	if _, held, _ := locker.Get(context.Background(), "lock:test"); held {
+		t.Fatalf("lock still held after the run returned")
+	}
+	if err := second(context.Background()); err != nil || runs.Load() != 2 {
+		t.Fatalf("second run after release: err = %v, runs = %d, want 2", err, runs.Load())
+	}
+}
+
+func TestExclusiveKeepsLockTakenByAnotherOwner(t *testing.T) {
+	t.Parallel()
+
+	locker := &memoryLocker{values: make(map[string]string)}
+	run := Exclusive(locker, "lock:test", time.Minute, func(context.Context) error {
+		// The lock expired mid-run and another replica took it.
+		locker.mu.Lock()
+		locker.values["lock:test"] = "other"
+		locker.mu.Unlock()
+		return nil
+	})
+	if err := run(context.Background()); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if owner, held, _ := locker.Get(context.Background(), "lock:test"); !held || owner != "other" {
+		t.Fatalf("lock = %q held=%v, want kept by other", owner, held)
+	}
+}
@@ -0,0 +1,108 @@
+// Package lifecycle moves campaigns between draft, active and closed, either
+// on request or as their StartAt/EndAt window opens and ends.
+package lifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"small-merchant-ops-hub-server/internal/db"
+)
+
+// Notes written by Advance on the changes it records.
+const (
+	NoteWindowOpened = "window opened"
+	NoteWindowEnded  = "window ended"
+)
+
+// Result counts what one Advance did.
+type Result struct {
+	Activated int `json:"activated"`
+	Closed    int `json:"closed"`
+}
+
+type statusChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Transition moves campaign from the status it was loaded with to to and
+// records the move under action. It reports false, writing nothing, when the
+// stored status no longer matches.
+func Transition(tx *gorm.DB, campaign db.Campaign, action, to, note, changedBy string) (bool, error) {
+	updated := tx.Model(&db.Campaign{}).
+		Where("id = ? AND status = ?", campaign.ID, campaign.Status).
+		Update("status", to)
+	if updated.Error != nil {
+		return false, updated.Error
+	}
+	if updated.RowsAffected == 0 {
+		return false, nil
+	}
+	changes, err := json.Marshal(map[string]statusChange{"status": {From: campaign.Status, To: to}})
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Create(&db.CampaignChange{
+		CampaignID: campaign.ID,
+		Action:     action,
+		Changes:    string(changes),
+		Note:       note,
+		ChangedBy:  changedBy,
+	}).Error
+}
+
+// Advance activates drafts whose window has opened by now and closes active
+// campaigns whose window has ended. Drafts without a StartAt wait for someone
+// to activate them, and drafts whose window ended unstarted are left alone.
+// A campaign edited while the run is in progress is picked up next time.
+func Advance(ctx context.Context, database *gorm.DB, now time.Time, changedBy string) (Result, error) {
+	var opened []db.Campaign
+	if err := database.WithContext(ctx).
+		Where("status = ? AND start_at <= ? AND (end_at IS NULL OR end_at > ?)", "draft", now, now).
+		Order("id ASC").
+		Find(&opened).Error; err != nil {
+		return Result{}, fmt.Errorf("list campaigns to activate: %w", err)
+	}
+	var ended []db.Campaign
+	if err := database.WithContext(ctx).
+		Where("status = ? AND end_at <= ?", "active", now).
+		Order("id ASC").
+		Find(&ended).Error; err != nil {
+		return Result{}, fmt.Errorf("list campaigns to close: %w", err)
+	}
+
+	var result Result
+	for _, campaign := range opened {
+		moved, err := transitionInTx(ctx, database, campaign, db.CampaignActionActivated, "active", NoteWindowOpened, changedBy)
+		if err != nil {
+			return result, fmt.Errorf("activate campaign %d: %w", campaign.ID, err)
+		}
+		if moved {
+			result.Activated++
+		}
+	}
+	for _, campaign := range ended {
+		moved, err := transitionInTx(ctx, database, campaign, db.CampaignActionClosed, "closed", NoteWindowEnded, changedBy)
+		if err != nil {
+			return result, fmt.Errorf("close campaign %d: %w", campaign.ID, err)
+		}
+		if moved {
+			result.Closed++
+		}
+	}
+	return result, nil
+}
+
+func transitionInTx(ctx context.Context, database *gorm.DB, campaign db.Campaign, action, to, note, changedBy string) (bool, error) {
+	var moved bool
+	err := database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		moved, err = Transition(tx, campaign, action, to, note, changedBy)
+		return err
+	})
+	return moved, err
+}
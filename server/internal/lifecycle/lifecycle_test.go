@@ -0,0 +1,85 @@
+package lifecycle
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"small-merchant-ops-hub-server/internal/config"
+	"small-merchant-ops-hub-server/internal/db"
+)
+
+func TestAdvance(t *testing.T) {
+	t.Parallel()
+
+	database, err := db.Open(config.Config{Env: "local", SQLitePath: filepath.Join(t.TempDir(), "app.db")})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+
+	now := time.Now()
+	at := func(days int) *time.Time {
+		value := now.AddDate(0, 0, days)
+		return &value
+	}
+	campaigns := []db.Campaign{
+		{Name: "opened", Status: "draft", StartAt: at(-1), EndAt: at(7)},
+		{Name: "not yet", Status: "draft", StartAt: at(1)},
+		{Name: "no window", Status: "draft"},
+		{Name: "missed", Status: "draft", StartAt: at(-9), EndAt: at(-2)},
+		{Name: "ended", Status: "active", StartAt: at(-9), EndAt: at(-1)},
+		{Name: "open ended", Status: "active", StartAt: at(-9)},
+	}
+	for i := range campaigns {
+		campaigns[i].Channel = "wechat"
+		campaigns[i].DiscountPct = 10
+	}
+	if err := database.Create(&campaigns).Error; err != nil {
+		t.Fatalf("create campaigns: %v", err)
+	}
+
+	result, err := Advance(context.Background(), database, now, "system")
+	if err != nil || result.Activated != 1 || result.Closed != 1 {
+		t.Fatalf("Advance = %+v, %v, want 1 activated and 1 closed", result, err)
+	}
+
+	want := map[string]string{
+		"opened":     "active",
+		"not yet":    "draft",
+		"no window":  "draft",
+		"missed":     "draft",
+		"ended":      "closed",
+		"open ended": "active",
+	}
+	var stored []db.Campaign
+	if err := database.Find(&stored).Error; err != nil {
+		t.Fatalf("load campaigns: %v", err)
+	}
+	for _, campaign := range stored {
+		if campaign.Status != want[campaign.Name] {
+			t.Fatalf("campaign %q status = %s, want %s", campaign.Name, campaign.Status, want[campaign.Name])
+		}
+	}
+
+	var changes []db.CampaignChange
+	if err := database.Order("campaign_id ASC").Find(&changes).Error; err != nil {
+		t.Fatalf("load changes: %v", err)
+	}
+	if len(changes) != 2 || changes[0].Action != db.CampaignActionActivated || changes[0].Note != NoteWindowOpened ||
+		changes[1].Action != db.CampaignActionClosed || changes[1].ChangedBy != "system" ||
+		changes[1].Changes != `{"status":{"from":"active","to":"closed"}}` {
+		t.Fatalf("changes = %+v", changes)
+	}
+
+	again, err := Advance(context.Background(), database, now, "system")
+	if err != nil || again != (Result{}) {
+		t.Fatalf("second Advance = %+v, %v, want nothing to do", again, err)
+	}
+
+	stale := campaigns[0]
+	moved, err := Transition(database, stale, db.CampaignActionActivated, "active", "", "Super")
+	if err != nil || moved {
+		t.Fatalf("Transition from stale status = %v, %v, want false", moved, err)
+	}
+}
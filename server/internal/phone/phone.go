@@ -0,0 +1,118 @@
+// Package phone normalizes member phone numbers to E.164 so the same number
+// typed in different ways ("138 0000 1111", "+8613800001111") maps to one member.
+package phone
+
+import (
+	"errors"
+	"strings"
+)
+
+// DefaultRegion is used when no region is configured.
+const DefaultRegion = "CN"
+
+// maxE164Digits is the longest number E.164 allows, country code included.
+const maxE164Digits = 15
+
+var (
+	ErrEmpty         = errors.New("phone is empty")
+	ErrInvalid       = errors.New("phone contains invalid characters")
+	ErrLength        = errors.New("phone has an invalid length")
+	ErrUnknownRegion = errors.New("unsupported phone region")
+)
+
+// region describes how national numbers of one country are written.
+type region struct {
+	CallingCode string
+	// TrunkPrefix is dialled before national numbers inside the country and
+	// dropped in international form, e.g. the 0 in 020 1234 5678.
+	TrunkPrefix string
+	MinDigits   int
+	MaxDigits   int
+}
+
+var regions = map[string]region{
+	"CN": {CallingCode: "86", TrunkPrefix: "0", MinDigits: 10, MaxDigits: 11},
+	"HK": {CallingCode: "852", MinDigits: 8, MaxDigits: 8},
+	"MO": {CallingCode: "853", MinDigits: 8, MaxDigits: 8},
+	"TW": {CallingCode: "886", TrunkPrefix: "0", MinDigits: 8, MaxDigits: 9},
+	"SG": {CallingCode: "65", MinDigits: 8, MaxDigits: 8},
+	"MY": {CallingCode: "60", TrunkPrefix: "0", MinDigits: 9, MaxDigits: 10},
+	"JP": {CallingCode: "81", TrunkPrefix: "0", MinDigits: 9, MaxDigits: 10},
+	"KR": {CallingCode: "82", TrunkPrefix: "0", MinDigits: 8, MaxDigits: 10},
+	"US": {CallingCode: "1", TrunkPrefix: "1", MinDigits: 10, MaxDigits: 10},
+	"CA": {CallingCode: "1", TrunkPrefix: "1", MinDigits: 10, MaxDigits: 10},
+	"GB": {CallingCode: "44", TrunkPrefix: "0", MinDigits: 9, MaxDigits: 10},
+	"AU": {CallingCode: "61", TrunkPrefix: "0", MinDigits: 9, MaxDigits: 9},
+}
+
+// IsSupportedRegion reports whether code (ISO 3166-1 alpha-2) can be used as
+// the default region.
+func IsSupportedRegion(code string) bool {
+	_, found := regions[strings.ToUpper(strings.TrimSpace(code))]
+	return found
+}
+
+// Normalize returns raw in E.164 form. Numbers written with + or 00 are taken
+// as international; anything else is read as a national number of
+// defaultRegion (DefaultRegion when empty). Spaces, dashes, dots and
+// parentheses are ignored.
+func Normalize(raw, defaultRegion string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", ErrEmpty
+	}
+
+	international := false
+	digits := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		ch := raw[i]
+		switch {
+		case ch >= '0' && ch <= '9':
+			digits = append(digits, ch)
+		case ch == '+' && len(digits) == 0 && !international:
+			international = true
+		case ch == ' ' || ch == '-' || ch == '.' || ch == '(' || ch == ')':
+		default:
+			return "", ErrInvalid
+		}
+	}
+	number := string(digits)
+	if !international && strings.HasPrefix(number, "00") {
+		international = true
+		number = number[2:]
+	}
+
+	if international {
+		if len(number) < 8 || len(number) > maxE164Digits || number[0] == '0' {
+			return "", ErrLength
+		}
+		return "+" + number, nil
+	}
+
+	if strings.TrimSpace(defaultRegion) == "" {
+		defaultRegion = DefaultRegion
+	}
+	info, found := regions[strings.ToUpper(strings.TrimSpace(defaultRegion))]
+	if !found {
+		return "", ErrUnknownRegion
+	}
+
+	// A national number that already carries the country code, such as
+	// 8613800001111 typed without the +.
+	if strings.HasPrefix(number, info.CallingCode) {
+		rest := number[len(info.CallingCode):]
+		if len(rest) >= info.MinDigits && len(rest) <= info.MaxDigits && len(number) > info.MaxDigits {
+			return "+" + info.CallingCode + rest, nil
+		}
+	}
+	if info.TrunkPrefix != "" && strings.HasPrefix(number, info.TrunkPrefix) && len(number) > info.MinDigits {
+		trimmed := number[len(info.TrunkPrefix):]
+		if len(trimmed) >= info.MinDigits && len(trimmed) <= info.MaxDigits {
+			number = trimmed
+		}
+	}
+	if len(number) < info.MinDigits || len(number) > info.MaxDigits {
+		return "", ErrLength
+	}
+	return "+" + info.CallingCode + number, nil
+}
@@ -0,0 +1,48 @@
+package phone
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		raw    string
+		region string
+		want   string
+		err    error
+	}{
+		{raw: "13800001111", region: "CN", want: "+8613800001111"},
+		{raw: "138 0000 1111", region: "CN", want: "+8613800001111"},
+		{raw: "138-0000-1111", region: "", want: "+8613800001111"},
+		{raw: "+86 138 0000 1111", region: "CN", want: "+8613800001111"},
+		{raw: "8613800001111", region: "CN", want: "+8613800001111"},
+		{raw: "008613800001111", region: "US", want: "+8613800001111"},
+		{raw: "020 1234 5678", region: "CN", want: "+862012345678"},
+		{raw: "(415) 555-0100", region: "us", want: "+14155550100"},
+		{raw: "1 415 555 0100", region: "US", want: "+14155550100"},
+		{raw: "9123 4567", region: "HK", want: "+85291234567"},
+		{raw: "+44 20 7946 0958", region: "CN", want: "+442079460958"},
+		{raw: "", region: "CN", err: ErrEmpty},
+		{raw: "138abc", region: "CN", err: ErrInvalid},
+		{raw: "138+0000", region: "CN", err: ErrInvalid},
+		{raw: "12345", region: "CN", err: ErrLength},
+		{raw: "+1234567890123456", region: "CN", err: ErrLength},
+		{raw: "13800001111", region: "ZZ", err: ErrUnknownRegion},
+	}
+
+	for _, tt := range tests {
+		got, err := Normalize(tt.raw, tt.region)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Normalize(%q, %q) err = %v, want %v", tt.raw, tt.region, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Fatalf("Normalize(%q, %q) = %q, %v; want %q", tt.raw, tt.region, got, err, tt.want)
+		}
+	}
+}
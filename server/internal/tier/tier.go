@@ -0,0 +1,193 @@
+// Package tier assigns every member the highest membership tier its recent
+// paid orders qualify for.
+package tier
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"small-merchant-ops-hub-server/internal/db"
+)
+
+// ReasonRecalculation is the MemberTierChange reason written by Recalculate.
+const ReasonRecalculation = "recalculation"
+
+const batchSize = 500
+
+// Result counts what one recalculation did.
+type Result struct {
+	Evaluated  int `json:"evaluated"`
+	Upgraded   int `json:"upgraded"`
+	Downgraded int `json:"downgraded"`
+}
+
+// Stats are a member's paid orders inside a tier window.
+type Stats struct {
+	PaidCents  int64
+	OrderCount int64
+}
+
+// Qualifies reports whether stats reach one of the tier thresholds.
+func Qualifies(tier db.MembershipTier, stats Stats) bool {
+	if tier.MinPaidCents > 0 && stats.PaidCents >= tier.MinPaidCents {
+		return true
+	}
+	return tier.MinOrderCount > 0 && stats.OrderCount >= tier.MinOrderCount
+}
+
+// Recalculate moves every active member to the highest tier it qualifies for
+// at now, or to no tier, and records each move. A member whose tier changed
+// while the run was in progress is skipped and picked up by the next run.
+func Recalculate(ctx context.Context, database *gorm.DB, now time.Time, changedBy string) (Result, error) {
+	var tiers []db.MembershipTier
+	if err := database.WithContext(ctx).Order("level DESC").Find(&tiers).Error; err != nil {
+		return Result{}, fmt.Errorf("load tiers: %w", err)
+	}
+
+	levels := make(map[string]int, len(tiers))
+	windows := make([]map[uint]Stats, len(tiers))
+	for i, tier := range tiers {
+		levels[tier.Code] = tier.Level
+		stats, err := windowStats(ctx, database, now.AddDate(0, 0, -tier.WindowDays))
+		if err != nil {
+			return Result{}, err
+		}
+		windows[i] = stats
+	}
+
+	var result Result
+	batch := make([]db.Member, 0, batchSize)
+	err := database.WithContext(ctx).
+		Select("id, tier_code").
+		FindInBatches(&batch, batchSize, func(_ *gorm.DB, _ int) error {
+			changes := make([]db.MemberTierChange, 0)
+			for _, member := range batch {
+				result.Evaluated++
+				target := ""
+				var decided Stats
+				for i, tier := range tiers {
+					decided = windows[i][member.ID]
+					if Qualifies(tier, decided) {
+						target = tier.Code
+						break
+					}
+				}
+				if target == member.TierCode {
+					continue
+				}
+				changes = append(changes, db.MemberTierChange{
+					MemberID:   member.ID,
+					FromTier:   member.TierCode,
+					ToTier:     target,
+					PaidCents:  decided.PaidCents,
+					OrderCount: decided.OrderCount,
+					Reason:     ReasonRecalculation,
+					ChangedBy:  changedBy,
+				})
+			}
+			if len(changes) == 0 {
+				return nil
+			}
+			return database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				for _, change := range changes {
+					applied, err := Apply(tx, change)
+					if err != nil {
+						return err
+					}
+					if !applied {
+						continue
+					}
+					if levels[change.ToTier] > levels[change.FromTier] {
+						result.Upgraded++
+					} else {
+						result.Downgraded++
+					}
+				}
+				return nil
+			})
+		}).Error
+	if err != nil {
+		return Result{}, fmt.Errorf("recalculate tiers: %w", err)
+	}
+	return result, nil
+}
+
+// Apply moves change.MemberID from FromTier to ToTier and records change. It
+// reports false, writing nothing, when the member no longer holds FromTier.
+// Soft-deleted members are moved too, so a removed tier leaves no holders.
+func Apply(tx *gorm.DB, change db.MemberTierChange) (bool, error) {
+	updated := tx.Unscoped().Model(&db.Member{}).
+		Where("id = ? AND tier_code = ?", change.MemberID, change.FromTier).
+		Update("tier_code", change.ToTier)
+	if updated.Error != nil {
+		return false, updated.Error
+	}
+	if updated.RowsAffected == 0 {
+		return false, nil
+	}
+	return true, tx.Create(&change).Error
+}
+
+// Reassess moves one member to the highest tier it qualifies for at now, or
+// to no tier, and records the move under reason. Run it inside the
+// transaction that changed the member's orders so the tier matches them.
+func Reassess(tx *gorm.DB, memberID uint, now time.Time, reason, changedBy string) (bool, error) {
+	var member db.Member
+	if err := tx.Unscoped().Select("id, tier_code").First(&member, memberID).Error; err != nil {
+		return false, fmt.Errorf("load member %d: %w", memberID, err)
+	}
+	var tiers []db.MembershipTier
+	if err := tx.Order("level DESC").Find(&tiers).Error; err != nil {
+		return false, fmt.Errorf("load tiers: %w", err)
+	}
+
+	change := db.MemberTierChange{
+		MemberID:  memberID,
+		FromTier:  member.TierCode,
+		Reason:    reason,
+		ChangedBy: changedBy,
+	}
+	for _, tier := range tiers {
+		var stats Stats
+		if err := tx.Model(&db.Order{}).
+			Select("COALESCE(SUM(amount_cents - refunded_cents), 0) AS paid_cents, COUNT(*) AS order_count").
+			Where("member_id = ? AND status = ? AND paid_at >= ?", memberID, "paid", now.AddDate(0, 0, -tier.WindowDays)).
+			Scan(&stats).Error; err != nil {
+			return false, fmt.Errorf("aggregate paid orders: %w", err)
+		}
+		change.PaidCents, change.OrderCount = stats.PaidCents, stats.OrderCount
+		if Qualifies(tier, stats) {
+			change.ToTier = tier.Code
+			break
+		}
+	}
+	if change.ToTier == change.FromTier {
+		return false, nil
+	}
+	return Apply(tx, change)
+}
+
+// windowStats sums paid orders since, per member. Refunded amounts are taken
+// off, and fully refunded orders no longer count.
+func windowStats(ctx context.Context, database *gorm.DB, since time.Time) (map[uint]Stats, error) {
+	var rows []struct {
+		MemberID   uint
+		PaidCents  int64
+		OrderCount int64
+	}
+	if err := database.WithContext(ctx).
+		Model(&db.Order{}).
+		Select("member_id, COALESCE(SUM(amount_cents - refunded_cents), 0) AS paid_cents, COUNT(*) AS order_count").
+		Where("status = ? AND paid_at >= ?", "paid", since).
+		Group("member_id").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("aggregate paid orders: %w", err)
+	}
+	stats := make(map[uint]Stats, len(rows))
+	for _, row := range rows {
+		stats[row.MemberID] = Stats{PaidCents: row.PaidCents, OrderCount: row.OrderCount}
+	}
+	return stats, nil
+}
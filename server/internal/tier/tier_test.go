@@ -0,0 +1,132 @@
+package tier
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"small-merchant-ops-hub-server/internal/config"
+	"small-merchant-ops-hub-server/internal/db"
+)
+
+func TestQualifies(t *testing.T) {
+	t.Parallel()
+
+	gold := db.MembershipTier{Code: "gold", MinPaidCents: 100000, MinOrderCount: 10}
+	tests := []struct {
+		stats Stats
+		want  bool
+	}{
+		{Stats{PaidCents: 100000}, true},
+		{Stats{OrderCount: 10}, true},
+		{Stats{PaidCents: 99999, OrderCount: 9}, false},
+	}
+	for _, tt := range tests {
+		if got := Qualifies(gold, tt.stats); got != tt.want {
+			t.Fatalf("Qualifies(gold, %+v) = %v, want %v", tt.stats, got, tt.want)
+		}
+	}
+	spendOnly := db.MembershipTier{Code: "silver", MinPaidCents: 5000}
+	if Qualifies(spendOnly, Stats{OrderCount: 100}) {
+		t.Fatalf("a zero order threshold must not qualify members")
+	}
+}
+
+func TestRecalculate(t *testing.T) {
+	t.Parallel()
+
+	database, err := db.Open(config.Config{Env: "local", SQLitePath: filepath.Join(t.TempDir(), "app.db")})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	tiers := []db.MembershipTier{
+		{Code: "silver", Name: "Silver", Level: 1, MinPaidCents: 10000, WindowDays: 365},
+		{Code: "gold", Name: "Gold", Level: 2, MinPaidCents: 50000, MinOrderCount: 5, WindowDays: 365},
+	}
+	if err := database.Create(&tiers).Error; err != nil {
+		t.Fatalf("create tiers: %v", err)
+	}
+
+	now := time.Now()
+	members := []db.Member{
+		{Name: "Ann", Phone: "+8613800006601", Channel: "wechat"},
+		{Name: "Bo", Phone: "+8613800006602", Channel: "wechat"},
+		{Name: "Cy", Phone: "+8613800006603", Channel: "wechat", TierCode: "gold"},
+	}
+	if err := database.Create(&members).Error; err != nil {
+		t.Fatalf("create members: %v", err)
+	}
+	paidAt := now.AddDate(0, -1, 0)
+	stale := now.AddDate(-2, 0, 0)
+	orders := []db.Order{
+		// Ann: 5 small orders reach gold by count.
+		{OrderNo: "T1", MemberID: members[0].ID, AmountCents: 100, Status: "paid", Source: "wechat", PaidAt: &paidAt},
+		{OrderNo: "T2", MemberID: members[0].ID, AmountCents: 100, Status: "paid", Source: "wechat", PaidAt: &paidAt},
+		{OrderNo: "T3", MemberID: members[0].ID, AmountCents: 100, Status: "paid", Source: "wechat", PaidAt: &paidAt},
+		{OrderNo: "T4", MemberID: members[0].ID, AmountCents: 100, Status: "paid", Source: "wechat", PaidAt: &paidAt},
+		{OrderNo: "T5", MemberID: members[0].ID, AmountCents: 100, Status: "paid", Source: "wechat", PaidAt: &paidAt},
+		// Bo: silver by spend, net of a partial refund.
+		{OrderNo: "T6", MemberID: members[1].ID, AmountCents: 12000, RefundedCents: 1000, Status: "paid", Source: "wechat", PaidAt: &paidAt},
+		// Cy: only spent outside the window, so drops out of gold.
+		{OrderNo: "T7", MemberID: members[2].ID, AmountCents: 90000, Status: "paid", Source: "wechat", PaidAt: &stale},
+	}
+	if err := database.Create(&orders).Error; err != nil {
+		t.Fatalf("create orders: %v", err)
+	}
+
+	result, err := Recalculate(context.Background(), database, now, "system")
+	if err != nil {
+		t.Fatalf("recalculate: %v", err)
+	}
+	if result != (Result{Evaluated: 3, Upgraded: 2, Downgraded: 1}) {
+		t.Fatalf("result = %+v", result)
+	}
+	want := map[uint]string{members[0].ID: "gold", members[1].ID: "silver", members[2].ID: ""}
+	for memberID, code := range want {
+		var member db.Member
+		if err := database.First(&member, memberID).Error; err != nil {
+			t.Fatalf("load member: %v", err)
+		}
+		if member.TierCode != code {
+			t.Fatalf("member %d tier = %q, want %q", memberID, member.TierCode, code)
+		}
+	}
+
+	var change db.MemberTierChange
+	if err := database.Where("member_id = ?", members[1].ID).First(&change).Error; err != nil {
+		t.Fatalf("load change: %v", err)
+	}
+	if change.FromTier != "" || change.ToTier != "silver" || change.PaidCents != 11000 || change.Reason != ReasonRecalculation {
+		t.Fatalf("change = %+v", change)
+	}
+
+	// A second run at the same time changes nothing.
+	again, err := Recalculate(context.Background(), database, now, "system")
+	if err != nil {
+		t.Fatalf("second recalculate: %v", err)
+	}
+	if again.Upgraded != 0 || again.Downgraded != 0 {
+		t.Fatalf("second result = %+v, want no moves", again)
+	}
+
+	// Bo's spend grows past gold; Reassess moves just Bo without a full run.
+	big := db.Order{OrderNo: "T8", MemberID: members[1].ID, AmountCents: 40000, Status: "paid", Source: "wechat", PaidAt: &paidAt}
+	if err := database.Create(&big).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	moved, err := Reassess(database, members[1].ID, now, "member merge", "Super")
+	if err != nil || !moved {
+		t.Fatalf("Reassess = %v, %v, want moved", moved, err)
+	}
+	var latest db.MemberTierChange
+	if err := database.Where("member_id = ?", members[1].ID).Order("id DESC").First(&latest).Error; err != nil {
+		t.Fatalf("load change: %v", err)
+	}
+	if latest.FromTier != "silver" || latest.ToTier != "gold" || latest.PaidCents != 51000 || latest.Reason != "member merge" {
+		t.Fatalf("reassess change = %+v", latest)
+	}
+	if moved, err := Reassess(database, members[1].ID, now, "member merge", "Super"); err != nil || moved {
+		t.Fatalf("second Reassess = %v, %v, want no move", moved, err)
+	}
+}